@@ -10,6 +10,7 @@ import (
 	"github.com/weaveworks/flux/remote"
 	"github.com/weaveworks/flux/service"
 	"github.com/weaveworks/flux/ssh"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -22,13 +23,18 @@ type ClientService interface {
 	SyncNotify(service.InstanceID) error
 	JobStatus(service.InstanceID, job.ID) (job.Status, error)
 	SyncStatus(service.InstanceID, string) ([]string, error)
+	SyncPlan(service.InstanceID) (fluxsync.Plan, error)
+	ListSyncStatus(service.InstanceID) ([]flux.ResourceSyncStatus, error)
 	UpdatePolicies(service.InstanceID, policy.Updates, update.Cause) (job.ID, error)
+	Rollback(service.InstanceID, update.RollbackSpec, update.Cause) (job.ID, error)
+	ApproveRelease(service.InstanceID, job.ID, update.Cause) (job.ID, error)
 	History(service.InstanceID, update.ServiceSpec, time.Time, int64, time.Time) ([]history.Entry, error)
 	GetConfig(_ service.InstanceID, fingerprint string) (service.InstanceConfig, error)
 	SetConfig(service.InstanceID, service.InstanceConfig) error
 	PatchConfig(service.InstanceID, service.ConfigPatch) error
 	Export(inst service.InstanceID) ([]byte, error)
 	PublicSSHKey(inst service.InstanceID, regenerate bool) (ssh.PublicKey, error)
+	GitRepoConfig(inst service.InstanceID, regenerate bool) (flux.GitConfig, error)
 }
 
 // API for daemons connecting to the service
@@ -34,11 +34,16 @@ type Service struct {
 	ID       flux.ServiceID
 	IP       string
 	Metadata map[string]string // a grab bag of goodies, likely platform-specific
+	Labels   map[string]string // for selecting services, e.g., in a release
 	Status   string            // A status summary for display
 
 	Containers ContainersOrExcuse
 }
 
+// StatusReady is the Status of a service that has finished rolling
+// out its current definition.
+const StatusReady = "ready"
+
 // A Container represents a container specification in a pod. The Name
 // identifies it within the pod, and the Image says which image it's
 // configured to run.
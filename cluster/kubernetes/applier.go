@@ -0,0 +1,232 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/1.5/discovery"
+	k8sclient "k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/rest"
+)
+
+// The annotation kubectl uses to record the configuration it last
+// applied. We use the same one, so that it's possible to switch
+// between appliers (or use kubectl by hand) without losing track of
+// which fields were set from the repo.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// APIApplier applies resource definitions by talking to the
+// Kubernetes API directly, rather than by running kubectl.
+//
+// Like `kubectl apply`, it creates resources that don't exist, and
+// patches those that do, removing any fields that were in the
+// previously applied definition but are no longer in the repo. Unlike
+// `kubectl apply`, it doesn't remove elements from lists (e.g., a
+// container from a pod template) that have been removed from the
+// repo; those lists are merged by the API server.
+type APIApplier struct {
+	client    *rest.RESTClient
+	discovery discovery.DiscoveryInterface
+
+	mu        sync.Mutex
+	resources map[string]map[string]unversioned.APIResource // group version -> kind -> resource
+}
+
+func NewAPIApplier(clientset k8sclient.Interface) *APIApplier {
+	return &APIApplier{
+		client:    clientset.Core().GetRESTClient(),
+		discovery: clientset.Discovery(),
+		resources: map[string]map[string]unversioned.APIResource{},
+	}
+}
+
+func (a *APIApplier) Delete(logger log.Logger, obj *apiObject) error {
+	begin := time.Now()
+	path, err := a.path(obj, true)
+	if err == nil {
+		err = a.client.Delete().
+			AbsPath(path...).
+			Body([]byte(`{"kind":"DeleteOptions","apiVersion":"v1","orphanDependents":false}`)).
+			Do().Error()
+		if apierrors.IsNotFound(err) {
+			err = nil
+		}
+	}
+	logger.Log("method", "delete", "path", strings.Join(path, "/"), "took", time.Since(begin), "err", err)
+	return err
+}
+
+func (a *APIApplier) Apply(logger log.Logger, obj *apiObject) error {
+	begin := time.Now()
+	path, err := a.path(obj, true)
+	if err == nil {
+		err = a.apply(obj, path)
+	}
+	logger.Log("method", "apply", "path", strings.Join(path, "/"), "took", time.Since(begin), "err", err)
+	return err
+}
+
+func (a *APIApplier) apply(obj *apiObject, path []string) error {
+	modifiedJSON, err := k8syaml.YAMLToJSON(obj.bytes)
+	if err != nil {
+		return errors.Wrap(err, "converting definition to JSON")
+	}
+	var modified map[string]interface{}
+	if err = json.Unmarshal(modifiedJSON, &modified); err != nil {
+		return errors.Wrap(err, "decoding definition")
+	}
+
+	currentJSON, err := a.client.Get().AbsPath(path...).Do().Raw()
+	if apierrors.IsNotFound(err) {
+		body, err := withLastApplied(modified, modifiedJSON)
+		if err != nil {
+			return err
+		}
+		collection, err := a.path(obj, false)
+		if err != nil {
+			return err
+		}
+		return a.client.Post().AbsPath(collection...).Body(body).Do().Error()
+	}
+	if err != nil {
+		return err
+	}
+
+	var original map[string]interface{}
+	if lastApplied := lastAppliedConfig(currentJSON); lastApplied != "" {
+		if err := json.Unmarshal([]byte(lastApplied), &original); err != nil {
+			// Treat an unreadable annotation as though it weren't there
+			original = nil
+		}
+	}
+	patch, err := withLastApplied(withRemovals(original, modified), modifiedJSON)
+	if err != nil {
+		return err
+	}
+	return a.client.Patch(api.StrategicMergePatchType).AbsPath(path...).Body(patch).Do().Error()
+}
+
+// path gives the API path for the object given, or for the collection
+// it belongs in, if `named` is false.
+func (a *APIApplier) path(obj *apiObject, named bool) ([]string, error) {
+	if obj.Version == "" || obj.Kind == "" {
+		return nil, errors.New("definition has no apiVersion or kind")
+	}
+	res, err := a.resource(obj.Version, obj.Kind)
+	if err != nil {
+		return nil, err
+	}
+	var path []string
+	if strings.Contains(obj.Version, "/") {
+		path = []string{"/apis", obj.Version}
+	} else {
+		path = []string{"/api", obj.Version}
+	}
+	if res.Namespaced {
+		path = append(path, "namespaces", obj.namespaceOrDefault())
+	}
+	path = append(path, res.Name)
+	if named {
+		path = append(path, obj.Metadata.Name)
+	}
+	return path, nil
+}
+
+// resource looks up the API resource for a kind, asking the API
+// server about the group version if we haven't already.
+func (a *APIApplier) resource(groupVersion, kind string) (unversioned.APIResource, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	kinds, ok := a.resources[groupVersion]
+	if !ok {
+		list, err := a.discovery.ServerResourcesForGroupVersion(groupVersion)
+		if err != nil {
+			return unversioned.APIResource{}, errors.Wrapf(err, "getting API resources for %s", groupVersion)
+		}
+		kinds = map[string]unversioned.APIResource{}
+		for _, r := range list.APIResources {
+			// Skip subresources, e.g., deployments/scale
+			if strings.Contains(r.Name, "/") {
+				continue
+			}
+			kinds[r.Kind] = r
+		}
+		a.resources[groupVersion] = kinds
+	}
+	r, ok := kinds[kind]
+	if !ok {
+		return unversioned.APIResource{}, fmt.Errorf("no API resource for kind %s in %s", kind, groupVersion)
+	}
+	return r, nil
+}
+
+// withRemovals returns a copy of `modified` in which each field that
+// is in `original` (the configuration last applied) but not in
+// `modified` is set to null, so that patching with the result removes
+// those fields. Lists are left alone.
+func withRemovals(original, modified map[string]interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	for k, v := range modified {
+		res[k] = v
+	}
+	for k, ov := range original {
+		mv, ok := modified[k]
+		if !ok {
+			res[k] = nil
+			continue
+		}
+		om, ok1 := ov.(map[string]interface{})
+		mm, ok2 := mv.(map[string]interface{})
+		if ok1 && ok2 {
+			res[k] = withRemovals(om, mm)
+		}
+	}
+	return res
+}
+
+// withLastApplied encodes the object given, with the last-applied
+// annotation set to `applied`.
+func withLastApplied(obj map[string]interface{}, applied []byte) ([]byte, error) {
+	res := map[string]interface{}{}
+	for k, v := range obj {
+		res[k] = v
+	}
+	meta := map[string]interface{}{}
+	if m, ok := obj["metadata"].(map[string]interface{}); ok {
+		for k, v := range m {
+			meta[k] = v
+		}
+	}
+	annotations := map[string]interface{}{}
+	if a, ok := meta["annotations"].(map[string]interface{}); ok {
+		for k, v := range a {
+			annotations[k] = v
+		}
+	}
+	annotations[lastAppliedAnnotation] = string(applied)
+	meta["annotations"] = annotations
+	res["metadata"] = meta
+	return json.Marshal(res)
+}
+
+func lastAppliedConfig(objJSON []byte) string {
+	var obj struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(objJSON, &obj); err != nil {
+		return ""
+	}
+	return obj.Metadata.Annotations[lastAppliedAnnotation]
+}
@@ -0,0 +1,64 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestWithRemovals(t *testing.T) {
+	var original, modified, expected map[string]interface{}
+	for _, x := range []struct {
+		doc string
+		v   *map[string]interface{}
+	}{
+		{`{"metadata": {"name": "foo", "labels": {"a": "b"}}, "spec": {"replicas": 2, "minReadySeconds": 5, "template": {"spec": {"containers": [{"name": "c"}]}}}}`, &original},
+		{`{"metadata": {"name": "foo"}, "spec": {"replicas": 3, "template": {"spec": {"containers": []}}}}`, &modified},
+		{`{"metadata": {"name": "foo", "labels": null}, "spec": {"replicas": 3, "minReadySeconds": null, "template": {"spec": {"containers": []}}}}`, &expected},
+	} {
+		if err := json.Unmarshal([]byte(x.doc), x.v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := withRemovals(original, modified)
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expected, got)
+	}
+
+	// With nothing applied before, it's just the modified definition
+	got = withRemovals(nil, modified)
+	if !reflect.DeepEqual(modified, got) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", modified, got)
+	}
+}
+
+func TestWithLastApplied(t *testing.T) {
+	def := []byte(`{"metadata":{"name":"foo","annotations":{"x":"y"}}}`)
+	var obj map[string]interface{}
+	if err := json.Unmarshal(def, &obj); err != nil {
+		t.Fatal(err)
+	}
+	out, err := withLastApplied(obj, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lastAppliedConfig(out); got != string(def) {
+		t.Errorf("expected last applied configuration %q, got %q", def, got)
+	}
+	var annotated struct {
+		Metadata struct {
+			Annotations map[string]string
+		}
+	}
+	if err := json.Unmarshal(out, &annotated); err != nil {
+		t.Fatal(err)
+	}
+	if annotated.Metadata.Annotations["x"] != "y" {
+		t.Errorf("expected existing annotations to be kept, got %#v", annotated.Metadata.Annotations)
+	}
+	// The original is left alone
+	if _, ok := obj["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})[lastAppliedAnnotation]; ok {
+		t.Error("expected the object given to be left unchanged")
+	}
+}
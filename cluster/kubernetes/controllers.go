@@ -0,0 +1,155 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// The version of client-go we use predates StatefulSets (it has
+// PetSets) and CronJobs (it has neither those nor ScheduledJobs), so
+// there are no typed clients for them. Its DaemonSets lack the status
+// fields that say how far a rolling update has got. Instead, we fetch
+// these from the API directly, and decode just the parts we need.
+
+const (
+	daemonSetGroupVersion   = "extensions/v1beta1"
+	statefulSetGroupVersion = "apps/v1beta1"
+)
+
+// CronJobs are served at batch/v1beta1 from Kubernetes 1.8; before
+// that, they're at batch/v2alpha1 if that's been enabled.
+var cronJobGroupVersions = []string{"batch/v1beta1", "batch/v2alpha1"}
+
+type daemonSet struct {
+	v1.ObjectMeta `json:"metadata"`
+	Spec          struct {
+		Template v1.PodTemplateSpec `json:"template"`
+	} `json:"spec"`
+	Status struct {
+		// Not reported before Kubernetes 1.6, along with the
+		// updated and available numbers
+		ObservedGeneration     *int64 `json:"observedGeneration"`
+		DesiredNumberScheduled int32  `json:"desiredNumberScheduled"`
+		UpdatedNumberScheduled int32  `json:"updatedNumberScheduled"`
+		NumberAvailable        int32  `json:"numberAvailable"`
+		NumberReady            int32  `json:"numberReady"`
+	} `json:"status"`
+	raw []byte
+}
+
+type statefulSet struct {
+	v1.ObjectMeta `json:"metadata"`
+	Spec          struct {
+		Replicas *int32             `json:"replicas"`
+		Template v1.PodTemplateSpec `json:"template"`
+	} `json:"spec"`
+	Status struct {
+		ObservedGeneration *int64 `json:"observedGeneration"`
+		Replicas           int32  `json:"replicas"`
+		ReadyReplicas      int32  `json:"readyReplicas"`
+		// Not reported before Kubernetes 1.7
+		CurrentRevision string `json:"currentRevision"`
+		UpdateRevision  string `json:"updateRevision"`
+	} `json:"status"`
+	raw []byte
+}
+
+type cronJob struct {
+	v1.ObjectMeta `json:"metadata"`
+	Spec          struct {
+		JobTemplate struct {
+			Spec struct {
+				Template v1.PodTemplateSpec `json:"template"`
+			} `json:"spec"`
+		} `json:"jobTemplate"`
+	} `json:"spec"`
+	raw          []byte
+	groupVersion string // the one it was found at
+}
+
+// listRaw lists the resources of the given kind (in its plural,
+// lowercase form, as used in API paths) in a namespace, from the
+// first of the group versions given that the API server knows about,
+// and returns that group version. If it knows about none of them, it
+// is treated as there being no such resources.
+func (c *Cluster) listRaw(namespace, resource string, groupVersions ...string) ([]json.RawMessage, string, error) {
+	for _, groupVersion := range groupVersions {
+		body, err := c.client.CoreInterface.GetRESTClient().Get().
+			AbsPath("/apis", groupVersion, "namespaces", namespace, resource).
+			Do().Raw()
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		var list struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, "", errors.Wrapf(err, "decoding %s list", resource)
+		}
+		return list.Items, groupVersion, nil
+	}
+	return nil, "", nil
+}
+
+func (c *Cluster) daemonSets(namespace string) ([]daemonSet, error) {
+	items, _, err := c.listRaw(namespace, "daemonsets", daemonSetGroupVersion)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]daemonSet, len(items))
+	for i, item := range items {
+		if err := json.Unmarshal(item, &res[i]); err != nil {
+			return nil, errors.Wrap(err, "decoding daemonset")
+		}
+		res[i].raw = item
+	}
+	return res, nil
+}
+
+func (c *Cluster) statefulSets(namespace string) ([]statefulSet, error) {
+	items, _, err := c.listRaw(namespace, "statefulsets", statefulSetGroupVersion)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]statefulSet, len(items))
+	for i, item := range items {
+		if err := json.Unmarshal(item, &res[i]); err != nil {
+			return nil, errors.Wrap(err, "decoding statefulset")
+		}
+		res[i].raw = item
+	}
+	return res, nil
+}
+
+func (c *Cluster) cronJobs(namespace string) ([]cronJob, error) {
+	items, groupVersion, err := c.listRaw(namespace, "cronjobs", cronJobGroupVersions...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]cronJob, len(items))
+	for i, item := range items {
+		if err := json.Unmarshal(item, &res[i]); err != nil {
+			return nil, errors.Wrap(err, "decoding cronjob")
+		}
+		res[i].raw, res[i].groupVersion = item, groupVersion
+	}
+	return res, nil
+}
+
+// Like appendYAML, but for objects we only have as JSON.
+func appendRawYAML(buffer *bytes.Buffer, apiVersion, kind string, raw []byte) error {
+	yamlBytes, err := k8syaml.JSONToYAML(raw)
+	if err != nil {
+		return err
+	}
+	writeYAML(buffer, apiVersion, kind, yamlBytes)
+	return nil
+}
@@ -4,57 +4,71 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
-
-	"github.com/weaveworks/flux/cluster/kubernetes/resource"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/resource"
 )
 
 // FindDefinedServices finds all the services defined under the
 // directory given, and returns a map of service IDs (from its
-// specified namespace and name) to the paths of resource definition
-// files.
-func (c *Manifests) FindDefinedServices(path string) (map[flux.ServiceID][]string, error) {
-	objects, err := resource.Load(path)
+// specified namespace and name) to the pod controllers (Deployments
+// and so on) that the service selects.
+func (c *Manifests) FindDefinedServices(path string) (map[flux.ServiceID][]resource.Resource, error) {
+	objects, err := kresource.Load(path)
 	if err != nil {
 		return nil, errors.Wrap(err, "loading resources")
 	}
+	return definedServices(objects), nil
+}
 
+// definedServices maps each of the services among the objects given
+// to the pod controllers, also among the objects, that it selects.
+func definedServices(objects map[string]resource.Resource) map[flux.ServiceID][]resource.Resource {
 	type template struct {
-		source    string
-		namespace string
-		*resource.PodTemplate
+		controller resource.Resource
+		namespace  string
+		*kresource.PodTemplate
 	}
 
 	var (
-		result    = map[flux.ServiceID][]string{}
-		services  []*resource.Service
+		result    = map[flux.ServiceID][]resource.Resource{}
+		services  []*kresource.Service
 		templates []template
 	)
 
+	addTemplate := func(controller resource.Resource, namespace string, t *kresource.PodTemplate) {
+		templates = append(templates, template{controller, namespace, t})
+		for _, service := range services {
+			if namespace == service.Meta.Namespace && matches(service, t) {
+				sid := service.ServiceID()
+				result[sid] = append(result[sid], controller)
+			}
+		}
+	}
+
 	for _, obj := range objects {
 		switch res := obj.(type) {
-		case *resource.Service:
+		case *kresource.Service:
 			services = append(services, res)
 			for _, template := range templates {
 				if res.Meta.Namespace == template.namespace && matches(res, template.PodTemplate) {
 					sid := res.ServiceID()
-					result[sid] = append(result[sid], template.source)
-				}
-			}
-		case *resource.Deployment:
-			source := res.Source()
-			templates = append(templates, template{source, res.Meta.Namespace, &res.Spec.Template})
-			for _, service := range services {
-				if res.Meta.Namespace == service.Meta.Namespace && matches(service, &res.Spec.Template) {
-					sid := service.ServiceID()
-					result[sid] = append(result[sid], source)
+					result[sid] = append(result[sid], template.controller)
 				}
 			}
+		case *kresource.Deployment:
+			addTemplate(res, res.Meta.Namespace, &res.Spec.Template)
+		case *kresource.DaemonSet:
+			addTemplate(res, res.Meta.Namespace, &res.Spec.Template)
+		case *kresource.StatefulSet:
+			addTemplate(res, res.Meta.Namespace, &res.Spec.Template)
+		case *kresource.CronJob:
+			addTemplate(res, res.Meta.Namespace, &res.Spec.JobTemplate.Spec.Template)
 		}
 	}
-	return result, nil
+	return result
 }
 
-func matches(s *resource.Service, t *resource.PodTemplate) bool {
+func matches(s *kresource.Service, t *kresource.PodTemplate) bool {
 	labels := t.Metadata.Labels
 	selector := s.Spec.Selector
 	// A nil selector matches nothing
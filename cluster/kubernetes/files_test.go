@@ -1,10 +1,17 @@
 package kubernetes
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
 )
 
 func TestDefinedServices(t *testing.T) {
@@ -20,7 +27,241 @@ func TestDefinedServices(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if !reflect.DeepEqual(testfiles.ServiceMap(dir), services) {
-		t.Errorf("Expected:\n%#v\ngot:\n%#v\n", testfiles.ServiceMap(dir), services)
+	if !reflect.DeepEqual(testfiles.ServiceMap(dir), sources(services)) {
+		t.Errorf("Expected:\n%#v\ngot:\n%#v\n", testfiles.ServiceMap(dir), sources(services))
+	}
+}
+
+// sources gives the files each service's resources were defined in.
+func sources(services map[flux.ServiceID][]resource.Resource) map[flux.ServiceID][]string {
+	result := map[flux.ServiceID][]string{}
+	for id, resources := range services {
+		for _, res := range resources {
+			result[id] = append(result[id], res.Source())
+		}
+	}
+	return result
+}
+
+func TestDefinedServicesOtherControllers(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+
+	files := map[string]string{
+		"db-sts.yaml": `apiVersion: apps/v1beta1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  serviceName: db
+  template:
+    metadata:
+      labels:
+        name: db
+    spec:
+      containers:
+      - name: postgres
+        image: postgres:9.5
+`,
+		"db-svc.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: db
+spec:
+  clusterIP: None
+  selector:
+    name: db
+`,
+		"agent-ds.yaml": `apiVersion: extensions/v1beta1
+kind: DaemonSet
+metadata:
+  name: agent
+spec:
+  template:
+    metadata:
+      labels:
+        name: agent
+    spec:
+      containers:
+      - name: agent
+        image: quay.io/weaveworks/agent:1
+`,
+		"agent-svc.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: agent
+spec:
+  selector:
+    name: agent
+`,
+		"report-cj.yaml": `apiVersion: batch/v2alpha1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  schedule: "*/5 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          labels:
+            name: report
+        spec:
+          containers:
+          - name: report
+            image: quay.io/weaveworks/report:1
+`,
+		"report-svc.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: report
+spec:
+  selector:
+    name: report
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	services, err := (&Manifests{}).FindDefinedServices(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[flux.ServiceID][]string{
+		flux.ServiceID("default/db"):     []string{filepath.Join(dir, "db-sts.yaml")},
+		flux.ServiceID("default/agent"):  []string{filepath.Join(dir, "agent-ds.yaml")},
+		flux.ServiceID("default/report"): []string{filepath.Join(dir, "report-cj.yaml")},
+	}
+	if !reflect.DeepEqual(expected, sources(services)) {
+		t.Errorf("Expected:\n%#v\ngot:\n%#v\n", expected, sources(services))
+	}
+}
+
+const multidocFile = `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  selector:
+    name: app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+data:
+  debug: "true"
+---
+# The deployment
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    metadata:
+      labels:
+        name: app
+    spec:
+      containers:
+      - name: app
+        image: quay.io/weaveworks/app:1
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: other
+spec:
+  template:
+    metadata:
+      labels:
+        name: other
+    spec:
+      containers:
+      - name: app
+        image: quay.io/weaveworks/app:1
+`
+
+func TestDefinedServicesMultidoc(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "app.yaml")
+	if err := ioutil.WriteFile(path, []byte(multidocFile), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := (&Manifests{}).FindDefinedServices(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := services[flux.ServiceID("default/app")]
+	if len(resources) != 1 {
+		t.Fatalf("expected one resource for service, got %#v", services)
+	}
+	if id := resources[0].ResourceID(); id != "Deployment default/app" {
+		t.Errorf("expected the deployment, got %s", id)
+	}
+	if !strings.Contains(multidocFile, string(resources[0].Bytes())) || !strings.HasPrefix(string(resources[0].Bytes()), "# The deployment") {
+		t.Errorf("expected the deployment's own definition, got:\n%s", string(resources[0].Bytes()))
+	}
+}
+
+// Test that updating a service defined in a file with other
+// resources in it changes only the definition of that service's
+// resource.
+func TestUpdateManifestMultidoc(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "app.yaml")
+	if err := ioutil.WriteFile(path, []byte(multidocFile), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifests{}
+	newImage, _ := flux.ParseImageID("quay.io/weaveworks/app:2")
+	if err := cluster.UpdateManifest(m, dir, "default/app", func(def []byte) ([]byte, error) {
+		return m.UpdateDefinition(def, "app", newImage)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.UpdateManifest(m, dir, "default/app", func(def []byte) ([]byte, error) {
+		return m.UpdatePolicies(def, policy.Update{Add: policy.Set{policy.Locked: "true"}})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Replace(multidocFile, `  name: app
+spec:
+  template:
+    metadata:
+      labels:
+        name: app
+    spec:
+      containers:
+      - name: app
+        image: quay.io/weaveworks/app:1`, `  annotations:
+    flux.weave.works/locked: "true"
+  name: app
+spec:
+  template:
+    metadata:
+      labels:
+        name: app
+    spec:
+      containers:
+      - name: app
+        image: quay.io/weaveworks/app:2`, 1)
+	out, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
 	}
 }
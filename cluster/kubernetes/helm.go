@@ -0,0 +1,390 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// HelmManifests interprets the files under the git path as Helm
+// charts. Each chart is found by its Chart.yaml, and has a values
+// file (by default the values.yaml in the chart directory, but it can
+// be another file, relative to the chart directory) that it's
+// rendered with. The resources rendered from the charts are what get
+// synced; but it's the values file that gets updated, when releasing
+// images or changing policies.
+//
+// Images are updated in the values file wherever they appear as
+//
+//	image: quay.io/weaveworks/helloworld:master-a000001
+//
+// or as
+//
+//	image:
+//	  repository: quay.io/weaveworks/helloworld
+//	  tag: master-a000001
+//
+// (the `repository` and `tag` can be under any key). Policies are
+// given as annotations in the values file, under a top-level
+// `annotations` key, in the same format as in Kubernetes manifests:
+//
+//	annotations:
+//	  flux.weave.works/automated: "true"
+//
+// These apply to all the services that the chart defines.
+type HelmManifests struct {
+	valuesFile string
+	render     func(chart, values string) ([]byte, error)
+}
+
+// NewHelmManifests creates a HelmManifests that uses the helm
+// executable given to render charts, using the values file named.
+func NewHelmManifests(exe, valuesFile string) *HelmManifests {
+	return &HelmManifests{
+		valuesFile: valuesFile,
+		render: func(chart, values string) ([]byte, error) {
+			return helmTemplate(exe, chart, values)
+		},
+	}
+}
+
+// helmTemplate renders a chart with `helm template`. The chart
+// directory's name is used as the release name, so that the names of
+// the resources are the same each time.
+func helmTemplate(exe, chart, values string) ([]byte, error) {
+	args := []string{"template", "--name", filepath.Base(chart)}
+	if _, err := os.Stat(values); err == nil {
+		args = append(args, "--values", values)
+	}
+	args = append(args, chart)
+
+	cmd := exec.Command(exe, args...)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrap(errors.New(strings.TrimSpace(stderr.String())), "running helm template")
+	}
+	return stdout.Bytes(), nil
+}
+
+// findCharts returns the directories under the paths given that are
+// Helm charts. Charts inside charts (i.e., dependencies) are not
+// included, since they are rendered along with their parent.
+func findCharts(roots ...string) ([]string, error) {
+	var charts []string
+	for _, root := range roots {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fmt.Errorf(`walking %q for charts: %s`, path, err.Error())
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			if _, err := os.Stat(filepath.Join(path, "Chart.yaml")); err == nil {
+				charts = append(charts, path)
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return charts, nil
+}
+
+func (h *HelmManifests) valuesPath(chart string) string {
+	return filepath.Join(chart, h.valuesFile)
+}
+
+// renderCharts renders each chart under the paths given, and calls
+// `f` with the chart directory and the resources rendered from it.
+func (h *HelmManifests) renderCharts(paths []string, f func(chart string, objs map[string]resource.Resource) error) error {
+	charts, err := findCharts(paths...)
+	if err != nil {
+		return err
+	}
+	for _, chart := range charts {
+		out, err := h.render(chart, h.valuesPath(chart))
+		if err != nil {
+			return errors.Wrapf(err, "rendering chart %s", chart)
+		}
+		objs, err := kresource.ParseMultidoc(out, chart)
+		if err != nil {
+			return errors.Wrapf(err, "parsing resources rendered from chart %s", chart)
+		}
+		if err := f(chart, objs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *HelmManifests) LoadManifests(paths ...string) (map[string]resource.Resource, error) {
+	all := map[string]resource.Resource{}
+	err := h.renderCharts(paths, func(chart string, objs map[string]resource.Resource) error {
+		for id, obj := range objs {
+			if alreadyDefined, ok := all[id]; ok {
+				return fmt.Errorf(`resource '%s' defined more than once (in %s and %s)`, id, alreadyDefined.Source(), chart)
+			}
+			all[id] = obj
+		}
+		return nil
+	})
+	return all, err
+}
+
+func (h *HelmManifests) ParseManifests(allDefs []byte) (map[string]resource.Resource, error) {
+	return kresource.ParseMultidoc(allDefs, "exported")
+}
+
+// FindDefinedServices renders each chart, and maps the services
+// defined by it to its values file (if it has one), since that's
+// where changes to the services are made.
+func (h *HelmManifests) FindDefinedServices(path string) (map[flux.ServiceID][]resource.Resource, error) {
+	result := map[flux.ServiceID][]resource.Resource{}
+	err := h.renderCharts([]string{path}, func(chart string, objs map[string]resource.Resource) error {
+		services := definedServices(objs)
+		if len(services) == 0 {
+			return nil
+		}
+		values, err := loadValues(chart, h.valuesPath(chart))
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for id := range services {
+			result[id] = append(result[id], values)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (h *HelmManifests) ServicesWithPolicies(root string) (policy.ServiceMap, error) {
+	all, err := h.FindDefinedServices(root)
+	if err != nil {
+		return nil, err
+	}
+
+	result := policy.ServiceMap{}
+	for id, resources := range all {
+		if len(resources) != 1 {
+			continue
+		}
+		values, ok := resources[0].(*valuesFile)
+		if !ok {
+			continue
+		}
+		ps, err := policiesFrom(Manifest{Metadata: Metadata{Annotations: values.annotations}})
+		if err != nil {
+			return nil, err
+		}
+		result[id] = ps
+	}
+	return result, nil
+}
+
+// UpdateDefinition updates the image in the values file given. Since
+// there's no way to tell from a values file which container an image
+// is for, every occurrence of an image from the same repository is
+// updated.
+func (h *HelmManifests) UpdateDefinition(def []byte, container string, newImage flux.ImageID) ([]byte, error) {
+	docs, err := parseYAML(def)
+	if err != nil {
+		return nil, err
+	}
+	editor := newYAMLEditor(def)
+	found := false
+	visited := map[*yamlNode]bool{}
+	for _, doc := range docs {
+		found = updateValuesImages(editor, doc, newImage, visited) || found
+	}
+	if !found {
+		return nil, fmt.Errorf("could not find image from repository %s in values file", newImage.Repository())
+	}
+	return editor.bytes()
+}
+
+// updateValuesImages looks through the node given, and its children,
+// for images from the same repository as `newImage`, and updates them.
+func updateValuesImages(editor *yamlEditor, node *yamlNode, newImage flux.ImageID, visited map[*yamlNode]bool) bool {
+	node = node.resolve()
+	if node == nil || visited[node] {
+		return false
+	}
+	visited[node] = true
+
+	found := false
+	switch node.kind {
+	case yamlSequence:
+		for _, item := range node.items() {
+			found = updateValuesImages(editor, item, newImage, visited) || found
+		}
+	case yamlMapping:
+		if image := node.get("image"); image != nil && image.kind == yamlScalar && image.scalar() != "" {
+			current, err := flux.ParseImageID(image.scalar())
+			if err == nil && current.Repository() == newImage.Repository() {
+				editor.setScalar(image, newImage.String())
+				found = true
+			}
+		}
+		if repo, tag := node.get("repository"), node.get("tag"); repo != nil && tag != nil && repo.kind == yamlScalar && tag.kind == yamlScalar {
+			current, err := flux.ParseImageID(repo.scalar())
+			if err == nil && current.Repository() == newImage.Repository() {
+				editor.setScalar(tag, newImage.Tag)
+				found = true
+			}
+		}
+		for i := 1; i < len(node.children); i += 2 {
+			found = updateValuesImages(editor, node.children[i], newImage, visited) || found
+		}
+	}
+	return found
+}
+
+// UpdatePolicies changes the policy annotations in a values file. It
+// is also used to mark the resources rendered from charts (e.g., for
+// garbage collection), so if the definition given is a Kubernetes
+// resource, it's updated as one.
+func (h *HelmManifests) UpdatePolicies(def []byte, update policy.Update) ([]byte, error) {
+	docs, err := parseYAML(def)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding annotations")
+	}
+	if len(docs) > 0 && docs[0].get("kind") != nil && docs[0].get("metadata") != nil {
+		return (&Manifests{}).UpdatePolicies(def, update)
+	}
+	if _, ok := update.Add.Get(policy.TagAll); ok {
+		return nil, errors.New("tag_all cannot be used with Helm charts; give a tag policy for each container instead")
+	}
+
+	if len(docs) == 0 || docs[0].isEmpty() {
+		annotations := applyPolicyUpdate(map[string]string{}, update)
+		if len(annotations) == 0 {
+			return def, nil
+		}
+		var keys []string
+		for k := range annotations {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		editor := newYAMLEditor(def)
+		text := "annotations:\n"
+		for _, k := range keys {
+			text += "  " + annotationEntry(k, annotations[k]) + "\n"
+		}
+		if len(def) > 0 && !bytes.HasSuffix(def, []byte("\n")) {
+			text = "\n" + text
+		}
+		editor.insert(len(def), text)
+		return editor.bytes()
+	}
+
+	values := docs[0]
+	if values.kind != yamlMapping {
+		return nil, errors.New("values file is not a mapping")
+	}
+	old := valuesAnnotations(values)
+	annotations := map[string]string{}
+	for k, v := range old {
+		annotations[k] = v
+	}
+	annotations = applyPolicyUpdate(annotations, update)
+
+	editor := newYAMLEditor(def)
+	if err := writeAnnotations(editor, values, "  ", old, annotations); err != nil {
+		return nil, errors.Wrap(err, "updating values annotations")
+	}
+	return editor.bytes()
+}
+
+// valuesAnnotations returns the top-level annotations in a values
+// file.
+func valuesAnnotations(values *yamlNode) map[string]string {
+	annotations := map[string]string{}
+	node := values.get("annotations")
+	for _, k := range node.keys() {
+		annotations[k] = node.get(k).scalar()
+	}
+	return annotations
+}
+
+// valuesFile is a Helm chart's values file, standing in as the
+// definition of the services rendered from the chart.
+type valuesFile struct {
+	chart       string
+	source      string
+	bytes       []byte
+	annotations map[string]string
+}
+
+func loadValues(chart, path string) (*valuesFile, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading values file for chart %s", chart)
+	}
+	docs, err := parseYAML(bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing values file %s", path)
+	}
+	annotations := map[string]string{}
+	if len(docs) > 0 {
+		annotations = valuesAnnotations(docs[0])
+	}
+	return &valuesFile{
+		chart:       chart,
+		source:      path,
+		bytes:       bytes,
+		annotations: annotations,
+	}, nil
+}
+
+func (v *valuesFile) ResourceID() string {
+	return "HelmChart " + v.chart
+}
+
+func (v *valuesFile) ServiceIDs(all map[string]resource.Resource) []flux.ServiceID {
+	return nil
+}
+
+func (v *valuesFile) Policy() policy.Set {
+	set := policy.Set{}
+	for k, val := range v.annotations {
+		if strings.HasPrefix(k, kresource.PolicyPrefix) && val == "true" {
+			set = set.Add(policy.Policy(strings.TrimPrefix(k, kresource.PolicyPrefix)))
+		}
+	}
+	return set
+}
+
+func (v *valuesFile) Source() string {
+	return v.source
+}
+
+// The definition is the whole file.
+func (v *valuesFile) Offset() int {
+	return 0
+}
+
+func (v *valuesFile) Bytes() []byte {
+	return v.bytes
+}
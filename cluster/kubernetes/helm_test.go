@@ -0,0 +1,264 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/policy"
+)
+
+const helloValues = `# Values for the helloworld chart
+annotations:
+  flux.weave.works/automated: "true"
+  flux.weave.works/tag.helloworld: glob:master-*
+
+image:
+  repository: quay.io/weaveworks/helloworld # the app
+  tag: master-a000001
+sidecar:
+  image: quay.io/weaveworks/sidecar:master-a000002
+replicas: 2
+`
+
+const helloRendered = `---
+# Source: helloworld/templates/empty.yaml
+---
+# Source: helloworld/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: helloworld
+spec:
+  selector:
+    name: helloworld
+---
+# Source: helloworld/templates/deployment.yaml
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  replicas: 2
+  template:
+    metadata:
+      labels:
+        name: helloworld
+    spec:
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:master-a000001
+      - name: sidecar
+        image: quay.io/weaveworks/sidecar:master-a000002
+`
+
+// helmSetup writes a chart, with a values file, under a temporary
+// directory, and returns a HelmManifests that renders it as
+// `helloRendered` (rather than running helm).
+func helmSetup(t *testing.T) (*HelmManifests, string, func()) {
+	dir, cleanup := testfiles.TempDir(t)
+	chart := filepath.Join(dir, "charts", "helloworld")
+	if err := os.MkdirAll(filepath.Join(chart, "templates"), 0777); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"Chart.yaml":             "name: helloworld\nversion: 0.1.0\n",
+		"values.yaml":            "replicas: 1\n",
+		"prod.yaml":              helloValues,
+		"templates/service.yaml": "{{ not valid yaml }}\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(chart, name), []byte(content), 0666); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+
+	h := &HelmManifests{
+		valuesFile: "prod.yaml",
+		render: func(c, values string) ([]byte, error) {
+			if c != chart || values != filepath.Join(chart, "prod.yaml") {
+				t.Errorf("unexpected chart %q and values %q rendered", c, values)
+			}
+			return []byte(helloRendered), nil
+		},
+	}
+	return h, dir, cleanup
+}
+
+func TestHelmLoadManifests(t *testing.T) {
+	h, dir, cleanup := helmSetup(t)
+	defer cleanup()
+
+	objs, err := h.LoadManifests(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for id, obj := range objs {
+		ids = append(ids, id)
+		if obj.Source() != filepath.Join(dir, "charts", "helloworld") {
+			t.Errorf("expected resources to come from the chart, got %s", obj.Source())
+		}
+	}
+	if len(ids) != 2 || objs["Service default/helloworld"] == nil || objs["Deployment default/helloworld"] == nil {
+		t.Errorf("expected the service and deployment, got %v", ids)
+	}
+}
+
+func TestHelmDefinedServices(t *testing.T) {
+	h, dir, cleanup := helmSetup(t)
+	defer cleanup()
+
+	services, err := h.FindDefinedServices(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[flux.ServiceID][]string{
+		flux.ServiceID("default/helloworld"): []string{filepath.Join(dir, "charts", "helloworld", "prod.yaml")},
+	}
+	if !reflect.DeepEqual(expected, sources(services)) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expected, sources(services))
+	}
+
+	policies, err := h.ServicesWithPolicies(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPolicies := policy.ServiceMap{
+		flux.ServiceID("default/helloworld"): policy.Set{
+			policy.Automated:               "true",
+			policy.TagPrefix("helloworld"): "glob:master-*",
+		},
+	}
+	if !reflect.DeepEqual(expectedPolicies, policies) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expectedPolicies, policies)
+	}
+}
+
+func TestHelmUpdateDefinition(t *testing.T) {
+	h := &HelmManifests{}
+	for _, c := range []struct {
+		image, in, out string
+	}{
+		{
+			image: "quay.io/weaveworks/helloworld:master-a000003",
+			in:    helloValues,
+			out: `# Values for the helloworld chart
+annotations:
+  flux.weave.works/automated: "true"
+  flux.weave.works/tag.helloworld: glob:master-*
+
+image:
+  repository: quay.io/weaveworks/helloworld # the app
+  tag: master-a000003
+sidecar:
+  image: quay.io/weaveworks/sidecar:master-a000002
+replicas: 2
+`,
+		},
+		{
+			image: "quay.io/weaveworks/sidecar:1",
+			in:    helloValues,
+			out: `# Values for the helloworld chart
+annotations:
+  flux.weave.works/automated: "true"
+  flux.weave.works/tag.helloworld: glob:master-*
+
+image:
+  repository: quay.io/weaveworks/helloworld # the app
+  tag: master-a000001
+sidecar:
+  image: quay.io/weaveworks/sidecar:1
+replicas: 2
+`,
+		},
+		{
+			image: "nginx:1.13",
+			in:    "proxies:\n- image: {repository: nginx, tag: '1.12'}\n- image: nginx:1.12\n",
+			out:   "proxies:\n- image: {repository: nginx, tag: '1.13'}\n- image: nginx:1.13\n",
+		},
+	} {
+		newImage, _ := flux.ParseImageID(c.image)
+		out, err := h.UpdateDefinition([]byte(c.in), "any", newImage)
+		if err != nil {
+			t.Errorf("updating %s: %v", c.image, err)
+			continue
+		}
+		if string(out) != c.out {
+			t.Errorf("updating %s, expected:\n%s\ngot:\n%s", c.image, c.out, string(out))
+		}
+	}
+
+	newImage, _ := flux.ParseImageID("quay.io/weaveworks/other:1")
+	if _, err := h.UpdateDefinition([]byte(helloValues), "other", newImage); err == nil {
+		t.Errorf("expected error updating image not in values file")
+	}
+}
+
+func TestHelmUpdatePolicies(t *testing.T) {
+	h := &HelmManifests{}
+	for _, c := range []struct {
+		name    string
+		in, out string
+		update  policy.Update
+	}{
+		{
+			name: "add to existing",
+			in:   helloValues,
+			out: `# Values for the helloworld chart
+annotations:
+  flux.weave.works/automated: "true"
+  flux.weave.works/locked: "true"
+  flux.weave.works/tag.helloworld: glob:master-*
+
+image:
+  repository: quay.io/weaveworks/helloworld # the app
+  tag: master-a000001
+sidecar:
+  image: quay.io/weaveworks/sidecar:master-a000002
+replicas: 2
+`,
+			update: policy.Update{Add: policy.Set{policy.Locked: "true"}},
+		},
+		{
+			name:   "no annotations yet",
+			in:     "# comment\nreplicas: 1\n",
+			out:    "# comment\nannotations:\n  flux.weave.works/automated: \"true\"\nreplicas: 1\n",
+			update: policy.Update{Add: policy.Set{policy.Automated: "true"}},
+		},
+		{
+			name:   "empty values",
+			in:     "# nothing here",
+			out:    "# nothing here\nannotations:\n  flux.weave.works/automated: \"true\"\n",
+			update: policy.Update{Add: policy.Set{policy.Automated: "true"}},
+		},
+		{
+			name:   "remove the last",
+			in:     "annotations:\n  flux.weave.works/automated: \"true\"\nreplicas: 1\n",
+			out:    "replicas: 1\n",
+			update: policy.Update{Remove: policy.Set{policy.Automated: "true"}},
+		},
+		{
+			name:   "rendered resource",
+			in:     "kind: Deployment\nmetadata:\n  name: helloworld\n",
+			out:    "kind: Deployment\nmetadata:\n  annotations:\n    flux.weave.works/sync-gc-mark: \"true\"\n  name: helloworld\n",
+			update: policy.Update{Add: policy.Set{policy.SyncGCMark: "true"}},
+		},
+	} {
+		out, err := h.UpdatePolicies([]byte(c.in), c.update)
+		if err != nil {
+			t.Errorf("[%s] %v", c.name, err)
+		} else if string(out) != c.out {
+			t.Errorf("[%s] expected:\n%s\ngot:\n%s", c.name, c.out, string(out))
+		}
+	}
+
+	if _, err := h.UpdatePolicies([]byte(helloValues), policy.Update{Add: policy.Set{policy.TagAll: "glob:*"}}); err == nil {
+		t.Errorf("expected error using tag_all with values file")
+	}
+}
@@ -28,7 +28,7 @@ import (
 
 const (
 	StatusUnknown  = "unknown"
-	StatusReady    = "ready"
+	StatusReady    = cluster.StatusReady
 	StatusUpdating = "updating"
 )
 
@@ -212,6 +212,7 @@ func (c *Cluster) makeService(ns string, service *v1.Service, controllers []podC
 		ID:       id,
 		IP:       service.Spec.ClusterIP,
 		Metadata: metadataForService(service),
+		Labels:   service.Labels,
 	}
 
 	pc, err := matchController(service, controllers)
@@ -256,10 +257,41 @@ func (c *Cluster) podControllersInNamespace(namespace string) (res []podControll
 		}
 	}
 
+	dslist, err := c.daemonSets(namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "collecting daemonsets")
+	}
+	for i := range dslist {
+		if !isAddon(&dslist[i]) {
+			res = append(res, podController{DaemonSet: &dslist[i]})
+		}
+	}
+
+	sslist, err := c.statefulSets(namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "collecting statefulsets")
+	}
+	for i := range sslist {
+		if !isAddon(&sslist[i]) {
+			res = append(res, podController{StatefulSet: &sslist[i]})
+		}
+	}
+
+	cjlist, err := c.cronJobs(namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "collecting cronjobs")
+	}
+	for i := range cjlist {
+		if !isAddon(&cjlist[i]) {
+			res = append(res, podController{CronJob: &cjlist[i]})
+		}
+	}
+
 	return res, nil
 }
 
-// Find the pod controller (deployment or replication controller) that matches the service
+// Find the pod controller (deployment, replication controller,
+// daemonset, statefulset or cronjob) that matches the service
 func matchController(service *v1.Service, controllers []podController) (podController, error) {
 	selector := service.Spec.Selector
 	if len(selector) == 0 {
@@ -282,28 +314,46 @@ func matchController(service *v1.Service, controllers []podController) (podContr
 	}
 }
 
-// Either a replication controller, a deployment, or neither (both nils).
+// One of a replication controller, a deployment, a daemonset, a
+// statefulset or a cronjob; or none of them (all nils).
 type podController struct {
 	ReplicationController *v1.ReplicationController
 	Deployment            *apiext.Deployment
+	DaemonSet             *daemonSet
+	StatefulSet           *statefulSet
+	CronJob               *cronJob
+}
+
+// template returns the pod template of whichever controller this is,
+// or nil if it's none of them.
+func (p podController) template() *v1.PodTemplateSpec {
+	switch {
+	case p.Deployment != nil:
+		return &p.Deployment.Spec.Template
+	case p.ReplicationController != nil:
+		return p.ReplicationController.Spec.Template
+	case p.DaemonSet != nil:
+		return &p.DaemonSet.Spec.Template
+	case p.StatefulSet != nil:
+		return &p.StatefulSet.Spec.Template
+	case p.CronJob != nil:
+		return &p.CronJob.Spec.JobTemplate.Spec.Template
+	}
+	return nil
 }
 
 func (p podController) secrets() []v1.LocalObjectReference {
-	// If deployment doesn't contain any secrets, just return empty secret
-	if p.Deployment != nil {
-		return p.Deployment.Spec.Template.Spec.ImagePullSecrets
-	} else if p.ReplicationController != nil {
-		return p.ReplicationController.Spec.Template.Spec.ImagePullSecrets
+	// If the controller doesn't contain any secrets, just return empty secret
+	if t := p.template(); t != nil {
+		return t.Spec.ImagePullSecrets
 	}
 	return nil
 }
 
 func (p podController) templateContainers() (res []cluster.Container) {
 	var apiContainers []v1.Container
-	if p.Deployment != nil {
-		apiContainers = p.Deployment.Spec.Template.Spec.Containers
-	} else if p.ReplicationController != nil {
-		apiContainers = p.ReplicationController.Spec.Template.Spec.Containers
+	if t := p.template(); t != nil {
+		apiContainers = t.Spec.Containers
 	}
 
 	for _, c := range apiContainers {
@@ -313,10 +363,8 @@ func (p podController) templateContainers() (res []cluster.Container) {
 }
 
 func (p podController) templateLabels() map[string]string {
-	if p.Deployment != nil {
-		return p.Deployment.Spec.Template.Labels
-	} else if p.ReplicationController != nil {
-		return p.ReplicationController.Spec.Template.Labels
+	if t := p.template(); t != nil {
+		return t.Labels
 	}
 	return nil
 }
@@ -335,7 +383,7 @@ func (p podController) matchedBy(selector map[string]string) bool {
 }
 
 // Determine a status for the service by looking at the rollout status
-// for the deployment or replication controller.
+// for the pod controller.
 func (p podController) status() string {
 	switch {
 	case p.Deployment != nil:
@@ -363,39 +411,78 @@ func (p podController) status() string {
 			return fmt.Sprintf("%d out of %d ready", ready, total)
 		}
 		return StatusUpdating
+	case p.DaemonSet != nil:
+		meta, status := p.DaemonSet.ObjectMeta, p.DaemonSet.Status
+		wanted := status.DesiredNumberScheduled
+		if status.ObservedGeneration == nil {
+			// Before Kubernetes 1.6, daemonsets aren't updated in
+			// place, so all there is to go on is readiness
+			if ready := status.NumberReady; ready != wanted {
+				return fmt.Sprintf("%d out of %d ready", ready, wanted)
+			}
+			return StatusReady
+		}
+		if *status.ObservedGeneration < meta.Generation {
+			return StatusUpdating
+		}
+		if updated := status.UpdatedNumberScheduled; updated != wanted {
+			return fmt.Sprintf("%d out of %d updated", updated, wanted)
+		}
+		if available := status.NumberAvailable; available != wanted {
+			return fmt.Sprintf("%d out of %d ready", available, wanted)
+		}
+		return StatusReady
+	case p.StatefulSet != nil:
+		meta, status := p.StatefulSet.ObjectMeta, p.StatefulSet.Status
+		if status.ObservedGeneration == nil || *status.ObservedGeneration < meta.Generation {
+			return StatusUpdating
+		}
+		var wanted int32 = 1
+		if p.StatefulSet.Spec.Replicas != nil {
+			wanted = *p.StatefulSet.Spec.Replicas
+		}
+		if status.UpdateRevision == "" {
+			// Before Kubernetes 1.7, statefulsets aren't updated in
+			// place (and don't report readiness), so all there is to
+			// go on is the number of pods
+			if status.Replicas != wanted {
+				return fmt.Sprintf("%d out of %d ready", status.Replicas, wanted)
+			}
+			return StatusReady
+		}
+		if status.CurrentRevision != status.UpdateRevision {
+			return StatusUpdating
+		}
+		if ready := status.ReadyReplicas; ready != wanted {
+			return fmt.Sprintf("%d out of %d ready", ready, wanted)
+		}
+		return StatusReady
+	case p.CronJob != nil:
+		// There's no rollout as such for a cronjob; the next job
+		// scheduled will simply use the new template.
+		return StatusReady
 	}
 	return StatusUnknown
 }
 
 // Sync performs the given actions on resources. Operations are
 // asynchronous, but serialised.
+//
+// The actions are carried out in stages, so that resources are
+// applied after those they depend on (see stages.go); deletions are
+// done first, in the reverse order. If deleting a resource fails, it
+// is not then applied.
 func (c *Cluster) Sync(spec cluster.SyncDef) error {
 	errc := make(chan error)
 	logger := log.NewContext(c.logger).With("method", "Sync")
 	c.actionc <- func() {
 		errs := cluster.SyncError{}
-		for _, action := range spec.Actions {
-			logger := log.NewContext(logger).With("resource", action.ResourceID)
-			if len(action.Delete) > 0 {
-				obj, err := definitionObj(action.Delete)
-				if err == nil {
-					err = c.applier.Delete(logger, obj)
-				}
-				if err != nil {
-					errs[action.ResourceID] = err
-					continue
-				}
-			}
-			if len(action.Apply) > 0 {
-				obj, err := definitionObj(action.Apply)
-				if err == nil {
-					err = c.applier.Apply(logger, obj)
-				}
-				if err != nil {
-					errs[action.ResourceID] = err
-					continue
-				}
-			}
+		deletes, applies := stageActions(spec.Actions, errs)
+		for i := len(deletes) - 1; i >= 0; i-- {
+			c.deleteStage(logger, stages[i], deletes[i], errs)
+		}
+		for i := range applies {
+			c.applyStage(logger, stages[i], applies[i], errs)
 		}
 		if len(errs) > 0 {
 			errc <- errs
@@ -451,6 +538,48 @@ func (c *Cluster) Export() ([]byte, error) {
 			}
 		}
 
+		daemonSets, err := c.daemonSets(ns.Name)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting daemonsets")
+		}
+		for _, ds := range daemonSets {
+			if isAddon(&ds) {
+				continue
+			}
+			err := appendRawYAML(&config, daemonSetGroupVersion, "DaemonSet", ds.raw)
+			if err != nil {
+				return nil, errors.Wrap(err, "marshalling daemonset to YAML")
+			}
+		}
+
+		statefulSets, err := c.statefulSets(ns.Name)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting statefulsets")
+		}
+		for _, ss := range statefulSets {
+			if isAddon(&ss) {
+				continue
+			}
+			err := appendRawYAML(&config, statefulSetGroupVersion, "StatefulSet", ss.raw)
+			if err != nil {
+				return nil, errors.Wrap(err, "marshalling statefulset to YAML")
+			}
+		}
+
+		cronJobs, err := c.cronJobs(ns.Name)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting cronjobs")
+		}
+		for _, cj := range cronJobs {
+			if isAddon(&cj) {
+				continue
+			}
+			err := appendRawYAML(&config, cj.groupVersion, "CronJob", cj.raw)
+			if err != nil {
+				return nil, errors.Wrap(err, "marshalling cronjob to YAML")
+			}
+		}
+
 		services, err := c.client.Services(ns.Name).List(api.ListOptions{})
 		if err != nil {
 			return nil, errors.Wrap(err, "getting services")
@@ -474,6 +603,11 @@ func appendYAML(buffer *bytes.Buffer, apiVersion, kind string, object interface{
 	if err != nil {
 		return err
 	}
+	writeYAML(buffer, apiVersion, kind, yamlBytes)
+	return nil
+}
+
+func writeYAML(buffer *bytes.Buffer, apiVersion, kind string, yamlBytes []byte) {
 	buffer.WriteString("---\n")
 	buffer.WriteString("apiVersion: ")
 	buffer.WriteString(apiVersion)
@@ -481,7 +615,6 @@ func appendYAML(buffer *bytes.Buffer, apiVersion, kind string, object interface{
 	buffer.WriteString(kind)
 	buffer.WriteString("\n")
 	buffer.Write(yamlBytes)
-	return nil
 }
 
 func (c *Cluster) PublicSSHKey(regenerate bool) (ssh.PublicKey, error) {
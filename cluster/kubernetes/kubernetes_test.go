@@ -4,11 +4,13 @@ package kubernetes
 // adequate. Starting with Sync.
 
 import (
-	"errors"
+	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
 	discovery "k8s.io/client-go/1.5/discovery"
 	v1alpha1apps "k8s.io/client-go/1.5/kubernetes/typed/apps/v1alpha1"
 	v1beta1authentication "k8s.io/client-go/1.5/kubernetes/typed/authentication/v1beta1"
@@ -209,3 +211,177 @@ func TestSkipOnError(t *testing.T) {
 		t.Errorf("expected commands:\n%#v\ngot:\n%#v", expected, mock.commands)
 	}
 }
+
+func resourceDef(kind, name, namespace string) []byte {
+	return []byte(`---
+kind: ` + kind + `
+metadata:
+  name: ` + name + `
+  namespace: ` + namespace + `
+`)
+}
+
+// Test that resources are applied in order of dependency, and deleted
+// in the reverse order.
+func TestSyncStages(t *testing.T) {
+	kube, mock := setup(t)
+	if err := kube.Sync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{
+			{ResourceID: "ingress", Apply: resourceDef("Ingress", "ingress", "test-ns")},
+			{ResourceID: "service", Apply: resourceDef("Service", "service", "test-ns")},
+			{ResourceID: "deployment", Apply: resourceDef("Deployment", "deployment", "test-ns")},
+			{ResourceID: "role", Apply: resourceDef("Role", "role", "test-ns")},
+			{ResourceID: "secret", Apply: resourceDef("Secret", "secret", "test-ns")},
+			{ResourceID: "namespace", Apply: resourceDef("Namespace", "namespace", "")},
+			{ResourceID: "old-namespace", Delete: resourceDef("Namespace", "old-namespace", "")},
+			{ResourceID: "old-service", Delete: resourceDef("Service", "old-service", "test-ns")},
+		},
+	}); err != nil {
+		t.Error(err)
+	}
+
+	expected := []command{
+		command{"delete", "old-service"},
+		command{"delete", "old-namespace"},
+		command{"apply", "namespace"},
+		command{"apply", "secret"},
+		command{"apply", "role"},
+		command{"apply", "deployment"},
+		command{"apply", "ingress"},
+		command{"apply", "service"},
+	}
+	if !reflect.DeepEqual(expected, mock.commands) {
+		t.Errorf("expected commands:\n%#v\ngot:\n%#v", expected, mock.commands)
+	}
+}
+
+type mockBatchApplier struct {
+	mockApplier
+	batches  [][]string
+	batchErr error
+}
+
+func (m *mockBatchApplier) ApplyBatch(logger log.Logger, objs []*apiObject) error {
+	var names []string
+	for _, obj := range objs {
+		names = append(names, obj.Metadata.Name)
+	}
+	m.batches = append(m.batches, names)
+	return m.batchErr
+}
+
+func batchSetup(t *testing.T) (*Cluster, *mockBatchApplier) {
+	applier := &mockBatchApplier{}
+	kube, err := NewCluster(&mockClientset{}, applier, nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kube, applier
+}
+
+// Test that resources in a stage are applied in batches, by
+// namespace.
+func TestSyncBatches(t *testing.T) {
+	kube, mock := batchSetup(t)
+	var actions []cluster.SyncAction
+	for _, name := range []string{"a", "b", "c"} {
+		actions = append(actions, cluster.SyncAction{ResourceID: name, Apply: resourceDef("Deployment", name, "ns1")})
+	}
+	actions = append(actions, cluster.SyncAction{ResourceID: "d", Apply: resourceDef("Deployment", "d", "ns2")})
+	if err := kube.Sync(cluster.SyncDef{Actions: actions}); err != nil {
+		t.Error(err)
+	}
+
+	expectedBatches := [][]string{{"a", "b", "c"}}
+	if !reflect.DeepEqual(expectedBatches, mock.batches) {
+		t.Errorf("expected batches:\n%#v\ngot:\n%#v", expectedBatches, mock.batches)
+	}
+	// A batch of one is applied on its own
+	expected := []command{command{"apply", "d"}}
+	if !reflect.DeepEqual(expected, mock.commands) {
+		t.Errorf("expected commands:\n%#v\ngot:\n%#v", expected, mock.commands)
+	}
+}
+
+// Test that a failed batch is retried one resource at a time, so
+// errors are reported against each resource.
+func TestSyncBatchFailure(t *testing.T) {
+	kube, mock := batchSetup(t)
+	mock.batchErr = errors.New("batch failed")
+	mock.applyErr = errors.New("apply failed")
+
+	err := kube.Sync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{
+			{ResourceID: "a", Apply: resourceDef("ConfigMap", "a", "ns1")},
+			{ResourceID: "b", Apply: resourceDef("ConfigMap", "b", "ns1")},
+		},
+	})
+	errs, ok := err.(cluster.SyncError)
+	if !ok {
+		t.Fatalf("expected sync error, got %#v", err)
+	}
+	if len(errs) != 2 || errs["a"] == nil || errs["b"] == nil {
+		t.Errorf("expected errors for both resources, got %#v", errs)
+	}
+	for id, err := range errs {
+		if errors.Cause(err) != mock.applyErr || !strings.Contains(err.Error(), "stage config") {
+			t.Errorf("expected error for %s to be from applying in stage config, got %q", id, err)
+		}
+	}
+
+	expected := []command{
+		command{"apply", "a"},
+		command{"apply", "b"},
+	}
+	if !reflect.DeepEqual(expected, mock.commands) {
+		t.Errorf("expected commands:\n%#v\ngot:\n%#v", expected, mock.commands)
+	}
+}
+
+func TestPodControllerStatus(t *testing.T) {
+	for _, c := range []struct {
+		name, kind, def, status string
+	}{
+		{"daemonset rolled out", "DaemonSet",
+			`{"metadata": {"generation": 2}, "status": {"observedGeneration": 2, "desiredNumberScheduled": 3, "updatedNumberScheduled": 3, "numberAvailable": 3, "numberReady": 3}}`,
+			StatusReady},
+		{"daemonset not yet observed", "DaemonSet",
+			`{"metadata": {"generation": 3}, "status": {"observedGeneration": 2, "desiredNumberScheduled": 3, "updatedNumberScheduled": 3, "numberAvailable": 3, "numberReady": 3}}`,
+			StatusUpdating},
+		{"daemonset old pods ready", "DaemonSet",
+			`{"metadata": {"generation": 2}, "status": {"observedGeneration": 2, "desiredNumberScheduled": 3, "updatedNumberScheduled": 1, "numberAvailable": 3, "numberReady": 3}}`,
+			"1 out of 3 updated"},
+		{"daemonset updated pods unavailable", "DaemonSet",
+			`{"metadata": {"generation": 2}, "status": {"observedGeneration": 2, "desiredNumberScheduled": 3, "updatedNumberScheduled": 3, "numberAvailable": 2, "numberReady": 2}}`,
+			"2 out of 3 ready"},
+		{"daemonset before 1.6", "DaemonSet",
+			`{"metadata": {"generation": 2}, "status": {"desiredNumberScheduled": 3, "numberReady": 3}}`,
+			StatusReady},
+		{"statefulset rolled out", "StatefulSet",
+			`{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 3, "readyReplicas": 3, "currentRevision": "web-2", "updateRevision": "web-2"}}`,
+			StatusReady},
+		{"statefulset rolling", "StatefulSet",
+			`{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 3, "readyReplicas": 3, "currentRevision": "web-1", "updateRevision": "web-2"}}`,
+			StatusUpdating},
+		{"statefulset pods not ready", "StatefulSet",
+			`{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 3, "readyReplicas": 1, "currentRevision": "web-2", "updateRevision": "web-2"}}`,
+			"1 out of 3 ready"},
+	} {
+		var p podController
+		var err error
+		switch c.kind {
+		case "DaemonSet":
+			p.DaemonSet = &daemonSet{}
+			err = json.Unmarshal([]byte(c.def), p.DaemonSet)
+		case "StatefulSet":
+			p.StatefulSet = &statefulSet{}
+			err = json.Unmarshal([]byte(c.def), p.StatefulSet)
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if status := p.status(); status != c.status {
+			t.Errorf("%s: expected status %q, got %q", c.name, c.status, status)
+		}
+	}
+}
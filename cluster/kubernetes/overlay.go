@@ -0,0 +1,582 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// The file that marks a directory as an overlay
+const kustomizationFile = "kustomization.yaml"
+
+// OverlayManifests lets a single repo hold the manifests for more
+// than one cluster, as a base directory of manifests shared between
+// clusters, plus a directory for each cluster that overlays it, in
+// the style of kustomize. An overlay is a directory with a
+// kustomization.yaml, like this:
+//
+//	bases:                  # directories to build on; either plain
+//	- ../../base            # manifests, or other overlays
+//	resources:              # more manifests, just for this cluster
+//	- ingress.yaml
+//	patchesStrategicMerge:  # patches to the resources from the bases
+//	- replicas.yaml
+//	images:                 # images to use instead of those given
+//	- name: quay.io/weaveworks/helloworld
+//	  newTag: master-a000002
+//
+// The git path for each cluster is then its overlay directory. (If
+// the git path isn't an overlay, the manifests under it are used as
+// they are.)
+//
+// Releases are written into the overlay, as entries in `images`, so
+// that the base, and the other clusters, are not affected. Policies
+// are read from the resources as patched, but can't be changed by
+// fluxd for resources defined through an overlay.
+type OverlayManifests struct {
+	Manifests
+}
+
+func isOverlay(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, kustomizationFile))
+	return err == nil
+}
+
+// The fields that only a kustomization has
+var kustomizationFields = []string{"bases", "resources", "patchesStrategicMerge", "images"}
+
+// isKustomization says whether the definition given is a
+// kustomization, rather than a Kubernetes resource. Kustomizations
+// don't need a kind, but may have one; since the name of the file
+// isn't known here, one without a kind must have at least one of the
+// kustomization fields, and nothing that marks it as a resource.
+func isKustomization(docs []*yamlNode) bool {
+	if len(docs) != 1 || docs[0].kind != yamlMapping {
+		return false
+	}
+	if kind := docs[0].get("kind"); kind != nil {
+		return kind.scalar() == "Kustomization"
+	}
+	if docs[0].get("apiVersion") != nil || docs[0].get("metadata") != nil {
+		return false
+	}
+	for _, field := range kustomizationFields {
+		if key, _ := docs[0].entry(field); key != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type kustomization struct {
+	Bases                 []string `yaml:"bases"`
+	Resources             []string `yaml:"resources"`
+	PatchesStrategicMerge []string `yaml:"patchesStrategicMerge"`
+	Images                []struct {
+		Name    string `yaml:"name"`
+		NewName string `yaml:"newName"`
+		NewTag  string `yaml:"newTag"`
+	} `yaml:"images"`
+}
+
+// overlayObject is a resource definition being composed from a base
+// and overlays.
+type overlayObject struct {
+	source string
+	doc    map[interface{}]interface{}
+}
+
+func (o overlayObject) id() string {
+	metadata, _ := o.doc["metadata"].(map[interface{}]interface{})
+	kind, _ := o.doc["kind"].(string)
+	namespace, _ := metadata["namespace"].(string)
+	name, _ := metadata["name"].(string)
+	if namespace == "" {
+		namespace = "default"
+	}
+	return fmt.Sprintf("%s %s/%s", kind, namespace, name)
+}
+
+// loadObjects reads the resource definitions from the files or
+// directories given.
+func loadObjects(paths ...string) ([]overlayObject, error) {
+	resources, err := kresource.Load(paths...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for id := range resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var objs []overlayObject
+	for _, id := range ids {
+		res := resources[id]
+		var doc map[interface{}]interface{}
+		if err := yaml.Unmarshal(res.Bytes(), &doc); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s from %s", id, res.Source())
+		}
+		objs = append(objs, overlayObject{res.Source(), doc})
+	}
+	return objs, nil
+}
+
+// buildOverlay composes the resources defined by the overlay in the
+// directory given. `visiting` holds the overlays that are being built
+// already, so that cycles can be detected.
+func buildOverlay(dir string, visiting map[string]bool) ([]overlayObject, error) {
+	dir = filepath.Clean(dir)
+	if visiting[dir] {
+		return nil, fmt.Errorf("overlay %s is its own base", dir)
+	}
+	visiting[dir] = true
+	defer delete(visiting, dir)
+
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, kustomizationFile))
+	if err != nil {
+		return nil, err
+	}
+	var k kustomization
+	if err := yaml.Unmarshal(bytes, &k); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", filepath.Join(dir, kustomizationFile))
+	}
+
+	var objs []overlayObject
+	for _, base := range k.Bases {
+		path := filepath.Join(dir, base)
+		var baseObjs []overlayObject
+		if isOverlay(path) {
+			baseObjs, err = buildOverlay(path, visiting)
+		} else {
+			baseObjs, err = loadObjects(path)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "building base %s of overlay %s", base, dir)
+		}
+		objs = append(objs, baseObjs...)
+	}
+	for _, file := range k.Resources {
+		fileObjs, err := loadObjects(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, fileObjs...)
+	}
+
+	index := map[string]int{}
+	for i, obj := range objs {
+		if j, ok := index[obj.id()]; ok {
+			return nil, fmt.Errorf(`resource '%s' defined more than once (in %s and %s)`, obj.id(), objs[j].source, obj.source)
+		}
+		index[obj.id()] = i
+	}
+
+	for _, file := range k.PatchesStrategicMerge {
+		patches, err := loadObjects(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		for _, patch := range patches {
+			i, ok := index[patch.id()]
+			if !ok {
+				return nil, fmt.Errorf("patch in %s is for %s, which is not in the bases of overlay %s", patch.source, patch.id(), dir)
+			}
+			merged, _ := mergePatch("", objs[i].doc, patch.doc).(map[interface{}]interface{})
+			objs[i].doc = merged
+		}
+	}
+
+	for _, image := range k.Images {
+		name, err := flux.ParseImageID(image.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing image name %q in overlay %s", image.Name, dir)
+		}
+		for _, obj := range objs {
+			for _, c := range overlayContainers(obj.doc) {
+				current, _ := c["image"].(string)
+				currentID, err := flux.ParseImageID(current)
+				if err != nil || currentID.Repository() != name.Repository() {
+					continue
+				}
+				// Keep the tag as written, if there is one, rather
+				// than the tag it's taken to mean (e.g., "latest")
+				repo, tag := image.Name, ""
+				if i := strings.LastIndex(current, ":"); i > strings.LastIndex(current, "/") {
+					tag = current[i+1:]
+				}
+				if image.NewName != "" {
+					repo = image.NewName
+				}
+				if image.NewTag != "" {
+					tag = image.NewTag
+				}
+				if tag == "" {
+					c["image"] = repo
+				} else {
+					c["image"] = repo + ":" + tag
+				}
+			}
+		}
+	}
+	return objs, nil
+}
+
+// overlayContainers returns the containers (and init containers) in
+// the pod template of a resource, if it has one.
+func overlayContainers(doc map[interface{}]interface{}) []map[interface{}]interface{} {
+	get := func(m map[interface{}]interface{}, keys ...string) map[interface{}]interface{} {
+		for _, k := range keys {
+			m, _ = m[k].(map[interface{}]interface{})
+		}
+		return m
+	}
+	podSpec := get(doc, "spec", "template", "spec")
+	if podSpec == nil {
+		podSpec = get(doc, "spec", "jobTemplate", "spec", "template", "spec")
+	}
+	var containers []map[interface{}]interface{}
+	for _, field := range []string{"initContainers", "containers"} {
+		items, _ := podSpec[field].([]interface{})
+		for _, item := range items {
+			if c, ok := item.(map[interface{}]interface{}); ok {
+				containers = append(containers, c)
+			}
+		}
+	}
+	return containers
+}
+
+// Lists of these fields are merged item by item (matching items on
+// the key given), rather than replaced, when patching.
+var patchMergeKeys = map[string][]string{
+	"containers":       {"name"},
+	"initContainers":   {"name"},
+	"env":              {"name"},
+	"volumes":          {"name"},
+	"imagePullSecrets": {"name"},
+	"volumeMounts":     {"mountPath"},
+	"ports":            {"containerPort", "port"},
+}
+
+// mergePatch applies a strategic merge patch to a value, returning
+// the result. Mappings are merged key by key, with a null value
+// deleting the key; lists of fields in patchMergeKeys are merged item
+// by item, with `$patch: delete` in an item removing it; and anything
+// else is replaced by the patch. `field` is the key the value is
+// under. The original value may be changed, but the patch is not;
+// whatever is taken from the patch is copied, so the same patch can
+// be applied more than once.
+func mergePatch(field string, orig, patch interface{}) interface{} {
+	switch p := patch.(type) {
+	case map[interface{}]interface{}:
+		switch p["$patch"] {
+		case "replace":
+			replacement := copyValue(p).(map[interface{}]interface{})
+			delete(replacement, "$patch")
+			return replacement
+		case "delete":
+			return nil
+		}
+		o, ok := orig.(map[interface{}]interface{})
+		if !ok {
+			return copyValue(p)
+		}
+		for k, v := range p {
+			if v == nil {
+				delete(o, k)
+				continue
+			}
+			key, _ := k.(string)
+			o[k] = mergePatch(key, o[k], v)
+		}
+		return o
+	case []interface{}:
+		o, ok := orig.([]interface{})
+		keys, merge := patchMergeKeys[field]
+		if !ok || !merge {
+			return copyValue(p)
+		}
+		for _, item := range p {
+			pm, ok := item.(map[interface{}]interface{})
+			if !ok {
+				return copyValue(p)
+			}
+			i := findMergeItem(o, keys, pm)
+			switch {
+			case pm["$patch"] == "delete":
+				if i >= 0 {
+					o = append(o[:i], o[i+1:]...)
+				}
+			case i >= 0:
+				o[i] = mergePatch("", o[i], pm)
+			default:
+				o = append(o, mergePatch("", nil, pm))
+			}
+		}
+		return o
+	}
+	return patch
+}
+
+// copyValue makes a deep copy of a value decoded from YAML.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for k, item := range v {
+			m[k] = copyValue(item)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, item := range v {
+			l[i] = copyValue(item)
+		}
+		return l
+	}
+	return v
+}
+
+// findMergeItem returns the index of the item in `items` with the
+// same value, for the first merge key it has, as `patch`; or -1 if
+// there's no such item.
+func findMergeItem(items []interface{}, keys []string, patch map[interface{}]interface{}) int {
+	for _, key := range keys {
+		want, ok := patch[key]
+		if !ok {
+			continue
+		}
+		for i, item := range items {
+			if m, ok := item.(map[interface{}]interface{}); ok && fmt.Sprint(m[key]) == fmt.Sprint(want) {
+				return i
+			}
+		}
+		return -1
+	}
+	return -1
+}
+
+// loadOverlay builds the overlay in the directory given, and returns
+// the composed resources.
+func loadOverlay(dir string) (map[string]resource.Resource, error) {
+	objs, err := buildOverlay(dir, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]resource.Resource{}
+	for _, obj := range objs {
+		def, err := yaml.Marshal(obj.doc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encoding %s", obj.id())
+		}
+		parsed, err := kresource.ParseMultidoc(def, obj.source)
+		if err != nil {
+			return nil, err
+		}
+		for id, res := range parsed {
+			result[id] = res
+		}
+	}
+	return result, nil
+}
+
+func (m *OverlayManifests) LoadManifests(paths ...string) (map[string]resource.Resource, error) {
+	all := map[string]resource.Resource{}
+	for _, path := range paths {
+		var objs map[string]resource.Resource
+		var err error
+		if isOverlay(path) {
+			objs, err = loadOverlay(path)
+		} else {
+			objs, err = kresource.Load(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for id, obj := range objs {
+			if alreadyDefined, ok := all[id]; ok {
+				return nil, fmt.Errorf(`resource '%s' defined more than once (in %s and %s)`, id, alreadyDefined.Source(), obj.Source())
+			}
+			all[id] = obj
+		}
+	}
+	return all, nil
+}
+
+// FindDefinedServices maps the services defined by an overlay to its
+// kustomization file, since that's where changes to the services are
+// written.
+func (m *OverlayManifests) FindDefinedServices(path string) (map[flux.ServiceID][]resource.Resource, error) {
+	if !isOverlay(path) {
+		return m.Manifests.FindDefinedServices(path)
+	}
+	objs, err := loadOverlay(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "building overlay")
+	}
+	k, err := loadKustomization(path)
+	if err != nil {
+		return nil, err
+	}
+	result := map[flux.ServiceID][]resource.Resource{}
+	for id := range definedServices(objs) {
+		result[id] = []resource.Resource{k}
+	}
+	return result, nil
+}
+
+func (m *OverlayManifests) ServicesWithPolicies(root string) (policy.ServiceMap, error) {
+	if !isOverlay(root) {
+		return m.Manifests.ServicesWithPolicies(root)
+	}
+	objs, err := loadOverlay(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "building overlay")
+	}
+	result := policy.ServiceMap{}
+	err = iterateManifests(definedServices(objs), func(s flux.ServiceID, m Manifest) error {
+		ps, err := policiesFrom(m)
+		if err != nil {
+			return err
+		}
+		result[s] = ps
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UpdateDefinition sets the image in an overlay's kustomization, by
+// changing the `newTag` of the entry in `images` for the image's
+// repository, or adding an entry if there isn't one. Other
+// definitions (i.e., those not in an overlay) are updated as usual.
+func (m *OverlayManifests) UpdateDefinition(def []byte, container string, newImage flux.ImageID) ([]byte, error) {
+	docs, err := parseYAML(def)
+	if err != nil {
+		return nil, err
+	}
+	if !isKustomization(docs) {
+		return m.Manifests.UpdateDefinition(def, container, newImage)
+	}
+
+	editor := newYAMLEditor(def)
+	images := docs[0].get("images")
+	for _, entry := range images.items() {
+		name, err := flux.ParseImageID(entry.get("name").scalar())
+		if err != nil || name.Repository() != newImage.Repository() {
+			continue
+		}
+		if tag := entry.get("newTag"); tag != nil {
+			editor.setScalar(tag, newImage.Tag)
+		} else if entry.flow {
+			editor.insert(entry.end-1, ", newTag: "+quoteIfNeeded(newImage.Tag, true))
+		} else {
+			_, nameValue := entry.entry("name")
+			editor.insert(nextLine(editor.src, nameValue.end), strings.Repeat(" ", entry.column)+"newTag: "+quoteIfNeeded(newImage.Tag, false)+"\n")
+		}
+		return editor.bytes()
+	}
+
+	name := newImage.Repository()
+	switch {
+	case images.isEmpty():
+		key, _ := docs[0].entry("images")
+		text := "- name: " + quoteIfNeeded(name, false) + "\n  newTag: " + quoteIfNeeded(newImage.Tag, false) + "\n"
+		if key != nil {
+			editor.replace(lineStart(editor.src, key.start), nextLine(editor.src, key.end), "images:\n"+text)
+			break
+		}
+		text = "images:\n" + text
+		if len(def) > 0 && !bytes.HasSuffix(def, []byte("\n")) {
+			text = "\n" + text
+		}
+		editor.insert(len(def), text)
+	case images.kind != yamlSequence:
+		return nil, errors.New("images in kustomization are not a list")
+	case images.flow:
+		text := "{name: " + quoteIfNeeded(name, true) + ", newTag: " + quoteIfNeeded(newImage.Tag, true) + "}"
+		if len(images.children) > 0 {
+			text = ", " + text
+		}
+		editor.insert(images.end-1, text)
+	default:
+		indent := strings.Repeat(" ", images.column)
+		text := indent + "- name: " + quoteIfNeeded(name, false) + "\n" + indent + "  newTag: " + quoteIfNeeded(newImage.Tag, false) + "\n"
+		at := nextLine(editor.src, images.end)
+		if at == len(def) && !bytes.HasSuffix(def, []byte("\n")) {
+			text = "\n" + strings.TrimSuffix(text, "\n")
+		}
+		editor.insert(at, text)
+	}
+	return editor.bytes()
+}
+
+// UpdatePolicies updates the policies in a resource definition. It's
+// not possible to update policies via a kustomization, since a
+// kustomization may define many resources.
+func (m *OverlayManifests) UpdatePolicies(def []byte, update policy.Update) ([]byte, error) {
+	docs, err := parseYAML(def)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding annotations")
+	}
+	if isKustomization(docs) {
+		return nil, errors.New("policies can't be changed for resources defined in an overlay; add annotations to the resources in the base, or in a patch in the overlay")
+	}
+	return m.Manifests.UpdatePolicies(def, update)
+}
+
+// overlayFile is a kustomization file, standing in as the definition
+// of the services defined by the overlay.
+type overlayFile struct {
+	source string
+	bytes  []byte
+}
+
+func loadKustomization(dir string) (*overlayFile, error) {
+	path := filepath.Join(dir, kustomizationFile)
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &overlayFile{path, bytes}, nil
+}
+
+func (o *overlayFile) ResourceID() string {
+	return "Kustomization " + filepath.Dir(o.source)
+}
+
+func (o *overlayFile) ServiceIDs(all map[string]resource.Resource) []flux.ServiceID {
+	return nil
+}
+
+func (o *overlayFile) Policy() policy.Set {
+	return policy.Set{}
+}
+
+func (o *overlayFile) Source() string {
+	return o.source
+}
+
+// The definition is the whole file.
+func (o *overlayFile) Offset() int {
+	return 0
+}
+
+func (o *overlayFile) Bytes() []byte {
+	return o.bytes
+}
@@ -0,0 +1,359 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/policy"
+)
+
+var overlayFiles = map[string]string{
+	"base/helloworld.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: helloworld
+spec:
+  selector:
+    name: helloworld
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  replicas: 1
+  template:
+    metadata:
+      labels:
+        name: helloworld
+    spec:
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:master-a000001
+        env:
+        - name: LOG_LEVEL
+          value: info
+        - name: DEBUG
+          value: "true"
+      - name: sidecar
+        image: quay.io/weaveworks/sidecar:master-a000001
+`,
+	"overlays/production/kustomization.yaml": `bases:
+- ../../base
+resources:
+- ingress.yaml
+patchesStrategicMerge:
+- helloworld.yaml
+images:
+- name: quay.io/weaveworks/helloworld
+  newTag: master-a000002
+`,
+	"overlays/production/helloworld.yaml": `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+  annotations:
+    flux.weave.works/locked: "true"
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: helloworld
+        env:
+        - name: LOG_LEVEL
+          value: warn
+        - name: DEBUG
+          $patch: delete
+      - name: sidecar
+        $patch: delete
+`,
+	"overlays/production/ingress.yaml": `apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: helloworld
+`,
+	"overlays/loop/kustomization.yaml": `bases:
+- ../loop
+`,
+	"untagged/nginx.yaml": `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx
+`,
+	"overlays/mirror/kustomization.yaml": `bases:
+- ../../untagged
+images:
+- name: nginx
+  newName: registry.example.com/nginx
+`,
+}
+
+func overlaySetup(t *testing.T) (string, func()) {
+	dir, cleanup := testfiles.TempDir(t)
+	for name, content := range overlayFiles {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	return dir, cleanup
+}
+
+func TestOverlayLoadManifests(t *testing.T) {
+	dir, cleanup := overlaySetup(t)
+	defer cleanup()
+
+	objs, err := (&OverlayManifests{}).LoadManifests(filepath.Join(dir, "overlays", "production"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 3 || objs["Ingress default/helloworld"] == nil || objs["Service default/helloworld"] == nil {
+		t.Fatalf("expected service, deployment and ingress, got %#v", objs)
+	}
+	dep := objs["Deployment default/helloworld"]
+	if dep == nil {
+		t.Fatalf("expected deployment, got %#v", objs)
+	}
+	if dep.Source() != filepath.Join(dir, "base", "helloworld.yaml") {
+		t.Errorf("expected deployment to come from the base, got %s", dep.Source())
+	}
+
+	var got map[string]interface{}
+	if err := yaml.Unmarshal(dep.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	var expected map[string]interface{}
+	if err := yaml.Unmarshal([]byte(`apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+  annotations:
+    flux.weave.works/locked: "true"
+spec:
+  replicas: 5
+  template:
+    metadata:
+      labels:
+        name: helloworld
+    spec:
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:master-a000002
+        env:
+        - name: LOG_LEVEL
+          value: warn
+`), &expected); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expected, got)
+	}
+
+	// Not an overlay, so loaded as it is
+	objs, err = (&OverlayManifests{}).LoadManifests(filepath.Join(dir, "base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Errorf("expected two resources from base, got %#v", objs)
+	}
+
+	if _, err := (&OverlayManifests{}).LoadManifests(filepath.Join(dir, "overlays", "loop")); err == nil {
+		t.Errorf("expected error from overlay that is its own base")
+	}
+
+	// An image without a tag is renamed, and still has no tag
+	objs, err = (&OverlayManifests{}).LoadManifests(filepath.Join(dir, "overlays", "mirror"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep = objs["Deployment default/nginx"]
+	if dep == nil {
+		t.Fatalf("expected deployment, got %#v", objs)
+	}
+	got = nil
+	if err := yaml.Unmarshal(dep.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	containers := overlayContainers(map[interface{}]interface{}{"spec": got["spec"]})
+	if len(containers) != 1 || containers[0]["image"] != "registry.example.com/nginx" {
+		t.Errorf("expected the image to be renamed without a tag, got %#v", containers)
+	}
+}
+
+func TestOverlayDefinedServices(t *testing.T) {
+	dir, cleanup := overlaySetup(t)
+	defer cleanup()
+
+	m := &OverlayManifests{}
+	overlay := filepath.Join(dir, "overlays", "production")
+	services, err := m.FindDefinedServices(overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[flux.ServiceID][]string{
+		flux.ServiceID("default/helloworld"): []string{filepath.Join(overlay, "kustomization.yaml")},
+	}
+	if !reflect.DeepEqual(expected, sources(services)) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expected, sources(services))
+	}
+
+	policies, err := m.ServicesWithPolicies(overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPolicies := policy.ServiceMap{
+		flux.ServiceID("default/helloworld"): policy.Set{policy.Locked: "true"},
+	}
+	if !reflect.DeepEqual(expectedPolicies, policies) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expectedPolicies, policies)
+	}
+}
+
+func TestOverlayUpdateDefinition(t *testing.T) {
+	m := &OverlayManifests{}
+	newImage, _ := flux.ParseImageID("quay.io/weaveworks/helloworld:master-a000003")
+	for _, c := range []struct {
+		name, in, out string
+	}{
+		{
+			name: "existing tag",
+			in:   "bases:\n- ../../base\nimages:\n- name: quay.io/weaveworks/helloworld\n  newTag: master-a000002 # current\n",
+			out:  "bases:\n- ../../base\nimages:\n- name: quay.io/weaveworks/helloworld\n  newTag: master-a000003 # current\n",
+		},
+		{
+			name: "entry without tag",
+			in:   "images:\n  - name: quay.io/weaveworks/helloworld\n    newName: quay.io/weaveworks/hello\n",
+			out:  "images:\n  - name: quay.io/weaveworks/helloworld\n    newTag: master-a000003\n    newName: quay.io/weaveworks/hello\n",
+		},
+		{
+			name: "flow entry without tag",
+			in:   "images: [{name: quay.io/weaveworks/helloworld}]\n",
+			out:  "images: [{name: quay.io/weaveworks/helloworld, newTag: master-a000003}]\n",
+		},
+		{
+			name: "other images",
+			in:   "images:\n- name: nginx\n  newTag: \"1.13\"\nbases:\n- ../../base\n",
+			out:  "images:\n- name: nginx\n  newTag: \"1.13\"\n- name: quay.io/weaveworks/helloworld\n  newTag: master-a000003\nbases:\n- ../../base\n",
+		},
+		{
+			name: "other images, flow",
+			in:   "images: [{name: nginx, newTag: \"1.13\"}]\n",
+			out:  "images: [{name: nginx, newTag: \"1.13\"}, {name: quay.io/weaveworks/helloworld, newTag: master-a000003}]\n",
+		},
+		{
+			name: "no images",
+			in:   "bases:\n- ../../base",
+			out:  "bases:\n- ../../base\nimages:\n- name: quay.io/weaveworks/helloworld\n  newTag: master-a000003\n",
+		},
+		{
+			name: "empty images",
+			in:   "images:\nbases:\n- ../../base\n",
+			out:  "images:\n- name: quay.io/weaveworks/helloworld\n  newTag: master-a000003\nbases:\n- ../../base\n",
+		},
+		{
+			name: "resource",
+			in:   "kind: Deployment\nmetadata:\n  name: helloworld\nspec:\n  template:\n    spec:\n      containers:\n      - name: helloworld\n        image: quay.io/weaveworks/helloworld:master-a000001\n",
+			out:  "kind: Deployment\nmetadata:\n  name: helloworld\nspec:\n  template:\n    spec:\n      containers:\n      - name: helloworld\n        image: quay.io/weaveworks/helloworld:master-a000003\n",
+		},
+	} {
+		out, err := m.UpdateDefinition([]byte(c.in), "helloworld", newImage)
+		if err != nil {
+			t.Errorf("[%s] %v", c.name, err)
+		} else if string(out) != c.out {
+			t.Errorf("[%s] expected:\n%s\ngot:\n%s", c.name, c.out, string(out))
+		}
+	}
+}
+
+func TestOverlayUpdatePolicies(t *testing.T) {
+	m := &OverlayManifests{}
+	update := policy.Update{Add: policy.Set{policy.Automated: "true"}}
+	if _, err := m.UpdatePolicies([]byte(overlayFiles["overlays/production/kustomization.yaml"]), update); err == nil {
+		t.Errorf("expected error updating policies in a kustomization")
+	}
+	out, err := m.UpdatePolicies([]byte("kind: Deployment\nmetadata:\n  name: helloworld\n"), update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "kind: Deployment\nmetadata:\n  annotations:\n    flux.weave.works/automated: \"true\"\n  name: helloworld\n"
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, c := range []struct {
+		orig, patch, out string
+	}{
+		{"a: 1\nb: 2", "b: 3\nc: 4", "a: 1\nb: 3\nc: 4"},
+		{"a: 1\nb: 2", "b: null", "a: 1"},
+		{"a: {b: 1, c: 2}", "a: {c: 3}", "a: {b: 1, c: 3}"},
+		{"a: {b: 1, c: 2}", "a: {$patch: replace, c: 3}", "a: {c: 3}"},
+		{"args: [a, b]", "args: [c]", "args: [c]"},
+		{"ports: [{port: 80, name: http}]", "ports: [{port: 80, name: web}, {port: 443}]", "ports: [{port: 80, name: web}, {port: 443}]"},
+		{"volumes: [{name: a}, {name: b}]", "volumes: [{name: a, $patch: delete}]", "volumes: [{name: b}]"},
+	} {
+		var orig, patch, expected interface{}
+		for _, x := range []struct {
+			src string
+			v   *interface{}
+		}{{c.orig, &orig}, {c.patch, &patch}, {c.out, &expected}} {
+			if err := yaml.Unmarshal([]byte(x.src), x.v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := mergePatch("", orig, patch); !reflect.DeepEqual(expected, got) {
+			t.Errorf("patching %q with %q: expected %#v, got %#v", c.orig, c.patch, expected, got)
+		}
+		var unpatched interface{}
+		if err := yaml.Unmarshal([]byte(c.patch), &unpatched); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(unpatched, patch) {
+			t.Errorf("patching %q with %q changed the patch to %#v", c.orig, c.patch, patch)
+		}
+	}
+}
+
+func TestIsKustomization(t *testing.T) {
+	for _, c := range []struct {
+		def      string
+		expected bool
+	}{
+		{"bases:\n- ../../base\n", true},
+		{"images: []\n", true},
+		{"apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n- app.yaml\n", true},
+		{"kind: Deployment\nmetadata:\n  name: helloworld\n", false},
+		{"metadata:\n  name: helloworld\nresources: []\n", false},
+		{"replicas: 3\n", false},
+		{"bases: []\n---\nbases: []\n", false},
+	} {
+		docs, err := parseYAML([]byte(c.def))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isKustomization(docs); got != c.expected {
+			t.Errorf("%q: expected %v, got %v", c.def, c.expected, got)
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package kubernetes
 
 import (
-	"io/ioutil"
-	"regexp"
+	"bytes"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -11,34 +12,58 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/policy"
+	fluxresource "github.com/weaveworks/flux/resource"
 )
 
 func (m *Manifests) UpdatePolicies(in []byte, update policy.Update) ([]byte, error) {
 	tagAll, _ := update.Add.Get(policy.TagAll)
 	return updateAnnotations(in, tagAll, func(a map[string]string) map[string]string {
-		for p, v := range update.Add {
-			if p == policy.TagAll {
-				continue
-			}
-			a[resource.PolicyPrefix+string(p)] = v
-		}
-		for p, _ := range update.Remove {
-			delete(a, resource.PolicyPrefix+string(p))
-		}
-		return a
+		return applyPolicyUpdate(a, update)
 	})
 }
 
+// applyPolicyUpdate changes the annotations given according to the
+// policy update, apart from any `tag_all`, which needs to know about
+// containers.
+func applyPolicyUpdate(a map[string]string, update policy.Update) map[string]string {
+	for p, v := range update.Add {
+		if p == policy.TagAll {
+			continue
+		}
+		a[resource.PolicyPrefix+string(p)] = v
+	}
+	for p, _ := range update.Remove {
+		delete(a, resource.PolicyPrefix+string(p))
+	}
+	return a
+}
+
+// updateAnnotations applies `f` to the annotations of the resource
+// defined in `def`, and writes the result back into the definition,
+// leaving the rest of the definition as it was. If `def` has more
+// than one document in it, the pod controller (or if there isn't
+// one, the first resource) is the one updated.
 func updateAnnotations(def []byte, tagAll string, f func(map[string]string) map[string]string) ([]byte, error) {
-	manifest, err := parseManifest(def)
+	docs, err := parseYAML(def)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "decoding annotations")
+	}
+	doc := policyDocument(docs)
+	metadata := doc.get("metadata")
+	if metadata == nil || metadata.kind != yamlMapping {
+		return nil, errors.New("Could not update resource annotations")
+	}
+
+	annotationsNode := metadata.get("annotations")
+	oldAnnotations := map[string]string{}
+	annotations := map[string]string{}
+	for _, k := range annotationsNode.keys() {
+		oldAnnotations[k] = annotationsNode.get(k).scalar()
+		annotations[k] = oldAnnotations[k]
 	}
-	annotations := manifest.Metadata.AnnotationsOrNil()
 	if tagAll != "" {
-		containers := manifest.Spec.Template.Spec.Containers
-		for _, c := range containers {
-			p := resource.PolicyPrefix + string(policy.TagPrefix(c.Name))
+		for _, c := range podTemplate(doc).path("spec", "containers").items() {
+			p := resource.PolicyPrefix + string(policy.TagPrefix(c.get("name").scalar()))
 			if tagAll != "glob:*" {
 				annotations[p] = tagAll
 			} else {
@@ -48,72 +73,187 @@ func updateAnnotations(def []byte, tagAll string, f func(map[string]string) map[
 	}
 	newAnnotations := f(annotations)
 
-	// Write the new annotations back into the manifest
-	// Generate a fragment of the new annotations.
-	var fragment string
-	if len(newAnnotations) > 0 {
-		fragmentB, err := yaml.Marshal(map[string]map[string]string{
-			"annotations": newAnnotations,
-		})
-		if err != nil {
-			return nil, err
+	// Indent any new block by as much as the metadata is indented
+	step := strings.Repeat(" ", metadata.column-doc.column)
+	if step == "" {
+		step = "  "
+	}
+	editor := newYAMLEditor(def)
+	if err := writeAnnotations(editor, metadata, step, oldAnnotations, newAnnotations); err != nil {
+		return nil, errors.Wrap(err, "updating resource annotations")
+	}
+	return editor.bytes()
+}
+
+// policyDocument picks the document that policies apply to: the pod
+// controller if there is one, or else the first document.
+func policyDocument(docs []*yamlNode) *yamlNode {
+	for _, doc := range docs {
+		if isPodControllerKind(doc.get("kind").scalar()) {
+			return doc
 		}
+	}
+	if len(docs) > 0 {
+		return docs[0]
+	}
+	return nil
+}
 
-		fragment = string(fragmentB)
+// writeAnnotations makes the edits needed to change the annotations
+// in `metadata` from `old` to `new`. Existing annotations are changed
+// in place; new annotations are added in order, if the existing
+// annotations are in order, or otherwise after them. If there's no
+// annotations mapping already, one is added, with its entries
+// indented by `step` more than the key.
+func writeAnnotations(editor *yamlEditor, metadata *yamlNode, step string, old, new map[string]string) error {
+	if len(new) == 0 {
+		if _, v := metadata.entry("annotations"); v != nil {
+			return editor.removeEntry(metadata, "annotations")
+		}
+		return nil
+	}
 
-		// Remove the last newline, so it fits in better
-		fragment = strings.TrimSuffix(fragment, "\n")
+	var added []string
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			added = append(added, k)
+		}
+	}
+	sort.Strings(added)
 
-		// indent the fragment 2 spaces
-		fragment = regexp.MustCompile(`(.+)`).ReplaceAllString(fragment, "  $1")
+	key, annotations := metadata.entry("annotations")
+	annotations = annotations.resolve()
+	switch {
+	case annotations.isEmpty():
+		// There's nowhere to put them yet, so add an `annotations`
+		// mapping, at the top of the metadata
+		if metadata.flow {
+			var entries []string
+			for _, k := range added {
+				entries = append(entries, annotationEntry(k, new[k]))
+			}
+			text := "annotations: {" + strings.Join(entries, ", ") + "}"
+			if key != nil {
+				editor.replace(key.start, annotations.end, text)
+				return nil
+			}
+			if len(metadata.children) > 0 {
+				text += ", "
+			}
+			editor.insert(metadata.start+1, text)
+			return nil
+		}
+		indent := editor.indentation(metadata.start)
+		var lines []string
+		for _, k := range added {
+			lines = append(lines, indent+step+annotationEntry(k, new[k]))
+		}
+		if key != nil {
+			editor.insert(lineEnd(editor.src, key.end), "\n"+strings.Join(lines, "\n"))
+			return nil
+		}
+		editor.insert(lineStart(editor.src, metadata.start), indent+"annotations:\n"+strings.Join(lines, "\n")+"\n")
+		return nil
+
+	case annotations.kind != yamlMapping:
+		return errors.New("annotations are not a mapping")
 
-		// Add a newline if it's not blank
-		if len(fragment) > 0 {
-			fragment = "\n" + fragment
+	case annotations.flow:
+		var entries []string
+		for _, k := range annotations.keys() {
+			if v, ok := new[k]; ok {
+				entries = append(entries, annotationEntry(k, v))
+			}
+		}
+		for _, k := range added {
+			entries = append(entries, annotationEntry(k, new[k]))
 		}
+		editor.replace(annotations.start, annotations.end, "{"+strings.Join(entries, ", ")+"}")
+		return nil
 	}
 
-	// Find where to insert the fragment.
-	// TODO: This should handle potentially different indentation.
-	// TODO: There's probably a more elegant regex-ey way to do this in one pass.
-	replaced := false
-	annotationsRE := regexp.MustCompile(`(?m:\n  annotations:\s*(?:#.*)*(?:\n    .*)*$)`)
-	newDef := annotationsRE.ReplaceAllStringFunc(string(def), func(found string) string {
-		if !replaced {
-			replaced = true
-			return fragment
+	// A block mapping. Work out where new entries go, before removing
+	// any entries, so that the edits come out in the right order.
+	var remaining []string
+	for _, k := range annotations.keys() {
+		if _, ok := new[k]; ok {
+			remaining = append(remaining, k)
 		}
-		return found
-	})
-	if !replaced {
-		metadataRE := multilineRE(`(metadata:\s*(?:#.*)*)`)
-		newDef = metadataRE.ReplaceAllStringFunc(string(def), func(found string) string {
-			if !replaced {
-				replaced = true
-				f := found + fragment
-				return f
+	}
+	inOrder := sort.StringsAreSorted(remaining)
+	indent := editor.indentation(annotations.start)
+	for _, k := range added {
+		at := -1
+		if inOrder {
+			for _, r := range remaining {
+				if r > k {
+					entryKey, _ := annotations.entry(r)
+					at = lineStart(editor.src, entryKey.start)
+					break
+				}
 			}
-			return found
-		})
+		}
+		text := indent + annotationEntry(k, new[k]) + "\n"
+		if at < 0 {
+			if len(remaining) == 0 {
+				at = lineStart(editor.src, annotations.start)
+			} else {
+				_, last := annotations.entry(remaining[len(remaining)-1])
+				at = nextLine(editor.src, last.end)
+				if at == len(editor.src) && !bytes.HasSuffix(editor.src, []byte("\n")) {
+					text = "\n" + strings.TrimSuffix(text, "\n")
+				}
+			}
+		}
+		editor.insert(at, text)
 	}
-	if !replaced {
-		return nil, errors.New("Could not update resource annotations")
+	for _, k := range annotations.keys() {
+		v, ok := new[k]
+		if !ok {
+			if err := editor.removeEntry(annotations, k); err != nil {
+				return err
+			}
+			continue
+		}
+		editor.setScalar(annotations.get(k), v)
 	}
+	return nil
+}
 
-	return []byte(newDef), err
+// annotationEntry renders an annotation as a mapping entry. Values
+// are always quoted, since annotation values must be strings.
+func annotationEntry(k, v string) string {
+	return quoteIfNeeded(k, true) + ": " + strconv.Quote(v)
 }
 
 type Manifest struct {
 	Metadata Metadata `yaml:"metadata"`
 	Spec     struct {
-		Template struct {
+		Template    PodTemplate `yaml:"template"`
+		JobTemplate struct {
 			Spec struct {
-				Containers []Container `yaml:"containers"`
+				Template PodTemplate `yaml:"template"`
 			} `yaml:"spec"`
-		} `yaml:"template"`
+		} `yaml:"jobTemplate"`
 	} `yaml:"spec"`
 }
 
+type PodTemplate struct {
+	Spec struct {
+		Containers []Container `yaml:"containers"`
+	} `yaml:"spec"`
+}
+
+// Containers returns the containers in the pod template of the
+// manifest. CronJobs keep their pod template in the job template;
+// everything else has it directly under the spec.
+func (m Manifest) Containers() []Container {
+	if cs := m.Spec.Template.Spec.Containers; len(cs) > 0 {
+		return cs
+	}
+	return m.Spec.JobTemplate.Spec.Template.Spec.Containers
+}
+
 func (m Metadata) AnnotationsOrNil() map[string]string {
 	if m.Annotations == nil {
 		return map[string]string{}
@@ -160,17 +300,13 @@ func (m *Manifests) ServicesWithPolicies(root string) (policy.ServiceMap, error)
 	return result, nil
 }
 
-func iterateManifests(services map[flux.ServiceID][]string, f func(flux.ServiceID, Manifest) error) error {
-	for serviceID, paths := range services {
-		if len(paths) != 1 {
+func iterateManifests(services map[flux.ServiceID][]fluxresource.Resource, f func(flux.ServiceID, Manifest) error) error {
+	for serviceID, resources := range services {
+		if len(resources) != 1 {
 			continue
 		}
 
-		def, err := ioutil.ReadFile(paths[0])
-		if err != nil {
-			return err
-		}
-		manifest, err := parseManifest(def)
+		manifest, err := parseManifest(resources[0].Bytes())
 		if err != nil {
 			return err
 		}
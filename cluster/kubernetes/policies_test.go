@@ -137,3 +137,69 @@ func templToString(t *testing.T, templ *template.Template, data interface{}) str
 	}
 	return out.String()
 }
+
+func TestUpdatePoliciesFormats(t *testing.T) {
+	automate := policy.Update{Add: policy.Set{policy.Automated: "true"}}
+	deautomate := policy.Update{Remove: policy.Set{policy.Automated: "true"}}
+	for _, c := range []struct {
+		name    string
+		in, out string
+		update  policy.Update
+	}{
+		{
+			name:   "flow metadata",
+			in:     "kind: Deployment\nmetadata: {name: nginx} # comment\n",
+			out:    "kind: Deployment\nmetadata: {annotations: {flux.weave.works/automated: \"true\"}, name: nginx} # comment\n",
+			update: automate,
+		},
+		{
+			name:   "flow annotations",
+			in:     "kind: Deployment\nmetadata:\n  name: nginx\n  annotations: {a.b/c: \"d\", flux.weave.works/automated: \"true\"}\n",
+			out:    "kind: Deployment\nmetadata:\n  name: nginx\n  annotations: {a.b/c: \"d\"}\n",
+			update: deautomate,
+		},
+		{
+			name:   "wider indentation",
+			in:     "kind: Deployment\nmetadata:\n    name: nginx\n",
+			out:    "kind: Deployment\nmetadata:\n    annotations:\n        flux.weave.works/automated: \"true\"\n    name: nginx\n",
+			update: automate,
+		},
+		{
+			name:   "empty annotations",
+			in:     "kind: Deployment\nmetadata:\n  annotations: # none yet\n  name: nginx\n",
+			out:    "kind: Deployment\nmetadata:\n  annotations: # none yet\n    flux.weave.works/automated: \"true\"\n  name: nginx\n",
+			update: automate,
+		},
+		{
+			name:   "comments in annotations",
+			in:     "kind: Deployment\nmetadata:\n  annotations:\n    # about z\n    z.io/z: \"1\" # one\n    a.io/a: \"2\"\n  name: nginx\n",
+			out:    "kind: Deployment\nmetadata:\n  annotations:\n    # about z\n    z.io/z: \"1\" # one\n    a.io/a: \"2\"\n    flux.weave.works/automated: \"true\"\n  name: nginx\n",
+			update: automate,
+		},
+		{
+			name:   "change value in place",
+			in:     "kind: Deployment\nmetadata:\n  annotations:\n    flux.weave.works/tag.nginx: 'glob:1.*' # pinned\n  name: nginx\n",
+			out:    "kind: Deployment\nmetadata:\n  annotations:\n    flux.weave.works/tag.nginx: 'semver:~1.13' # pinned\n  name: nginx\n",
+			update: policy.Update{Add: policy.Set{policy.TagPrefix("nginx"): "semver:~1.13"}},
+		},
+		{
+			name:   "not a pod controller",
+			in:     "kind: Service\nmetadata:\n  name: nginx\n",
+			out:    "kind: Service\nmetadata:\n  annotations:\n    flux.weave.works/automated: \"true\"\n  name: nginx\n",
+			update: automate,
+		},
+		{
+			name:   "multiple documents",
+			in:     "kind: Service\nmetadata:\n  name: nginx\n---\nkind: Deployment\nmetadata:\n  name: nginx\n",
+			out:    "kind: Service\nmetadata:\n  name: nginx\n---\nkind: Deployment\nmetadata:\n  annotations:\n    flux.weave.works/automated: \"true\"\n  name: nginx\n",
+			update: automate,
+		},
+	} {
+		out, err := (&Manifests{}).UpdatePolicies([]byte(c.in), c.update)
+		if err != nil {
+			t.Errorf("[%s] %v", c.name, err)
+		} else if string(out) != c.out {
+			t.Errorf("[%s] Did not get expected result:\n\n%s\n\nInstead got:\n\n%s", c.name, c.out, string(out))
+		}
+	}
+}
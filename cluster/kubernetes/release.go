@@ -81,3 +81,17 @@ func (c *Kubectl) Delete(logger log.Logger, obj *apiObject) error {
 func (c *Kubectl) Apply(logger log.Logger, obj *apiObject) error {
 	return c.doCommand(logger, obj.bytes, "--namespace", obj.namespaceOrDefault(), "apply", "-f", "-")
 }
+
+// ApplyBatch applies several definitions, all in the same namespace,
+// with a single invocation of kubectl.
+func (c *Kubectl) ApplyBatch(logger log.Logger, objs []*apiObject) error {
+	buf := &bytes.Buffer{}
+	for _, obj := range objs {
+		buf.WriteString("---\n")
+		buf.Write(obj.bytes)
+		if !bytes.HasSuffix(obj.bytes, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+	}
+	return c.doCommand(logger, buf.Bytes(), "--namespace", objs[0].namespaceOrDefault(), "apply", "-f", "-")
+}
@@ -0,0 +1,24 @@
+package resource
+
+import (
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/resource"
+)
+
+type CronJob struct {
+	baseObject
+	Spec CronJobSpec
+}
+
+func (o CronJob) ServiceIDs(all map[string]resource.Resource) []flux.ServiceID {
+	return o.Spec.JobTemplate.Spec.Template.serviceIDs(o.Meta.Namespace, all)
+}
+
+type CronJobSpec struct {
+	Schedule    string
+	JobTemplate struct {
+		Spec struct {
+			Template PodTemplate
+		}
+	} `yaml:"jobTemplate"`
+}
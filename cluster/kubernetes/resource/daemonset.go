@@ -0,0 +1,19 @@
+package resource
+
+import (
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/resource"
+)
+
+type DaemonSet struct {
+	baseObject
+	Spec DaemonSetSpec
+}
+
+func (o DaemonSet) ServiceIDs(all map[string]resource.Resource) []flux.ServiceID {
+	return o.Spec.Template.serviceIDs(o.Meta.Namespace, all)
+}
+
+type DaemonSetSpec struct {
+	Template PodTemplate
+}
@@ -1,8 +1,6 @@
 package resource
 
 import (
-	"k8s.io/client-go/1.5/pkg/labels"
-
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/resource"
 )
@@ -13,16 +11,7 @@ type Deployment struct {
 }
 
 func (o Deployment) ServiceIDs(all map[string]resource.Resource) []flux.ServiceID {
-	found := flux.ServiceIDSet{}
-	// Look through all for any matching services
-	for _, r := range all {
-		s, ok := r.(*Service)
-		if ok && s.Meta.Namespace == o.Meta.Namespace && s.Matches(labels.Set(o.Spec.Template.Metadata.Labels)) {
-			found.Add(s.ServiceIDs(all))
-		}
-	}
-
-	return found.ToSlice()
+	return o.Spec.Template.serviceIDs(o.Meta.Namespace, all)
 }
 
 type DeploymentSpec struct {
@@ -51,12 +51,25 @@ func Load(roots ...string) (map[string]resource.Resource, error) {
 func ParseMultidoc(multidoc []byte, source string) (map[string]resource.Resource, error) {
 	objs := map[string]resource.Resource{}
 	chunks := bufio.NewScanner(bytes.NewReader(multidoc))
-	chunks.Split(splitYAMLDocument)
+	// Keep track of where each document starts, so that its
+	// definition can be replaced in place later.
+	var start, next int
+	chunks.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := splitYAMLDocument(data, atEOF)
+		if token != nil {
+			start = next
+		}
+		next += advance
+		return advance, token, err
+	})
 
 	for chunks.Scan() {
-		if obj, err := unmarshalObject(source, chunks.Bytes()); err != nil {
+		// The scanner may reuse its buffer for the next document, so
+		// take a copy of this one for the resource to keep.
+		chunk := append([]byte(nil), chunks.Bytes()...)
+		if obj, err := unmarshalObject(source, start, chunk); err != nil {
 			return nil, fmt.Errorf(`parsing YAML doc from "%s": %s`, source, err.Error())
-		} else {
+		} else if obj != nil {
 			objs[obj.ResourceID()] = obj
 		}
 	}
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
 	"github.com/weaveworks/flux/resource"
 )
@@ -28,6 +29,24 @@ func TestParseEmpty(t *testing.T) {
 	}
 }
 
+func TestParseEmptyDocuments(t *testing.T) {
+	docs := `---
+# Source: chart/templates/empty.yaml
+---
+kind: Service
+metadata:
+  name: a-service
+---
+`
+	objs, err := ParseMultidoc([]byte(docs), "test")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(objs) != 1 {
+		t.Errorf("expected only the service; got %#v", objs)
+	}
+}
+
 func TestParseSome(t *testing.T) {
 	docs := `---
 kind: Service
@@ -59,6 +78,41 @@ metadata:
 	}
 }
 
+// Each resource records where its definition starts, so it can be
+// found again even if the same text appears more than once.
+func TestParseOffsets(t *testing.T) {
+	docs := `---
+kind: Service
+metadata:
+  name: a-service
+---
+kind: Service
+metadata:
+  name: a-service
+  namespace: other
+---
+kind: Deployment
+metadata:
+  name: a-deployment
+`
+	objs, err := ParseMultidoc([]byte(docs), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 3 {
+		t.Fatalf("expected three resources, got %#v", objs)
+	}
+	for id, obj := range objs {
+		offset, def := obj.Offset(), obj.Bytes()
+		if offset < 0 || offset+len(def) > len(docs) || docs[offset:offset+len(def)] != string(def) {
+			t.Errorf("%s: definition not found at offset %d", id, offset)
+		}
+	}
+	if objs["Service default/a-service"].Offset() != 0 {
+		t.Errorf("expected the first service to start at the beginning")
+	}
+}
+
 func debyte(r resource.Resource) resource.Resource {
 	if res, ok := r.(interface {
 		debyte()
@@ -83,3 +137,63 @@ func TestLoadSome(t *testing.T) {
 		t.Errorf("expected %d objects from %d files, got result:\n%#v", len(testfiles.Files), len(testfiles.Files), objs)
 	}
 }
+
+func TestPodControllerServiceIDs(t *testing.T) {
+	docs := `---
+kind: Service
+metadata:
+  name: web
+spec:
+  selector:
+    name: web
+---
+kind: DaemonSet
+metadata:
+  name: web-ds
+spec:
+  template:
+    metadata:
+      labels:
+        name: web
+---
+kind: StatefulSet
+metadata:
+  name: web-sts
+spec:
+  template:
+    metadata:
+      labels:
+        name: web
+---
+kind: CronJob
+metadata:
+  name: web-cj
+spec:
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          labels:
+            name: web
+`
+	objs, err := ParseMultidoc([]byte(docs), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{
+		"DaemonSet default/web-ds",
+		"StatefulSet default/web-sts",
+		"CronJob default/web-cj",
+	} {
+		obj, ok := objs[id]
+		if !ok {
+			t.Errorf("expected to find %s", id)
+			continue
+		}
+		sids := obj.ServiceIDs(objs)
+		if len(sids) != 1 || sids[0] != flux.ServiceID("default/web") {
+			t.Errorf("%s: expected service IDs [default/web], got %v", id, sids)
+		}
+	}
+}
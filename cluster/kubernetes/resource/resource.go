@@ -20,6 +20,7 @@ const (
 // struct to embed in objects, to provide default implementation
 type baseObject struct {
 	source string
+	offset int
 	bytes  []byte
 	Kind   string `yaml:"kind"`
 	Meta   struct {
@@ -38,8 +39,9 @@ func (o baseObject) ResourceID() string {
 }
 
 // It's useful for comparisons in tests to be able to remove the
-// record of bytes
+// record of bytes (and where they were)
 func (o *baseObject) debyte() {
+	o.offset = 0
 	o.bytes = nil
 }
 
@@ -62,15 +64,24 @@ func (o baseObject) Source() string {
 	return o.source
 }
 
+func (o baseObject) Offset() int {
+	return o.offset
+}
+
 func (o baseObject) Bytes() []byte {
 	return o.bytes
 }
 
-func unmarshalObject(source string, bytes []byte) (resource.Resource, error) {
-	var base = baseObject{source: source, bytes: bytes}
+func unmarshalObject(source string, offset int, bytes []byte) (resource.Resource, error) {
+	var base = baseObject{source: source, offset: offset, bytes: bytes}
 	if err := yaml.Unmarshal(bytes, &base); err != nil {
 		return nil, err
 	}
+	// A document with nothing in it (e.g., only comments, as
+	// templating can leave behind) doesn't define a resource
+	if base.Kind == "" && base.Meta.Name == "" {
+		return nil, nil
+	}
 
 	switch base.Kind {
 	case "Deployment":
@@ -79,6 +90,24 @@ func unmarshalObject(source string, bytes []byte) (resource.Resource, error) {
 			return nil, err
 		}
 		return &dep, nil
+	case "DaemonSet":
+		var ds = DaemonSet{baseObject: base}
+		if err := yaml.Unmarshal(bytes, &ds); err != nil {
+			return nil, err
+		}
+		return &ds, nil
+	case "StatefulSet":
+		var ss = StatefulSet{baseObject: base}
+		if err := yaml.Unmarshal(bytes, &ss); err != nil {
+			return nil, err
+		}
+		return &ss, nil
+	case "CronJob":
+		var cj = CronJob{baseObject: base}
+		if err := yaml.Unmarshal(bytes, &cj); err != nil {
+			return nil, err
+		}
+		return &cj, nil
 	case "Service":
 		var svc = Service{baseObject: base}
 		if err := yaml.Unmarshal(bytes, &svc); err != nil {
@@ -1,5 +1,12 @@
 package resource
 
+import (
+	"k8s.io/client-go/1.5/pkg/labels"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/resource"
+)
+
 // Types that daemonsets, deployments, and other things have in
 // common.
 
@@ -13,6 +20,19 @@ type PodTemplate struct {
 	Spec     PodSpec
 }
 
+// serviceIDs finds the services in the given namespace that select
+// pods made from this template.
+func (t PodTemplate) serviceIDs(namespace string, all map[string]resource.Resource) []flux.ServiceID {
+	found := flux.ServiceIDSet{}
+	for _, r := range all {
+		s, ok := r.(*Service)
+		if ok && s.Meta.Namespace == namespace && s.Matches(labels.Set(t.Metadata.Labels)) {
+			found.Add(s.ServiceIDs(all))
+		}
+	}
+	return found.ToSlice()
+}
+
 type PodSpec struct {
 	ImagePullSecrets []struct{ Name string }
 	Volumes          []Volume
@@ -0,0 +1,21 @@
+package resource
+
+import (
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/resource"
+)
+
+type StatefulSet struct {
+	baseObject
+	Spec StatefulSetSpec
+}
+
+func (o StatefulSet) ServiceIDs(all map[string]resource.Resource) []flux.ServiceID {
+	return o.Spec.Template.serviceIDs(o.Meta.Namespace, all)
+}
+
+type StatefulSetSpec struct {
+	Replicas    int
+	ServiceName string `yaml:"serviceName"`
+	Template    PodTemplate
+}
@@ -0,0 +1,177 @@
+package kubernetes
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/cluster"
+)
+
+// When syncing, resources are applied in stages, so that each is
+// applied after the resources it is likely to depend on: namespaces
+// before anything that goes in them, configuration before the
+// workloads that mount or refer to it, and workloads before the
+// services and ingresses that route to them. Kinds not mentioned
+// (e.g., RBAC roles, volume claims) go in their own stage, between
+// configuration and workloads.
+type stage struct {
+	name  string
+	kinds []string
+}
+
+var stages = []stage{
+	{"namespaces", []string{"Namespace"}},
+	{"config", []string{"ConfigMap", "Secret", "ServiceAccount"}},
+	{"other", nil},
+	{"workloads", []string{"Deployment", "DaemonSet", "StatefulSet", "CronJob", "Job", "ReplicaSet", "ReplicationController", "Pod"}},
+	{"services", []string{"Service", "Ingress"}},
+}
+
+// The stage that kinds not listed in any stage go in.
+const otherStage = 2
+
+// The most resources that will be given to an applier in one go.
+const syncBatchSize = 20
+
+func stageFor(kind string) int {
+	for i, s := range stages {
+		for _, k := range s.kinds {
+			if k == kind {
+				return i
+			}
+		}
+	}
+	return otherStage
+}
+
+// BatchApplier is implemented by appliers that can apply several
+// resources (in the same namespace) at once, which is usually
+// quicker than applying them one by one.
+type BatchApplier interface {
+	ApplyBatch(logger log.Logger, defs []*apiObject) error
+}
+
+type stagedObject struct {
+	id  string
+	obj *apiObject
+}
+
+// stageActions sorts the deletions and applications in the actions
+// given into stages, keeping their relative order within each
+// stage. Any definitions that can't be parsed are recorded in
+// `errs`; and if an action's deletion can't be parsed, nor is its
+// application attempted.
+func stageActions(actions []cluster.SyncAction, errs cluster.SyncError) (deletes, applies [][]stagedObject) {
+	deletes = make([][]stagedObject, len(stages))
+	applies = make([][]stagedObject, len(stages))
+	for _, action := range actions {
+		if len(action.Delete) > 0 {
+			obj, err := definitionObj(action.Delete)
+			if err != nil {
+				errs[action.ResourceID] = err
+				continue
+			}
+			i := stageFor(obj.Kind)
+			deletes[i] = append(deletes[i], stagedObject{action.ResourceID, obj})
+		}
+		if len(action.Apply) > 0 {
+			obj, err := definitionObj(action.Apply)
+			if err != nil {
+				errs[action.ResourceID] = err
+				continue
+			}
+			i := stageFor(obj.Kind)
+			applies[i] = append(applies[i], stagedObject{action.ResourceID, obj})
+		}
+	}
+	return deletes, applies
+}
+
+// deleteStage deletes each of the objects given, recording any
+// failures in `errs`.
+func (c *Cluster) deleteStage(logger log.Logger, s stage, objs []stagedObject, errs cluster.SyncError) {
+	if len(objs) == 0 {
+		return
+	}
+	logger = log.NewContext(logger).With("stage", s.name)
+	failed := 0
+	for _, o := range objs {
+		if err := c.applier.Delete(log.NewContext(logger).With("resource", o.id), o.obj); err != nil {
+			logger.Log("resource", o.id, "err", err)
+			errs[o.id] = errors.Wrapf(err, "deleting in stage %s", s.name)
+			failed++
+		}
+	}
+	logger.Log("deleted", len(objs)-failed, "failed", failed)
+}
+
+// applyStage applies the objects given, skipping any that already
+// have an error recorded (i.e., because they could not be
+// deleted). If the applier can apply in batches, objects are applied
+// a namespace-full (up to syncBatchSize) at a time; a batch that
+// fails is retried one object at a time, so that errors are
+// attributed to the right resources.
+func (c *Cluster) applyStage(logger log.Logger, s stage, objs []stagedObject, errs cluster.SyncError) {
+	var todo []stagedObject
+	for _, o := range objs {
+		if _, failed := errs[o.id]; !failed {
+			todo = append(todo, o)
+		}
+	}
+	if len(todo) == 0 {
+		return
+	}
+	logger = log.NewContext(logger).With("stage", s.name)
+
+	failed := 0
+	applyEach := func(batch []stagedObject) {
+		for _, o := range batch {
+			if err := c.applier.Apply(log.NewContext(logger).With("resource", o.id), o.obj); err != nil {
+				logger.Log("resource", o.id, "err", err)
+				errs[o.id] = errors.Wrapf(err, "applying in stage %s", s.name)
+				failed++
+			}
+		}
+	}
+
+	batcher, ok := c.applier.(BatchApplier)
+	for _, batch := range batches(todo) {
+		if !ok || len(batch) == 1 {
+			applyEach(batch)
+			continue
+		}
+		defs := make([]*apiObject, len(batch))
+		for i, o := range batch {
+			defs[i] = o.obj
+		}
+		if err := batcher.ApplyBatch(logger, defs); err != nil {
+			applyEach(batch)
+		}
+	}
+	logger.Log("applied", len(todo)-failed, "failed", failed)
+}
+
+// batches groups objects by namespace, in order of first appearance,
+// and splits each group into batches of at most syncBatchSize.
+func batches(objs []stagedObject) [][]stagedObject {
+	var namespaces []string
+	byNamespace := map[string][]stagedObject{}
+	for _, o := range objs {
+		ns := o.obj.namespaceOrDefault()
+		if _, ok := byNamespace[ns]; !ok {
+			namespaces = append(namespaces, ns)
+		}
+		byNamespace[ns] = append(byNamespace[ns], o)
+	}
+
+	var res [][]stagedObject
+	for _, ns := range namespaces {
+		group := byNamespace[ns]
+		for len(group) > syncBatchSize {
+			res = append(res, group[:syncBatchSize])
+			group = group[syncBatchSize:]
+		}
+		res = append(res, group)
+	}
+	return res
+}
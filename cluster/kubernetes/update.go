@@ -4,33 +4,38 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"regexp"
-	"strings"
 
 	"github.com/weaveworks/flux"
 )
 
-// updatePodController takes the body of a ReplicationController or Deployment
-// resource definition (specified in YAML) and the name of the new image that
-// should be put in the definition (in the format "repo.org/group/name:tag"). It
-// returns a new resource definition body where all references to the old image
-// have been replaced with the new one.
-//
-// This function has many additional requirements that are likely in flux. Read
-// the source to learn about them.
+// updatePodController takes a file of resource definitions (specified
+// in YAML), the name of a container, and the image that container
+// should now use (in the format "repo.org/group/name:tag"). It
+// returns a new file in which that container's image has been
+// replaced in each pod controller (Deployment, DaemonSet, StatefulSet
+// or CronJob) that has it.
 func updatePodController(def []byte, container string, newImageID flux.ImageID) ([]byte, error) {
 	// Sanity check
-	obj, err := definitionObj(def)
+	docs, err := parseYAML(def)
 	if err != nil {
 		return nil, err
 	}
-	switch obj.Kind {
-	case "ReplicationController":
-		return nil, ErrReplicationControllersDeprecated
-	case "Deployment":
-		break
-	default:
-		return nil, UpdateNotSupportedError(obj.Kind)
+	var kinds []string
+	for _, doc := range docs {
+		kind := doc.get("kind").scalar()
+		if isPodControllerKind(kind) {
+			kinds = nil
+			break
+		}
+		kinds = append(kinds, kind)
+	}
+	for _, kind := range kinds {
+		if kind == "ReplicationController" {
+			return nil, ErrReplicationControllersDeprecated
+		}
+	}
+	if len(kinds) > 0 {
+		return nil, UpdateNotSupportedError(kinds[0])
 	}
 
 	var buf bytes.Buffer
@@ -38,169 +43,132 @@ func updatePodController(def []byte, container string, newImageID flux.ImageID)
 	return buf.Bytes(), err
 }
 
-// Attempt to update an RC or Deployment config. This makes several assumptions
-// that are justified only with the phrase "because that's how we do it",
-// including:
+func isPodControllerKind(kind string) bool {
+	switch kind {
+	case "Deployment", "DaemonSet", "StatefulSet", "CronJob":
+		return true
+	}
+	return false
+}
+
+// tryUpdate replaces the image of each container with the name given
+// (including init containers), in each pod controller in the file,
+// so long as the container's current image is from the same
+// repository as the new image. It's an error if there are no such
+// containers.
+//
+// Only the image values are changed; everything else in the file --
+// comments, indentation, quoting, other documents -- is left as it
+// was. The file can be in any YAML style: block or flow collections,
+// with anchors and aliases, and so on. If an image is given via an
+// alias, the anchored value is changed.
+//
+// Some people label pods with the version of the image they run, for
+// example:
 //
-//  * the file is a replication controller or deployment
-//  * the update is from one tag of an image to another tag of the
-//    same image; e.g., "weaveworks/helloworld:a00001" to
-//    "weaveworks/helloworld:a00002"
-//  * the container spec to update is the (first) one that uses the
-//    same image name (e.g., weaveworks/helloworld)
-//  * the name of the controller is updated to reflect the new tag
-//  * there's a label which must be updated in both the pod spec and the selector
-//  * the file uses canonical YAML syntax, that is, one line per item
-//  * ... other assumptions as encoded in the regular expressions used
+//	spec:
+//	  selector:                 # )
+//	    name: helloworld        # ) `selector` or `selector.matchLabels`
+//	    version: master-a000001 # )
+//	  template:
+//	    metadata:
+//	      labels:                   # )
+//	        name: helloworld        # ) the labels in the pod template
+//	        version: master-a000001 # )
+//	    spec:
+//	      containers:
+//	      - name: helloworld
+//	        image: quay.io/weaveworks/helloworld:master-a000001
 //
-// Here's an example of the assumed structure:
+// so a `version` label in either of those places is also updated,
+// if it has the old image tag as its value.
 //
-// ```
-// apiVersion: v1
-// kind: ReplicationController # not presently checked
-// metadata:                         # )
-//   ...                             # ) any number of equally-indented lines
-//   name: helloworld-master-a000001 # ) can precede the name
-// spec:
-//   replicas: 2
-//   selector:                 # )
-//     name: helloworld        # ) this use of labels is assumed
-//     version: master-a000001 # )
-//   template:
-//     metadata:
-//       labels:                   # )
-//         name: helloworld        # ) this structure is assumed, as for the selector
-//         version: master-a000001 # )
-//     spec:
-//       containers:
-//       # extra container specs are allowed here ...
-//       - name: helloworld                                    # )
-//         image: quay.io/weaveworks/helloworld:master-a000001 # ) these must be together
-//         args:
-//         - -msg=Ahoy
-//         ports:
-//         - containerPort: 80
-// ```
+// The name of the controller is left alone, even if it ends with the
+// old image tag. Renaming was only ever wanted for
+// ReplicationControllers, which aren't updated any more (see
+// ErrReplicationControllersDeprecated); renaming a Deployment would
+// make Kubernetes create a new one, rather than update it.
 func tryUpdate(def []byte, container string, newImage flux.ImageID, out io.Writer) error {
-	manifest, err := parseManifest(def)
+	docs, err := parseYAML(def)
 	if err != nil {
 		return err
 	}
-	if manifest.Metadata.Name == "" {
-		return fmt.Errorf("could not find resource name")
-	}
 
-	// Check if any containers need updating. As we go through, we calculate the
-	// new manifest name, in case it includes the image tag (as in replication
-	// controllers).
-	newDefName := manifest.Metadata.Name
-	matchingContainers := map[int]Container{}
-	for i, c := range manifest.Spec.Template.Spec.Containers {
-		if c.Name != container {
+	editor := newYAMLEditor(def)
+	found := false
+	for _, doc := range docs {
+		if !isPodControllerKind(doc.get("kind").scalar()) {
 			continue
 		}
-		currentImage, err := flux.ParseImageID(c.Image)
+		updated, err := updateContainers(editor, doc, container, newImage)
 		if err != nil {
-			return fmt.Errorf("could not parse image %s", c.Image)
-		}
-		if currentImage.Repository() == newImage.Repository() {
-			matchingContainers[i] = c
-		}
-		_, _, oldImageTag := currentImage.Components()
-		if strings.HasSuffix(manifest.Metadata.Name, oldImageTag) {
-			newDefName = manifest.Metadata.Name[:len(manifest.Metadata.Name)-len(oldImageTag)] + newImage.Tag
+			return err
 		}
+		found = found || updated
 	}
-
-	// Some values (most likely the version) will be interpreted as a
-	// number if unquoted; while, on the other hand, it is apparently
-	// not OK to quote things that don't look like numbers. So: we
-	// extract values *without* quotes, and add them if necessary.
-	newDefName = maybeQuote(newDefName)
-
-	if len(matchingContainers) == 0 {
+	if !found {
 		return fmt.Errorf("could not find container using image: %s", newImage.Repository())
 	}
 
-	// Detect how indented the "containers" block is.
-	newDef := string(def)
-	matches := regexp.MustCompile(`( +)containers:.*`).FindStringSubmatch(newDef)
-	if len(matches) != 2 {
-		return fmt.Errorf("could not find container specs")
+	newDef, err := editor.bytes()
+	if err != nil {
+		return err
 	}
-	indent := matches[1]
-
-	// Replace the container images
-	// Parse out all the container blocks
-	containersRE := regexp.MustCompile(`(?m:^` + indent + `containers:\s*(?:#.*)*$(?:\n(?:` + indent + `[-\s#].*)?)*)`)
-	// Parse out an individual container blog
-	containerRE := regexp.MustCompile(`(?m:` + indent + `-.*(?:\n(?:` + indent + `\s+.*)?)*)`)
-	// Parse out the image ID
-	imageRE := regexp.MustCompile(`(` + indent + `[-\s]\s*"?image"?:\s*)"?(?:[\w\.\-/:]+\s*?)*"?([\t\f #]+.*)?`)
-	imageReplacement := fmt.Sprintf("${1}%s${2}", maybeQuote(newImage.String()))
-	// Find the block of container specs
-	newDef = containersRE.ReplaceAllStringFunc(newDef, func(containers string) string {
-		i := 0
-		// Find each container spec
-		return containerRE.ReplaceAllStringFunc(containers, func(spec string) string {
-			if _, ok := matchingContainers[i]; ok {
-				// container matches, let's replace the image
-				spec = imageRE.ReplaceAllString(spec, imageReplacement)
-				delete(matchingContainers, i)
-			}
-			i++
-			return spec
-		})
-	})
+	_, err = out.Write(newDef)
+	return err
+}
 
-	if len(matchingContainers) > 0 {
-		missed := []string{}
-		for _, c := range matchingContainers {
-			missed = append(missed, c.Name)
-		}
-		return fmt.Errorf("did not update expected containers: %s", strings.Join(missed, ", "))
+// updateContainers updates the image of the named container in a
+// single pod controller, and reports whether there was such a
+// container.
+func updateContainers(editor *yamlEditor, doc *yamlNode, container string, newImage flux.ImageID) (bool, error) {
+	if doc.path("metadata", "name").scalar() == "" {
+		return false, fmt.Errorf("could not find resource name")
+	}
+	template := podTemplate(doc)
+	labels := []*yamlNode{
+		doc.path("spec", "selector"),
+		doc.path("spec", "selector", "matchLabels"),
+		template.path("metadata", "labels"),
 	}
 
-	// The name we want is that under `metadata:`, which will *probably* be the first one
-	replacedName := false
-	replaceRCNameRE := regexp.MustCompile(`(\s+"?name"?:\s*)"?(?:[\w\.\-/:]+\s*?)"?([\t\f #]+.*)`)
-	replaceRCNameRE.ReplaceAllStringFunc(newDef, func(found string) string {
-		if replacedName {
-			return found
+	found := false
+	for _, c := range append(template.path("spec", "initContainers").items(), template.path("spec", "containers").items()...) {
+		if c.get("name").scalar() != container {
+			continue
 		}
-		replacedName = true
-		return replaceRCNameRE.ReplaceAllString(found, fmt.Sprintf(`${1}%s${2}`, newDefName))
-	})
-
-	// Replacing labels: these are in two places, the container template and the selector
-	// TODO: This doesn't handle # comments
-	// TODO: This encodes an expectation of map keys being ordered (i.e. name *then* version)
-	// TODO: This assumes that these are indented by exactly 2 spaces (which may not be true)
-	replaceLabelsRE := multilineRE(
-		`((?:  selector|      labels):.*)`,
-		`((?:  ){2,4}name:.*)`,
-		`((?:  ){2,4}version:\s*) (?:"?[-\w]+"?)(\s.*)`,
-	)
-	replaceLabels := fmt.Sprintf("$1\n$2\n$3 %s$4", maybeQuote(newImage.Tag))
-	newDef = replaceLabelsRE.ReplaceAllString(newDef, replaceLabels)
-
-	fmt.Fprint(out, newDef)
-	return nil
-}
+		image := c.get("image")
+		if image == nil {
+			continue
+		}
+		currentImage, err := flux.ParseImageID(image.scalar())
+		if err != nil {
+			return false, fmt.Errorf("could not parse image %s", image.scalar())
+		}
+		if currentImage.Repository() != newImage.Repository() {
+			continue
+		}
+		editor.setScalar(image, newImage.String())
+		found = true
 
-func multilineRE(lines ...string) *regexp.Regexp {
-	return regexp.MustCompile(`(?m:^` + strings.Join(lines, "\n") + `$)`)
+		if currentImage.Tag == "" {
+			continue
+		}
+		for _, l := range labels {
+			if version := l.get("version"); version != nil && version.scalar() == currentImage.Tag {
+				editor.setScalar(version, newImage.Tag)
+			}
+		}
+	}
+	return found, nil
 }
 
-var looksLikeNumber *regexp.Regexp = regexp.MustCompile("^(" + strings.Join([]string{
-	`(-?[1-9](\.[0-9]*[1-9])?(e[-+][1-9][0-9]*)?)`,
-	`(-?(0|[1-9][0-9]*))`,
-	`(0|(\.inf)|(-\.inf)|(\.nan))`},
-	"|") + ")$")
-
-func maybeQuote(scalar string) string {
-	if looksLikeNumber.MatchString(scalar) {
-		return `"` + scalar + `"`
+// podTemplate finds the pod template in a pod controller. CronJobs
+// keep their pod template in the job template; everything else has
+// it directly under the spec.
+func podTemplate(doc *yamlNode) *yamlNode {
+	if t := doc.path("spec", "template"); t != nil {
+		return t
 	}
-	return scalar
+	return doc.path("spec", "jobTemplate", "spec", "template")
 }
@@ -2,6 +2,9 @@ package kubernetes
 
 import (
 	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"fmt"
@@ -10,6 +13,8 @@ import (
 	"github.com/weaveworks/flux"
 )
 
+var updateGolden = flag.Bool("update-golden", false, "rewrite the expected results in testdata/update")
+
 type update struct {
 	name            string
 	containers      []string
@@ -49,11 +54,96 @@ func TestUpdates(t *testing.T) {
 		{"minimal dockerhub image name", case5container, case5image, case5, case5out},
 		{"reordered keys", case6containers, case6image, case6, case6out},
 		{"from prod", case7containers, case7image, case7, case7out},
+		{"statefulset", case8container, case8image, case8, case8out},
+		{"cronjob", case9container, case9image, case9, case9out},
 	} {
 		testUpdate(t, c)
 	}
 }
 
+// Each of these has an input file testdata/update/<name>.yaml, and
+// the expected result testdata/update/<name>.golden.
+func TestUpdateGolden(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		containers []string
+		image      string
+	}{
+		{"flow-containers", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"json", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"anchors", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"merge-keys", []string{"helloworld-canary"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"wide-indent", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"narrow-indent", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"multidoc", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"multidoc-two-controllers", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"init-containers", []string{"migrate"}, "quay.io/weaveworks/db-migrations:v2"},
+		{"single-quoted", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"double-quoted", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"comments", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"version-labels", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"numeric-tag", []string{"helloworld"}, "helloworld:2"},
+		{"no-trailing-newline", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"cronjob-flow", []string{"report"}, "quay.io/weaveworks/report:master-a000002"},
+		{"tags", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"block-scalars", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+		{"dockerhub", []string{"nginx"}, "nginx:1.13"},
+		{"tagged-name", []string{"helloworld"}, "quay.io/weaveworks/helloworld:master-a000002"},
+	} {
+		in, err := ioutil.ReadFile(filepath.Join("testdata", "update", c.name+".yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := flux.ParseImageID(c.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out := in
+		for _, container := range c.containers {
+			if out, err = updatePodController(out, container, id); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			t.Errorf("[%s] %v", c.name, err)
+			continue
+		}
+
+		goldenPath := filepath.Join("testdata", "update", c.name+".golden")
+		if *updateGolden {
+			if err := ioutil.WriteFile(goldenPath, out, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		expected, err := ioutil.ReadFile(goldenPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expected, out) {
+			t.Errorf("[%s] Did not get expected result:\n\n%s\n\nInstead got:\n\n%s", c.name, expected, out)
+		}
+	}
+}
+
+func TestUpdateErrors(t *testing.T) {
+	id, _ := flux.ParseImageID("quay.io/weaveworks/helloworld:master-a000002")
+	for _, c := range []struct {
+		name, container, def string
+	}{
+		{"no such container", "goodbyeworld", case1},
+		{"different image", "pr-assigner", case1},
+		{"not a pod controller", "helloworld", "kind: Service\nmetadata:\n  name: helloworld\n"},
+		{"replication controller", "helloworld", "kind: ReplicationController\nmetadata:\n  name: helloworld\n"},
+		{"malformed", "helloworld", "kind: Deployment\nmetadata: {name: helloworld\n"},
+	} {
+		if _, err := updatePodController([]byte(c.def), c.container, id); err == nil {
+			t.Errorf("[%s] expected error, got nil", c.name)
+		}
+	}
+}
+
 // Unusual but still valid indentation between containers: and the
 // next line
 const case1 = `---
@@ -534,3 +624,98 @@ spec:
         - name: FLUENTD_CONF
           value: fluent.conf
 `
+
+// A StatefulSet looks much like a Deployment, as far as updating is
+// concerned.
+const case8 = `---
+apiVersion: apps/v1beta1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  serviceName: db
+  replicas: 3
+  template:
+    metadata:
+      labels:
+        name: db
+    spec:
+      containers:
+      - name: postgres
+        image: postgres:9.5
+        ports:
+        - containerPort: 5432
+`
+
+const case8image = "postgres:9.6"
+
+var case8container = []string{"postgres"}
+
+const case8out = `---
+apiVersion: apps/v1beta1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  serviceName: db
+  replicas: 3
+  template:
+    metadata:
+      labels:
+        name: db
+    spec:
+      containers:
+      - name: postgres
+        image: postgres:9.6
+        ports:
+        - containerPort: 5432
+`
+
+// A CronJob has its pod template inside the job template.
+const case9 = `---
+apiVersion: batch/v2alpha1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  schedule: "*/5 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          labels:
+            name: report
+        spec:
+          restartPolicy: OnFailure
+          containers:
+          - name: report
+            image: quay.io/weaveworks/report:master-a000001
+            args:
+            - --all
+`
+
+const case9image = "quay.io/weaveworks/report:master-a000002"
+
+var case9container = []string{"report"}
+
+const case9out = `---
+apiVersion: batch/v2alpha1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  schedule: "*/5 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          labels:
+            name: report
+        spec:
+          restartPolicy: OnFailure
+          containers:
+          - name: report
+            image: quay.io/weaveworks/report:master-a000002
+            args:
+            - --all
+`
@@ -0,0 +1,432 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	yamlv2 "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/resource"
+)
+
+// SchemaFile gives the path to the OpenAPI schema for the version of
+// Kubernetes given, in the directory of schemas `dir`; e.g., for
+// version 1.8 it's `dir/v1.8.json`. The minor version may come with
+// a suffix (GKE reports versions like "8+"), which is ignored.
+func SchemaFile(dir, major, minor string) string {
+	minor = strings.TrimRightFunc(minor, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	return filepath.Join(dir, fmt.Sprintf("v%s.%s.json", major, minor))
+}
+
+// Definitions that can hold anything, so can't be checked
+// usefully. (RawExtension declares a required field that never
+// appears in the YAML.)
+var opaqueDefinitions = []string{
+	".RawExtension",
+	".JSONSchemaProps",
+}
+
+// schema is the part of an OpenAPI (v2) schema definition used to
+// validate resources.
+type schema struct {
+	name                 string
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Ref                  string             `json:"$ref"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	GroupVersionKind     []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind"`
+}
+
+// SchemaValidator checks resources against the OpenAPI schema
+// published by the Kubernetes API server (at /swagger.json, or
+// /openapi/v2), so that e.g., misspelt fields and values of the wrong
+// type are caught before they are committed rather than when they are
+// applied. Kinds that aren't in the schema (e.g., custom resources)
+// aren't checked.
+type SchemaValidator struct {
+	definitions map[string]*schema
+	kinds       map[string]*schema // by apiVersion and kind
+}
+
+// NewSchemaValidator loads the OpenAPI schema in the file given.
+func NewSchemaValidator(path string) (*SchemaValidator, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading Kubernetes schema")
+	}
+	return parseSchema(bytes)
+}
+
+func parseSchema(bytes []byte) (*SchemaValidator, error) {
+	var doc struct {
+		Definitions map[string]*schema `json:"definitions"`
+	}
+	if err := json.Unmarshal(bytes, &doc); err != nil {
+		return nil, errors.Wrap(err, "parsing Kubernetes schema")
+	}
+	v := &SchemaValidator{
+		definitions: doc.Definitions,
+		kinds:       map[string]*schema{},
+	}
+	for name, def := range doc.Definitions {
+		def.name = name
+		for _, gvk := range def.GroupVersionKind {
+			v.kinds[apiVersion(gvk.Group, gvk.Version)+" "+gvk.Kind] = def
+		}
+	}
+	return v, nil
+}
+
+func apiVersion(group, version string) string {
+	if group == "" {
+		return version
+	}
+	return group + "/" + version
+}
+
+// definitionFor finds the schema for the apiVersion and kind given,
+// either by the group, version and kind each definition is declared
+// for, or failing that (older schemas don't declare them), by the
+// name of the definition.
+func (v *SchemaValidator) definitionFor(version, kind string) *schema {
+	if def, ok := v.kinds[version+" "+kind]; ok {
+		return def
+	}
+	if i := strings.LastIndex(version, "/"); i >= 0 {
+		version = version[i+1:]
+	}
+	suffix := version + "." + kind
+	var names []string
+	for name := range v.definitions {
+		if name == suffix || strings.HasSuffix(name, "."+suffix) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return v.definitions[names[0]]
+}
+
+func (v *SchemaValidator) Validate(repoDir string, resources []resource.Resource) ([]string, error) {
+	var problems []string
+	for _, res := range resources {
+		source := relativeSource(repoDir, res.Source())
+		jsonBytes, err := yaml.YAMLToJSON(res.Bytes())
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s: %s", source, res.ResourceID(), err))
+			continue
+		}
+		var obj map[string]interface{}
+		if err := json.Unmarshal(jsonBytes, &obj); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s: %s", source, res.ResourceID(), err))
+			continue
+		}
+		version, _ := obj["apiVersion"].(string)
+		kind, _ := obj["kind"].(string)
+		if version == "" {
+			problems = append(problems, fmt.Sprintf("%s: %s: missing apiVersion", source, res.ResourceID()))
+			continue
+		}
+		def := v.definitionFor(version, kind)
+		if def == nil {
+			continue
+		}
+		for _, p := range v.check("", obj, def) {
+			problems = append(problems, fmt.Sprintf("%s: %s: %s", source, res.ResourceID(), p))
+		}
+	}
+	return problems, nil
+}
+
+// check validates a value against a schema, returning the problems
+// found, each prefixed with the path to the field at fault.
+func (v *SchemaValidator) check(path string, value interface{}, s *schema) []string {
+	for s.Ref != "" {
+		def, ok := v.definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+		if !ok {
+			return nil
+		}
+		s = def
+	}
+	for _, suffix := range opaqueDefinitions {
+		if strings.HasSuffix(s.name, suffix) {
+			return nil
+		}
+	}
+	// Nulls are treated by the API server as though the field
+	// wasn't there.
+	if value == nil {
+		return nil
+	}
+
+	field := path
+	if field == "" {
+		field = "."
+	}
+	typ := s.Type
+	if typ == "" && s.Properties != nil {
+		typ = "object"
+	}
+	switch typ {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %s", field, describe(value))}
+		}
+		var problems []string
+		for _, key := range s.Required {
+			if _, ok := obj[key]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required field %q", field, key))
+			}
+		}
+		var keys []string
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if prop, ok := s.Properties[key]; ok {
+				problems = append(problems, v.check(path+"."+key, obj[key], prop)...)
+			} else if s.AdditionalProperties != nil {
+				problems = append(problems, v.check(path+"."+key, obj[key], s.AdditionalProperties)...)
+			} else if s.Properties != nil {
+				problems = append(problems, fmt.Sprintf("%s: unknown field %q", field, key))
+			}
+		}
+		return problems
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a list, got %s", field, describe(value))}
+		}
+		if s.Items == nil {
+			return nil
+		}
+		var problems []string
+		for i, item := range items {
+			problems = append(problems, v.check(fmt.Sprintf("%s[%d]", path, i), item, s.Items)...)
+		}
+		return problems
+	case "string":
+		switch value.(type) {
+		case string:
+			return nil
+		case float64:
+			// Quantities (e.g., resource limits) and int-or-string
+			// fields (e.g., ports) may be given as numbers
+			if s.Format == "int-or-string" || strings.HasSuffix(s.name, ".Quantity") {
+				return nil
+			}
+		}
+		return []string{fmt.Sprintf("%s: expected a string, got %s", field, describe(value))}
+	case "integer":
+		if f, ok := value.(float64); ok && f == math.Trunc(f) {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: expected an integer, got %s", field, describe(value))}
+	case "number":
+		if _, ok := value.(float64); ok {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: expected a number, got %s", field, describe(value))}
+	case "boolean":
+		if _, ok := value.(bool); ok {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: expected true or false, got %s", field, describe(value))}
+	}
+	return nil
+}
+
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "a list"
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func relativeSource(repoDir, source string) string {
+	if rel, err := filepath.Rel(repoDir, source); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return source
+}
+
+// ---
+
+// RuleValidator checks resources against rules kept in the repo
+// itself, in a YAML file like this:
+//
+//	rules:
+//	- name: owned
+//	  kinds: [Deployment, DaemonSet]
+//	  requiredLabels: [team]
+//	  requiredAnnotations: [example.com/on-call]
+//	- name: pinned-images
+//	  forbiddenTags: [latest]
+//
+// A rule applies to the kinds of resource listed, or to all kinds if
+// none are. An image with no tag is taken to have the tag "latest". If
+// there's no file at the path given, there are no rules.
+type RuleValidator struct {
+	// Path of the rules file, relative to the root of the repo
+	Path string
+}
+
+type validationRules struct {
+	Rules []validationRule `yaml:"rules"`
+}
+
+type validationRule struct {
+	Name                string   `yaml:"name"`
+	Kinds               []string `yaml:"kinds"`
+	RequiredLabels      []string `yaml:"requiredLabels"`
+	RequiredAnnotations []string `yaml:"requiredAnnotations"`
+	ForbiddenTags       []string `yaml:"forbiddenTags"`
+}
+
+func (r validationRule) appliesTo(kind string) bool {
+	if len(r.Kinds) == 0 {
+		return true
+	}
+	for _, k := range r.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleObject is the part of a resource the rules look at.
+type ruleObject struct {
+	Kind string `yaml:"kind"`
+	Meta struct {
+		Labels      map[string]string `yaml:"labels"`
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+}
+
+func (v RuleValidator) Validate(repoDir string, resources []resource.Resource) ([]string, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(repoDir, v.Path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading validation rules")
+	}
+	var rules validationRules
+	if err := yamlv2.Unmarshal(bytes, &rules); err != nil {
+		return nil, errors.Wrapf(err, "parsing validation rules in %s", v.Path)
+	}
+
+	var problems []string
+	for _, res := range resources {
+		var obj ruleObject
+		var doc interface{}
+		if err := yamlv2.Unmarshal(res.Bytes(), &obj); err != nil {
+			return nil, err
+		}
+		if err := yamlv2.Unmarshal(res.Bytes(), &doc); err != nil {
+			return nil, err
+		}
+		images := containerImages(doc)
+		prefix := fmt.Sprintf("%s: %s", relativeSource(repoDir, res.Source()), res.ResourceID())
+		for _, rule := range rules.Rules {
+			if !rule.appliesTo(obj.Kind) {
+				continue
+			}
+			for _, label := range rule.RequiredLabels {
+				if _, ok := obj.Meta.Labels[label]; !ok {
+					problems = append(problems, fmt.Sprintf("%s: missing label %q (rule %s)", prefix, label, rule.Name))
+				}
+			}
+			for _, annotation := range rule.RequiredAnnotations {
+				if _, ok := obj.Meta.Annotations[annotation]; !ok {
+					problems = append(problems, fmt.Sprintf("%s: missing annotation %q (rule %s)", prefix, annotation, rule.Name))
+				}
+			}
+			for _, image := range images {
+				id, err := flux.ParseImageID(image)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%s: image %q: %s", prefix, image, err))
+					continue
+				}
+				for _, tag := range rule.ForbiddenTags {
+					if id.Tag == tag {
+						problems = append(problems, fmt.Sprintf("%s: image %q uses forbidden tag %q (rule %s)", prefix, image, tag, rule.Name))
+					}
+				}
+			}
+		}
+	}
+	return problems, nil
+}
+
+// containerImages finds the images of all the containers (and init
+// containers) anywhere in a resource, so that it works for any kind
+// with a pod template (or more than one).
+func containerImages(doc interface{}) []string {
+	var images []string
+	switch d := doc.(type) {
+	case map[interface{}]interface{}:
+		var keys []string
+		for k := range d {
+			if key, ok := k.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if key == "containers" || key == "initContainers" {
+				if containers, ok := d[key].([]interface{}); ok {
+					for _, c := range containers {
+						if container, ok := c.(map[interface{}]interface{}); ok {
+							if image, ok := container["image"].(string); ok {
+								images = append(images, image)
+							}
+						}
+					}
+					continue
+				}
+			}
+			images = append(images, containerImages(d[key])...)
+		}
+	case []interface{}:
+		for _, item := range d {
+			images = append(images, containerImages(item)...)
+		}
+	}
+	return images
+}
+
+var (
+	_ cluster.ManifestValidator = &SchemaValidator{}
+	_ cluster.ManifestValidator = RuleValidator{}
+)
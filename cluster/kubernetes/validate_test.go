@@ -0,0 +1,268 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/resource"
+)
+
+const testSchema = `{
+  "definitions": {
+    "io.k8s.api.apps.v1beta1.Deployment": {
+      "required": ["metadata"],
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {"$ref": "#/definitions/io.k8s.api.apps.v1beta1.DeploymentSpec"}
+      },
+      "x-kubernetes-group-version-kind": [{"group": "apps", "version": "v1beta1", "kind": "Deployment"}]
+    },
+    "io.k8s.api.apps.v1beta1.DeploymentSpec": {
+      "required": ["template"],
+      "properties": {
+        "replicas": {"type": "integer", "format": "int32"},
+        "paused": {"type": "boolean"},
+        "template": {"$ref": "#/definitions/io.k8s.api.core.v1.PodTemplateSpec"}
+      }
+    },
+    "io.k8s.api.core.v1.PodTemplateSpec": {
+      "properties": {
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {
+          "required": ["containers"],
+          "properties": {
+            "containers": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.Container"}}
+          }
+        }
+      }
+    },
+    "io.k8s.api.core.v1.Container": {
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string"},
+        "image": {"type": "string"},
+        "resources": {
+          "properties": {
+            "limits": {"type": "object", "additionalProperties": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.api.resource.Quantity"}}
+          }
+        },
+        "ports": {
+          "type": "array",
+          "items": {
+            "properties": {
+              "containerPort": {"type": "integer"},
+              "targetPort": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.util.intstr.IntOrString"}
+            }
+          }
+        }
+      }
+    },
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "properties": {
+        "name": {"type": "string"},
+        "namespace": {"type": "string"},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+      }
+    },
+    "io.k8s.apimachinery.pkg.api.resource.Quantity": {"type": "string"},
+    "io.k8s.apimachinery.pkg.util.intstr.IntOrString": {"type": "string", "format": "int-or-string"}
+  }
+}`
+
+func parseResources(t *testing.T, source, defs string) []resource.Resource {
+	objs, err := kresource.ParseMultidoc([]byte(defs), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for id := range objs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var resources []resource.Resource
+	for _, id := range ids {
+		resources = append(resources, objs[id])
+	}
+	return resources
+}
+
+func TestSchemaFile(t *testing.T) {
+	for _, c := range []struct{ major, minor, file string }{
+		{"1", "8", "schemas/v1.8.json"},
+		{"1", "8+", "schemas/v1.8.json"},
+	} {
+		if got := SchemaFile("schemas", c.major, c.minor); got != c.file {
+			t.Errorf("version %s.%s: expected %s, got %s", c.major, c.minor, c.file, got)
+		}
+	}
+}
+
+func TestSchemaValidator(t *testing.T) {
+	v, err := parseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		defs     string
+		problems []string
+	}{
+		{
+			name: "valid",
+			defs: `---
+apiVersion: apps/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+  labels:
+    app: helloworld
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: greeter
+        image: quay.io/weaveworks/helloworld:master-a000001
+        resources:
+          limits:
+            cpu: 1
+            memory: 100Mi
+        ports:
+        - containerPort: 80
+          targetPort: 8080
+`,
+		},
+		{
+			name: "not in the schema",
+			defs: `---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: gadget
+spec:
+  anything: goes
+`,
+		},
+		{
+			name: "invalid",
+			defs: `---
+apiVersion: apps/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  pasued: true
+  paused: "yes"
+  template:
+    spec:
+      containers:
+      - image: quay.io/weaveworks/helloworld:master-a000001
+        ports:
+        - containerPort: 80.5
+`,
+			problems: []string{
+				`deploy.yaml: Deployment default/helloworld: .spec: unknown field "pasued"`,
+				`deploy.yaml: Deployment default/helloworld: .spec.paused: expected true or false, got "yes"`,
+				`deploy.yaml: Deployment default/helloworld: .spec.template.spec.containers[0]: missing required field "name"`,
+				`deploy.yaml: Deployment default/helloworld: .spec.template.spec.containers[0].ports[0].containerPort: expected an integer, got 80.5`,
+			},
+		},
+		{
+			name: "missing required",
+			defs: `---
+apiVersion: apps/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  template:
+    spec: {}
+`,
+			problems: []string{
+				`deploy.yaml: Deployment default/helloworld: .spec.template.spec: missing required field "containers"`,
+			},
+		},
+	} {
+		problems, err := v.Validate("", parseResources(t, "deploy.yaml", c.defs))
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(problems, c.problems) {
+			t.Errorf("%s: expected problems:\n%q\ngot:\n%q", c.name, c.problems, problems)
+		}
+	}
+}
+
+func TestRuleValidator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	v := RuleValidator{Path: "rules.conf"}
+	resources := parseResources(t, filepath.Join(dir, "deploy.yaml"), `---
+apiVersion: apps/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+  labels:
+    app: helloworld
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: alpine
+      containers:
+      - name: greeter
+        image: quay.io/weaveworks/helloworld:master-a000001
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: helloworld
+`)
+
+	// No rules file means no rules
+	problems, err := v.Validate(dir, resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected no problems without rules, got %q", problems)
+	}
+
+	rules := `rules:
+- name: owned
+  kinds: [Deployment]
+  requiredLabels: [app, team]
+  requiredAnnotations: [example.com/on-call]
+- name: pinned
+  forbiddenTags: [latest]
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "rules.conf"), []byte(rules), 0600); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = v.Validate(dir, resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`deploy.yaml: Deployment default/helloworld: missing label "team" (rule owned)`,
+		`deploy.yaml: Deployment default/helloworld: missing annotation "example.com/on-call" (rule owned)`,
+		`deploy.yaml: Deployment default/helloworld: image "alpine" uses forbidden tag "latest" (rule pinned)`,
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected problems:\n%q\ngot:\n%q", expected, problems)
+	}
+}
@@ -0,0 +1,1037 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// This is a small YAML parser that, unlike gopkg.in/yaml.v2, keeps
+// track of where each node came from in the source. That means we
+// can change a value (e.g., an image) by replacing just the bytes of
+// that value, and leave everything else -- comments, indentation,
+// quoting, other documents in the file -- as it was.
+//
+// It understands as much of YAML as turns up in Kubernetes
+// manifests: block and flow collections, all the scalar styles, tags,
+// anchors and aliases (including merge keys), and multiple documents
+// in a file. It does not understand complex (`?`) keys.
+
+type yamlKind int
+
+const (
+	yamlScalar yamlKind = iota
+	yamlMapping
+	yamlSequence
+	yamlAlias
+)
+
+type yamlStyle int
+
+const (
+	yamlPlain yamlStyle = iota
+	yamlSingleQuoted
+	yamlDoubleQuoted
+	yamlLiteral
+	yamlFolded
+)
+
+type yamlNode struct {
+	kind  yamlKind
+	style yamlStyle
+	// Whether the node is, or is inside, a flow collection
+	flow bool
+	// The node's content is src[start:end], not including any tag or
+	// anchor. An empty (null) value has start == end.
+	start, end int
+	// The column of the entries of a block collection
+	column int
+	tag    string
+	anchor string
+	// The value of a scalar, with quoting and escapes dealt with
+	value string
+	// The entries of a mapping (alternating keys and values) or the
+	// items of a sequence
+	children []*yamlNode
+	// What an alias refers to
+	alias *yamlNode
+}
+
+// resolve follows aliases to the node they refer to.
+func (n *yamlNode) resolve() *yamlNode {
+	for n != nil && n.kind == yamlAlias {
+		n = n.alias
+	}
+	return n
+}
+
+func (n *yamlNode) isEmpty() bool {
+	return n == nil || (n.kind == yamlScalar && n.style == yamlPlain && n.start == n.end)
+}
+
+// scalar returns the value of the node if it's a scalar, and the
+// empty string otherwise.
+func (n *yamlNode) scalar() string {
+	n = n.resolve()
+	if n == nil || n.kind != yamlScalar {
+		return ""
+	}
+	return n.value
+}
+
+// entry returns the key and value nodes for the key given, if the
+// node is a mapping with that key. Merge keys are not consulted,
+// since an entry returned from here might be edited.
+func (n *yamlNode) entry(key string) (k, v *yamlNode) {
+	n = n.resolve()
+	if n == nil || n.kind != yamlMapping {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(n.children); i += 2 {
+		k := n.children[i].resolve()
+		if k.kind == yamlScalar && k.value == key {
+			return n.children[i], n.children[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// get returns the value for the key given, if the node is a mapping
+// with that key (either directly, or via a merge key). Aliases are
+// resolved.
+func (n *yamlNode) get(key string) *yamlNode {
+	if _, v := n.entry(key); v != nil {
+		return v.resolve()
+	}
+	_, merge := n.entry("<<")
+	merge = merge.resolve()
+	if merge == nil {
+		return nil
+	}
+	if merge.kind == yamlMapping {
+		return merge.get(key)
+	}
+	for _, m := range merge.items() {
+		if v := m.get(key); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// path follows the keys given down through nested mappings.
+func (n *yamlNode) path(keys ...string) *yamlNode {
+	for _, k := range keys {
+		if n = n.get(k); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// items returns the (resolved) items of a sequence.
+func (n *yamlNode) items() []*yamlNode {
+	n = n.resolve()
+	if n == nil || n.kind != yamlSequence {
+		return nil
+	}
+	items := make([]*yamlNode, len(n.children))
+	for i, c := range n.children {
+		items[i] = c.resolve()
+	}
+	return items
+}
+
+// keys returns the keys of a mapping, in the order they appear.
+func (n *yamlNode) keys() []string {
+	n = n.resolve()
+	if n == nil || n.kind != yamlMapping {
+		return nil
+	}
+	var keys []string
+	for i := 0; i+1 < len(n.children); i += 2 {
+		keys = append(keys, n.children[i].scalar())
+	}
+	return keys
+}
+
+// parseYAML parses all the documents in the source given, returning
+// the root node of each document that isn't empty.
+func parseYAML(src []byte) ([]*yamlNode, error) {
+	p := &yamlParser{src: src}
+	var docs []*yamlNode
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return docs, nil
+		}
+		if p.column() == 0 && p.peek() == '%' {
+			p.skipLine()
+			continue
+		}
+		if p.atDocMarker("...") {
+			p.pos += 3
+			continue
+		}
+		if p.atDocMarker("---") {
+			p.pos += 3
+		}
+		p.anchors = map[string]*yamlNode{}
+		root, err := p.parseBlock(-1, false)
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.eof() && !p.atDocBoundary() {
+			return nil, p.errorf("unexpected content after end of document")
+		}
+		if !root.isEmpty() {
+			docs = append(docs, root)
+		}
+	}
+}
+
+type yamlParser struct {
+	src     []byte
+	pos     int
+	anchors map[string]*yamlNode
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	line := bytes.Count(p.src[:p.pos], []byte("\n")) + 1
+	return fmt.Errorf("YAML parse error at line %d, column %d: %s", line, p.column()+1, fmt.Sprintf(format, args...))
+}
+
+func (p *yamlParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *yamlParser) at(pos int) byte {
+	if pos < 0 || pos >= len(p.src) {
+		return 0
+	}
+	return p.src[pos]
+}
+
+func (p *yamlParser) peek() byte {
+	return p.at(p.pos)
+}
+
+// lineStart gives the position of the start of the line that pos is
+// on.
+func lineStart(src []byte, pos int) int {
+	return bytes.LastIndexByte(src[:pos], '\n') + 1
+}
+
+// lineEnd gives the position of the end of the line that pos is on,
+// i.e., the position of the line break, or the end of the source.
+func lineEnd(src []byte, pos int) int {
+	if i := bytes.IndexByte(src[pos:], '\n'); i > -1 {
+		return pos + i
+	}
+	return len(src)
+}
+
+// nextLine gives the position of the start of the line following
+// the one that pos is on (or the end of the source).
+func nextLine(src []byte, pos int) int {
+	if end := lineEnd(src, pos); end < len(src) {
+		return end + 1
+	}
+	return len(src)
+}
+
+func (p *yamlParser) column() int {
+	return p.pos - lineStart(p.src, p.pos)
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func isBreak(c byte) bool {
+	return c == '\n' || c == '\r'
+}
+
+// isSpaceOrEnd is true of the characters that may follow an
+// indicator such as `-` or `:`; 0 stands for the end of the source.
+func isSpaceOrEnd(c byte) bool {
+	return isBlank(c) || isBreak(c) || c == 0
+}
+
+func isFlowIndicator(c byte) bool {
+	return c == ',' || c == '[' || c == ']' || c == '{' || c == '}'
+}
+
+func (p *yamlParser) skipLine() {
+	p.pos = lineEnd(p.src, p.pos)
+}
+
+// skipSpace skips whitespace, line breaks and comments, and reports
+// whether it went past a line break.
+func (p *yamlParser) skipSpace() bool {
+	newline := false
+	for !p.eof() {
+		c := p.peek()
+		switch {
+		case isBlank(c):
+			p.pos++
+		case isBreak(c):
+			p.pos++
+			newline = true
+		case c == '#' && (p.pos == 0 || isSpaceOrEnd(p.at(p.pos-1))):
+			p.skipLine()
+		default:
+			return newline
+		}
+	}
+	return newline
+}
+
+// skipBlanks skips spaces and tabs, but not line breaks.
+func (p *yamlParser) skipBlanks() {
+	for isBlank(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *yamlParser) atDocMarker(marker string) bool {
+	return p.column() == 0 &&
+		bytes.HasPrefix(p.src[p.pos:], []byte(marker)) &&
+		isSpaceOrEnd(p.at(p.pos+3))
+}
+
+func (p *yamlParser) atDocBoundary() bool {
+	return p.atDocMarker("---") || p.atDocMarker("...")
+}
+
+func (p *yamlParser) atSeqEntry() bool {
+	return p.peek() == '-' && isSpaceOrEnd(p.at(p.pos+1))
+}
+
+func (p *yamlParser) emptyNode(at int, flow bool) *yamlNode {
+	return &yamlNode{kind: yamlScalar, start: at, end: at, flow: flow}
+}
+
+// parseBlock parses a node in block context, e.g., after `key:` or
+// `- `. If the node starts on a following line, it must be indented
+// further than `indent` -- except that a sequence may be at the same
+// indentation as the key it belongs to, if `seqOK` is true.
+func (p *yamlParser) parseBlock(indent int, seqOK bool) (*yamlNode, error) {
+	emptyAt := p.pos
+	newline := p.skipSpace() || indent < 0
+	var tag, anchor string
+	for {
+		if p.eof() || p.atDocBoundary() {
+			return p.emptyNode(emptyAt, false), nil
+		}
+		if newline {
+			col := p.column()
+			if col < indent || (col == indent && !(seqOK && p.atSeqEntry())) {
+				return p.emptyNode(emptyAt, false), nil
+			}
+		}
+		c := p.peek()
+		if c != '&' && c != '!' {
+			break
+		}
+		word := p.readWord(false)
+		if c == '&' {
+			anchor = word[1:]
+		} else {
+			tag = word
+		}
+		emptyAt = p.pos
+		if p.skipSpace() {
+			newline = true
+		}
+	}
+
+	col := p.column()
+	var node *yamlNode
+	var err error
+	switch c := p.peek(); {
+	case c == '-' && isSpaceOrEnd(p.at(p.pos+1)):
+		node, err = p.parseBlockSequence(col)
+	case c == '[' || c == '{':
+		node, err = p.parseFlowCollection()
+	case c == '|' || c == '>':
+		node, err = p.parseBlockScalar(indent)
+	case c == '?' && isSpaceOrEnd(p.at(p.pos+1)):
+		err = p.errorf("complex mapping keys are not supported")
+	default:
+		var key *yamlNode
+		key, err = p.parseScalarOrAlias(indent, false)
+		if err != nil {
+			break
+		}
+		p.skipBlanks()
+		if p.peek() == ':' && isSpaceOrEnd(p.at(p.pos+1)) {
+			node, err = p.parseBlockMapping(col, key)
+		} else {
+			node = key
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.withProperties(node, tag, anchor), nil
+}
+
+func (p *yamlParser) withProperties(node *yamlNode, tag, anchor string) *yamlNode {
+	if tag != "" {
+		node.tag = tag
+	}
+	if anchor != "" {
+		node.anchor = anchor
+		p.anchors[anchor] = node
+	}
+	return node
+}
+
+// readWord reads up to the next space (or, in flow context, flow
+// indicator); it's used for tags, anchors and aliases.
+func (p *yamlParser) readWord(flow bool) string {
+	start := p.pos
+	for !p.eof() && !isSpaceOrEnd(p.peek()) && !(flow && isFlowIndicator(p.peek())) {
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+func (p *yamlParser) parseScalarOrAlias(indent int, flow bool) (*yamlNode, error) {
+	switch p.peek() {
+	case '*':
+		start := p.pos
+		name := p.readWord(flow)[1:]
+		target, ok := p.anchors[name]
+		if !ok {
+			p.pos = start
+			return nil, p.errorf("alias to unknown anchor %q", name)
+		}
+		return &yamlNode{kind: yamlAlias, start: start, end: p.pos, alias: target, flow: flow}, nil
+	case '"':
+		return p.parseDoubleQuoted(flow)
+	case '\'':
+		return p.parseSingleQuoted(flow)
+	}
+	return p.parsePlain(indent, flow), nil
+}
+
+// parseBlockMapping parses a block mapping with entries at column
+// `col`, the first key of which has already been parsed. It expects
+// to be at the `:` following the first key.
+func (p *yamlParser) parseBlockMapping(col int, key *yamlNode) (*yamlNode, error) {
+	m := &yamlNode{kind: yamlMapping, column: col, start: key.start}
+	for {
+		p.pos++ // the ':'
+		m.end = p.pos
+		value, err := p.parseBlock(col, true)
+		if err != nil {
+			return nil, err
+		}
+		if !value.isEmpty() {
+			m.end = value.end
+		}
+		m.children = append(m.children, key, value)
+
+		save := p.pos
+		p.skipSpace()
+		if p.eof() || p.atDocBoundary() || p.column() < col {
+			p.pos = save
+			return m, nil
+		}
+		if p.column() > col {
+			return nil, p.errorf("bad indentation of a mapping entry")
+		}
+		if p.atSeqEntry() {
+			return nil, p.errorf("unexpected sequence entry in a mapping")
+		}
+		if key, err = p.parseScalarOrAlias(col, false); err != nil {
+			return nil, err
+		}
+		p.skipBlanks()
+		if p.peek() != ':' || !isSpaceOrEnd(p.at(p.pos+1)) {
+			return nil, p.errorf("expected ':' after mapping key")
+		}
+	}
+}
+
+// parseBlockSequence parses a block sequence with entries at column
+// `col`. It expects to be at the first `-`.
+func (p *yamlParser) parseBlockSequence(col int) (*yamlNode, error) {
+	s := &yamlNode{kind: yamlSequence, column: col, start: p.pos}
+	for {
+		p.pos++ // the '-'
+		s.end = p.pos
+		item, err := p.parseBlock(col, false)
+		if err != nil {
+			return nil, err
+		}
+		if !item.isEmpty() {
+			s.end = item.end
+		}
+		s.children = append(s.children, item)
+
+		save := p.pos
+		p.skipSpace()
+		if p.eof() || p.atDocBoundary() || p.column() < col || (p.column() == col && !p.atSeqEntry()) {
+			p.pos = save
+			return s, nil
+		}
+		if p.column() > col {
+			return nil, p.errorf("bad indentation of a sequence entry")
+		}
+	}
+}
+
+// parseFlowCollection parses a `[...]` or `{...}` collection,
+// which may span lines.
+func (p *yamlParser) parseFlowCollection() (*yamlNode, error) {
+	n := &yamlNode{kind: yamlSequence, flow: true, start: p.pos}
+	closing := byte(']')
+	if p.peek() == '{' {
+		n.kind, closing = yamlMapping, '}'
+	}
+	p.pos++
+	for {
+		p.skipSpace()
+		if p.peek() == closing {
+			break
+		}
+		if p.eof() {
+			return nil, p.errorf("unterminated flow collection")
+		}
+		entryStart := p.pos
+		item, err := p.parseFlowNode()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() == ':' {
+			p.pos++
+			value, err := p.parseFlowNode()
+			if err != nil {
+				return nil, err
+			}
+			if n.kind == yamlMapping {
+				n.children = append(n.children, item, value)
+			} else {
+				// A single pair mapping, e.g., `[a: b]`
+				pair := &yamlNode{kind: yamlMapping, flow: true, start: entryStart, end: p.pos, children: []*yamlNode{item, value}}
+				n.children = append(n.children, pair)
+			}
+			p.skipSpace()
+		} else if n.kind == yamlMapping {
+			n.children = append(n.children, item, p.emptyNode(item.end, true))
+		} else {
+			n.children = append(n.children, item)
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+			continue
+		case closing:
+		default:
+			return nil, p.errorf("expected ',' or '%c' in flow collection", closing)
+		}
+		break
+	}
+	p.pos++
+	n.end = p.pos
+	return n, nil
+}
+
+func (p *yamlParser) parseFlowNode() (*yamlNode, error) {
+	emptyAt := p.pos
+	p.skipSpace()
+	var tag, anchor string
+	for c := p.peek(); c == '&' || c == '!'; c = p.peek() {
+		word := p.readWord(true)
+		if c == '&' {
+			anchor = word[1:]
+		} else {
+			tag = word
+		}
+		emptyAt = p.pos
+		p.skipSpace()
+	}
+	var node *yamlNode
+	var err error
+	switch c := p.peek(); {
+	case c == '[' || c == '{':
+		node, err = p.parseFlowCollection()
+	case c == ',' || c == ']' || c == '}' || (c == ':' && isSpaceOrEnd(p.at(p.pos+1))):
+		node = p.emptyNode(emptyAt, true)
+	default:
+		node, err = p.parseScalarOrAlias(-1, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.withProperties(node, tag, anchor), nil
+}
+
+// parsePlain parses an unquoted scalar. In block context, it may
+// continue onto following lines that are indented further than
+// `indent`.
+func (p *yamlParser) parsePlain(indent int, flow bool) *yamlNode {
+	n := &yamlNode{kind: yamlScalar, style: yamlPlain, flow: flow, start: p.pos, end: p.pos}
+	var value []byte
+	for {
+		segStart := p.pos
+	line:
+		for !p.eof() {
+			c := p.peek()
+			switch {
+			case isBreak(c):
+				break line
+			case c == ':' && (isSpaceOrEnd(p.at(p.pos+1)) || (flow && isFlowIndicator(p.at(p.pos+1)))):
+				break line
+			case c == '#' && p.pos > segStart && isBlank(p.at(p.pos-1)):
+				break line
+			case flow && isFlowIndicator(c):
+				break line
+			}
+			p.pos++
+		}
+		segment := bytes.TrimRight(p.src[segStart:p.pos], " \t")
+		value = append(value, segment...)
+		n.end = segStart + len(segment)
+		if !isBreak(p.peek()) {
+			break
+		}
+
+		// Is there a continuation line?
+		q, breaks := p.pos, 0
+		for q < len(p.src) && (isBlank(p.src[q]) || isBreak(p.src[q])) {
+			if p.src[q] == '\n' {
+				breaks++
+			}
+			q++
+		}
+		save := p.pos
+		p.pos = q
+		if p.eof() || p.peek() == '#' || p.atDocBoundary() ||
+			(!flow && p.column() <= indent) ||
+			(flow && isFlowIndicator(p.peek())) {
+			p.pos = save
+			break
+		}
+		if breaks == 1 {
+			value = append(value, ' ')
+		} else {
+			value = append(value, bytes.Repeat([]byte("\n"), breaks-1)...)
+		}
+	}
+	p.pos = n.end
+	n.value = string(value)
+	return n
+}
+
+func (p *yamlParser) parseSingleQuoted(flow bool) (*yamlNode, error) {
+	n := &yamlNode{kind: yamlScalar, style: yamlSingleQuoted, flow: flow, start: p.pos}
+	p.pos++
+	var value []byte
+	for {
+		if p.eof() {
+			return nil, p.errorf("unterminated single-quoted string")
+		}
+		c := p.peek()
+		switch {
+		case c == '\'' && p.at(p.pos+1) == '\'':
+			value = append(value, '\'')
+			p.pos += 2
+		case c == '\'':
+			p.pos++
+			n.end = p.pos
+			n.value = string(value)
+			return n, nil
+		case isBreak(c):
+			value = p.foldQuotedLines(value)
+		default:
+			value = append(value, c)
+			p.pos++
+		}
+	}
+}
+
+func (p *yamlParser) parseDoubleQuoted(flow bool) (*yamlNode, error) {
+	n := &yamlNode{kind: yamlScalar, style: yamlDoubleQuoted, flow: flow, start: p.pos}
+	p.pos++
+	var value []byte
+	for {
+		if p.eof() {
+			return nil, p.errorf("unterminated double-quoted string")
+		}
+		c := p.peek()
+		switch {
+		case c == '"':
+			p.pos++
+			n.end = p.pos
+			n.value = string(value)
+			return n, nil
+		case c == '\\':
+			var err error
+			if value, err = p.unescape(value); err != nil {
+				return nil, err
+			}
+		case isBreak(c):
+			value = p.foldQuotedLines(value)
+		default:
+			value = append(value, c)
+			p.pos++
+		}
+	}
+}
+
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n",
+	'v': "\v", 'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': "\"",
+	'/': "/", '\\': "\\", 'N': "\u0085", '_': " ", 'L': " ", 'P': " ",
+}
+
+// unescape reads an escape sequence in a double-quoted scalar,
+// appending the character it stands for to `value`.
+func (p *yamlParser) unescape(value []byte) ([]byte, error) {
+	c := p.at(p.pos + 1)
+	if s, ok := yamlEscapes[c]; ok {
+		p.pos += 2
+		return append(value, s...), nil
+	}
+	if isBreak(c) {
+		// An escaped line break; the break and any leading blanks on
+		// the next line are dropped
+		p.pos++
+		p.skipSpaceNoComments()
+		return value, nil
+	}
+	width := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+	if width == 0 || p.pos+2+width > len(p.src) {
+		return nil, p.errorf("bad escape sequence in double-quoted string")
+	}
+	code, err := strconv.ParseUint(string(p.src[p.pos+2:p.pos+2+width]), 16, 32)
+	if err != nil {
+		return nil, p.errorf("bad escape sequence in double-quoted string")
+	}
+	p.pos += 2 + width
+	return append(value, string(rune(code))...), nil
+}
+
+func (p *yamlParser) skipSpaceNoComments() {
+	for isBlank(p.peek()) || isBreak(p.peek()) {
+		p.pos++
+	}
+}
+
+// foldQuotedLines deals with a line break in a quoted scalar:
+// trailing blanks are dropped, a single break becomes a space, and
+// any further (empty) lines become line feeds.
+func (p *yamlParser) foldQuotedLines(value []byte) []byte {
+	value = bytes.TrimRight(value, " \t")
+	breaks := 0
+	for isBlank(p.peek()) || isBreak(p.peek()) {
+		if p.peek() == '\n' {
+			breaks++
+		}
+		p.pos++
+	}
+	if breaks <= 1 {
+		return append(value, ' ')
+	}
+	return append(value, bytes.Repeat([]byte("\n"), breaks-1)...)
+}
+
+// parseBlockScalar parses a literal (`|`) or folded (`>`) scalar,
+// the content of which must be indented further than `indent`.
+func (p *yamlParser) parseBlockScalar(indent int) (*yamlNode, error) {
+	n := &yamlNode{kind: yamlScalar, style: yamlLiteral, start: p.pos}
+	if p.peek() == '>' {
+		n.style = yamlFolded
+	}
+	p.pos++
+	chomp, explicit := byte(0), 0
+	for c := p.peek(); c == '+' || c == '-' || (c >= '1' && c <= '9'); c = p.peek() {
+		if c == '+' || c == '-' {
+			chomp = c
+		} else {
+			explicit = int(c - '0')
+		}
+		p.pos++
+	}
+	p.skipBlanks()
+	if p.peek() == '#' {
+		p.skipLine()
+	}
+	if !isBreak(p.peek()) && !p.eof() {
+		return nil, p.errorf("unexpected content after block scalar indicator")
+	}
+	n.end = p.pos
+
+	contentIndent := 0
+	if explicit > 0 {
+		contentIndent = indent + explicit
+		if indent < 0 {
+			contentIndent = explicit
+		}
+	}
+	var lines []string
+	trailing := 0
+	pos := lineEnd(p.src, p.pos)
+	for pos+1 < len(p.src) {
+		start := pos + 1
+		end := lineEnd(p.src, start)
+		line := strings.TrimRight(string(p.src[start:end]), "\r")
+		spaces := len(line) - len(strings.TrimLeft(line, " "))
+		if strings.TrimSpace(line) == "" && (contentIndent == 0 || spaces <= contentIndent) {
+			trailing++
+			pos = end
+			continue
+		}
+		if contentIndent == 0 {
+			if spaces <= indent {
+				break
+			}
+			contentIndent = spaces
+		}
+		if spaces < contentIndent {
+			break
+		}
+		p.pos = start
+		if p.atDocBoundary() {
+			break
+		}
+		for ; trailing > 0; trailing-- {
+			lines = append(lines, "")
+		}
+		lines = append(lines, line[contentIndent:])
+		n.end = start + len(line)
+		pos = end
+	}
+	p.pos = n.end
+
+	var value bytes.Buffer
+	moreIndented := func(l string) bool { return strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t") }
+	for i, l := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			switch {
+			case n.style == yamlLiteral:
+				value.WriteByte('\n')
+			case l == "" && prev != "" && !moreIndented(prev):
+				// the break before empty lines is dropped when folding
+			case l != "" && prev != "" && !moreIndented(l) && !moreIndented(prev):
+				value.WriteByte(' ')
+			default:
+				value.WriteByte('\n')
+			}
+		}
+		value.WriteString(l)
+	}
+	switch {
+	case chomp == '-' || len(lines) == 0 && chomp != '+':
+	case chomp == '+':
+		if len(lines) > 0 {
+			value.WriteByte('\n')
+		}
+		value.WriteString(strings.Repeat("\n", trailing))
+	default:
+		value.WriteByte('\n')
+	}
+	n.value = value.String()
+	return n, nil
+}
+
+// --- Editing
+
+type yamlEdit struct {
+	start, end int
+	text       string
+}
+
+// yamlEditor collects changes to a YAML source, to be applied all at
+// once; since the parsed nodes refer to positions in the original
+// source, it's easiest not to change it until everything has been
+// worked out.
+type yamlEditor struct {
+	src   []byte
+	edits []yamlEdit
+}
+
+func newYAMLEditor(src []byte) *yamlEditor {
+	return &yamlEditor{src: src}
+}
+
+// replace replaces the source from start to end with the text
+// given. Replacing the same span twice replaces the earlier edit.
+func (e *yamlEditor) replace(start, end int, text string) {
+	for i, edit := range e.edits {
+		if edit.start == start && edit.end == end && start != end {
+			e.edits[i].text = text
+			return
+		}
+	}
+	e.edits = append(e.edits, yamlEdit{start, end, text})
+}
+
+type byStart []yamlEdit
+
+func (s byStart) Len() int           { return len(s) }
+func (s byStart) Less(i, j int) bool { return s[i].start < s[j].start }
+func (s byStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (e *yamlEditor) insert(at int, text string) {
+	e.replace(at, at, text)
+}
+
+// bytes applies the edits, and returns the result.
+func (e *yamlEditor) bytes() ([]byte, error) {
+	edits := make([]yamlEdit, len(e.edits))
+	copy(edits, e.edits)
+	sort.Stable(byStart(edits))
+	var out bytes.Buffer
+	pos := 0
+	for _, edit := range edits {
+		if edit.start < pos {
+			return nil, fmt.Errorf("overlapping changes to YAML at offset %d", edit.start)
+		}
+		out.Write(e.src[pos:edit.start])
+		out.WriteString(edit.text)
+		pos = edit.end
+	}
+	out.Write(e.src[pos:])
+	return out.Bytes(), nil
+}
+
+// indentation gives the whitespace used to indent the line that pos
+// is on.
+func (e *yamlEditor) indentation(pos int) string {
+	start := lineStart(e.src, pos)
+	end := start
+	for end < len(e.src) && isBlank(e.src[end]) {
+		end++
+	}
+	return string(e.src[start:end])
+}
+
+// removeEntry removes the entry with the key given from a mapping. In
+// a block mapping, the lines the entry is on are removed.
+func (e *yamlEditor) removeEntry(m *yamlNode, key string) error {
+	m = m.resolve()
+	for i := 0; i+1 < len(m.children); i += 2 {
+		k, v := m.children[i], m.children[i+1]
+		if k.resolve().value != key {
+			continue
+		}
+		end := v.end
+		if end < k.end {
+			end = k.end
+		}
+		if m.flow {
+			switch {
+			case i+2 < len(m.children):
+				// up to the next key, taking the comma with it
+				e.replace(k.start, m.children[i+2].start, "")
+			case i > 0:
+				// from the end of the previous entry, taking the comma
+				// with it
+				prevEnd := m.children[i-2].end
+				if m.children[i-1].end > prevEnd {
+					prevEnd = m.children[i-1].end
+				}
+				e.replace(prevEnd, end, "")
+			default:
+				e.replace(k.start, end, "")
+			}
+			return nil
+		}
+		start := lineStart(e.src, k.start)
+		if len(strings.TrimSpace(string(e.src[start:k.start]))) > 0 {
+			return fmt.Errorf("cannot remove %q, since it shares a line with something else", key)
+		}
+		e.replace(start, nextLine(e.src, end), "")
+		return nil
+	}
+	return nil
+}
+
+// setScalar changes the value of a scalar node (or the node it's an
+// alias for), keeping its quoting style where that's possible.
+func (e *yamlEditor) setScalar(n *yamlNode, value string) {
+	n = n.resolve()
+	if n.kind == yamlScalar && n.value == value && !n.isEmpty() {
+		return
+	}
+	text := renderScalar(n, value)
+	if n.isEmpty() && n.start > 0 && !isSpaceOrEnd(e.src[n.start-1]) {
+		text = " " + text
+	}
+	e.replace(n.start, n.end, text)
+}
+
+// renderScalar gives the source for `value`, to replace the node
+// given. If the node was quoted for the sake of it (rather than
+// because it needed to be), or the new value needs quoting too, the
+// same quoting is used; otherwise, the value is quoted only if it has
+// to be.
+func renderScalar(n *yamlNode, value string) string {
+	keepQuotes := !needsQuotes(n.value, n.flow) || needsQuotes(value, n.flow)
+	if n.kind == yamlScalar && keepQuotes && !strings.ContainsAny(value, "\n\r") {
+		switch n.style {
+		case yamlSingleQuoted:
+			return "'" + strings.Replace(value, "'", "''", -1) + "'"
+		case yamlDoubleQuoted:
+			return strconv.Quote(value)
+		}
+	}
+	return quoteIfNeeded(value, n.flow)
+}
+
+func quoteIfNeeded(value string, flow bool) string {
+	if needsQuotes(value, flow) {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+var (
+	// Plain scalars that YAML would read as something other than a
+	// string
+	looksLikeNonString = regexp.MustCompile(`^(` + strings.Join([]string{
+		`[-+]?(\.[0-9]+|[0-9][0-9_]*(\.[0-9_]*)?)([eE][-+]?[0-9]+)?`,
+		`[-+]?0x[0-9a-fA-F_]+`,
+		`[-+]?0o?[0-7_]+`,
+		`[-+]?\.(inf|Inf|INF)`,
+		`\.(nan|NaN|NAN)`,
+		`[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}([Tt ].*)?`,
+		`(?i:true|false|yes|no|y|n|on|off|null)`,
+		`~`,
+	}, "|") + `)$`)
+)
+
+// needsQuotes says whether a value has to be quoted to be read back
+// as the same string.
+func needsQuotes(value string, flow bool) bool {
+	switch {
+	case value == "":
+		return true
+	case looksLikeNonString.MatchString(value):
+		return true
+	case strings.TrimSpace(value) != value:
+		return true
+	case strings.ContainsAny(value[:1], ",[]{}#&*!|>'\"%@`"):
+		return true
+	case strings.ContainsAny(value[:1], "-?:") && (len(value) == 1 || isBlank(value[1])):
+		return true
+	case strings.Contains(value, ": ") || strings.Contains(value, " #") || strings.HasSuffix(value, ":"):
+		return true
+	case strings.ContainsAny(value, "\n\r\t"):
+		return true
+	case flow && strings.ContainsAny(value, ",[]{}"):
+		return true
+	}
+	return false
+}
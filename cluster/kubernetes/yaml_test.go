@@ -0,0 +1,190 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func parseOne(t *testing.T, src string) *yamlNode {
+	docs, err := parseYAML([]byte(src))
+	if err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("expected one document from %q, got %d", src, len(docs))
+	}
+	return docs[0]
+}
+
+func TestParseScalars(t *testing.T) {
+	for _, c := range []struct {
+		src, value string
+	}{
+		{`key: plain value`, "plain value"},
+		{`key: plain value # comment`, "plain value"},
+		{`key: not#comment`, "not#comment"},
+		{`key: http://example.com:8080/`, "http://example.com:8080/"},
+		{`key: 'single ''quoted'''`, "single 'quoted'"},
+		{`key: "double \"quoted\"\t\u00e9"`, "double \"quoted\"\t\u00e9"},
+		{"key: \"folded\n  over lines\"", "folded over lines"},
+		{"key: plain\n  continued\n\n  paragraph", "plain continued\nparagraph"},
+		{"key: |\n  literal\n  text\n", "literal\ntext\n"},
+		{"key: |-\n  literal\n  text\n\n", "literal\ntext"},
+		{"key: |+\n  literal\n\n", "literal\n\n"},
+		{"key: >\n  folded\n  text\n\n  para\n", "folded text\npara\n"},
+		{"key: !!str 5", "5"},
+		{"key: &a value", "value"},
+		{"key:\n  indented", "indented"},
+	} {
+		doc := parseOne(t, c.src)
+		if got := doc.get("key").scalar(); got != c.value {
+			t.Errorf("parsing %q: expected %q, got %q", c.src, c.value, got)
+		}
+	}
+}
+
+func TestParseCollections(t *testing.T) {
+	src := `# a comment
+top:
+  list:
+  - a
+  -   b   # comment
+  - - nested
+    - seq
+  - name: compact
+    image: mapping
+  flow: [a, "b", {c: d, "e":f}]
+  flowmap: {x: 1, y: [2, 3],
+    z: 4}
+  empty:
+  last: thing
+`
+	doc := parseOne(t, src)
+	if keys := doc.get("top").keys(); !reflect.DeepEqual(keys, []string{"list", "flow", "flowmap", "empty", "last"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	list := doc.path("top", "list").items()
+	if len(list) != 4 {
+		t.Fatalf("expected 4 items, got %d", len(list))
+	}
+	if list[1].scalar() != "b" {
+		t.Errorf("expected %q, got %q", "b", list[1].scalar())
+	}
+	if nested := list[2].items(); len(nested) != 2 || nested[1].scalar() != "seq" {
+		t.Errorf("unexpected nested sequence %#v", nested)
+	}
+	if list[3].get("image").scalar() != "mapping" {
+		t.Errorf("expected compact mapping, got %#v", list[3])
+	}
+	flow := doc.path("top", "flow").items()
+	if len(flow) != 3 || flow[1].scalar() != "b" || flow[2].get("e").scalar() != "f" {
+		t.Errorf("unexpected flow sequence %#v", flow)
+	}
+	if doc.path("top", "flowmap", "z").scalar() != "4" {
+		t.Errorf("expected flow mapping to span lines")
+	}
+	if !doc.path("top", "empty").isEmpty() {
+		t.Errorf("expected empty value")
+	}
+	if doc.path("top", "last").scalar() != "thing" {
+		t.Errorf("expected last entry to be parsed")
+	}
+}
+
+func TestParseSequenceAtKeyIndent(t *testing.T) {
+	doc := parseOne(t, "a:\n- 1\n- 2\nb: 3\n")
+	if len(doc.get("a").items()) != 2 || doc.get("b").scalar() != "3" {
+		t.Errorf("unexpected parse %#v", doc)
+	}
+}
+
+func TestParseAliases(t *testing.T) {
+	src := `base: &base
+  image: foo:v1
+  name: base
+derived:
+  <<: *base
+  name: derived
+ref: *base
+`
+	doc := parseOne(t, src)
+	if doc.path("derived", "image").scalar() != "foo:v1" {
+		t.Errorf("expected merged key")
+	}
+	if doc.path("derived", "name").scalar() != "derived" {
+		t.Errorf("expected own key to take precedence over merged key")
+	}
+	if doc.path("ref", "name").scalar() != "base" {
+		t.Errorf("expected alias to resolve")
+	}
+}
+
+func TestParseMultidoc(t *testing.T) {
+	src := `%YAML 1.1
+---
+a: 1
+---
+# only a comment
+---
+b: 2
+...
+--- c
+`
+	docs, err := parseYAML([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 3 {
+		t.Fatalf("expected 3 documents, got %d", len(docs))
+	}
+	if docs[0].get("a").scalar() != "1" || docs[1].get("b").scalar() != "2" || docs[2].scalar() != "c" {
+		t.Errorf("unexpected documents %#v", docs)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"a: 'unterminated",
+		"a: [1, 2",
+		"a: *nowhere",
+		"a:\n  b: 1\n c: 2",
+		"a: 1\n- 2",
+	} {
+		if _, err := parseYAML([]byte(src)); err == nil {
+			t.Errorf("expected error parsing %q", src)
+		}
+	}
+}
+
+func TestSetScalar(t *testing.T) {
+	for _, c := range []struct {
+		src, value, out string
+	}{
+		{`key: old # comment`, "new", `key: new # comment`},
+		{`key: old`, "1234", `key: "1234"`},
+		{`key: "1234"`, "new", `key: new`},
+		{`key: "old"`, "new", `key: "new"`},
+		{`key: 'old'`, "new's", `key: 'new''s'`},
+		{`key: '1.12'`, "1.13", `key: '1.13'`},
+		{`key: '1.12'`, "v1.13", `key: v1.13`},
+		{`key: {a: old}`, "new, really", `key: {a: "new, really"}`},
+		{"key: |\n  old\nnext: 1", "new", "key: new\nnext: 1"},
+		{`key:`, "new", `key: new`},
+	} {
+		src := []byte(c.src)
+		doc := parseOne(t, c.src)
+		node := doc.get("key")
+		if node.kind == yamlMapping {
+			node = node.get("a")
+		}
+		e := newYAMLEditor(src)
+		e.setScalar(node, c.value)
+		out, err := e.bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != c.out {
+			t.Errorf("setting %q in %q: expected %q, got %q", c.value, c.src, c.out, string(out))
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package cluster
 
 import (
+	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 
@@ -13,9 +15,11 @@ import (
 // resources, e.g., in Kubernetes, YAML files describing Kubernetes
 // resources.
 type Manifests interface {
-	// Given a directory with manifest files, find which files define
-	// which services.
-	FindDefinedServices(path string) (map[flux.ServiceID][]string, error)
+	// Given a directory with manifest files, find which resources
+	// (e.g., Deployments) define which services. A file may define
+	// more than one resource, so the resources returned carry their
+	// own definition as well as the file it came from.
+	FindDefinedServices(path string) (map[flux.ServiceID][]resource.Resource, error)
 	// Update the definitions in a manifests bytes according to the
 	// spec given.
 	UpdateDefinition(def []byte, container string, newImageID flux.ImageID) ([]byte, error)
@@ -29,35 +33,53 @@ type Manifests interface {
 	ServicesWithPolicies(path string) (policy.ServiceMap, error)
 }
 
-// UpdateManifest looks for the manifest for a given service, reads
-// its contents, applies f(contents), and writes the results back to
-// the file.
+// UpdateManifest looks for the resource defining a given service,
+// applies f(definition), and writes the result back to the file the
+// resource came from, in place of the original definition.
 func UpdateManifest(m Manifests, root string, serviceID string, f func(manifest []byte) ([]byte, error)) error {
 	services, err := m.FindDefinedServices(root)
 	if err != nil {
 		return err
 	}
-	paths := services[flux.ServiceID(serviceID)]
-	if len(paths) == 0 {
+	resources := services[flux.ServiceID(serviceID)]
+	if len(resources) == 0 {
 		return ErrNoResourceFilesFoundForService
 	}
-	if len(paths) > 1 {
+	if len(resources) > 1 {
 		return ErrMultipleResourceFilesFoundForService
 	}
 
-	def, err := ioutil.ReadFile(paths[0])
+	def := resources[0].Bytes()
+	newDef, err := f(def)
 	if err != nil {
 		return err
 	}
+	return ReplaceDefinition(resources[0].Source(), resources[0].Offset(), def, newDef)
+}
 
-	newDef, err := f(def)
+// ReplaceDefinition replaces the definition `def`, starting at
+// `offset` in the file at `path`, with `newDef`. The offset is that
+// recorded when the file was parsed, so the definition is replaced
+// where it was found, even if the same text appears elsewhere in the
+// file. Anything else in the file, e.g., the definitions of other
+// resources, is left exactly as it was.
+func ReplaceDefinition(path string, offset int, def, newDef []byte) error {
+	contents, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
+	end := offset + len(def)
+	if offset < 0 || end > len(contents) || !bytes.Equal(contents[offset:end], def) {
+		return fmt.Errorf("definition not found at offset %d in %s", offset, path)
+	}
+	var buf bytes.Buffer
+	buf.Write(contents[:offset])
+	buf.Write(newDef)
+	buf.Write(contents[end:])
 
-	fi, err := os.Stat(paths[0])
+	fi, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(paths[0], newDef, fi.Mode())
+	return ioutil.WriteFile(path, buf.Bytes(), fi.Mode())
 }
@@ -15,7 +15,7 @@ type Mock struct {
 	ExportFunc               func() ([]byte, error)
 	SyncFunc                 func(SyncDef) error
 	PublicSSHKeyFunc         func(regenerate bool) (ssh.PublicKey, error)
-	FindDefinedServicesFunc  func(path string) (map[flux.ServiceID][]string, error)
+	FindDefinedServicesFunc  func(path string) (map[flux.ServiceID][]resource.Resource, error)
 	UpdateDefinitionFunc     func(def []byte, container string, newImageID flux.ImageID) ([]byte, error)
 	LoadManifestsFunc        func(paths ...string) (map[string]resource.Resource, error)
 	ParseManifestsFunc       func([]byte) (map[string]resource.Resource, error)
@@ -48,7 +48,7 @@ func (m *Mock) PublicSSHKey(regenerate bool) (ssh.PublicKey, error) {
 	return m.PublicSSHKeyFunc(regenerate)
 }
 
-func (m *Mock) FindDefinedServices(path string) (map[flux.ServiceID][]string, error) {
+func (m *Mock) FindDefinedServices(path string) (map[flux.ServiceID][]resource.Resource, error) {
 	return m.FindDefinedServicesFunc(path)
 }
 
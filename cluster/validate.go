@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/weaveworks/flux/resource"
+)
+
+// ManifestValidator checks resource definitions before they are
+// committed. It returns a description of each problem found; an
+// error means the validator itself couldn't run (e.g., its
+// configuration couldn't be read).
+type ManifestValidator interface {
+	// Validate the resources given, which are from the repo checked
+	// out at `repoDir`.
+	Validate(repoDir string, resources []resource.Resource) ([]string, error)
+}
+
+// Validators runs each of a list of validators in turn, and reports
+// all the problems found by any of them.
+type Validators []ManifestValidator
+
+func (vs Validators) Validate(repoDir string, resources []resource.Resource) ([]string, error) {
+	var problems []string
+	for _, v := range vs {
+		ps, err := v.Validate(repoDir, resources)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, ps...)
+	}
+	return problems, nil
+}
+
+// ValidationError is returned when manifests fail validation, and
+// lists each of the problems found.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "manifest validation failed: " + e.Problems[0]
+	}
+	return fmt.Sprintf("manifest validation failed with %d problems:\n  %s", len(e.Problems), strings.Join(e.Problems, "\n  "))
+}
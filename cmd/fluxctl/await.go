@@ -32,6 +32,10 @@ func await(stdout, stderr io.Writer, client api.ClientService, jobID job.ID, app
 		fmt.Fprintf(stderr, "Nothing to do\n")
 		return nil
 	}
+	if len(metadata.PullRequests) > 0 {
+		printPullRequests(stderr, metadata.PullRequests)
+		return nil
+	}
 
 	if apply && metadata.Revision != "" {
 		if err := awaitSync(client, metadata.Revision); err != nil {
@@ -44,6 +48,16 @@ func await(stdout, stderr io.Writer, client api.ClientService, jobID job.ID, app
 	return nil
 }
 
+// printPullRequests reports the pull requests opened by a job, in
+// place of commits pushed to the branch being synced; there's nothing
+// to wait for, since the changes aren't applied until they're merged.
+func printPullRequests(stderr io.Writer, urls []string) {
+	for _, url := range urls {
+		fmt.Fprintf(stderr, "Pull request:\t%s\n", url)
+	}
+	fmt.Fprintf(stderr, "The change takes effect once the pull request is merged and synced\n")
+}
+
 // await polls for a job to have been completed, with exponential backoff.
 func awaitJob(client api.ClientService, jobID job.ID) (history.CommitEventMetadata, error) {
 	var result history.CommitEventMetadata
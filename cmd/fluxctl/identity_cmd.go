@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/git"
 )
 
 type identityOpts struct {
@@ -20,7 +22,7 @@ func newIdentity(parent *rootOpts) *identityOpts {
 func (opts *identityOpts) Command() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "identity",
-		Short: "Display SSH public key",
+		Short: "Display SSH public key, or how fluxd authenticates to git",
 		RunE:  opts.RunE,
 	}
 	cmd.Flags().BoolVarP(&opts.regenerate, "regenerate", "r", false, `Generate a new identity`)
@@ -29,15 +31,20 @@ func (opts *identityOpts) Command() *cobra.Command {
 	return cmd
 }
 
-func (opts *identityOpts) RunE(_ *cobra.Command, args []string) error {
+func (opts *identityOpts) RunE(cmd *cobra.Command, args []string) error {
 	if len(args) > 0 {
 		return errorWantedNoArgs
 	}
 
-	publicSSHKey, err := opts.API.PublicSSHKey(noInstanceID, opts.regenerate)
+	config, err := opts.API.GitRepoConfig(noInstanceID, opts.regenerate)
 	if err != nil {
 		return err
 	}
+	if config.Auth == git.AuthMethodHTTPS {
+		fmt.Fprintf(cmd.OutOrStderr(), "fluxd authenticates to git over HTTPS, with the credentials in its secret; it does not use an SSH key\n")
+		return nil
+	}
+	publicSSHKey := config.PublicSSHKey
 
 	if opts.visual {
 		opts.fingerprint = true
@@ -59,17 +59,24 @@ func (opts *serviceShowOpts) RunE(cmd *cobra.Command, args []string) error {
 		}
 
 		serviceName := service.ID
-		var lineCount int
+		var lineCount, lastPrinted int
 		for _, container := range service.Containers {
 			containerName := container.Name
 			reg, repo, currentTag := container.Current.ID.Components()
 			if reg != "" {
 				reg += "/"
 			}
+			tagPolicy := ""
+			switch {
+			case container.TagPolicyError != "":
+				tagPolicy = " (invalid tag policy " + container.TagPolicy + ": " + container.TagPolicyError + ")"
+			case container.TagPolicy != "":
+				tagPolicy = " (" + container.TagPolicy + ")"
+			}
 			if len(container.Available) == 0 {
-				fmt.Fprintf(out, "%s\t%s\t%s%s\twaiting for cache\n", serviceName, containerName, reg, repo)
+				fmt.Fprintf(out, "%s\t%s\t%s%s%s\twaiting for cache\n", serviceName, containerName, reg, repo, tagPolicy)
 			} else {
-				fmt.Fprintf(out, "%s\t%s\t%s%s\t\n", serviceName, containerName, reg, repo)
+				fmt.Fprintf(out, "%s\t%s\t%s%s%s\t\n", serviceName, containerName, reg, repo, tagPolicy)
 			}
 			foundRunning := false
 			for _, available := range container.Available {
@@ -82,12 +89,18 @@ func (opts *serviceShowOpts) RunE(cmd *cobra.Command, args []string) error {
 					running = "   "
 				}
 
+				// Point out the image the tag policy picks, if there is one
+				selected := container.TagPolicy != "" && container.Selected != nil && container.Selected.ID == available.ID
+
 				lineCount++
 				var printEllipsis, printLine bool
 				if opts.limit <= 0 || lineCount <= opts.limit {
 					printEllipsis, printLine = false, true
-				} else if container.Current.ID == available.ID {
-					printEllipsis, printLine = lineCount > (opts.limit+1), true
+				} else if container.Current.ID == available.ID || selected {
+					printEllipsis, printLine = lineCount > (lastPrinted+1), true
+				}
+				if printLine {
+					lastPrinted = lineCount
 				}
 				if printEllipsis {
 					fmt.Fprintf(out, "\t\t%s\t\n", ":")
@@ -97,6 +110,9 @@ func (opts *serviceShowOpts) RunE(cmd *cobra.Command, args []string) error {
 					if !available.CreatedAt.IsZero() {
 						createdAt = available.CreatedAt.Format(time.RFC822)
 					}
+					if selected {
+						tag += " <- selected by policy"
+					}
 					fmt.Fprintf(out, "\t\t%s %s\t%s\n", running, tag, createdAt)
 				}
 			}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -55,6 +56,16 @@ func (opts *serviceListOpts) RunE(cmd *cobra.Command, args []string) error {
 		} else {
 			fmt.Fprintf(w, "%s\t\t\t\t\n", s.ID)
 		}
+		if d := s.Deferred; d != nil {
+			reason := "deferred: " + d.Reason
+			if !d.Until.IsZero() {
+				reason += ", until " + d.Until.Format(time.RFC822)
+			}
+			for _, image := range d.Images {
+				fmt.Fprintf(w, "\t\t-> %s\t\t%s\n", image, reason)
+				reason = ""
+			}
+		}
 	}
 	w.Flush()
 	return nil
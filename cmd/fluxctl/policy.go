@@ -36,7 +36,12 @@ func (opts *servicePolicyOpts) Command() *cobra.Command {
 Manage policies for a service.
 
 Tag filter patterns must be specified as 'container=pattern', such as 'foo=1.*'
-where an asterisk means 'match anything'.
+where an asterisk means 'match anything'. Patterns starting with 'semver:' are
+semantic version constraints instead, such as 'foo=semver:~1.4'; the highest
+matching version is used, and pre-releases only if the constraint names one.
+Patterns starting with 'regex:' are regular expressions, such as
+'foo=regex:^master-[0-9a-f]+-(\d+)$'; if there is a capture group, the image
+with the highest captured value (compared as a number, if it is one) is used.
 Surrounding these with single-quotes are recommended to avoid shell expansion.
 
 If both --tag-all and --tag are specified, --tag-all will apply to all
@@ -47,6 +52,8 @@ containers which aren't explicitly named.
 			"fluxctl policy --service=foo --lock",
 			"fluxctl policy --service=foo --tag='bar=1.*' --tag='baz=2.*'",
 			"fluxctl policy --service=foo --tag-all='master-*' --tag='bar=1.*'",
+			"fluxctl policy --service=foo --tag='bar=semver:^1.2'",
+			"fluxctl policy --service=foo --tag='bar=regex:^master-[0-9a-f]+-(\\d+)$'",
 		),
 		RunE: opts.RunE,
 	}
@@ -114,18 +121,26 @@ func calculatePolicyChanges(opts *servicePolicyOpts) (policy.Update, error) {
 		remove = remove.Add(policy.Locked)
 	}
 	if opts.tagAll != "" {
-		add = add.Set(policy.TagAll, "glob:"+opts.tagAll)
+		pattern, err := policy.ParsePattern(opts.tagAll)
+		if err != nil {
+			return policy.Update{}, err
+		}
+		add = add.Set(policy.TagAll, pattern.String())
 	}
 
 	for _, tagPair := range opts.tags {
-		parts := strings.Split(tagPair, "=")
+		parts := strings.SplitN(tagPair, "=", 2)
 		if len(parts) != 2 {
 			return policy.Update{}, fmt.Errorf("invalid container/tag pair: %q. Expected format is 'container=filter'", tagPair)
 		}
 
 		container, tag := parts[0], parts[1]
 		if tag != "*" {
-			add = add.Set(policy.TagPrefix(container), "glob:"+tag)
+			pattern, err := policy.ParsePattern(tag)
+			if err != nil {
+				return policy.Update{}, err
+			}
+			add = add.Set(policy.TagPrefix(container), pattern.String())
 		} else {
 			remove = remove.Add(policy.TagPrefix(container))
 		}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
+)
+
+type releaseApproveOpts struct {
+	*rootOpts
+	outputOpts
+	cause update.Cause
+}
+
+func newReleaseApprove(parent *rootOpts) *releaseApproveOpts {
+	return &releaseApproveOpts{rootOpts: parent}
+}
+
+func (opts *releaseApproveOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "approve <id>",
+		Short: "Approve a proposed release, so it can be made.",
+		Example: makeExample(
+			"fluxctl release approve 5c4e7b9c-65e2-4a0d-8c6f-2b3e1f0d9a71",
+		),
+		RunE: opts.RunE,
+	}
+	AddOutputFlags(cmd, &opts.outputOpts)
+	AddCauseFlags(cmd, &opts.cause)
+	return cmd
+}
+
+func (opts *releaseApproveOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return newUsageError("expected the ID of the release to approve")
+	}
+
+	jobID, err := opts.API.ApproveRelease(noInstanceID, job.ID(args[0]), opts.cause)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := awaitJob(opts.API, jobID)
+	if err != nil {
+		return err
+	}
+	if metadata.Result != nil {
+		update.PrintResults(cmd.OutOrStdout(), metadata.Result, opts.verbose)
+	}
+	if metadata.Revision == "" {
+		fmt.Fprintf(cmd.OutOrStderr(), "Approval recorded; the release needs more approvals before it is made\n")
+		return nil
+	}
+
+	fmt.Fprintf(cmd.OutOrStderr(), "Commit pushed:\t%s\n", metadata.ShortRevision())
+	if len(metadata.PullRequests) > 0 {
+		printPullRequests(cmd.OutOrStderr(), metadata.PullRequests)
+		return nil
+	}
+	if err := awaitSync(opts.API, metadata.Revision); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStderr(), "Commit applied:\t%s\n", metadata.ShortRevision())
+	return nil
+}
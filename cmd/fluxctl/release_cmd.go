@@ -16,7 +16,12 @@ type serviceReleaseOpts struct {
 	image       string
 	allImages   bool
 	exclude     []string
+	namespaces  []string
+	selector    string
+	excludeNS   []string
+	excludeSel  string
 	dryRun      bool
+	propose     bool
 	outputOpts
 	cause update.Cause
 }
@@ -33,6 +38,9 @@ func (opts *serviceReleaseOpts) Command() *cobra.Command {
 			"fluxctl release --service=default/foo --update-image=library/hello:v2",
 			"fluxctl release --all --update-image=library/hello:v2",
 			"fluxctl release --service=default/foo --update-all-images",
+			"fluxctl release --service=default/foo --update-image=library/hello:v2 --propose",
+			"fluxctl release --all --selector=app=hello --namespace='team-*' --update-image=library/hello:v2",
+			"fluxctl release --all --update-image=library/hello:v2 --exclude-namespace=prod --exclude-selector=tier=canary",
 		),
 		RunE: opts.RunE,
 	}
@@ -44,7 +52,13 @@ func (opts *serviceReleaseOpts) Command() *cobra.Command {
 	cmd.Flags().StringVarP(&opts.image, "update-image", "i", "", "update a specific image")
 	cmd.Flags().BoolVar(&opts.allImages, "update-all-images", false, "update all images to latest versions")
 	cmd.Flags().StringSliceVar(&opts.exclude, "exclude", []string{}, "exclude a service")
+	cmd.Flags().StringSliceVar(&opts.namespaces, "namespace", []string{}, "with --all, release only services in namespaces matching this glob")
+	cmd.Flags().StringVarP(&opts.selector, "selector", "l", "", "with --all, release only services with labels matching this selector, e.g., app=foo")
+	cmd.Flags().StringSliceVar(&opts.excludeNS, "exclude-namespace", []string{}, "exclude services in namespaces matching this glob (and, with --exclude-selector, with matching labels)")
+	cmd.Flags().StringVar(&opts.excludeSel, "exclude-selector", "", "exclude services with labels matching this selector (and, with --exclude-namespace, in a matching namespace)")
 	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "do not release anything; just report back what would have been done")
+	cmd.Flags().BoolVar(&opts.propose, "propose", false, "do not release anything yet; report back what would be done, and wait for the release to be approved")
+	cmd.AddCommand(newReleaseApprove(opts.rootOpts).Command())
 	return cmd
 }
 
@@ -57,9 +71,24 @@ func (opts *serviceReleaseOpts) RunE(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if opts.dryRun && opts.propose {
+		return newUsageError("please supply at most one of --dry-run and --propose")
+	}
+
 	if len(opts.services) <= 0 && !opts.allServices {
 		return newUsageError("please supply either --all, or at least one --service=<service>")
 	}
+	// The selection narrows down --all; insisting on both means that
+	// if the daemon doesn't know about selections, it's clear from
+	// the command that everything may be released.
+	if (len(opts.namespaces) > 0 || opts.selector != "") && !opts.allServices {
+		return newUsageError("--namespace and --selector select from all services, so please supply --all as well")
+	}
+	for _, sel := range []string{opts.selector, opts.excludeSel} {
+		if _, err := update.ParseLabelSelector(sel); err != nil {
+			return newUsageError(err.Error())
+		}
+	}
 
 	var services []update.ServiceSpec
 	if opts.allServices {
@@ -88,8 +117,11 @@ func (opts *serviceReleaseOpts) RunE(cmd *cobra.Command, args []string) error {
 	}
 
 	var kind update.ReleaseKind = update.ReleaseKindExecute
-	if opts.dryRun {
+	switch {
+	case opts.dryRun:
 		kind = update.ReleaseKindPlan
+	case opts.propose:
+		kind = update.ReleaseKindPropose
 	}
 
 	var excludes []flux.ServiceID
@@ -101,21 +133,36 @@ func (opts *serviceReleaseOpts) RunE(cmd *cobra.Command, args []string) error {
 		excludes = append(excludes, s)
 	}
 
-	if opts.dryRun {
+	switch {
+	case opts.dryRun:
 		fmt.Fprintf(cmd.OutOrStderr(), "Submitting dry-run release...\n")
-	} else {
+	case opts.propose:
+		fmt.Fprintf(cmd.OutOrStderr(), "Submitting proposed release...\n")
+	default:
 		fmt.Fprintf(cmd.OutOrStderr(), "Submitting release ...\n")
 	}
 
 	jobID, err := opts.API.UpdateImages(noInstanceID, update.ReleaseSpec{
-		ServiceSpecs: services,
-		ImageSpec:    image,
-		Kind:         kind,
-		Excludes:     excludes,
+		ServiceSpecs:      services,
+		ImageSpec:         image,
+		Kind:              kind,
+		Excludes:          excludes,
+		Namespaces:        opts.namespaces,
+		Selector:          opts.selector,
+		ExcludeNamespaces: opts.excludeNS,
+		ExcludeSelector:   opts.excludeSel,
 	}, opts.cause)
 	if err != nil {
 		return err
 	}
 
+	if opts.propose {
+		if err := await(cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, false, opts.verbose); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStderr(), "Release proposed; to approve it, run\n\n\tfluxctl release approve %s\n", jobID)
+		return nil
+	}
+
 	return await(cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, !opts.dryRun, opts.verbose)
 }
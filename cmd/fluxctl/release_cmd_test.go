@@ -37,6 +37,20 @@ func TestReleaseCommand_CLIConversion(t *testing.T) {
 			"kind":    string(update.ReleaseKindExecute),
 			"exclude": "default/test,default/yeah",
 		}},
+		{[]string{"--update-all-images", "--all", "--selector=app=foo", "--namespace=team-*"}, map[string]string{
+			"service":   string(update.ServiceSpecAll),
+			"image":     string(update.ImageSpecLatest),
+			"kind":      string(update.ReleaseKindExecute),
+			"selector":  "app=foo",
+			"namespace": "team-*",
+		}},
+		{[]string{"--update-all-images", "--all", "--exclude-namespace=prod", "--exclude-selector=tier in (canary)"}, map[string]string{
+			"service":           string(update.ServiceSpecAll),
+			"image":             string(update.ImageSpecLatest),
+			"kind":              string(update.ReleaseKindExecute),
+			"exclude-namespace": "prod",
+			"exclude-selector":  "tier in (canary)",
+		}},
 	} {
 		svc := testArgs(t, v.args, false, "")
 
@@ -69,6 +83,9 @@ func TestReleaseCommand_InputFailures(t *testing.T) {
 		{[]string{"--update-all-images"}, "Should error when not specifying service spec"},
 		{[]string{"--service=invalid&service", "--update-all-images"}, "Should error with invalid service"},
 		{[]string{"subcommand"}, "Should error when given subcommand"},
+		{[]string{"--update-all-images", "--all", "--selector=app in foo"}, "Should error with invalid label selector"},
+		{[]string{"--update-all-images", "--selector=app=foo"}, "Should error when selecting without --all"},
+		{[]string{"--update-all-images", "--service=default/flux", "--namespace=default"}, "Should error when selecting without --all"},
 	} {
 		testArgs(t, v.args, true, v.msg)
 	}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/update"
+)
+
+type serviceRollbackOpts struct {
+	*rootOpts
+	service  string
+	to       string
+	event    string
+	revision string
+	outputOpts
+	cause update.Cause
+}
+
+func newServiceRollback(parent *rootOpts) *serviceRollbackOpts {
+	return &serviceRollbackOpts{rootOpts: parent}
+}
+
+func (opts *serviceRollbackOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Return a service to the images it was running before a release.",
+		Example: makeExample(
+			"fluxctl rollback --service=default/foo",
+			"fluxctl rollback --service=default/foo --to=1234",
+			"fluxctl rollback --service=default/foo --to=a54ef2c",
+		),
+		RunE: opts.RunE,
+	}
+	AddOutputFlags(cmd, &opts.outputOpts)
+	AddCauseFlags(cmd, &opts.cause)
+	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Service to roll back")
+	cmd.Flags().StringVar(&opts.to, "to", "", "roll back the release with this event ID, or committed in this revision (or a prefix of it), rather than the most recent release")
+	cmd.Flags().StringVar(&opts.event, "event", "", "roll back the release with this event ID, rather than the most recent release")
+	cmd.Flags().StringVar(&opts.revision, "revision", "", "roll back the release committed in this revision (or a prefix of it), rather than the most recent release")
+	return cmd
+}
+
+func (opts *serviceRollbackOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	if opts.service == "" {
+		return newUsageError("-s, --service is required")
+	}
+	var given int
+	for _, v := range []string{opts.to, opts.event, opts.revision} {
+		if v != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return newUsageError("give only one of --to, --event and --revision")
+	}
+
+	serviceID, err := flux.ParseServiceID(opts.service)
+	if err != nil {
+		return err
+	}
+
+	entries, err := opts.API.History(noInstanceID, update.ServiceSpec(serviceID.String()), time.Time{}, -1, time.Time{})
+	if err != nil {
+		return errors.Wrap(err, "fetching history")
+	}
+	var spec update.RollbackSpec
+	if opts.to != "" {
+		spec, err = rollbackTo(serviceID, entries, opts.to)
+	} else {
+		spec, err = rollbackSpec(serviceID, entries, opts.event, opts.revision)
+	}
+	if err != nil {
+		return err
+	}
+
+	jobID, err := opts.API.Rollback(noInstanceID, spec, opts.cause)
+	if err != nil {
+		return err
+	}
+	return await(cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, false, opts.verbose)
+}
+
+// rollbackTo finds the release given by the value of --to, which is
+// taken to be an event ID if it's a number, and a revision (or a
+// prefix of one) otherwise. A number that could be either is refused,
+// since it's not clear which release was meant.
+func rollbackTo(serviceID flux.ServiceID, entries []history.Entry, to string) (update.RollbackSpec, error) {
+	if _, err := strconv.ParseUint(to, 10, 64); err != nil {
+		return rollbackSpec(serviceID, entries, "", to)
+	}
+	if matchesRevision(serviceID, entries, to) {
+		return update.RollbackSpec{}, fmt.Errorf("%q could be an event ID or a revision; give --event or --revision instead of --to", to)
+	}
+	return rollbackSpec(serviceID, entries, to, "")
+}
+
+// matchesRevision reports whether any release of the service in the
+// history was committed in a revision starting with the prefix given.
+func matchesRevision(serviceID flux.ServiceID, entries []history.Entry, prefix string) bool {
+	for _, entry := range entries {
+		if entry.Event == nil {
+			continue
+		}
+		var common history.ReleaseEventCommon
+		switch metadata := entry.Event.Metadata.(type) {
+		case *history.ReleaseEventMetadata:
+			common = metadata.ReleaseEventCommon
+		case *history.AutoReleaseEventMetadata:
+			common = metadata.ReleaseEventCommon
+		default:
+			continue
+		}
+		if _, ok := common.Result[serviceID]; ok && common.Revision != "" && strings.HasPrefix(common.Revision, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// rollbackSpec finds the release of the service to roll back in the
+// history given -- the one with the event ID or revision given, or
+// else the most recent that hasn't already been rolled back -- and
+// returns a spec for returning each container it updated to the
+// image it was running before.
+func rollbackSpec(serviceID flux.ServiceID, entries []history.Entry, eventID, revision string) (update.RollbackSpec, error) {
+	var found, rolledBack *history.Event
+	var updates []update.ContainerUpdate
+	for _, entry := range entries {
+		event := entry.Event
+		if event == nil {
+			continue
+		}
+		var common history.ReleaseEventCommon
+		var isRollback bool
+		switch metadata := event.Metadata.(type) {
+		case *history.ReleaseEventMetadata:
+			common = metadata.ReleaseEventCommon
+		case *history.AutoReleaseEventMetadata:
+			common = metadata.ReleaseEventCommon
+		case *history.RollbackEventMetadata:
+			common, isRollback = metadata.ReleaseEventCommon, true
+		default:
+			continue
+		}
+		result, ok := common.Result[serviceID]
+		if !ok || result.Status != update.ReleaseStatusSuccess {
+			continue
+		}
+		if isRollback {
+			if rolledBack == nil || event.StartedAt.After(rolledBack.StartedAt) {
+				rolledBack = event
+			}
+			continue
+		}
+		if len(result.PerContainer) == 0 {
+			continue
+		}
+		switch {
+		case eventID != "":
+			if fmt.Sprint(event.ID) == eventID {
+				found, updates = event, result.PerContainer
+			}
+		case revision != "":
+			if common.Revision != "" && strings.HasPrefix(common.Revision, revision) {
+				if found != nil && found.ID != event.ID {
+					return update.RollbackSpec{}, fmt.Errorf("revision %q is ambiguous: it matches releases %d and %d", revision, found.ID, event.ID)
+				}
+				found, updates = event, result.PerContainer
+			}
+		default:
+			if found == nil || event.StartedAt.After(found.StartedAt) {
+				found, updates = event, result.PerContainer
+			}
+		}
+	}
+	switch {
+	case found == nil && eventID != "":
+		return update.RollbackSpec{}, fmt.Errorf("no release of %s found with event ID %s", serviceID, eventID)
+	case found == nil && revision != "":
+		return update.RollbackSpec{}, fmt.Errorf("no release of %s found with revision %q", serviceID, revision)
+	case found == nil:
+		return update.RollbackSpec{}, fmt.Errorf("no release of %s found in the history", serviceID)
+	case eventID == "" && revision == "" && rolledBack != nil && rolledBack.StartedAt.After(found.StartedAt):
+		// Rolling back again would redo the release before it, so
+		// the release to undo has to be picked explicitly
+		return update.RollbackSpec{}, fmt.Errorf("the most recent release of %s (event %d) has already been rolled back (event %d); give --to to roll back an earlier release", serviceID, found.ID, rolledBack.ID)
+	}
+
+	spec := update.RollbackSpec{
+		Reason: fmt.Sprintf("reverting release %d", found.ID),
+	}
+	for _, u := range updates {
+		spec.Changes = append(spec.Changes, update.Change{
+			ServiceID: serviceID,
+			Container: cluster.Container{Name: u.Container, Image: u.Target.String()},
+			ImageID:   u.Current,
+		})
+	}
+	return spec, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/update"
+)
+
+func releaseEntry(t *testing.T, id history.EventID, revision string, started time.Time, service flux.ServiceID, current, target string) history.Entry {
+	c, err := flux.ParseImageID(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg, err := flux.ParseImageID(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return history.Entry{
+		Event: &history.Event{
+			ID:        id,
+			Type:      history.EventRelease,
+			StartedAt: started,
+			Metadata: &history.ReleaseEventMetadata{
+				ReleaseEventCommon: history.ReleaseEventCommon{
+					Revision: revision,
+					Result: update.Result{
+						service: update.ServiceResult{
+							Status: update.ReleaseStatusSuccess,
+							PerContainer: []update.ContainerUpdate{
+								{Container: "hello", Current: c, Target: tg},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestRollbackSpec(t *testing.T) {
+	service := flux.ServiceID("default/hello")
+	now := time.Now()
+	entries := []history.Entry{
+		releaseEntry(t, 3, "cccccccc", now, service, "hello:v2", "hello:v3"),
+		{Event: &history.Event{ID: 4, Type: history.EventSync, StartedAt: now.Add(time.Minute)}},
+		releaseEntry(t, 2, "bbbbbbbb", now.Add(-time.Hour), service, "hello:v1", "hello:v2"),
+		releaseEntry(t, 1, "aaaaaaaa", now.Add(2*time.Hour), "default/other", "other:v1", "other:v2"),
+	}
+
+	change := func(current, target string) []update.Change {
+		id, _ := flux.ParseImageID(current)
+		return []update.Change{{
+			ServiceID: service,
+			Container: cluster.Container{Name: "hello", Image: target},
+			ImageID:   id,
+		}}
+	}
+
+	for _, c := range []struct {
+		event, revision string
+		changes         []update.Change
+		reason          string
+	}{
+		{"", "", change("hello:v2", "hello:v3"), "reverting release 3"},
+		{"2", "", change("hello:v1", "hello:v2"), "reverting release 2"},
+		{"", "bbbb", change("hello:v1", "hello:v2"), "reverting release 2"},
+	} {
+		spec, err := rollbackSpec(service, entries, c.event, c.revision)
+		if err != nil {
+			t.Errorf("--event=%q --revision=%q: %s", c.event, c.revision, err)
+			continue
+		}
+		if !reflect.DeepEqual(spec.Changes, c.changes) {
+			t.Errorf("--event=%q --revision=%q: expected changes %#v, got %#v", c.event, c.revision, c.changes, spec.Changes)
+		}
+		if spec.Reason != c.reason {
+			t.Errorf("--event=%q --revision=%q: expected reason %q, got %q", c.event, c.revision, c.reason, spec.Reason)
+		}
+	}
+
+	for _, c := range []struct{ event, revision string }{
+		{"1", ""}, {"", "aaaa"}, {"5", ""}, {"bbbb", ""}, {"", "2"},
+	} {
+		if _, err := rollbackSpec(service, entries, c.event, c.revision); err == nil {
+			t.Errorf("--event=%q --revision=%q: expected error, got nil", c.event, c.revision)
+		}
+	}
+	if _, err := rollbackSpec("default/none", entries, "", ""); err == nil {
+		t.Error("expected error for service with no releases, got nil")
+	}
+
+	// Once the most recent release has been rolled back, it isn't
+	// picked again; an earlier one has to be asked for
+	rollback := releaseEntry(t, 5, "dddddddd", now.Add(30*time.Minute), service, "hello:v3", "hello:v2")
+	rollback.Event.Type = history.EventRollback
+	rollback.Event.Metadata = &history.RollbackEventMetadata{
+		ReleaseEventCommon: rollback.Event.Metadata.(*history.ReleaseEventMetadata).ReleaseEventCommon,
+	}
+	entries = append([]history.Entry{rollback}, entries...)
+	if _, err := rollbackSpec(service, entries, "", ""); err == nil {
+		t.Error("expected error when the most recent release has been rolled back, got nil")
+	}
+	if spec, err := rollbackSpec(service, entries, "2", ""); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(spec.Changes, change("hello:v1", "hello:v2")) {
+		t.Errorf("expected to roll back release 2, got %#v", spec.Changes)
+	}
+}
+
+func TestRollbackTo(t *testing.T) {
+	service := flux.ServiceID("default/hello")
+	now := time.Now()
+	entries := []history.Entry{
+		releaseEntry(t, 3, "3ccccccc", now, service, "hello:v2", "hello:v3"),
+		releaseEntry(t, 2, "bbbbbbbb", now.Add(-time.Hour), service, "hello:v1", "hello:v2"),
+	}
+
+	for _, to := range []string{"2", "bbbb"} {
+		spec, err := rollbackTo(service, entries, to)
+		if err != nil {
+			t.Errorf("--to=%q: %s", to, err)
+			continue
+		}
+		if spec.Reason != "reverting release 2" {
+			t.Errorf("--to=%q: expected to roll back release 2, got %q", to, spec.Reason)
+		}
+	}
+
+	// "3" is both the ID of an event, and the start of a revision
+	for _, to := range []string{"3", "5", "dddd"} {
+		if _, err := rollbackTo(service, entries, to); err == nil {
+			t.Errorf("--to=%q: expected error, got nil", to)
+		}
+	}
+}
@@ -39,6 +39,8 @@ Workflow:
   fluxctl list-services                                        # Which services are running?
   fluxctl list-images --service=default/foo                    # Which images are running/available?
   fluxctl release --service=default/foo --update-image=bar:v2  # Release new version.
+  fluxctl sync --dry-run                                       # What would the next sync do?
+  fluxctl sync-status --failing                                # Which resources failed to apply?
 `)
 
 const (
@@ -69,7 +71,10 @@ func (opts *rootOpts) Command() *cobra.Command {
 		newServiceDeautomate(opts).Command(),
 		newServiceLock(opts).Command(),
 		newServiceUnlock(opts).Command(),
+		newServiceRollback(opts).Command(),
 		newServicePolicy(opts).Command(),
+		newSync(opts).Command(),
+		newSyncStatus(opts).Command(),
 		newSave(opts).Command(),
 		newIdentity(opts).Command(),
 	)
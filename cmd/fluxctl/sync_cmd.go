@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	fluxsync "github.com/weaveworks/flux/sync"
+)
+
+type syncOpts struct {
+	*rootOpts
+	dryRun bool
+	outputOpts
+}
+
+func newSync(parent *rootOpts) *syncOpts {
+	return &syncOpts{rootOpts: parent}
+}
+
+func (opts *syncOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Synchronise the cluster with the git repo.",
+		Example: makeExample(
+			"fluxctl sync",
+			"fluxctl sync --dry-run",
+		),
+		RunE: opts.RunE,
+	}
+	AddOutputFlags(cmd, &opts.outputOpts)
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "do not sync anything; just report back what would be done")
+	return cmd
+}
+
+func (opts *syncOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+
+	if !opts.dryRun {
+		if err := opts.API.SyncNotify(noInstanceID); err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStderr(), "Sync requested")
+		return nil
+	}
+
+	plan, err := opts.API.SyncPlan(noInstanceID)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for id := range plan {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	w := newTabwriter()
+	fmt.Fprintf(w, "RESOURCE\tACTION\tCHANGES\n")
+	for _, id := range ids {
+		p := plan[id]
+		switch p.Action {
+		case fluxsync.ActionIgnore, fluxsync.ActionUnchanged:
+			if !opts.verbose {
+				continue
+			}
+		}
+		if len(p.Changes) == 0 {
+			fmt.Fprintf(w, "%s\t%s\t\n", id, p.Action)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", id, p.Action, describeChange(p.Changes[0]))
+		for _, c := range p.Changes[1:] {
+			fmt.Fprintf(w, "\t\t%s\n", describeChange(c))
+		}
+	}
+	w.Flush()
+	return nil
+}
+
+func describeChange(c fluxsync.Change) string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("%s: (none) -> %q", c.Path, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s: %q -> (none)", c.Path, c.Old)
+	default:
+		return fmt.Sprintf("%s: %q -> %q", c.Path, c.Old, c.New)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type syncStatusOpts struct {
+	*rootOpts
+	failing bool
+}
+
+func newSyncStatus(parent *rootOpts) *syncStatusOpts {
+	return &syncStatusOpts{rootOpts: parent}
+}
+
+func (opts *syncStatusOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync-status",
+		Short: "Show how each resource fared in the most recent sync.",
+		Example: makeExample(
+			"fluxctl sync-status",
+			"fluxctl sync-status --failing",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().BoolVar(&opts.failing, "failing", false, "only show resources that failed to apply")
+	return cmd
+}
+
+func (opts *syncStatusOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+
+	statuses, err := opts.API.ListSyncStatus(noInstanceID)
+	if err != nil {
+		return err
+	}
+
+	w := newTabwriter()
+	fmt.Fprintf(w, "RESOURCE\tREVISION\tAPPLIED\tERROR\n")
+	for _, s := range statuses {
+		if opts.failing && s.Error == "" {
+			continue
+		}
+		var rev, applied string
+		if s.Revision != "" {
+			rev = shortRevision(s.Revision)
+			applied = s.AppliedAt.Format(time.RFC822)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.ID, rev, applied, s.Error)
+	}
+	w.Flush()
+	return nil
+}
+
+func shortRevision(rev string) string {
+	if len(rev) > 7 {
+		return rev[:7]
+	}
+	return rev
+}
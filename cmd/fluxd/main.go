@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -27,12 +28,15 @@ import (
 	"github.com/weaveworks/flux/history"
 	transport "github.com/weaveworks/flux/http"
 	daemonhttp "github.com/weaveworks/flux/http/daemon"
+	"github.com/weaveworks/flux/integrations"
+	"github.com/weaveworks/flux/integrations/github"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/registry"
 	registryMemcache "github.com/weaveworks/flux/registry/cache"
 	registryMiddleware "github.com/weaveworks/flux/registry/middleware"
 	"github.com/weaveworks/flux/remote"
 	"github.com/weaveworks/flux/ssh"
+	fluxsync "github.com/weaveworks/flux/sync"
 )
 
 var version string
@@ -49,6 +53,20 @@ func optionalVar(fs *pflag.FlagSet, value ssh.OptionalValue, name, usage string)
 	return value
 }
 
+// repeatedValue is a flag that can be given more than once, keeping
+// each value (a string slice flag would split values at commas).
+type repeatedValue []string
+
+func (v *repeatedValue) String() string     { return strings.Join(*v, " ") }
+func (v *repeatedValue) Set(s string) error { *v = append(*v, s); return nil }
+func (v *repeatedValue) Type() string       { return "string" }
+
+func repeatedVar(fs *pflag.FlagSet, name, usage string) *repeatedValue {
+	value := &repeatedValue{}
+	fs.Var(value, name, usage)
+	return value
+}
+
 func main() {
 	// Flag domain.
 	fs := pflag.NewFlagSet("default", pflag.ExitOnError)
@@ -63,6 +81,7 @@ func main() {
 	var (
 		listenAddr        = fs.StringP("listen", "l", ":3030", "Listen address where /metrics and API will be served")
 		kubernetesKubectl = fs.String("kubernetes-kubectl", "", "Optional, explicit path to kubectl tool")
+		kubernetesApplier = fs.String("kubernetes-applier", "kubectl", `how to apply resources to the cluster; either "kubectl", to run kubectl, or "api", to use the Kubernetes API directly (kubectl is then not needed)`)
 		versionFlag       = fs.Bool("version", false, "Get version number")
 		// Git repo & key etc.
 		gitURL          = fs.String("git-url", "", "URL of git repo with Kubernetes manifests; e.g., git@github.com:weaveworks/flux-example")
@@ -73,6 +92,35 @@ func main() {
 		gitSyncTag      = fs.String("git-sync-tag", "flux-sync", "tag to use to mark sync progress for this cluster")
 		gitNotesRef     = fs.String("git-notes-ref", "flux", "ref to use for keeping commit annotations in git notes")
 		gitPollInterval = fs.Duration("git-poll-interval", 5*time.Minute, "period at which to poll git repo for new commits")
+		gitSources      = repeatedVar(fs, "git-source", "another git repo to sync from, as well as --git-url, given as name=<name>,url=<url>[,branch=<branch>][,path=<path>][,sync-tag=<tag>][,notes-ref=<ref>]; the branch defaults to --git-branch, and the sync tag and notes ref to those of --git-sync-tag and --git-notes-ref with -<name> appended; may be given more than once")
+		// manifests
+		manifestFormat = fs.String("manifest-format", "kubernetes", `how to interpret the files at --git-path; either "kubernetes", for Kubernetes YAML files, "overlay", for Kubernetes YAML files composed from a base and an overlay (kustomize-style), or "helm", for Helm charts`)
+		helmPath       = fs.String("helm", "", "Optional, explicit path to helm tool, used to render charts when --manifest-format=helm")
+		helmValues     = fs.String("helm-values", "values.yaml", "values file to render each chart with, and to update, when --manifest-format=helm (relative to the chart directory)")
+		// validation
+		k8sSchemaDir    = fs.String("k8s-schema-dir", "/home/flux/k8s-schemas", "directory of Kubernetes OpenAPI schemas, named for the version of Kubernetes, e.g., v1.8.json; manifests are checked against the schema for the cluster's version before changes to them are committed. The default is where the schemas bundled in the fluxd image are; give an empty value to skip the check")
+		validationRules = fs.String("validation-rules", "", "file of rules in the git repo (relative to the root of the repo) to check manifests against before changes to them are committed")
+		// sync
+		syncGC     = fs.Bool("sync-garbage-collection", false, "delete resources that fluxd applied, when they are removed from the git repo")
+		syncGCMark = fs.String("sync-garbage-collection-mark", "", "value to mark the resources fluxd applies with, for --sync-garbage-collection; only resources with this mark are deleted. Defaults to a hash of the git URL, branch and path of each source, so daemons syncing different repos (or different paths in a repo) to the same cluster won't delete each other's resources")
+		syncStrict = fs.Bool("sync-strict", false, "only move the sync tag when every resource applied successfully; otherwise, report the sync as failed")
+		// commit signing
+		gitSigningKey       = fs.String("git-signing-key", "", "GPG key (e.g., its ID or email) to sign the commits fluxd makes with; if not given, commits are not signed")
+		gitGPGKeys          = fs.String("git-gpg-keys", "", "file, or directory (e.g., a mounted k8s secret) of files, with the private GPG key for --git-signing-key in it; the key must not have a passphrase")
+		gitVerifySignatures = fs.Bool("git-verify-signatures", false, "only sync commits signed by a key in --git-trusted-keys; commits that aren't are reported, and nothing after them is synced")
+		gitTrustedKeys      = fs.String("git-trusted-keys", "", "file, or directory (e.g., a mounted k8s secret) of files, with the public GPG keys trusted to sign commits, for --git-verify-signatures")
+		// pull requests
+		gitPullRequests      = fs.String("git-pull-requests", "", `if given, push changes to a new branch and open a pull request to merge it into --git-branch, rather than pushing to --git-branch; the only provider so far is "github"`)
+		gitPullRequestsToken = fs.String("git-pull-requests-token-file", "/etc/fluxd/pull-requests/token", "file (e.g., in a mounted k8s secret) with the API token used to open pull requests, for --git-pull-requests")
+		gitPullRequestsAPI   = fs.String("git-pull-requests-api-url", "", "base URL of the API used to open pull requests, e.g., for GitHub Enterprise; if not given, the provider's public API is used")
+		// automation
+		automationMaxPerHour = fs.Int("automation-max-per-hour", 0, "maximum number of services to release automatically in any hour (0 for no limit)")
+		automationChain      = fs.StringSlice("automation-chain", nil, "globs of service IDs, in the order automated releases are promoted through them, e.g., 'dev/*,staging/*,prod/*'")
+		automationSoakTime   = fs.Duration("automation-soak-time", 0, "how long the services in a step of --automation-chain must have been ready before promoting to the next step")
+		rollbackDeadline     = fs.Duration("rollback-deadline", 10*time.Minute, "how long a service with the rollback-on-failure policy has to become ready after a release, before the release is rolled back; zero to never roll back. Releases still rolling out when fluxd restarts are picked up again from the notes on synced commits")
+		// releases
+		releaseApprovals       = fs.Int("release-approvals", 1, "number of distinct users who must approve a release proposed with fluxctl release --propose before it is made; users are as given with fluxctl --user, and are not authenticated")
+		releaseApprovalTimeout = fs.Duration("release-approval-timeout", 24*time.Hour, "how long a proposed release waits for approval before it is dropped; zero to wait indefinitely")
 		// registry
 		memcachedHostname    = fs.String("memcached-hostname", "", "Hostname for memcached service to use when caching chunks. If empty, no memcached will be used.")
 		memcachedTimeout     = fs.Duration("memcached-timeout", time.Second, "Maximum time to wait before giving up on memcached requests.")
@@ -86,6 +134,9 @@ func main() {
 		k8sSecretName            = fs.String("k8s-secret-name", "flux-git-deploy", "Name of the k8s secret used to store the private SSH key")
 		k8sSecretVolumeMountPath = fs.String("k8s-secret-volume-mount-path", "/etc/fluxd/ssh", "Mount location of the k8s secret storing the private SSH key")
 		k8sSecretDataKey         = fs.String("k8s-secret-data-key", "identity", "Data key holding the private SSH key within the k8s secret")
+		// git authentication; the ssh keyring above is used with "ssh"
+		gitAuthMethod         = fs.String("git-auth", git.AuthMethodSSH, `how to authenticate to the git repo; either "ssh", to use the deploy key in --k8s-secret-name, or "https", to use the credentials mounted at --k8s-git-credentials-path`)
+		k8sGitCredentialsPath = fs.String("k8s-git-credentials-path", "/etc/fluxd/git-credentials", "Mount location of the k8s secret with credentials for --git-auth=https; it should have either token, or username and password, in it")
 		// SSH key generation
 		sshKeyBits = optionalVar(fs, &ssh.KeyBitsValue{}, "ssh-keygen-bits", "-b argument to ssh-keygen (default unspecified)")
 		sshKeyType = optionalVar(fs, &ssh.KeyTypeValue{}, "ssh-keygen-type", "-t argument to ssh-keygen (default unspecified)")
@@ -123,6 +174,7 @@ func main() {
 	var k8s cluster.Cluster
 	var image_creds func() registry.ImageCreds
 	var k8sManifests cluster.Manifests
+	var validators cluster.Validators
 	{
 		restClientConfig, err := rest.InClusterConfig()
 		if err != nil {
@@ -172,20 +224,30 @@ func main() {
 		logger.Log("identity.pub", publicKey.Key)
 		logger.Log("host", restClientConfig.Host, "version", clusterVersion)
 
-		kubectl := *kubernetesKubectl
-		if kubectl == "" {
-			kubectl, err = exec.LookPath("kubectl")
-		} else {
-			_, err = os.Stat(kubectl)
-		}
-		if err != nil {
-			logger.Log("err", err)
+		var applier kubernetes.Applier
+		switch *kubernetesApplier {
+		case "kubectl":
+			kubectl := *kubernetesKubectl
+			if kubectl == "" {
+				kubectl, err = exec.LookPath("kubectl")
+			} else {
+				_, err = os.Stat(kubectl)
+			}
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			logger.Log("kubectl", kubectl)
+			applier = kubernetes.NewKubectl(kubectl, restClientConfig, os.Stdout, os.Stderr)
+		case "api":
+			logger.Log("applier", "api")
+			applier = kubernetes.NewAPIApplier(clientset)
+		default:
+			logger.Log("err", fmt.Sprintf("unknown applier %q; expected kubectl or api", *kubernetesApplier))
 			os.Exit(1)
 		}
-		logger.Log("kubectl", kubectl)
 
-		kubectlApplier := kubernetes.NewKubectl(kubectl, restClientConfig, os.Stdout, os.Stderr)
-		k8s_inst, err := kubernetes.NewCluster(clientset, kubectlApplier, sshKeyRing, logger)
+		k8s_inst, err := kubernetes.NewCluster(clientset, applier, sshKeyRing, logger)
 		if err != nil {
 			logger.Log("err", err)
 			os.Exit(1)
@@ -199,9 +261,50 @@ func main() {
 
 		image_creds = k8s_inst.ImagesToFetch
 		k8s = k8s_inst
-		// There is only one way we currently interpret a repo of
-		// files as manifests, and that's as Kubernetes yamels.
-		k8sManifests = &kubernetes.Manifests{}
+
+		switch *manifestFormat {
+		case "kubernetes":
+			k8sManifests = &kubernetes.Manifests{}
+		case "overlay":
+			k8sManifests = &kubernetes.OverlayManifests{}
+		case "helm":
+			helm := *helmPath
+			if helm == "" {
+				helm, err = exec.LookPath("helm")
+			} else {
+				_, err = os.Stat(helm)
+			}
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			logger.Log("helm", helm, "values", *helmValues)
+			k8sManifests = kubernetes.NewHelmManifests(helm, *helmValues)
+		default:
+			logger.Log("err", fmt.Sprintf("unknown manifest format %q; expected kubernetes, overlay or helm", *manifestFormat))
+			os.Exit(1)
+		}
+
+		if *k8sSchemaDir != "" {
+			schemaFile := kubernetes.SchemaFile(*k8sSchemaDir, serverVersion.Major, serverVersion.Minor)
+			if _, err := os.Stat(schemaFile); os.IsNotExist(err) && !fs.Changed("k8s-schema-dir") {
+				// The bundled schemas don't cover every version (and
+				// aren't there when running outside the image)
+				logger.Log("schema", "none", "missing", schemaFile)
+			} else {
+				schema, err := kubernetes.NewSchemaValidator(schemaFile)
+				if err != nil {
+					logger.Log("err", err)
+					os.Exit(1)
+				}
+				logger.Log("schema", schemaFile)
+				validators = append(validators, schema)
+			}
+		}
+		if *validationRules != "" {
+			logger.Log("validation-rules", *validationRules)
+			validators = append(validators, kubernetes.RuleValidator{Path: *validationRules})
+		}
 	}
 
 	// Registry components
@@ -268,9 +371,106 @@ func main() {
 		logger.Log("err", err)
 		os.Exit(1)
 	}
+	var gitAuth git.Auth
+	switch *gitAuthMethod {
+	case git.AuthMethodSSH:
+		gitAuth = git.SSHAuth{KeyRing: sshKeyRing}
+	case git.AuthMethodHTTPS:
+		httpsAuth, err := git.NewHTTPSAuth(*k8sGitCredentialsPath)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		gitAuth = httpsAuth
+	default:
+		logger.Log("err", fmt.Errorf("unknown git auth method %q; expected %q or %q", *gitAuthMethod, git.AuthMethodSSH, git.AuthMethodHTTPS))
+		os.Exit(1)
+	}
+	if err := git.CheckURL(gitAuth, gitRemoteConfig.URL); err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
+	logger.Log("component", "git", "auth", gitAuth.Method())
+	var sourceConfigs []daemon.SourceConfig
+	{
+		defaults := daemon.SourceConfig{
+			Remote:   flux.GitRemoteConfig{Branch: *gitBranch},
+			SyncTag:  *gitSyncTag,
+			NotesRef: *gitNotesRef,
+		}
+		names := map[string]bool{}
+		for _, s := range *gitSources {
+			conf, err := daemon.ParseSourceConfig(s, defaults)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			if names[conf.Name] {
+				logger.Log("err", fmt.Sprintf("more than one git source named %q", conf.Name))
+				os.Exit(1)
+			}
+			if err := git.CheckURL(gitAuth, conf.Remote.URL); err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			names[conf.Name] = true
+			sourceConfigs = append(sourceConfigs, conf)
+		}
+	}
+
+	// The keys are read from the files each time they're used, so
+	// these just check that they can be read at all.
+	var signingKeyring, trustedKeyring string
+	if *gitSigningKey != "" {
+		if *gitGPGKeys == "" {
+			logger.Log("err", "--git-signing-key needs --git-gpg-keys")
+			os.Exit(1)
+		}
+		if _, err := git.SigningKey(*gitGPGKeys, *gitSigningKey); err != nil {
+			logger.Log("component", "git", "operation", "reading signing key", "err", err)
+			os.Exit(1)
+		}
+		signingKeyring = *gitGPGKeys
+		logger.Log("component", "git", "signing-key", *gitSigningKey)
+	}
+	if *gitVerifySignatures {
+		if *gitTrustedKeys == "" {
+			logger.Log("err", "--git-verify-signatures needs --git-trusted-keys")
+			os.Exit(1)
+		}
+		if _, err := git.ReadKeyRing(*gitTrustedKeys); err != nil {
+			logger.Log("component", "git", "operation", "reading trusted keys", "err", err)
+			os.Exit(1)
+		}
+		trustedKeyring = *gitTrustedKeys
+		logger.Log("component", "git", "verify-signatures", "true", "trusted-keys", *gitTrustedKeys)
+	}
+
+	var pullRequests integrations.PullRequester
+	switch *gitPullRequests {
+	case "":
+	case "github":
+		tokenBytes, err := ioutil.ReadFile(*gitPullRequestsToken)
+		if err != nil {
+			logger.Log("component", "git", "operation", "reading pull requests token", "err", err)
+			os.Exit(1)
+		}
+		token := strings.TrimSpace(string(tokenBytes))
+		if *gitPullRequestsAPI == "" {
+			pullRequests = github.NewGithubClient(token)
+		} else if pullRequests, err = github.NewGithubEnterpriseClient(token, *gitPullRequestsAPI); err != nil {
+			logger.Log("component", "git", "operation", "creating pull requests client", "err", err)
+			os.Exit(1)
+		}
+		logger.Log("component", "git", "pull-requests", *gitPullRequests)
+	default:
+		logger.Log("err", fmt.Sprintf("--git-pull-requests %q is not supported; the only provider is \"github\"", *gitPullRequests))
+		os.Exit(1)
+	}
+
 	// Indirect reference to a daemon, initially of the NotReady variety
 	notReadyDaemon := daemon.NewNotReadyDaemon(
-		version, k8s, gitRemoteConfig, errors.New("waiting to clone repo"))
+		version, k8s, gitRemoteConfig, gitAuth.Method(), errors.New("waiting to clone repo"))
 
 	daemonRef := daemon.NewRef(notReadyDaemon)
 
@@ -331,13 +531,15 @@ func main() {
 	{
 		repo = git.Repo{
 			GitRemoteConfig: gitRemoteConfig,
-			KeyRing:         sshKeyRing,
+			Auth:            gitAuth,
 		}
 		gitConfig := git.Config{
-			SyncTag:   *gitSyncTag,
-			NotesRef:  *gitNotesRef,
-			UserName:  *gitUser,
-			UserEmail: *gitEmail,
+			SyncTag:        *gitSyncTag,
+			NotesRef:       *gitNotesRef,
+			UserName:       *gitUser,
+			UserEmail:      *gitEmail,
+			SigningKey:     *gitSigningKey,
+			SigningKeyring: signingKeyring,
 		}
 
 		for checkout == nil {
@@ -364,6 +566,49 @@ func main() {
 		}
 	}
 
+	if *syncGC && *syncGCMark == "" {
+		remotes := []string{gitRemoteConfig.URL, gitRemoteConfig.Branch, gitRemoteConfig.Path}
+		for _, conf := range sourceConfigs {
+			remotes = append(remotes, conf.Remote.URL, conf.Remote.Branch, conf.Remote.Path)
+		}
+		*syncGCMark = fluxsync.GCMark(remotes...)
+	}
+
+	var sources []daemon.Source
+	for _, conf := range sourceConfigs {
+		src := daemon.Source{
+			Name: conf.Name,
+			Repo: git.Repo{
+				GitRemoteConfig: conf.Remote,
+				Auth:            gitAuth,
+			},
+		}
+		gitConfig := git.Config{
+			SyncTag:        conf.SyncTag,
+			NotesRef:       conf.NotesRef,
+			UserName:       *gitUser,
+			UserEmail:      *gitEmail,
+			SigningKey:     *gitSigningKey,
+			SigningKeyring: signingKeyring,
+		}
+		for src.Checkout == nil {
+			working, err := src.Repo.Clone(gitConfig)
+			if err != nil {
+				logger.Log("component", "git", "source", conf.Name, "err", err.Error())
+				notReadyDaemon.UpdateReason(err)
+				time.Sleep(10 * time.Second)
+				continue
+			}
+			logger.Log("source", conf.Name,
+				"url", conf.Remote.URL,
+				"working-dir", working.Dir,
+				"sync-tag", conf.SyncTag,
+				"notes-ref", conf.NotesRef)
+			src.Checkout = working
+		}
+		sources = append(sources, src)
+	}
+
 	shutdown := make(chan struct{})
 	shutdownWg := &sync.WaitGroup{}
 
@@ -372,6 +617,13 @@ func main() {
 		jobs = job.NewQueue(shutdown, shutdownWg)
 	}
 
+	// A nil validator means no checks, rather than checks that
+	// always pass.
+	var validator cluster.ManifestValidator
+	if len(validators) > 0 {
+		validator = validators
+	}
+
 	daemon := &daemon.Daemon{
 		V:         version,
 		Cluster:   k8s,
@@ -381,10 +633,23 @@ func main() {
 		Jobs:           jobs,
 		JobStatusCache: &job.StatusCache{Size: 100},
 
-		EventWriter: eventWriter,
-		Logger:      log.NewContext(logger).With("component", "daemon"), LoopVars: &daemon.LoopVars{
-			GitPollInterval:      *gitPollInterval,
-			RegistryPollInterval: *registryPollInterval,
+		EventWriter:  eventWriter,
+		Validator:    validator,
+		Sources:      sources,
+		PullRequests: pullRequests,
+		Logger:       log.NewContext(logger).With("component", "daemon"), LoopVars: &daemon.LoopVars{
+			GitPollInterval:        *gitPollInterval,
+			RegistryPollInterval:   *registryPollInterval,
+			SyncGarbageCollect:     *syncGC,
+			SyncGarbageCollectMark: *syncGCMark,
+			SyncStrict:             *syncStrict,
+			TrustedKeyring:         trustedKeyring,
+			AutomationMaxPerHour:   *automationMaxPerHour,
+			AutomationChain:        *automationChain,
+			AutomationSoakTime:     *automationSoakTime,
+			RollbackDeadline:       *rollbackDeadline,
+			ReleaseApprovals:       *releaseApprovals,
+			ReleaseApprovalTimeout: *releaseApprovalTimeout,
 		},
 	}
 
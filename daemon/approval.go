@@ -0,0 +1,265 @@
+package daemon
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+)
+
+// pendingRelease is a release that's been proposed, and is waiting
+// to be approved before it's made.
+type pendingRelease struct {
+	spec update.Spec // as proposed
+	// the revision the release was planned against, and the result
+	// of planning it
+	revision   string
+	result     update.Result
+	approvers  []string
+	proposedAt time.Time
+}
+
+// pendingReleases keeps the releases that have been proposed, by the
+// ID of the job that proposed them, until they are made or expire.
+// They're also saved in the repo whenever they change (see
+// saveReleases), and read back when the daemon starts.
+type pendingReleases struct {
+	mu    sync.Mutex
+	plans map[job.ID]*pendingRelease
+}
+
+func (p *pendingReleases) propose(id job.ID, spec update.Spec, revision string, result update.Result, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.plans == nil {
+		p.plans = map[job.ID]*pendingRelease{}
+	}
+	p.plans[id] = &pendingRelease{spec: spec, revision: revision, result: result, proposedAt: now}
+}
+
+// expire drops the releases proposed before the time given, that
+// are still waiting for approval.
+func (p *pendingReleases) expire(before time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, plan := range p.plans {
+		if plan.proposedAt.Before(before) {
+			delete(p.plans, id)
+		}
+	}
+}
+
+// get returns a copy of the release as it is now.
+func (p *pendingReleases) get(id job.ID) (pendingRelease, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	plan, ok := p.plans[id]
+	if !ok {
+		return pendingRelease{}, false
+	}
+	res := *plan
+	res.approvers = append([]string(nil), plan.approvers...)
+	return res, true
+}
+
+// approve records the approval of the release by the user given, and
+// returns a copy of the release as it is then. A user approving the
+// same release more than once counts only once.
+func (p *pendingReleases) approve(id job.ID, user string) (pendingRelease, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	plan, ok := p.plans[id]
+	if !ok {
+		return pendingRelease{}, false
+	}
+	approved := false
+	for _, u := range plan.approvers {
+		if u == user {
+			approved = true
+			break
+		}
+	}
+	if !approved {
+		plan.approvers = append(plan.approvers, user)
+	}
+	res := *plan
+	res.approvers = append([]string(nil), plan.approvers...)
+	return res, true
+}
+
+// revise replaces the plan for the release, e.g., because it's been
+// planned again against a later revision. Since what's been approved
+// is no longer what would be released, the approvals are dropped.
+func (p *pendingReleases) revise(id job.ID, revision string, result update.Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if plan, ok := p.plans[id]; ok {
+		plan.revision, plan.result, plan.approvers = revision, result, nil
+	}
+}
+
+func (p *pendingReleases) remove(id job.ID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.plans, id)
+}
+
+// proposals gives the releases waiting for approval, in the form
+// they're saved in the repo.
+func (p *pendingReleases) proposals() []git.Proposal {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var res []git.Proposal
+	for id, plan := range p.plans {
+		res = append(res, git.Proposal{
+			JobID:      id,
+			Spec:       plan.spec,
+			Revision:   plan.revision,
+			Result:     plan.result,
+			Approvers:  append([]string(nil), plan.approvers...),
+			ProposedAt: plan.proposedAt,
+		})
+	}
+	return res
+}
+
+// restore adds the releases saved in the repo to those waiting for
+// approval.
+func (p *pendingReleases) restore(proposals []git.Proposal) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.plans == nil {
+		p.plans = map[job.ID]*pendingRelease{}
+	}
+	for _, prop := range proposals {
+		p.plans[prop.JobID] = &pendingRelease{
+			spec:       prop.Spec,
+			revision:   prop.Revision,
+			result:     prop.Result,
+			approvers:  prop.Approvers,
+			proposedAt: prop.ProposedAt,
+		}
+	}
+}
+
+// approve records an approval of a proposed release and, once it has
+// enough approvals, makes the release. If the repo has moved on since
+// the release was proposed, it's planned again first; and if that
+// comes out differently, the new plan has to be approved afresh.
+func (d *Daemon) approve(spec update.Spec, a update.ApprovalSpec) DaemonJobFunc {
+	return func(jobID job.ID, working *git.Checkout, before map[string]resource.Resource, logger log.Logger) (*history.CommitEventMetadata, error) {
+		if spec.Cause.User == "" {
+			return nil, errors.New("approving a release needs a user")
+		}
+		d.expireReleases()
+		id := job.ID(a.ReleaseID)
+		plan, ok := d.pending.approve(id, spec.Cause.User)
+		d.saveReleases(logger)
+		if !ok {
+			return nil, fmt.Errorf("no release %s waiting for approval; it may have expired", a.ReleaseID)
+		}
+		if len(plan.approvers) < d.releaseApprovals() {
+			return &history.CommitEventMetadata{Spec: &plan.spec, Result: plan.result}, nil
+		}
+
+		proposed, ok := plan.spec.Spec.(update.ReleaseSpec)
+		if !ok {
+			return nil, fmt.Errorf("release %s is not a release of images", a.ReleaseID)
+		}
+		releaseSpec := proposed
+		releaseSpec.Kind = update.ReleaseKindExecute
+		executed := update.Spec{Type: plan.spec.Type, Cause: plan.spec.Cause, Spec: releaseSpec}
+
+		head, err := working.HeadRevision()
+		if err != nil {
+			return nil, err
+		}
+		rc := release.NewReleaseContext(d.Cluster, d.Manifests, d.Registry, working)
+		result, err := release.Release(rc, releaseSpec, logger)
+		if err != nil {
+			return nil, err
+		}
+		if head != plan.revision && !reflect.DeepEqual(result, plan.result) {
+			d.pending.revise(id, head, result)
+			d.saveReleases(logger)
+			return nil, fmt.Errorf("release %s would now have a different result, since the repo has changed; it needs to be approved again", a.ReleaseID)
+		}
+
+		commitMsg := plan.spec.Cause.Message
+		if commitMsg == "" {
+			commitMsg = releaseSpec.CommitMessage()
+		}
+		commitMsg += "\n\nApproved by " + strings.Join(plan.approvers, ", ")
+		if err := d.validate(working, before); err != nil {
+			return nil, err
+		}
+		pr, err := d.commitAndPush(working, commitMsg, &git.Note{JobID: jobID, Spec: executed, Result: result})
+		if err != nil {
+			// As with releases, ask for a sync so the next attempt
+			// is more likely to succeed.
+			d.askForSync()
+			return nil, err
+		}
+		d.pending.remove(id)
+		d.saveReleases(logger)
+		revision, err := working.HeadRevision()
+		if err != nil {
+			return nil, err
+		}
+		return &history.CommitEventMetadata{
+			Revision:     revision,
+			Spec:         &executed,
+			Result:       result,
+			PullRequests: pr,
+		}, nil
+	}
+}
+
+// releaseApprovals is the number of distinct users who must approve
+// a proposed release before it's made.
+func (d *Daemon) releaseApprovals() int {
+	if d.ReleaseApprovals < 1 {
+		return 1
+	}
+	return d.ReleaseApprovals
+}
+
+// expireReleases drops the proposed releases that have been waiting
+// for approval for longer than ReleaseApprovalTimeout, if that's
+// given.
+func (d *Daemon) expireReleases() {
+	if d.ReleaseApprovalTimeout > 0 {
+		d.pending.expire(time.Now().Add(-d.ReleaseApprovalTimeout))
+	}
+}
+
+// saveReleases saves the releases waiting for approval in the repo,
+// so that they aren't lost if the daemon restarts. They're kept with
+// the first source, whichever source they release to.
+func (d *Daemon) saveReleases(logger log.Logger) {
+	if err := d.Checkout.SaveProposals(d.pending.proposals()); err != nil {
+		logger.Log("err", errors.Wrap(err, "saving proposed releases"))
+	}
+}
+
+// restoreReleases reads back the releases waiting for approval that
+// were saved in the repo.
+func (d *Daemon) restoreReleases(logger log.Logger) {
+	proposals, err := d.Checkout.Proposals()
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "reading proposed releases"))
+		return
+	}
+	d.pending.restore(proposals)
+}
@@ -0,0 +1,156 @@
+package daemon
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
+)
+
+func TestPendingReleasesApprove(t *testing.T) {
+	var p pendingReleases
+	id := job.ID("release")
+	if _, ok := p.approve(id, "alice"); ok {
+		t.Fatal("expected approving an unknown release to fail")
+	}
+
+	p.propose(id, update.Spec{Type: update.Images}, "rev1", update.Result{}, time.Now())
+	for _, c := range []struct {
+		user      string
+		approvers []string
+	}{
+		{"alice", []string{"alice"}},
+		{"alice", []string{"alice"}}, // approving twice counts once
+		{"bob", []string{"alice", "bob"}},
+	} {
+		plan, ok := p.approve(id, c.user)
+		if !ok {
+			t.Fatalf("expected release to be found")
+		}
+		if !reflect.DeepEqual(plan.approvers, c.approvers) {
+			t.Errorf("after approval by %s: expected approvers %v, got %v", c.user, c.approvers, plan.approvers)
+		}
+	}
+
+	// revising the plan drops the approvals
+	p.revise(id, "rev2", update.Result{"default/helloworld": update.ServiceResult{Status: update.ReleaseStatusSuccess}})
+	plan, _ := p.approve(id, "carol")
+	if plan.revision != "rev2" || len(plan.result) != 1 {
+		t.Errorf("expected revised plan, got %+v", plan)
+	}
+	if !reflect.DeepEqual(plan.approvers, []string{"carol"}) {
+		t.Errorf("expected only the approval since revising, got %v", plan.approvers)
+	}
+
+	p.remove(id)
+	if _, ok := p.approve(id, "alice"); ok {
+		t.Fatal("expected approving a removed release to fail")
+	}
+}
+
+func TestPendingReleasesExpire(t *testing.T) {
+	var p pendingReleases
+	now := time.Now()
+	p.propose("old", update.Spec{Type: update.Images}, "rev1", update.Result{}, now.Add(-2*time.Hour))
+	p.propose("new", update.Spec{Type: update.Images}, "rev1", update.Result{}, now)
+
+	p.expire(now.Add(-time.Hour))
+	if _, ok := p.get("old"); ok {
+		t.Error("expected release proposed before the expiry time to be dropped")
+	}
+	if _, ok := p.get("new"); !ok {
+		t.Error("expected release proposed since the expiry time to be kept")
+	}
+}
+
+// Proposed releases, and their approvals, are saved in the repo, and
+// picked up again when the daemon restarts.
+func TestDaemon_RestoresProposedReleases(t *testing.T) {
+	d, clean, _, _ := mockDaemon(t)
+	defer clean()
+
+	id := job.ID("release")
+	proposedAt := time.Now().Add(-time.Minute).UTC()
+	d.pending.propose(id, update.Spec{Type: update.Images, Spec: update.ReleaseSpec{
+		ServiceSpecs: []update.ServiceSpec{update.ServiceSpecAll},
+		ImageSpec:    update.ImageSpecLatest,
+		Kind:         update.ReleaseKindPropose,
+	}}, "rev1", update.Result{}, proposedAt)
+	d.pending.approve(id, "alice")
+	d.saveReleases(log.NewNopLogger())
+
+	restarted := &Daemon{Checkout: d.Checkout, LoopVars: &LoopVars{}}
+	restarted.restoreReleases(log.NewNopLogger())
+	plan, ok := restarted.pending.get(id)
+	if !ok {
+		t.Fatal("expected the proposed release to be restored")
+	}
+	if plan.revision != "rev1" || !plan.proposedAt.Equal(proposedAt) || !reflect.DeepEqual(plan.approvers, []string{"alice"}) {
+		t.Errorf("expected the release as proposed and approved, got %+v", plan)
+	}
+}
+
+// If the repo has moved on since a release was proposed, approving it
+// plans it again; if the plan comes out differently, it has to be
+// approved afresh, and otherwise it goes ahead.
+func TestDaemon_ApproveReplansStaleRelease(t *testing.T) {
+	d, clean, _, _ := mockDaemon(t)
+	defer clean()
+
+	id := job.ID("release")
+	d.pending.propose(id, update.Spec{Type: update.Images, Spec: update.ReleaseSpec{
+		ServiceSpecs: []update.ServiceSpec{update.ServiceSpec(svc)},
+		ImageSpec:    newHelloImage,
+		Kind:         update.ReleaseKindPropose,
+	}}, "stale", update.Result{}, time.Now())
+
+	approve := func(user string) (*history.CommitEventMetadata, error) {
+		working, err := d.Checkout.WorkingClone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer working.Clean()
+		a := update.ApprovalSpec{ReleaseID: string(id)}
+		spec := update.Spec{Type: update.Approval, Cause: update.Cause{User: user}, Spec: a}
+		return d.approve(spec, a)(job.ID("approval-"+user), working, nil, log.NewNopLogger())
+	}
+
+	// The release would now update the service, which it wouldn't
+	// have when proposed
+	if _, err := approve("alice"); err == nil {
+		t.Fatal("expected approving a release with a different result to fail")
+	}
+	head, err := d.Checkout.HeadRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, ok := d.pending.get(id)
+	if !ok {
+		t.Fatal("expected the release to be waiting for approval still")
+	}
+	if plan.revision != head || len(plan.approvers) != 0 {
+		t.Errorf("expected the release to be planned again at %s, without approvals, got %+v", head, plan)
+	}
+	if res := plan.result[svc]; res.Status != update.ReleaseStatusSuccess {
+		t.Errorf("expected the revised plan to update %s, got %+v", svc, res)
+	}
+
+	// Had the repo moved on without changing the result, the release
+	// goes ahead with the approvals it has
+	d.pending.revise(id, "stale", plan.result)
+	metadata, err := approve("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Revision == "" || metadata.Result[svc].Status != update.ReleaseStatusSuccess {
+		t.Errorf("expected the release to be committed, got %+v", metadata)
+	}
+	if _, ok := d.pending.get(id); ok {
+		t.Error("expected the release to be done with once made")
+	}
+}
@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/policy"
+)
+
+// automationLimits keeps track of automated releases, so that they
+// can be held back according to each service's automation window and
+// interval, and the limit on automated releases per hour. It also
+// keeps the releases that are being held back, so they can be
+// reported.
+type automationLimits struct {
+	mu          sync.RWMutex
+	lastRelease map[flux.ServiceID]time.Time
+	// the times of the automated releases in the last hour, oldest
+	// first
+	recent   []time.Time
+	deferred map[flux.ServiceID]flux.DeferredRelease
+}
+
+// check returns the reason an automated release of the service,
+// with the policies given, can't go ahead at the time given, and
+// when it may go ahead (if that's known); or an empty reason if it
+// can go ahead. `maxPerHour` is the limit on automated releases in
+// any hour, if it's more than zero; `queued` is the number of
+// automated releases about to be made, which count against the limit
+// as well as those already made.
+func (a *automationLimits) check(id flux.ServiceID, policies policy.Set, maxPerHour, queued int, now time.Time) (string, time.Time) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if value, ok := policies.Get(policy.AutomationWindow); ok {
+		windows, err := policy.ParseWindows(value)
+		if err != nil {
+			return errors.Wrap(err, "invalid automation window").Error(), time.Time{}
+		}
+		if !windows.Contains(now) {
+			return "outside automation window", windows.Next(now)
+		}
+	}
+	if value, ok := policies.Get(policy.AutomationInterval); ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.Wrap(err, "invalid automation interval").Error(), time.Time{}
+		}
+		if last, ok := a.lastRelease[id]; ok && now.Before(last.Add(interval)) {
+			return fmt.Sprintf("released less than %s ago", interval), last.Add(interval)
+		}
+	}
+	if maxPerHour > 0 {
+		recent := a.since(now.Add(-time.Hour))
+		if len(recent)+queued >= maxPerHour {
+			// There's room for another release once enough of the
+			// recent ones are an hour old; if the queued releases
+			// alone use up the limit, that's not known yet.
+			var until time.Time
+			if i := len(recent) + queued - maxPerHour; i < len(recent) {
+				until = recent[i].Add(time.Hour)
+			}
+			return fmt.Sprintf("limit of %d automated releases per hour reached", maxPerHour), until
+		}
+	}
+	return "", time.Time{}
+}
+
+// since returns the times of recent releases after the time given.
+func (a *automationLimits) since(t time.Time) []time.Time {
+	for i, r := range a.recent {
+		if r.After(t) {
+			return a.recent[i:]
+		}
+	}
+	return nil
+}
+
+// released records an automated release of the service at the time
+// given. It's called once the release has been committed, so that
+// releases that fail, or come to nothing, don't count.
+func (a *automationLimits) released(id flux.ServiceID, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.lastRelease == nil {
+		a.lastRelease = map[flux.ServiceID]time.Time{}
+	}
+	a.lastRelease[id] = now
+	a.recent = append(a.since(now.Add(-time.Hour)), now)
+}
+
+// setDeferred records the releases being held back, replacing those
+// recorded before, and returns those that weren't recorded before
+// (or were, but for a different reason or images).
+func (a *automationLimits) setDeferred(deferred map[flux.ServiceID]flux.DeferredRelease) map[flux.ServiceID]flux.DeferredRelease {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	changed := map[flux.ServiceID]flux.DeferredRelease{}
+	for id, d := range deferred {
+		if old, ok := a.deferred[id]; !ok || old.Reason != d.Reason || !sameImages(old.Images, d.Images) {
+			changed[id] = d
+		}
+	}
+	a.deferred = deferred
+	return changed
+}
+
+func (a *automationLimits) forService(id flux.ServiceID) *flux.DeferredRelease {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if d, ok := a.deferred[id]; ok {
+		return &d
+	}
+	return nil
+}
+
+func sameImages(a, b []flux.ImageID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/policy"
+)
+
+func TestAutomationLimits(t *testing.T) {
+	var a automationLimits
+	// a Monday
+	now := time.Date(2017, 10, 2, 10, 0, 0, 0, time.UTC)
+	svc := flux.ServiceID("default/helloworld")
+	other := flux.ServiceID("default/other")
+
+	for _, c := range []struct {
+		policies policy.Set
+		reason   string
+		until    time.Time
+	}{
+		{policy.Set{}, "", time.Time{}},
+		{policy.Set{policy.AutomationWindow: "Mon-Fri 09:00-17:00"}, "", time.Time{}},
+		{policy.Set{policy.AutomationWindow: "Sat-Sun 09:00-17:00"}, "outside automation window", time.Date(2017, 10, 7, 9, 0, 0, 0, time.UTC)},
+		{policy.Set{policy.AutomationWindow: "whenever"}, "invalid automation window", time.Time{}},
+		{policy.Set{policy.AutomationInterval: "1h"}, "", time.Time{}},
+		{policy.Set{policy.AutomationInterval: "often"}, "invalid automation interval", time.Time{}},
+	} {
+		reason, until := a.check(svc, c.policies, 0, 0, now)
+		if (c.reason == "") != (reason == "") || !strings.HasPrefix(reason, c.reason) || !until.Equal(c.until) {
+			t.Errorf("%v: expected %q until %s, got %q until %s", c.policies, c.reason, c.until, reason, until)
+		}
+	}
+
+	a.released(svc, now)
+	interval := policy.Set{policy.AutomationInterval: "1h"}
+	if reason, until := a.check(svc, interval, 0, 0, now.Add(30*time.Minute)); reason == "" || !until.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected release to be held back until %s, got %q until %s", now.Add(time.Hour), reason, until)
+	}
+	if reason, _ := a.check(svc, interval, 0, 0, now.Add(time.Hour)); reason != "" {
+		t.Errorf("expected release to go ahead after interval, got %q", reason)
+	}
+	if reason, _ := a.check(other, interval, 0, 0, now.Add(30*time.Minute)); reason != "" {
+		t.Errorf("expected release of another service to go ahead, got %q", reason)
+	}
+
+	a.released(other, now.Add(10*time.Minute))
+	if reason, until := a.check(other, policy.Set{}, 2, 0, now.Add(20*time.Minute)); reason == "" || !until.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected release to be held back by limit until %s, got %q until %s", now.Add(time.Hour), reason, until)
+	}
+	if reason, _ := a.check(other, policy.Set{}, 3, 0, now.Add(20*time.Minute)); reason != "" {
+		t.Errorf("expected release to go ahead under limit, got %q", reason)
+	}
+	if reason, _ := a.check(other, policy.Set{}, 2, 0, now.Add(61*time.Minute)); reason != "" {
+		t.Errorf("expected release to go ahead when a release is more than an hour ago, got %q", reason)
+	}
+	// Releases about to be made count against the limit too
+	if reason, until := a.check(other, policy.Set{}, 3, 1, now.Add(20*time.Minute)); reason == "" || !until.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected release to be held back by limit until %s, got %q until %s", now.Add(time.Hour), reason, until)
+	}
+	if reason, until := a.check(other, policy.Set{}, 1, 1, now.Add(61*time.Minute)); reason == "" || !until.IsZero() {
+		t.Errorf("expected release to be held back by queued releases, got %q until %s", reason, until)
+	}
+}
+
+func TestAutomationDeferred(t *testing.T) {
+	var a automationLimits
+	svc := flux.ServiceID("default/helloworld")
+	image, _ := flux.ParseImageID("quay.io/weaveworks/helloworld:master-a000002")
+	deferred := map[flux.ServiceID]flux.DeferredRelease{
+		svc: {Images: []flux.ImageID{image}, Reason: "outside automation window"},
+	}
+	if changed := a.setDeferred(deferred); len(changed) != 1 {
+		t.Errorf("expected new deferred release to be reported, got %v", changed)
+	}
+	if changed := a.setDeferred(deferred); len(changed) != 0 {
+		t.Errorf("expected the same deferred release not to be reported again, got %v", changed)
+	}
+	if d := a.forService(svc); d == nil || d.Reason != "outside automation window" {
+		t.Errorf("expected deferred release for service, got %v", d)
+	}
+	a.setDeferred(nil)
+	if d := a.forService(svc); d != nil {
+		t.Errorf("expected no deferred release, got %v", d)
+	}
+}
@@ -14,11 +14,14 @@ import (
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/guid"
 	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/integrations"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/release"
 	"github.com/weaveworks/flux/remote"
+	"github.com/weaveworks/flux/resource"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -35,6 +38,16 @@ type Daemon struct {
 	JobStatusCache *job.StatusCache
 	EventWriter    history.EventWriter
 	Logger         log.Logger
+	// Validator checks manifests before changes to them are
+	// committed; if nil, they aren't checked.
+	Validator cluster.ManifestValidator
+	// Sources are git repos to sync from as well as Repo, each
+	// with its own checkout
+	Sources []Source
+	// PullRequests, if set, is used to open a pull request for each
+	// commit made, which is pushed to a branch of its own rather than
+	// to the branch being synced
+	PullRequests integrations.PullRequester
 	// bookkeeping
 	*LoopVars
 }
@@ -60,10 +73,7 @@ func (d *Daemon) ListServices(namespace string) ([]flux.ServiceStatus, error) {
 		return nil, errors.Wrap(err, "getting services from cluster")
 	}
 
-	d.Checkout.RLock()
-	defer d.Checkout.RUnlock()
-
-	services, err := d.Manifests.ServicesWithPolicies(d.Checkout.ManifestDir())
+	services, err := d.servicesWithPolicies()
 	if err != nil {
 		return nil, errors.Wrap(err, "getting service policies")
 	}
@@ -79,6 +89,8 @@ func (d *Daemon) ListServices(namespace string) ([]flux.ServiceStatus, error) {
 			Locked:     policies.Contains(policy.Locked),
 			Ignore:     policies.Contains(policy.Ignore),
 			Policies:   policies.ToStringMap(),
+			Sync:       d.syncStatus.forService(service.ID),
+			Deferred:   d.automation.forService(service.ID),
 		})
 	}
 
@@ -104,9 +116,14 @@ func (d *Daemon) ListImages(spec update.ServiceSpec) ([]flux.ImageStatus, error)
 		return nil, errors.Wrap(err, "getting images for services")
 	}
 
+	policies, err := d.servicesWithPolicies()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting service policies")
+	}
+
 	var res []flux.ImageStatus
 	for _, service := range services {
-		containers := containersWithAvailable(service, images)
+		containers := containersWithAvailable(service, images, policies[service.ID], d.Logger)
 		res = append(res, flux.ImageStatus{
 			ID:         service.ID,
 			Containers: containers,
@@ -118,47 +135,55 @@ func (d *Daemon) ListImages(spec update.ServiceSpec) ([]flux.ImageStatus, error)
 
 // Let's use the CommitEventMetadata as a convenient transport for the
 // results of a job; if no commit was made (e.g., if it was a dry
-// run), leave the revision field empty.
-type DaemonJobFunc func(jobID job.ID, working *git.Checkout, logger log.Logger) (*history.CommitEventMetadata, error)
-
-func (d *Daemon) queueJob(do DaemonJobFunc) job.ID {
+// run), leave the revision field empty. `before` are the resources
+// in the working clone before the job changed anything, if they were
+// loaded (they're needed only to validate changes).
+type DaemonJobFunc func(jobID job.ID, working *git.Checkout, before map[string]resource.Resource, logger log.Logger) (*history.CommitEventMetadata, error)
+
+// queueJob queues a job to be done in the working clone of each of
+// the sources given, in turn. When a job is done in more than one
+// source, a source it makes no changes to is passed over, and the
+// results are combined; the revision reported is that of the first
+// commit made. If the job fails in a source, it stops there (commits
+// already pushed to other sources stay).
+func (d *Daemon) queueJob(sources []Source, do DaemonJobFunc) job.ID {
 	id := job.ID(guid.New())
 	d.Jobs.Enqueue(&job.Job{
 		ID: id,
 		Do: func(logger log.Logger) error {
-			started := time.Now().UTC()
 			d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusRunning})
-			// make a working clone so we don't mess with files we
-			// will be reading from elsewhere
-			working, err := d.Checkout.WorkingClone()
-			if err != nil {
-				d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusFailed, Err: err.Error()})
-				return err
+			var metadata *history.CommitEventMetadata
+			for _, src := range sources {
+				srcLogger := logger
+				if len(sources) > 1 {
+					srcLogger = log.NewContext(logger).With("source", src)
+				}
+				m, err := d.doJobIn(src, id, do, srcLogger)
+				if err != nil && len(sources) > 1 && errors.Cause(err) == git.ErrNoChanges {
+					continue
+				}
+				if err != nil {
+					d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusFailed, Err: err.Error()})
+					return err
+				}
+				if metadata == nil {
+					metadata = m
+					continue
+				}
+				if metadata.Revision == "" {
+					metadata.Revision = m.Revision
+				}
+				metadata.PullRequests = append(metadata.PullRequests, m.PullRequests...)
+				if metadata.Result == nil {
+					metadata.Result = update.Result{}
+				}
+				mergeResults(metadata.Result, m.Result)
 			}
-			defer working.Clean()
-			metadata, err := do(id, working, logger)
-			if err != nil {
-				d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusFailed, Err: err.Error()})
-				return err
+			if metadata == nil {
+				d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusFailed, Err: git.ErrNoChanges.Error()})
+				return git.ErrNoChanges
 			}
 			d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusSucceeded, Result: *metadata})
-			logger.Log("revision", metadata.Revision)
-			if metadata.Revision != "" {
-				var serviceIDs []flux.ServiceID
-				for id, result := range metadata.Result {
-					if result.Status == update.ReleaseStatusSuccess {
-						serviceIDs = append(serviceIDs, id)
-					}
-				}
-				return d.LogEvent(history.Event{
-					ServiceIDs: serviceIDs,
-					Type:       history.EventCommit,
-					StartedAt:  started,
-					EndedAt:    started,
-					LogLevel:   history.LogLevelInfo,
-					Metadata:   metadata,
-				})
-			}
 			return nil
 		},
 	})
@@ -166,6 +191,52 @@ func (d *Daemon) queueJob(do DaemonJobFunc) job.ID {
 	return id
 }
 
+// doJobIn does a job in a working clone of the source given, and if
+// it made a commit, logs an event for it.
+func (d *Daemon) doJobIn(src Source, id job.ID, do DaemonJobFunc, logger log.Logger) (*history.CommitEventMetadata, error) {
+	started := time.Now().UTC()
+	// make a working clone so we don't mess with files we
+	// will be reading from elsewhere
+	working, err := src.Checkout.WorkingClone()
+	if err != nil {
+		return nil, err
+	}
+	defer working.Clean()
+	var before map[string]resource.Resource
+	if d.Validator != nil {
+		// Load the manifests before the job changes anything, so
+		// that validate can tell what it changed. If they can't be
+		// loaded, everything is validated.
+		if before, err = d.Manifests.LoadManifests(working.ManifestDir()); err != nil {
+			logger.Log("err", errors.Wrap(err, "loading resources before job"))
+		}
+	}
+	metadata, err := do(id, working, before, logger)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log("revision", metadata.Revision)
+	if metadata.Revision != "" {
+		var serviceIDs []flux.ServiceID
+		for id, result := range metadata.Result {
+			if result.Status == update.ReleaseStatusSuccess {
+				serviceIDs = append(serviceIDs, id)
+			}
+		}
+		if err := d.LogEvent(history.Event{
+			ServiceIDs: serviceIDs,
+			Type:       history.EventCommit,
+			StartedAt:  started,
+			EndedAt:    started,
+			LogLevel:   history.LogLevelInfo,
+			Metadata:   metadata,
+		}); err != nil {
+			logger.Log("err", err)
+		}
+	}
+	return metadata, nil
+}
+
 // Apply the desired changes to the config files
 func (d *Daemon) UpdateManifests(spec update.Spec) (job.ID, error) {
 	var id job.ID
@@ -173,17 +244,53 @@ func (d *Daemon) UpdateManifests(spec update.Spec) (job.ID, error) {
 		return id, errors.New("no type in update spec")
 	}
 	switch s := spec.Spec.(type) {
+	case update.RollbackSpec:
+		sources, err := d.sourcesFor(servicesNamed(s))
+		if err != nil {
+			return id, err
+		}
+		return d.queueJob(sources, d.rollback(spec, s)), nil
+	case update.ApprovalSpec:
+		// The release is made in the source it was proposed in, or
+		// if there's no such release, the job will say so
+		sources := d.sources()[:1]
+		if plan, ok := d.pending.get(job.ID(s.ReleaseID)); ok {
+			if c, ok := plan.spec.Spec.(release.Changes); ok {
+				var err error
+				if sources, err = d.sourcesFor(servicesNamed(c)); err != nil {
+					return id, err
+				}
+			}
+		}
+		return d.queueJob(sources, d.approve(spec, s)), nil
 	case release.Changes:
-		return d.queueJob(d.release(spec, s)), nil
+		sources, err := d.sourcesFor(servicesNamed(s))
+		if err != nil {
+			return id, err
+		}
+		// A proposal is planned against a single revision, so it
+		// can't span sources
+		if s.ReleaseKind() == update.ReleaseKindPropose && len(sources) > 1 {
+			return id, errors.New("a release to services in more than one git source can't be proposed; propose a release for each source")
+		}
+		return d.queueJob(sources, d.release(spec, s)), nil
 	case policy.Updates:
-		return d.queueJob(d.updatePolicy(spec, s)), nil
+		var ids []flux.ServiceID
+		for serviceID := range s {
+			ids = append(ids, serviceID)
+		}
+		sources, err := d.sourcesFor(ids)
+		if err != nil {
+			return id, err
+		}
+		return d.queueJob(sources, d.updatePolicy(spec, s)), nil
 	default:
 		return id, fmt.Errorf(`unknown update type "%s"`, spec.Type)
 	}
 }
 
 func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) DaemonJobFunc {
-	return func(jobID job.ID, working *git.Checkout, logger log.Logger) (*history.CommitEventMetadata, error) {
+	return func(jobID job.ID, working *git.Checkout, before map[string]resource.Resource, logger log.Logger) (*history.CommitEventMetadata, error) {
 		// For each update
 		var serviceIDs []flux.ServiceID
 		metadata := &history.CommitEventMetadata{
@@ -238,7 +345,11 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) DaemonJo
 			return metadata, nil
 		}
 
-		if err := working.CommitAndPush(policyCommitMessage(updates, spec.Cause), &git.Note{JobID: jobID, Spec: spec}); err != nil {
+		if err := d.validate(working, before); err != nil {
+			return nil, err
+		}
+		pr, err := d.commitAndPush(working, policyCommitMessage(updates, spec.Cause), &git.Note{JobID: jobID, Spec: spec})
+		if err != nil {
 			// On the chance pushing failed because it was not
 			// possible to fast-forward, ask for a sync so the
 			// next attempt is more likely to succeed.
@@ -249,7 +360,7 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) DaemonJo
 			d.askForImagePoll()
 		}
 
-		var err error
+		metadata.PullRequests = pr
 		metadata.Revision, err = working.HeadRevision()
 		if err != nil {
 			return nil, err
@@ -259,7 +370,7 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) DaemonJo
 }
 
 func (d *Daemon) release(spec update.Spec, c release.Changes) DaemonJobFunc {
-	return func(jobID job.ID, working *git.Checkout, logger log.Logger) (*history.CommitEventMetadata, error) {
+	return func(jobID job.ID, working *git.Checkout, before map[string]resource.Resource, logger log.Logger) (*history.CommitEventMetadata, error) {
 		rc := release.NewReleaseContext(d.Cluster, d.Manifests, d.Registry, working)
 		result, err := release.Release(rc, c, logger)
 		if err != nil {
@@ -267,12 +378,17 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) DaemonJobFunc {
 		}
 
 		var revision string
+		var pr []string
 		if c.ReleaseKind() == update.ReleaseKindExecute {
 			commitMsg := spec.Cause.Message
 			if commitMsg == "" {
 				commitMsg = c.CommitMessage()
 			}
-			if err := working.CommitAndPush(commitMsg, &git.Note{JobID: jobID, Spec: spec, Result: result}); err != nil {
+			if err := d.validate(working, before); err != nil {
+				return nil, err
+			}
+			pr, err = d.commitAndPush(working, commitMsg, &git.Note{JobID: jobID, Spec: spec, Result: result})
+			if err != nil {
 				// On the chance pushing failed because it was not
 				// possible to fast-forward, ask for a sync so the
 				// next attempt is more likely to succeed.
@@ -283,11 +399,29 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) DaemonJobFunc {
 			if err != nil {
 				return nil, err
 			}
+			if spec.Type == update.Auto {
+				now := time.Now()
+				for id, r := range result {
+					if r.Status == update.ReleaseStatusSuccess {
+						d.automation.released(id, now)
+					}
+				}
+			}
+		}
+		if c.ReleaseKind() == update.ReleaseKindPropose {
+			head, err := working.HeadRevision()
+			if err != nil {
+				return nil, err
+			}
+			d.expireReleases()
+			d.pending.propose(jobID, spec, head, result, time.Now())
+			d.saveReleases(logger)
 		}
 		return &history.CommitEventMetadata{
-			Revision: revision,
-			Spec:     &spec,
-			Result:   result,
+			Revision:     revision,
+			Spec:         &spec,
+			Result:       result,
+			PullRequests: pr,
 		}, nil
 	}
 }
@@ -313,24 +447,26 @@ func (d *Daemon) JobStatus(jobID job.ID) (job.Status, error) {
 	// Look through the commits for a note referencing this job.  This
 	// means that even if fluxd restarts, we will at least remember
 	// jobs which have pushed a commit.
-	if err := d.Checkout.Pull(); err != nil {
-		return job.Status{}, errors.Wrap(err, "updating repo for status")
-	}
-	commits, err := d.Checkout.CommitsBefore("HEAD")
-	if err != nil {
-		return job.Status{}, errors.Wrap(err, "checking revisions for status")
-	}
-	for _, commit := range commits {
-		note, _ := d.Checkout.GetNote(commit.Revision)
-		if note != nil && note.JobID == jobID {
-			return job.Status{
-				StatusString: job.StatusSucceeded,
-				Result: history.CommitEventMetadata{
-					Revision: commit.Revision,
-					Spec:     &note.Spec,
-					Result:   note.Result,
-				},
-			}, nil
+	for _, src := range d.sources() {
+		if err := src.Checkout.Pull(); err != nil {
+			return job.Status{}, errors.Wrapf(err, "updating repo for status, in source %s", src)
+		}
+		commits, err := src.Checkout.CommitsBefore("HEAD")
+		if err != nil {
+			return job.Status{}, errors.Wrapf(err, "checking revisions for status, in source %s", src)
+		}
+		for _, commit := range commits {
+			note, _ := src.Checkout.GetNote(commit.Revision)
+			if note != nil && note.JobID == jobID {
+				return job.Status{
+					StatusString: job.StatusSucceeded,
+					Result: history.CommitEventMetadata{
+						Revision: commit.Revision,
+						Spec:     &note.Spec,
+						Result:   note.Result,
+					},
+				}, nil
+			}
 		}
 	}
 
@@ -342,8 +478,21 @@ func (d *Daemon) JobStatus(jobID job.ID) (job.Status, error) {
 // we have applied and the ref given, inclusive. E.g., if you send HEAD,
 // you'll get all the commits yet to be applied. If you send a hash
 // and it's applied _past_ it, you'll get an empty list.
+//
+// In strict mode, if the commit given was part of a sync that
+// failed, you'll get an error instead, since it won't be applied
+// until someone fixes the problem.
+//
+// The commit given is looked for in each git source in turn.
 func (d *Daemon) SyncStatus(commitRef string) ([]string, error) {
-	commits, err := d.Checkout.CommitsBetween(d.Checkout.SyncTag, commitRef)
+	var commits []git.Commit
+	var err error
+	for _, src := range d.sources() {
+		commits, err = src.Checkout.CommitsBetween(src.Checkout.SyncTag, commitRef)
+		if !isUnknownRevision(err) {
+			break
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -353,18 +502,84 @@ func (d *Daemon) SyncStatus(commitRef string) ([]string, error) {
 	for i, commit := range commits {
 		revs[i] = commit.Revision
 	}
+	if len(revs) > 0 {
+		if err := d.syncFailedFor(revs[0]); err != nil {
+			return nil, err
+		}
+	}
 	return revs, nil
 }
 
+// syncFailedFor returns an error if the revision given was included
+// in a sync that failed, or if that can't be determined.
+func (d *Daemon) syncFailedFor(rev string) error {
+	failedRevs, syncErr := d.syncFailure.get()
+	if syncErr == nil {
+		return nil
+	}
+	// A sync is of the HEAD revision of every source
+	for i, src := range d.sources() {
+		failedRev := revisionAt(failedRevs, i)
+		if failedRev == "" {
+			continue
+		}
+		failed := rev == failedRev
+		if !failed {
+			commits, err := src.Checkout.CommitsBetween(src.Checkout.SyncTag, failedRev)
+			if err != nil {
+				return errors.Wrapf(err, "finding the commits in the failed sync of %s", failedRev)
+			}
+			for _, c := range commits {
+				if c.Revision == rev {
+					failed = true
+					break
+				}
+			}
+		}
+		if failed {
+			return errors.Wrapf(syncErr, "sync of revision %s failed", failedRev)
+		}
+	}
+	return nil
+}
+
+// ListSyncStatus reports the outcome of the most recent sync for each
+// resource in the repo.
+func (d *Daemon) ListSyncStatus() ([]flux.ResourceSyncStatus, error) {
+	return d.syncStatus.list(), nil
+}
+
+// Work out what a sync would do to the cluster, were it to happen
+// now, given the state of the repo as last pulled.
+func (d *Daemon) SyncPlan() (fluxsync.Plan, error) {
+	sources := d.sources()
+	loaded := make([]map[string]resource.Resource, len(sources))
+	for i, src := range sources {
+		src.Checkout.RLock()
+		resources, err := d.Manifests.LoadManifests(src.Checkout.ManifestDir())
+		src.Checkout.RUnlock()
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading resources from repo, in source %s", src)
+		}
+		loaded[i] = resources
+	}
+	resources, _, _ := mergeResources(sources, make([]string, len(sources)), loaded)
+	return fluxsync.DryRun(d.Manifests, resources, d.Cluster, d.gcMark(), log.NewNopLogger())
+}
+
 func (d *Daemon) GitRepoConfig(regenerate bool) (flux.GitConfig, error) {
 	publicSSHKey, err := d.Cluster.PublicSSHKey(regenerate)
 	if err != nil {
 		return flux.GitConfig{}, err
 	}
-	return flux.GitConfig{
+	config := flux.GitConfig{
 		Remote:       d.Repo.GitRemoteConfig,
 		PublicSSHKey: publicSSHKey,
-	}, nil
+	}
+	if d.Repo.Auth != nil {
+		config.Auth = d.Repo.Auth.Method()
+	}
+	return config, nil
 }
 
 // Non-remote.Platform methods
@@ -398,18 +613,31 @@ func containers2containers(cs []cluster.Container) []flux.Container {
 	return res
 }
 
-func containersWithAvailable(service cluster.Service, images update.ImageMap) (res []flux.Container) {
+func containersWithAvailable(service cluster.Service, images update.ImageMap, policies policy.Set, logger log.Logger) (res []flux.Container) {
 	for _, c := range service.ContainersOrNil() {
 		id, _ := flux.ParseImageID(c.Image)
 		repo := id.Repository()
 		available := images[repo]
-		res = append(res, flux.Container{
+		container := flux.Container{
 			Name: c.Name,
 			Current: flux.Image{
 				ID: id,
 			},
 			Available: available,
-		})
+		}
+		pattern := policy.PatternAll
+		if tagPolicy, ok := policies.Get(policy.TagPrefix(c.Name)); ok {
+			container.TagPolicy = tagPolicy
+			var err error
+			if pattern, err = policy.ParsePattern(tagPolicy); err != nil {
+				logger.Log("service", service.ID, "container", c.Name, "err", errors.Wrap(err, "invalid tag policy"))
+				container.TagPolicyError = err.Error()
+			}
+		}
+		if pattern != nil {
+			container.Selected = images.LatestImage(repo, pattern)
+		}
+		res = append(res, container)
 	}
 	return res
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -237,6 +238,29 @@ func TestDaemon_Release(t *testing.T) {
 
 }
 
+// An automated release counts against the automation limits once
+// it's been made.
+func TestDaemon_AutomatedReleaseLimits(t *testing.T) {
+	d, clean, _, _ := mockDaemon(t)
+	defer clean()
+	w := newWait(t)
+
+	interval := policy.Set{policy.AutomationInterval: "1h"}
+	if reason, _ := d.automation.check(svc, interval, 0, 0, time.Now()); reason != "" {
+		t.Fatalf("expected no limit before release, got %q", reason)
+	}
+
+	newImage, _ := flux.ParseImageID(newHelloImage)
+	changes := &update.Automated{}
+	changes.Add(svc, cluster.Container{Name: container, Image: currentHelloImage}, newImage)
+	id := updateManifest(t, d, update.Spec{Type: update.Auto, Spec: changes})
+	w.ForJobSucceeded(d, id)
+
+	if reason, _ := d.automation.check(svc, interval, 0, 0, time.Now()); reason == "" {
+		t.Errorf("expected the automated release to count against the interval")
+	}
+}
+
 // When I update a policy, I expect it to add to the queue
 // When I update a policy, it should add an annotation to the manifest
 func TestDaemon_PolicyUpdate(t *testing.T) {
@@ -262,6 +286,34 @@ func TestDaemon_PolicyUpdate(t *testing.T) {
 	}, "Waiting for new annotation")
 }
 
+// recordingValidator records the resources it's asked to check.
+type recordingValidator struct {
+	checked []string
+}
+
+func (v *recordingValidator) Validate(repoDir string, resources []resource.Resource) ([]string, error) {
+	for _, res := range resources {
+		v.checked = append(v.checked, res.ResourceID())
+	}
+	return nil, nil
+}
+
+// When I update a policy, only the resource it changed is validated
+func TestDaemon_ValidatesChanges(t *testing.T) {
+	d, clean, _, _ := mockDaemon(t)
+	defer clean()
+	w := newWait(t)
+	v := &recordingValidator{}
+	d.Validator = v
+
+	id := updatePolicy(t, d)
+	w.ForJobSucceeded(d, id)
+
+	if !reflect.DeepEqual(v.checked, []string{"Deployment " + svc}) {
+		t.Errorf("expected only the changed deployment to be validated, got %v", v.checked)
+	}
+}
+
 // When I call sync status, it should return a commit showing the sync
 // that is about to take place. Then it should return empty once it is
 // complete
@@ -1,12 +1,15 @@
 package daemon
 
 import (
-	"strings"
+	"sort"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/history"
 	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/update"
 )
@@ -35,9 +38,27 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 		logger.Log("error", errors.Wrap(err, "fetching image updates"))
 		return
 	}
+	// To promote images along the chain, we need to see what every
+	// service is running, automated or not
+	var allServices []cluster.Service
+	if len(d.AutomationChain) > 0 {
+		if allServices, err = d.Cluster.AllServices(""); err != nil {
+			logger.Log("error", errors.Wrap(err, "getting services for promotion"))
+			return
+		}
+	}
 
-	changes := &update.Automated{}
+	now := time.Now()
+	// Changes are released in a separate commit for each step of the
+	// promotion chain (services not in the chain being step -1)
+	changes := map[int]*update.Automated{}
+	deferred := map[flux.ServiceID]flux.DeferredRelease{}
+	seen := map[string]time.Time{}
+	queued := 0
 	for _, service := range services {
+		step := promotionStep(d.AutomationChain, service.ID)
+		serviceChanges := &update.Automated{}
+		var waiting flux.DeferredRelease
 		for _, container := range service.ContainersOrNil() {
 			logger := log.NewContext(logger).With("service", service.ID, "container", container.Name, "currentimage", container.Image)
 
@@ -47,32 +68,107 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 				continue
 			}
 
-			pattern := getTagPattern(candidateServices, service.ID, container.Name)
+			pattern, err := getTagPattern(candidateServices, service.ID, container.Name)
+			if err != nil {
+				logger.Log("error", err)
+				continue
+			}
 			repo := currentImageID.Repository()
 			logger.Log("repo", repo, "pattern", pattern)
 
+			if step > 0 {
+				if target, ok := d.promotion.target(d.AutomationChain, d.AutomationSoakTime, step, repo, allServices, now, seen); ok {
+					switch {
+					case target.Image == currentImageID || target.Image.Repository() != repo || !pattern.Matches(target.Image.Tag):
+						if target.Reason != "" {
+							logger.Log("msg", "not promoting image", "reason", target.Reason)
+						}
+					case target.Reason != "":
+						waiting.Images = append(waiting.Images, target.Image)
+						if waiting.Reason == "" {
+							waiting.Reason, waiting.Until = target.Reason, target.Until
+						}
+						logger.Log("msg", "waiting to promote image", "newimage", target.Image, "reason", target.Reason)
+					default:
+						serviceChanges.Add(service.ID, container, target.Image)
+						logger.Log("msg", "added promoted image to changes", "newimage", target.Image)
+					}
+					continue
+				}
+			}
+
 			if latest := imageMap.LatestImage(repo, pattern); latest != nil && latest.ID != currentImageID {
-				changes.Add(service.ID, container, latest.ID)
+				serviceChanges.Add(service.ID, container, latest.ID)
 				logger.Log("msg", "added image to changes", "newimage", latest.ID)
 			}
 		}
+		if len(serviceChanges.Changes) == 0 {
+			if len(waiting.Images) > 0 {
+				deferred[service.ID] = waiting
+			}
+			continue
+		}
+
+		// Hold the release back if the service is outside its
+		// automation window, or it's been released too recently
+		reason, until := d.automation.check(service.ID, candidateServices[service.ID], d.AutomationMaxPerHour, queued, now)
+		if reason != "" {
+			var images []flux.ImageID
+			for _, change := range serviceChanges.Changes {
+				images = append(images, change.ImageID)
+			}
+			deferred[service.ID] = flux.DeferredRelease{
+				Images: append(images, waiting.Images...),
+				Reason: reason,
+				Until:  until,
+			}
+			logger.Log("service", service.ID, "msg", "deferred automated release", "reason", reason, "until", until)
+			continue
+		}
+		if len(waiting.Images) > 0 {
+			deferred[service.ID] = waiting
+		}
+		// The release is recorded against the limits once it's
+		// been committed; until then, it's counted here
+		queued++
+		if changes[step] == nil {
+			changes[step] = &update.Automated{}
+		}
+		changes[step].Changes = append(changes[step].Changes, serviceChanges.Changes...)
+	}
+	d.promotion.observed(seen)
+
+	for id, def := range d.automation.setDeferred(deferred) {
+		d.LogEvent(history.Event{
+			ServiceIDs: []flux.ServiceID{id},
+			Type:       history.EventAutoDeferred,
+			StartedAt:  now,
+			EndedAt:    now,
+			LogLevel:   history.LogLevelInfo,
+			Metadata:   &history.AutoReleaseDeferredEventMetadata{DeferredRelease: def},
+		})
 	}
 
-	if len(changes.Changes) > 0 {
-		d.UpdateManifests(update.Spec{Type: update.Auto, Spec: changes})
+	var steps []int
+	for step := range changes {
+		steps = append(steps, step)
+	}
+	sort.Ints(steps)
+	for _, step := range steps {
+		d.UpdateManifests(update.Spec{Type: update.Auto, Spec: changes[step]})
 	}
 }
 
-func getTagPattern(services policy.ServiceMap, service flux.ServiceID, container string) string {
+func getTagPattern(services policy.ServiceMap, service flux.ServiceID, container string) (policy.Pattern, error) {
 	policies := services[service]
 	if pattern, ok := policies.Get(policy.TagPrefix(container)); ok {
-		return strings.TrimPrefix(pattern, "glob:")
+		return policy.ParsePattern(pattern)
 	}
-	return "*"
+	return policy.PatternAll, nil
 }
 
 func (d *Daemon) unlockedAutomatedServices() (policy.ServiceMap, error) {
-	services, err := d.Manifests.ServicesWithPolicies(d.Checkout.ManifestDir())
+	services, err := d.servicesWithPolicies()
 	if err != nil {
 		return nil, err
 	}
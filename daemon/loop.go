@@ -1,7 +1,6 @@
 package daemon
 
 import (
-	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -10,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/history"
 	"github.com/weaveworks/flux/resource"
@@ -20,9 +20,48 @@ import (
 type LoopVars struct {
 	GitPollInterval      time.Duration
 	RegistryPollInterval time.Duration
-	syncSoon             chan struct{}
-	pollImagesSoon       chan struct{}
-	initOnce             sync.Once
+	SyncGarbageCollect   bool
+	// SyncGarbageCollectMark is put on resources when they're
+	// applied, if SyncGarbageCollect is set; only resources with
+	// the same mark are deleted
+	SyncGarbageCollectMark string
+	SyncStrict             bool
+	// AutomationMaxPerHour limits the number of services released
+	// automatically in any hour, if it's more than zero
+	AutomationMaxPerHour int
+	// AutomationChain is the order in which automated releases are
+	// promoted through services, each step being a glob of service
+	// IDs; AutomationSoakTime is how long the services in a step
+	// must have been ready before the next step is released to
+	AutomationChain    []string
+	AutomationSoakTime time.Duration
+	syncSoon           chan struct{}
+	pollImagesSoon     chan struct{}
+	initOnce           sync.Once
+	syncStatus         syncStatusCache
+	syncFailure        syncFailure
+	automation         automationLimits
+	promotion          promotion
+	// RollbackDeadline is how long a service with the
+	// rollback-on-failure policy has to become ready after a
+	// release, before the release is rolled back
+	RollbackDeadline time.Duration
+	rollouts         rollouts
+	restoreOnce      sync.Once
+	// ReleaseApprovals is the number of distinct users who must
+	// approve a proposed release before it's made. Users are as
+	// given in the cause of each approval, and aren't authenticated.
+	ReleaseApprovals int
+	// ReleaseApprovalTimeout is how long a proposed release waits
+	// for approval before it's dropped, if it's more than zero
+	ReleaseApprovalTimeout time.Duration
+	pending                pendingReleases
+	// TrustedKeyring is the file, or directory of files, with the
+	// public keys trusted to sign commits (see git.ReadKeyRing). If
+	// it's given, commits not signed by one of those keys are not
+	// synced.
+	TrustedKeyring string
+	unverified     unverifiedCommits
 }
 
 func (loop *LoopVars) ensureInit() {
@@ -43,15 +82,23 @@ func (d *Daemon) GitPollLoop(stop chan struct{}, wg *sync.WaitGroup, logger log.
 			gitPollTimer.Stop()
 			gitPollTimer = time.NewTimer(d.GitPollInterval)
 		}()
-		if err := d.Checkout.Pull(); err != nil {
-			logger.Log("operation", "pull", "err", err)
-			return
+		for _, src := range d.sources() {
+			if err := src.Checkout.Pull(); err != nil {
+				logger.Log("operation", "pull", "source", src, "err", err)
+				return
+			}
 		}
 		k(logger)
 	}
 
 	imagePollTimer := time.NewTimer(d.RegistryPollInterval)
 
+	rolloutTicker := time.NewTicker(rolloutCheckInterval)
+	defer rolloutTicker.Stop()
+
+	// Pick up any releases proposed before the daemon started
+	d.restoreReleases(logger)
+
 	// Ask for a sync, and to poll images, straight away
 	d.askForSync()
 	d.askForImagePoll()
@@ -72,6 +119,8 @@ func (d *Daemon) GitPollLoop(stop chan struct{}, wg *sync.WaitGroup, logger log.
 			// Time to poll for new commits (unless we're already
 			// about to do that)
 			d.askForSync()
+		case <-rolloutTicker.C:
+			d.checkRollouts(logger)
 		case job := <-d.Jobs.Ready():
 			jobLogger := log.NewContext(logger).With("jobID", job.ID)
 			jobLogger.Log("state", "in-progress")
@@ -88,6 +137,15 @@ func (d *Daemon) GitPollLoop(stop chan struct{}, wg *sync.WaitGroup, logger log.
 	}
 }
 
+// gcMark gives the mark for garbage collection, or an empty string if
+// resources are not to be garbage collected.
+func (d *LoopVars) gcMark() string {
+	if !d.SyncGarbageCollect {
+		return ""
+	}
+	return d.SyncGarbageCollectMark
+}
+
 // Ask for a sync, or if there's one waiting, let that happen.
 func (d *LoopVars) askForSync() {
 	d.ensureInit()
@@ -111,27 +169,135 @@ func (d *LoopVars) askForImagePoll() {
 func (d *Daemon) doSync(logger log.Logger) {
 	started := time.Now().UTC()
 
-	// checkout a working clone so we can mess around with tags later
-	working, err := d.Checkout.WorkingClone()
-	if err != nil {
-		logger.Log("err", err)
+	// checkout a working clone of each source so we can mess around
+	// with tags later
+	var (
+		sources  []Source
+		workings []*git.Checkout
+		loaded   []map[string]resource.Resource
+		heads    []string
+		// held says which sources are being synced as they were
+		// last time, because nothing since could be verified
+		held []bool
+	)
+	for _, src := range d.sources() {
+		working, err := src.Checkout.WorkingClone()
+		if err != nil {
+			logger.Log("source", src, "err", err)
+			return
+		}
+		defer working.Clean()
+
+		var isHeld bool
+		if d.TrustedKeyring != "" && !d.verifySource(working, log.NewContext(logger).With("source", src)) {
+			// Don't let this source stop the others being synced.
+			// Hold it at the revision it was last synced at, so
+			// that nothing new is applied from it and what was
+			// applied before isn't garbage collected; or if it's
+			// never been synced, leave it out.
+			err := working.ResetTo(working.SyncTag)
+			if isUnknownRevision(err) {
+				continue
+			}
+			if err != nil {
+				logger.Log("source", src, "err", errors.Wrap(err, "resetting to sync tag"))
+				return
+			}
+			isHeld = true
+		}
+
+		// TODO logging, metrics?
+		// Get a map of all resources defined in the repo
+		resources, err := d.Manifests.LoadManifests(working.ManifestDir())
+		if err != nil {
+			logger.Log("source", src, "err", errors.Wrap(err, "loading resources from repo"))
+			return
+		}
+
+		head, err := working.HeadRevision()
+		if err != nil {
+			logger.Log("source", src, "err", errors.Wrap(err, "getting HEAD revision"))
+			return
+		}
+
+		sources = append(sources, src)
+		workings = append(workings, working)
+		loaded = append(loaded, resources)
+		heads = append(heads, head)
+		held = append(held, isHeld)
+	}
+	// Syncing nothing at all would garbage collect everything
+	if len(sources) == 0 {
 		return
 	}
-	defer working.Clean()
 
-	// TODO logging, metrics?
-	// Get a map of all resources defined in the repo
-	allResources, err := d.Manifests.LoadManifests(working.ManifestDir())
-	if err != nil {
-		logger.Log("err", errors.Wrap(err, "loading resources from repo"))
+	// The releases being watched for rollback are only kept in
+	// memory, so the first time through, pick up any made before
+	// the daemon started
+	d.restoreOnce.Do(func() {
+		for i, src := range sources {
+			if err := d.restoreRollouts(workings[i], logger); err != nil {
+				logger.Log("source", src, "err", errors.Wrap(err, "restoring rollouts"))
+			}
+		}
+	})
+
+	// Resources defined in more than one source are reported as
+	// failing to sync (though one definition is still applied)
+	allResources, revisions, conflicts := mergeResources(sources, heads, loaded)
+
+	result, syncErr := fluxsync.Sync(d.Manifests, allResources, d.Cluster, d.gcMark(), logger)
+	syncErr = withConflicts(syncErr, conflicts)
+	if syncErr != nil {
+		logger.Log("err", syncErr)
+	}
+	for _, id := range result.Deleted {
+		logger.Log("resource", id, "deleted", "true")
+	}
+	d.syncStatus.record(revisions, time.Now().UTC(), allResources, result, syncErr)
+
+	// In strict mode, we don't move the sync tag unless everything
+	// applied; and we report the failure (once per revision) rather
+	// than the commits as having been synced.
+	if syncErr != nil && d.SyncStrict {
+		if d.syncFailure.set(syncRevision(heads), syncErr) {
+			var synced []*git.Checkout
+			for i, working := range workings {
+				if !held[i] {
+					synced = append(synced, working)
+				}
+			}
+			d.logSyncFailure(synced, started, allResources, result.Deleted, syncErr, logger)
+		}
 		return
 	}
-
-	// TODO supply deletes argument from somewhere (command-line?)
-	if err := fluxsync.Sync(d.Manifests, allResources, d.Cluster, false, logger); err != nil {
-		logger.Log("err", err)
+	d.syncFailure.clear()
+
+	// Deleted resources aren't defined in any source (that's why
+	// they were deleted), so report them, once, along with the
+	// first source synced. A source that's held has no new commits
+	// to report, and its sync tag stays where it is.
+	deleted := result.Deleted
+	for i, src := range sources {
+		if held[i] {
+			continue
+		}
+		srcLogger := logger
+		if len(sources) > 1 {
+			srcLogger = log.NewContext(logger).With("source", src)
+		}
+		d.syncedSource(src, workings[i], started, loaded[i], allResources, deleted, srcLogger)
+		deleted = nil
 	}
+}
 
+// syncedSource emits events for the commits in a source that have
+// just been synced, and moves its sync tag to mark them as synced.
+// `defined` are the resources defined in the source, `allResources`
+// those in all the sources, and `deleted` any resources garbage
+// collected, to be reported with the sync event (which is emitted
+// even if there are no new commits).
+func (d *Daemon) syncedSource(src Source, working *git.Checkout, started time.Time, defined, allResources map[string]resource.Resource, deleted []string, logger log.Logger) {
 	var initialSync bool
 	// update notes and emit events for applied commits
 	commits, err := working.CommitsBetween(working.SyncTag, "HEAD")
@@ -149,7 +315,7 @@ func (d *Daemon) doSync(logger log.Logger) {
 
 	if initialSync {
 		// no synctag, We are syncing everything from scratch
-		changedResources = allResources
+		changedResources = defined
 	} else {
 		changedFiles, err := working.ChangedFiles(working.SyncTag)
 		if err == nil {
@@ -173,9 +339,8 @@ func (d *Daemon) doSync(logger log.Logger) {
 	// autoreleases, that we're already posting as events, so upstream
 	// can skip the sync event if it wants to.
 	includes := make(map[string]bool)
+	var noteEvents []history.Event
 	if len(commits) > 0 {
-		var noteEvents []history.Event
-
 		// Find notes in revisions.
 		for i := len(commits) - 1; i >= 0; i-- {
 			n, err := working.GetNote(commits[i].Revision)
@@ -215,6 +380,9 @@ func (d *Daemon) doSync(logger log.Logger) {
 					},
 				})
 				includes[history.EventRelease] = true
+				if err := d.watchRollouts(working, commits[i].Revision, n.Result); err != nil {
+					logger.Log("err", err)
+				}
 			case update.Auto:
 				spec := n.Spec.Spec.(update.Automated)
 				noteEvents = append(noteEvents, history.Event{
@@ -233,6 +401,35 @@ func (d *Daemon) doSync(logger log.Logger) {
 					},
 				})
 				includes[history.EventAutoRelease] = true
+				if err := d.watchRollouts(working, commits[i].Revision, n.Result); err != nil {
+					logger.Log("err", err)
+				}
+			case update.Rollback:
+				spec := n.Spec.Spec.(update.RollbackSpec)
+				// A rollback that locks services is one made because
+				// the release didn't become ready, so report it as
+				// an error
+				level := history.LogLevelInfo
+				if spec.Lock {
+					level = history.LogLevelError
+				}
+				noteEvents = append(noteEvents, history.Event{
+					ServiceIDs: serviceIDs.ToSlice(),
+					Type:       history.EventRollback,
+					StartedAt:  started,
+					EndedAt:    time.Now().UTC(),
+					LogLevel:   level,
+					Metadata: &history.RollbackEventMetadata{
+						ReleaseEventCommon: history.ReleaseEventCommon{
+							Revision: commits[i].Revision,
+							Result:   n.Result,
+							Error:    rollbackError(n.Result),
+						},
+						Spec:  spec,
+						Cause: n.Spec.Cause,
+					},
+				})
+				includes[history.EventRollback] = true
 			case update.Policy:
 				// Use this to mean any change to policy
 				includes[history.EventUpdatePolicy] = true
@@ -242,7 +439,9 @@ func (d *Daemon) doSync(logger log.Logger) {
 				includes[history.NoneOfTheAbove] = true
 			}
 		}
+	}
 
+	if len(commits) > 0 || len(deleted) > 0 {
 		cs := make([]history.Commit, len(commits))
 		for i, c := range commits {
 			cs[i].Revision = c.Revision
@@ -258,6 +457,7 @@ func (d *Daemon) doSync(logger log.Logger) {
 				Commits:     cs,
 				InitialSync: initialSync,
 				Includes:    includes,
+				Deleted:     deleted,
 			},
 		}); err != nil {
 			logger.Log("err", err)
@@ -276,14 +476,64 @@ func (d *Daemon) doSync(logger log.Logger) {
 	}
 
 	// Pull the tag if it has changed
-	if err := d.updateTagRev(working, logger); err != nil {
+	if err := d.updateTagRev(src, working, logger); err != nil {
 		logger.Log("err", errors.Wrap(err, "updating tag"))
 	}
 }
 
-func (d *Daemon) updateTagRev(working *git.Checkout, logger log.Logger) error {
-	oldTagRev, err := d.Checkout.TagRevision(d.Checkout.SyncTag)
-	if err != nil && !strings.Contains(err.Error(), "unknown revision or path not in the working tree") {
+// logSyncFailure records an event for a sync that didn't completely
+// succeed, including the error for each resource that failed, and
+// any resources that were deleted regardless.
+func (d *Daemon) logSyncFailure(workings []*git.Checkout, started time.Time, allResources map[string]resource.Resource, deleted []string, syncErr error, logger log.Logger) {
+	var commits []git.Commit
+	for _, working := range workings {
+		cs, err := working.CommitsBetween(working.SyncTag, "HEAD")
+		if isUnknownRevision(err) {
+			cs, err = working.CommitsBefore("HEAD")
+		}
+		if err != nil {
+			logger.Log("err", err)
+		}
+		commits = append(commits, cs...)
+	}
+	cs := make([]history.Commit, len(commits))
+	for i, c := range commits {
+		cs[i].Revision = c.Revision
+		cs[i].Message = c.Message
+	}
+
+	metadata := &history.SyncEventMetadata{
+		Commits: cs,
+		Deleted: deleted,
+	}
+	serviceIDs := flux.ServiceIDSet{}
+	if errs, ok := syncErr.(cluster.SyncError); ok {
+		metadata.Errors = map[string]string{}
+		for id, e := range errs {
+			metadata.Errors[id] = e.Error()
+			if res, ok := allResources[id]; ok {
+				serviceIDs.Add(res.ServiceIDs(allResources))
+			}
+		}
+	} else {
+		metadata.Error = syncErr.Error()
+	}
+
+	if err := d.LogEvent(history.Event{
+		ServiceIDs: serviceIDs.ToSlice(),
+		Type:       history.EventSync,
+		StartedAt:  started,
+		EndedAt:    time.Now().UTC(),
+		LogLevel:   history.LogLevelError,
+		Metadata:   metadata,
+	}); err != nil {
+		logger.Log("err", err)
+	}
+}
+
+func (d *Daemon) updateTagRev(src Source, working *git.Checkout, logger log.Logger) error {
+	oldTagRev, err := src.Checkout.TagRevision(src.Checkout.SyncTag)
+	if err != nil && !isUnknownRevision(err) {
 		return err
 	}
 	newTagRev, err := working.TagRevision(working.SyncTag)
@@ -292,9 +542,9 @@ func (d *Daemon) updateTagRev(working *git.Checkout, logger log.Logger) error {
 	}
 
 	if oldTagRev != newTagRev {
-		logger.Log("tag", d.Checkout.SyncTag, "old", oldTagRev, "new", newTagRev)
+		logger.Log("tag", src.Checkout.SyncTag, "old", oldTagRev, "new", newTagRev)
 
-		if err := d.Checkout.Pull(); err != nil {
+		if err := src.Checkout.Pull(); err != nil {
 			return err
 		}
 	}
@@ -303,7 +553,5 @@ func (d *Daemon) updateTagRev(working *git.Checkout, logger log.Logger) error {
 }
 
 func isUnknownRevision(err error) bool {
-	return err != nil &&
-		(strings.Contains(err.Error(), "unknown revision or path not in the working tree.") ||
-			strings.Contains(err.Error(), "bad revision"))
+	return err != nil && errors.Cause(err) == git.ErrUnknownRevision
 }
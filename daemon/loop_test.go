@@ -1,6 +1,7 @@
 package daemon
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -15,12 +16,15 @@ import (
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/cluster/kubernetes"
 	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/git/gittest"
 	"github.com/weaveworks/flux/history"
 	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
 )
 
 const (
@@ -186,6 +190,51 @@ func TestDoSync_NoNewCommits(t *testing.T) {
 	}
 }
 
+func TestDoSync_ReportsDeletedWithNoNewCommits(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.SyncGarbageCollect = true
+	d.SyncGarbageCollectMark = "test-mark"
+	if err := d.Checkout.MoveTagAndPush("HEAD", "Sync pointer"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Something we applied before, that's no longer in the repo
+	gone := []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: gone
+  namespace: default
+  annotations:
+    flux.weave.works/sync-gc-mark: test-mark
+`)
+	goneResources, err := kresource.ParseMultidoc(gone, "exported")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var goneID string
+	for id := range goneResources {
+		goneID = id
+	}
+	k8s.ExportFunc = func() ([]byte, error) { return gone, nil }
+	k8s.UpdatePoliciesFunc = (&kubernetes.Manifests{}).UpdatePolicies
+	k8s.SyncFunc = func(def cluster.SyncDef) error { return nil }
+
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 1 || es[0].Type != history.EventSync {
+		t.Fatalf("Expected a sync event, got %#v", es)
+	}
+	metadata := es[0].Metadata.(*history.SyncEventMetadata)
+	if !reflect.DeepEqual(metadata.Deleted, []string{goneID}) {
+		t.Errorf("Expected %s to be reported as deleted, got %#v", goneID, metadata.Deleted)
+	}
+}
+
 func TestDoSync_WithNewCommit(t *testing.T) {
 	// Tag exists
 	d, cleanup := daemon(t)
@@ -262,3 +311,178 @@ func TestDoSync_WithNewCommit(t *testing.T) {
 		t.Errorf("Should have moved sync tag to HEAD (%s), but was moved to: %s")
 	}
 }
+
+func TestDoSync_RecordsResourceStatus(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	failing := "Deployment default/helloworld"
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		return cluster.SyncError{failing: errors.New("could not apply")}
+	}
+
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+
+	head, err := d.Checkout.HeadRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := d.ListSyncStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != len(testfiles.Files) {
+		t.Fatalf("expected a status for each of %d resources, got %#v", len(testfiles.Files), statuses)
+	}
+	for _, s := range statuses {
+		if s.ID == failing {
+			if s.Error == "" || s.Revision != "" {
+				t.Errorf("expected %s to have failed and never been applied, got %#v", s.ID, s)
+			}
+			continue
+		}
+		if s.Error != "" || s.Revision != head || s.AppliedAt.IsZero() {
+			t.Errorf("expected %s to have been applied at %s, got %#v", s.ID, head, s)
+		}
+	}
+
+	k8s.AllServicesFunc = func(string) ([]cluster.Service, error) {
+		return []cluster.Service{{ID: flux.ServiceID("default/helloworld")}}, nil
+	}
+	services, err := d.ListServices("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range services {
+		var sawFailing bool
+		for _, s := range service.Sync {
+			if s.ID == failing {
+				sawFailing = true
+			}
+		}
+		if !sawFailing {
+			t.Errorf("expected the sync status of %s to be reported with its service, got %#v", failing, service.Sync)
+		}
+	}
+}
+
+func TestDoSync_StrictModeFailure(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.SyncStrict = true
+
+	if err := d.Checkout.MoveTagAndPush("HEAD", "Sync pointer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.UpdateManifest(k8s, d.Checkout.ManifestDir(), "default/helloworld", func(def []byte) ([]byte, error) {
+		return []byte(strings.Replace(string(def), "replicas: 5", "replicas: 4", -1)), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Checkout.CommitAndPush("test commit", nil); err != nil {
+		t.Fatal(err)
+	}
+	newRevision, err := d.Checkout.HeadRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing := "Deployment default/helloworld"
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		return cluster.SyncError{failing: errors.New("could not apply")}
+	}
+
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+	// A second attempt at the same revision shouldn't emit another event
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+
+	// The failure is recorded as an event
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 1 {
+		t.Fatalf("Expected one event, got %#v", es)
+	}
+	if es[0].Type != history.EventSync || es[0].LogLevel != history.LogLevelError {
+		t.Errorf("Expected a sync event at level error, got %#v", es[0])
+	}
+	metadata := es[0].Metadata.(*history.SyncEventMetadata)
+	if _, ok := metadata.Errors[failing]; !ok || len(metadata.Errors) != 1 {
+		t.Errorf("Expected an error for %s in the event, got %#v", failing, metadata.Errors)
+	}
+
+	// The tag has not moved
+	if err := d.Checkout.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	revs, err := d.Checkout.CommitsBetween(gitSyncTag, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 1 || revs[0].Revision != newRevision {
+		t.Errorf("Expected the sync tag to be one commit behind HEAD, got %#v", revs)
+	}
+
+	// Anyone waiting for the revision finds out it failed
+	if _, err := d.SyncStatus(newRevision); err == nil {
+		t.Error("Expected an error from SyncStatus for a revision that failed to sync")
+	}
+}
+
+func TestDoSync_RestoresRollouts(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.RollbackDeadline = time.Hour
+	k8s.SyncFunc = func(def cluster.SyncDef) error { return nil }
+	k8s.UpdatePoliciesFunc = (&kubernetes.Manifests{}).UpdatePolicies
+
+	helloworld, testService := flux.ServiceID("default/helloworld"), flux.ServiceID("default/test-service")
+	for _, id := range []flux.ServiceID{helloworld, testService} {
+		if err := cluster.UpdateManifest(k8s, d.Checkout.ManifestDir(), string(id), func(def []byte) ([]byte, error) {
+			return k8s.UpdatePolicies(def, policy.Update{Add: policy.Set{policy.RollbackOnFailure: "true"}})
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	updates := rolloutUpdates(t, "quay.io/weaveworks/helloworld:master-a000001", "quay.io/weaveworks/helloworld:master-a000002")
+	succeeded := update.ServiceResult{Status: update.ReleaseStatusSuccess, PerContainer: updates}
+
+	// A release of both services, and then a rollback of one of
+	// them, made and synced before the daemon started
+	release := &git.Note{
+		Spec: update.Spec{Type: update.Images, Spec: update.ReleaseSpec{
+			ServiceSpecs: []update.ServiceSpec{update.ServiceSpecAll},
+			ImageSpec:    update.ImageSpecLatest,
+			Kind:         update.ReleaseKindExecute,
+		}},
+		Result: update.Result{helloworld: succeeded, testService: succeeded},
+	}
+	if err := d.Checkout.CommitAndPush("release", release); err != nil {
+		t.Fatal(err)
+	}
+	releaseRevision, err := d.Checkout.HeadRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollback := &git.Note{
+		Spec: update.Spec{Type: update.Rollback, Spec: update.RollbackSpec{
+			Changes: []update.Change{{ServiceID: helloworld}},
+		}},
+		Result: update.Result{helloworld: succeeded},
+	}
+	if err := d.Checkout.CommitAndPush("rollback", rollback); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Checkout.MoveTagAndPush("HEAD", "Sync pointer"); err != nil {
+		t.Fatal(err)
+	}
+
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+
+	pending := d.rollouts.list()
+	if len(pending) != 1 || pending[testService].revision != releaseRevision {
+		t.Errorf("expected the release of %s in %s to be watched, got %+v", testService, releaseRevision, pending)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/job"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -16,14 +17,16 @@ type NotReadyDaemon struct {
 	version   string
 	cluster   cluster.Cluster
 	gitRemote flux.GitRemoteConfig
+	gitAuth   string
 	reason    error
 }
 
-func NewNotReadyDaemon(version string, cluster cluster.Cluster, gitRemote flux.GitRemoteConfig, reason error) (nrd *NotReadyDaemon) {
+func NewNotReadyDaemon(version string, cluster cluster.Cluster, gitRemote flux.GitRemoteConfig, gitAuth string, reason error) (nrd *NotReadyDaemon) {
 	return &NotReadyDaemon{
 		version:   version,
 		cluster:   cluster,
 		gitRemote: gitRemote,
+		gitAuth:   gitAuth,
 		reason:    reason,
 	}
 }
@@ -79,6 +82,14 @@ func (nrd *NotReadyDaemon) SyncStatus(string) ([]string, error) {
 	return nil, nrd.Reason()
 }
 
+func (nrd *NotReadyDaemon) SyncPlan() (fluxsync.Plan, error) {
+	return nil, nrd.Reason()
+}
+
+func (nrd *NotReadyDaemon) ListSyncStatus() ([]flux.ResourceSyncStatus, error) {
+	return nil, nrd.Reason()
+}
+
 func (nrd *NotReadyDaemon) GitRepoConfig(regenerate bool) (flux.GitConfig, error) {
 	publicSSHKey, err := nrd.cluster.PublicSSHKey(regenerate)
 	if err != nil {
@@ -87,5 +98,6 @@ func (nrd *NotReadyDaemon) GitRepoConfig(regenerate bool) (flux.GitConfig, error
 	return flux.GitConfig{
 		Remote:       nrd.gitRemote,
 		PublicSSHKey: publicSSHKey,
+		Auth:         nrd.gitAuth,
 	}, nil
 }
@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	glob "github.com/ryanuber/go-glob"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+)
+
+// promotion keeps track of automated releases being promoted along a
+// chain of steps, each step being the services with IDs matching a
+// glob, e.g., `dev/*`, then `staging/*`, then `prod/*`. Services in
+// the first step are released new images as usual; services in each
+// step after that are released the image the services in the step
+// before are running, once those are ready and have been for the
+// soak time.
+type promotion struct {
+	mu sync.Mutex
+	// when the services in a step were first seen ready with an
+	// image, by step and image
+	readySince map[string]time.Time
+}
+
+// promotionStep returns the index of the first step in the chain
+// that the service is in, or -1 if it's not in any.
+func promotionStep(chain []string, id flux.ServiceID) int {
+	for i, step := range chain {
+		if glob.Glob(step, string(id)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// promotionTarget is the image a container in a step of the chain
+// is to be promoted to, or the reason it can't be yet, and (if
+// known) until when.
+type promotionTarget struct {
+	Image  flux.ImageID
+	Reason string
+	Until  time.Time
+}
+
+// target works out the image from the repository given that a
+// container in step `step` of the chain should be running, by
+// looking at the services in the nearest step before it that have
+// containers using the repository. If no step before has any, it
+// returns false, and the container is released new images as though
+// it were at the start of the chain.
+//
+// `seen` collects the times the services in a step were first seen
+// ready with an image, for this round; pass it to `observed`
+// afterwards.
+func (p *promotion) target(chain []string, soak time.Duration, step int, repo string, services []cluster.Service, now time.Time, seen map[string]time.Time) (promotionTarget, bool) {
+	for prev := step - 1; prev >= 0; prev-- {
+		var image flux.ImageID
+		found, ready := false, true
+		for _, service := range services {
+			if promotionStep(chain, service.ID) != prev {
+				continue
+			}
+			for _, container := range service.ContainersOrNil() {
+				id, err := flux.ParseImageID(container.Image)
+				if err != nil || id.Repository() != repo {
+					continue
+				}
+				if found && id != image {
+					return promotionTarget{Reason: fmt.Sprintf("services in %s are running different images from %s", chain[prev], repo)}, true
+				}
+				image, found = id, true
+				if service.Status != cluster.StatusReady {
+					ready = false
+				}
+			}
+		}
+		if !found {
+			continue
+		}
+		if !ready {
+			return promotionTarget{Image: image, Reason: fmt.Sprintf("waiting for services in %s to be ready", chain[prev])}, true
+		}
+
+		key := fmt.Sprintf("%d %s", prev, image)
+		since, ok := seen[key]
+		if !ok {
+			p.mu.Lock()
+			since, ok = p.readySince[key]
+			p.mu.Unlock()
+			if !ok {
+				since = now
+			}
+			seen[key] = since
+		}
+		if until := since.Add(soak); now.Before(until) {
+			return promotionTarget{Image: image, Reason: fmt.Sprintf("soaking in %s", chain[prev]), Until: until}, true
+		}
+		return promotionTarget{Image: image}, true
+	}
+	return promotionTarget{}, false
+}
+
+// observed records the times steps were seen ready with an image,
+// in the last round, forgetting any not seen this time (e.g.,
+// because they are no longer ready, or the step has moved on).
+func (p *promotion) observed(seen map[string]time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readySince = seen
+}
@@ -0,0 +1,104 @@
+package daemon
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+)
+
+var chain = []string{"dev/*", "staging/*", "prod/*"}
+
+func promotionService(id, status string, images ...string) cluster.Service {
+	var containers []cluster.Container
+	for i, image := range images {
+		containers = append(containers, cluster.Container{Name: fmt.Sprintf("container%d", i), Image: image})
+	}
+	return cluster.Service{
+		ID:         flux.ServiceID(id),
+		Status:     status,
+		Containers: cluster.ContainersOrExcuse{Containers: containers},
+	}
+}
+
+func TestPromotionStep(t *testing.T) {
+	for id, step := range map[string]int{
+		"dev/helloworld":     0,
+		"staging/helloworld": 1,
+		"prod/helloworld":    2,
+		"default/helloworld": -1,
+	} {
+		if s := promotionStep(chain, flux.ServiceID(id)); s != step {
+			t.Errorf("expected %s in step %d, got %d", id, step, s)
+		}
+	}
+}
+
+func TestPromotionTarget(t *testing.T) {
+	const repo = "quay.io/weaveworks/helloworld"
+	v1, _ := flux.ParseImageID(repo + ":v1")
+	v2, _ := flux.ParseImageID(repo + ":v2")
+	now := time.Now()
+	soak := 10 * time.Minute
+
+	var p promotion
+	services := []cluster.Service{
+		promotionService("dev/helloworld", "updating", v2.String()),
+		promotionService("dev/sidecar", cluster.StatusReady, "quay.io/weaveworks/sidecar:v1"),
+		promotionService("staging/helloworld", cluster.StatusReady, v1.String()),
+		promotionService("prod/helloworld", cluster.StatusReady, v1.String()),
+	}
+
+	// Not ready yet
+	seen := map[string]time.Time{}
+	target, ok := p.target(chain, soak, 1, repo, services, now, seen)
+	if !ok || target.Image != v2 || target.Reason == "" {
+		t.Errorf("expected to wait for dev to be ready, got %+v", target)
+	}
+	p.observed(seen)
+
+	// Ready, but not for long enough
+	services[0].Status = cluster.StatusReady
+	seen = map[string]time.Time{}
+	target, ok = p.target(chain, soak, 1, repo, services, now, seen)
+	if !ok || target.Image != v2 || target.Reason == "" || !target.Until.Equal(now.Add(soak)) {
+		t.Errorf("expected to soak until %s, got %+v", now.Add(soak), target)
+	}
+	p.observed(seen)
+
+	// Soaked
+	later := now.Add(soak)
+	seen = map[string]time.Time{}
+	target, ok = p.target(chain, soak, 1, repo, services, later, seen)
+	if !ok || target.Image != v2 || target.Reason != "" {
+		t.Errorf("expected to promote v2 to staging, got %+v", target)
+	}
+	p.observed(seen)
+
+	// prod follows staging, which is still running v1 (and hasn't
+	// been seen ready before)
+	target, ok = p.target(chain, soak, 2, repo, services, later, map[string]time.Time{})
+	if !ok || target.Image != v1 || target.Reason == "" || !target.Until.Equal(later.Add(soak)) {
+		t.Errorf("expected prod to soak at v1 until %s, got %+v", later.Add(soak), target)
+	}
+
+	// Staging without the repository, so prod follows dev
+	target, ok = p.target(chain, soak, 2, repo, services[:2], later, map[string]time.Time{})
+	if !ok || target.Image != v2 || target.Reason != "" {
+		t.Errorf("expected prod to follow dev at v2, got %+v", target)
+	}
+
+	// No earlier step runs the repository
+	if _, ok = p.target(chain, soak, 1, "quay.io/weaveworks/other", services, later, map[string]time.Time{}); ok {
+		t.Errorf("expected no target for repository not in earlier steps")
+	}
+
+	// Disagreement in the step before
+	services = append(services, promotionService("dev/helloworld2", cluster.StatusReady, v1.String()))
+	target, ok = p.target(chain, soak, 1, repo, services, later, map[string]time.Time{})
+	if !ok || target.Image != (flux.ImageID{}) || target.Reason == "" {
+		t.Errorf("expected to wait for dev to agree, got %+v", target)
+	}
+}
@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/integrations"
+	"github.com/weaveworks/flux/update"
+)
+
+// Branches pushed for pull requests are named with this prefix.
+const pullRequestBranchPrefix = "flux-"
+
+// commitAndPush commits the changes made in a working clone, and
+// pushes them. Usually they're pushed to the branch being synced; but
+// if the daemon is set up to open pull requests, they're pushed to a
+// new branch instead, and a pull request is opened to merge it. The
+// URL of the pull request is returned, if there is one.
+func (d *Daemon) commitAndPush(working *git.Checkout, commitMessage string, note *git.Note) ([]string, error) {
+	if d.PullRequests == nil {
+		return nil, working.CommitAndPush(commitMessage, note)
+	}
+
+	branch, created, err := working.CommitAndPushBranch(commitMessage, note, pullRequestBranchPrefix)
+	if err != nil {
+		return nil, err
+	}
+	remote := working.Remote()
+	title, body := pullRequestText(commitMessage, note)
+	url, opened, err := d.PullRequests.OpenPullRequest(integrations.PullRequest{
+		RepoURL: remote.URL,
+		Head:    branch,
+		Base:    remote.Branch,
+		Title:   title,
+		Body:    body,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening pull request for branch %s", branch)
+	}
+	// Automated releases are tried again at each image poll; if the
+	// same changes are waiting in a pull request already, there's
+	// nothing more to do. If the pull request for them was closed
+	// without being merged, a new one has just been opened.
+	if !created && !opened && note != nil && note.Spec.Type == update.Auto {
+		return nil, git.ErrNoChanges
+	}
+	return []string{url}, nil
+}
+
+// pullRequestText makes the title and body of a pull request from the
+// commit message and note. The note is included in full, since it may
+// not survive the pull request being merged (e.g., if it's squashed).
+func pullRequestText(commitMessage string, note *git.Note) (string, string) {
+	parts := strings.SplitN(commitMessage, "\n", 2)
+	title := strings.TrimSpace(parts[0])
+	var body string
+	if len(parts) > 1 {
+		body = strings.TrimSpace(parts[1]) + "\n\n"
+	}
+	body += "The change takes effect once this is merged and synced."
+	if note != nil {
+		if b, err := json.MarshalIndent(note, "", "  "); err == nil {
+			body += "\n\n```json\n" + string(b) + "\n```\n"
+		}
+	}
+	return title, body
+}
@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/gittest"
+	"github.com/weaveworks/flux/integrations"
+	"github.com/weaveworks/flux/update"
+)
+
+// fakePullRequests keeps track of which branches have an open pull
+// request.
+type fakePullRequests struct {
+	open   map[string]bool
+	opened int
+}
+
+func (f *fakePullRequests) OpenPullRequest(pr integrations.PullRequest) (string, bool, error) {
+	url := "https://example.com/pulls/" + pr.Head
+	if f.open[pr.Head] {
+		return url, false, nil
+	}
+	f.open[pr.Head] = true
+	f.opened++
+	return url, true, nil
+}
+
+func TestCommitAndPush_PullRequests(t *testing.T) {
+	checkout, cleanup := gittest.Checkout(t)
+	defer cleanup()
+
+	prs := &fakePullRequests{open: map[string]bool{}}
+	d := &Daemon{PullRequests: prs, LoopVars: &LoopVars{}}
+	note := &git.Note{Spec: update.Spec{Type: update.Auto, Spec: update.Automated{}}}
+	var changedFile string
+	for file := range testfiles.Files {
+		changedFile = file
+		break
+	}
+	release := func() ([]string, error) {
+		working, err := checkout.WorkingClone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer working.Clean()
+		if err := ioutil.WriteFile(filepath.Join(working.ManifestDir(), changedFile), []byte("AUTOMATED CHANGE"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return d.commitAndPush(working, "Automated release", note)
+	}
+
+	urls, err := release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 1 || prs.opened != 1 {
+		t.Fatalf("expected a pull request to be opened, got %v (%d opened)", urls, prs.opened)
+	}
+
+	// The same automated release again has nothing to do, while the
+	// pull request is open
+	if _, err := release(); err != git.ErrNoChanges {
+		t.Errorf("expected no changes while the pull request is open, got %v", err)
+	}
+
+	// If the pull request is closed without being merged, another is
+	// opened for the branch
+	prs.open = map[string]bool{}
+	urls, err = release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 1 || prs.opened != 2 {
+		t.Errorf("expected another pull request to be opened, got %v (%d opened)", urls, prs.opened)
+	}
+}
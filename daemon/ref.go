@@ -6,6 +6,7 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/remote"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -69,6 +70,14 @@ func (pr *Ref) SyncStatus(ref string) ([]string, error) {
 	return pr.Platform().SyncStatus(ref)
 }
 
+func (pr *Ref) SyncPlan() (fluxsync.Plan, error) {
+	return pr.Platform().SyncPlan()
+}
+
+func (pr *Ref) ListSyncStatus() ([]flux.ResourceSyncStatus, error) {
+	return pr.Platform().ListSyncStatus()
+}
+
 func (pr *Ref) GitRepoConfig(regenerate bool) (flux.GitConfig, error) {
 	return pr.Platform().GitRepoConfig(regenerate)
 }
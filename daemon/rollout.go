@@ -0,0 +1,305 @@
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+)
+
+// How often to check whether releases being watched have rolled out
+const rolloutCheckInterval = 30 * time.Second
+
+// rollouts keeps track of the releases, to services with the
+// rollback-on-failure policy, that haven't yet been seen to roll out.
+type rollouts struct {
+	mu      sync.Mutex
+	pending map[flux.ServiceID]rollout
+}
+
+type rollout struct {
+	revision   string
+	releasedAt time.Time
+	updates    []update.ContainerUpdate
+}
+
+// watch starts watching the release of a service, replacing any
+// earlier release of it being watched.
+func (r *rollouts) watch(id flux.ServiceID, ro rollout) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending = map[flux.ServiceID]rollout{}
+	}
+	r.pending[id] = ro
+}
+
+// forget stops watching a release of a service, unless a later
+// release has replaced it.
+func (r *rollouts) forget(id flux.ServiceID, revision string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ro, ok := r.pending[id]; ok && ro.revision == revision {
+		delete(r.pending, id)
+	}
+}
+
+func (r *rollouts) list() map[flux.ServiceID]rollout {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := map[flux.ServiceID]rollout{}
+	for id, ro := range r.pending {
+		res[id] = ro
+	}
+	return res
+}
+
+// rolledOut reports whether the service is ready, and running the
+// images released to it.
+func rolledOut(service cluster.Service, updates []update.ContainerUpdate) bool {
+	if service.Status != cluster.StatusReady {
+		return false
+	}
+	images := map[string]string{}
+	for _, c := range service.ContainersOrNil() {
+		images[c.Name] = c.Image
+	}
+	for _, u := range updates {
+		id, err := flux.ParseImageID(images[u.Container])
+		if err != nil || id != u.Target {
+			return false
+		}
+	}
+	return true
+}
+
+// watchRollouts starts watching the services released successfully
+// in the revision given, which have the rollback-on-failure policy in
+// the working clone.
+func (d *Daemon) watchRollouts(working *git.Checkout, revision string, result update.Result) error {
+	if d.RollbackDeadline <= 0 {
+		return nil
+	}
+	policies, err := d.Manifests.ServicesWithPolicies(working.ManifestDir())
+	if err != nil {
+		return errors.Wrap(err, "getting service policies")
+	}
+	now := time.Now()
+	for id, res := range result {
+		if res.Status != update.ReleaseStatusSuccess || len(res.PerContainer) == 0 {
+			continue
+		}
+		if policies[id].Contains(policy.RollbackOnFailure) {
+			d.rollouts.watch(id, rollout{revision: revision, releasedAt: now, updates: res.PerContainer})
+		}
+	}
+	return nil
+}
+
+// restoreRollouts starts watching again the releases that were
+// synced before the daemon started, and might still be rolling out;
+// otherwise they would be lost on restart, since they're only kept
+// in memory. It looks at the notes on the commits up to the sync tag
+// made within the rollback deadline, newest first; a service is
+// watched if the last of those that released or rolled it back
+// successfully is a release.
+func (d *Daemon) restoreRollouts(working *git.Checkout, logger log.Logger) error {
+	if d.RollbackDeadline <= 0 {
+		return nil
+	}
+	commits, err := working.CommitsBefore(working.SyncTag)
+	if isUnknownRevision(err) {
+		// Nothing has been synced yet
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "finding synced commits")
+	}
+	policies, err := d.Manifests.ServicesWithPolicies(working.ManifestDir())
+	if err != nil {
+		return errors.Wrap(err, "getting service policies")
+	}
+
+	since := time.Now().Add(-d.RollbackDeadline)
+	seen := map[flux.ServiceID]bool{}
+	for _, commit := range commits {
+		if commit.Time.Before(since) {
+			break
+		}
+		n, err := working.GetNote(commit.Revision)
+		if err != nil {
+			logger.Log("revision", commit.Revision, "err", errors.Wrap(err, "loading note"))
+			continue
+		}
+		if n == nil {
+			continue
+		}
+		switch n.Spec.Type {
+		case update.Images, update.Auto, update.Rollback:
+		default:
+			continue
+		}
+		for id, res := range n.Result {
+			if res.Status != update.ReleaseStatusSuccess || seen[id] {
+				continue
+			}
+			seen[id] = true
+			if n.Spec.Type != update.Rollback && len(res.PerContainer) > 0 && policies[id].Contains(policy.RollbackOnFailure) {
+				d.rollouts.watch(id, rollout{revision: commit.Revision, releasedAt: commit.Time, updates: res.PerContainer})
+			}
+		}
+	}
+	return nil
+}
+
+// rollbackError gives the error to report for a rollback: that of any
+// services that failed to roll back or, failing that, that of any
+// that were rolled back but couldn't be locked.
+func rollbackError(result update.Result) string {
+	if err := result.Error(); err != "" {
+		return err
+	}
+	var unlocked []string
+	for id, res := range result {
+		if res.Status == update.ReleaseStatusSuccess && res.Error != "" {
+			unlocked = append(unlocked, fmt.Sprintf("%s %s", id, res.Error))
+		}
+	}
+	sort.Strings(unlocked)
+	return strings.Join(unlocked, "; ")
+}
+
+// checkRollouts looks at the services being watched, and rolls back
+// the release of any that haven't rolled out by the deadline.
+func (d *Daemon) checkRollouts(logger log.Logger) {
+	pending := d.rollouts.list()
+	if len(pending) == 0 {
+		return
+	}
+	var ids []flux.ServiceID
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	services, err := d.Cluster.SomeServices(ids)
+	if err != nil {
+		logger.Log("error", errors.Wrap(err, "checking services for rollout"))
+		return
+	}
+
+	now := time.Now()
+	found := map[flux.ServiceID]bool{}
+	for _, service := range services {
+		found[service.ID] = true
+		ro := pending[service.ID]
+		if rolledOut(service, ro.updates) {
+			d.rollouts.forget(service.ID, ro.revision)
+			continue
+		}
+		if now.Before(ro.releasedAt.Add(d.RollbackDeadline)) {
+			continue
+		}
+
+		d.rollouts.forget(service.ID, ro.revision)
+		var changes []update.Change
+		var images []string
+		for _, u := range ro.updates {
+			changes = append(changes, update.Change{
+				ServiceID: service.ID,
+				Container: cluster.Container{Name: u.Container, Image: u.Target.String()},
+				ImageID:   u.Current,
+			})
+			images = append(images, u.Target.String())
+		}
+		reason := fmt.Sprintf("%s was not ready %s after releasing %s (status: %s)", service.ID, d.RollbackDeadline, strings.Join(images, ", "), service.Status)
+		logger.Log("service", service.ID, "msg", "rolling back release", "reason", reason)
+		if _, err := d.UpdateManifests(update.Spec{
+			Type: update.Rollback,
+			Spec: update.RollbackSpec{Changes: changes, Reason: reason, Lock: true},
+		}); err != nil {
+			logger.Log("service", service.ID, "error", errors.Wrap(err, "rolling back release"))
+		}
+	}
+	// Services that have gone altogether can't be rolled back
+	for id, ro := range pending {
+		if !found[id] && !now.Before(ro.releasedAt.Add(d.RollbackDeadline)) {
+			d.rollouts.forget(id, ro.revision)
+		}
+	}
+}
+
+// rollback returns services to the images they were running before
+// a release, locking them if asked to. The rollback event is recorded
+// when the commit is synced, as with releases.
+func (d *Daemon) rollback(spec update.Spec, r update.RollbackSpec) DaemonJobFunc {
+	return func(jobID job.ID, working *git.Checkout, before map[string]resource.Resource, logger log.Logger) (*history.CommitEventMetadata, error) {
+		rc := release.NewReleaseContext(d.Cluster, d.Manifests, d.Registry, working)
+		result, err := release.Release(rc, r, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		// Failing to lock a service (e.g., because its manifest is
+		// generated) mustn't stop the images being reverted; it's
+		// recorded in the service's result instead.
+		var rolledBack bool
+		for id, res := range result {
+			if res.Status != update.ReleaseStatusSuccess {
+				continue
+			}
+			rolledBack = true
+			if !r.Lock {
+				continue
+			}
+			err := cluster.UpdateManifest(d.Manifests, working.ManifestDir(), string(id), func(def []byte) ([]byte, error) {
+				return d.Manifests.UpdatePolicies(def, policy.Update{Add: policy.Set{}.Add(policy.Locked)})
+			})
+			if err != nil {
+				logger.Log("service", id, "err", errors.Wrap(err, "locking service"))
+				res.Error = fmt.Sprintf("rolled back, but could not be locked: %s", err)
+				result[id] = res
+			}
+		}
+		if !rolledBack {
+			return &history.CommitEventMetadata{Spec: &spec, Result: result}, nil
+		}
+
+		commitMsg := spec.Cause.Message
+		if commitMsg == "" {
+			commitMsg = r.CommitMessage()
+		}
+		if err := d.validate(working, before); err != nil {
+			return nil, err
+		}
+		pr, err := d.commitAndPush(working, commitMsg, &git.Note{JobID: jobID, Spec: spec, Result: result})
+		if err != nil {
+			// As with releases, ask for a sync so the next attempt
+			// is more likely to succeed.
+			d.askForSync()
+			return nil, err
+		}
+		revision, err := working.HeadRevision()
+		if err != nil {
+			return nil, err
+		}
+		return &history.CommitEventMetadata{
+			Revision:     revision,
+			Spec:         &spec,
+			Result:       result,
+			PullRequests: pr,
+		}, nil
+	}
+}
@@ -0,0 +1,183 @@
+package daemon
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+func rolloutUpdates(t *testing.T, current, target string) []update.ContainerUpdate {
+	c, err := flux.ParseImageID(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg, err := flux.ParseImageID(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []update.ContainerUpdate{{Container: "container0", Current: c, Target: tg}}
+}
+
+func TestRolledOut(t *testing.T) {
+	updates := rolloutUpdates(t, "helloworld:1", "helloworld:2")
+	for _, c := range []struct {
+		name    string
+		service cluster.Service
+		want    bool
+	}{
+		{"ready with new image", promotionService("default/helloworld", cluster.StatusReady, "helloworld:2"), true},
+		{"ready with old image", promotionService("default/helloworld", cluster.StatusReady, "helloworld:1"), false},
+		{"updating", promotionService("default/helloworld", "updating", "helloworld:2"), false},
+		{"container gone", promotionService("default/helloworld", cluster.StatusReady), false},
+	} {
+		if got := rolledOut(c.service, updates); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestRolloutsForget(t *testing.T) {
+	var r rollouts
+	id := flux.ServiceID("default/helloworld")
+	now := time.Now()
+	r.watch(id, rollout{revision: "a", releasedAt: now})
+	r.watch(id, rollout{revision: "b", releasedAt: now})
+
+	// forgetting an earlier release leaves the later one watched
+	r.forget(id, "a")
+	pending := r.list()
+	if ro, ok := pending[id]; !ok || ro.revision != "b" {
+		t.Fatalf("expected revision b to be watched, got %+v", pending)
+	}
+
+	// the list is a copy
+	delete(pending, id)
+	if _, ok := r.list()[id]; !ok {
+		t.Fatal("expected revision b still to be watched")
+	}
+
+	r.forget(id, "b")
+	if len(r.list()) != 0 {
+		t.Fatalf("expected nothing to be watched, got %+v", r.list())
+	}
+}
+
+// The image the test service was running before the (pretend) release
+// of currentHelloImage
+const previousHelloImage = "quay.io/weaveworks/helloworld:master-a000000"
+
+// watchStalledRelease has the daemon watch a release of the test
+// service that should have rolled out by now.
+func watchStalledRelease(t *testing.T, d *Daemon) {
+	d.RollbackDeadline = time.Minute
+	updates := rolloutUpdates(t, previousHelloImage, currentHelloImage)
+	updates[0].Container = container
+	d.rollouts.watch(svc, rollout{revision: "stalled", releasedAt: time.Now().Add(-time.Hour), updates: updates})
+}
+
+func manifestHasImage(t *testing.T, d *Daemon, image string) bool {
+	d.Checkout.Lock()
+	defer d.Checkout.Unlock()
+	def, err := ioutil.ReadFile(filepath.Join(d.Checkout.ManifestDir(), "helloworld-deploy.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Contains(string(def), image+"\n")
+}
+
+// unlockableManifests can't update policies, as with e.g., generated
+// manifests.
+type unlockableManifests struct {
+	cluster.Manifests
+}
+
+func (unlockableManifests) UpdatePolicies([]byte, policy.Update) ([]byte, error) {
+	return nil, errors.New("policies cannot be updated")
+}
+
+// waitForRollbackEvent waits for a rollback to be recorded in the
+// history, and returns its metadata.
+func waitForRollbackEvent(t *testing.T, w wait, events history.EventReader) *history.RollbackEventMetadata {
+	var rollback *history.RollbackEventMetadata
+	w.Eventually(func() bool {
+		es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range es {
+			if e.Type == history.EventRollback {
+				rollback = e.Metadata.(*history.RollbackEventMetadata)
+				return true
+			}
+		}
+		return false
+	}, "Waiting for the rollback event")
+	return rollback
+}
+
+// A release that doesn't roll out by the deadline is rolled back, and
+// the service locked so it isn't released again straight away.
+func TestCheckRollouts_RollsBackAndLocks(t *testing.T) {
+	d, clean, _, events := mockDaemon(t)
+	defer clean()
+	w := newWait(t)
+	watchStalledRelease(t, d)
+
+	d.checkRollouts(log.NewNopLogger())
+
+	w.Eventually(func() bool {
+		return manifestHasImage(t, d, previousHelloImage)
+	}, "Waiting for the release to be rolled back")
+	w.Eventually(func() bool {
+		d.Checkout.RLock()
+		defer d.Checkout.RUnlock()
+		policies, err := d.Manifests.ServicesWithPolicies(d.Checkout.ManifestDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return policies[svc].Contains(policy.Locked)
+	}, "Waiting for the service to be locked")
+
+	rollback := waitForRollbackEvent(t, w, events)
+	if rollback.Error != "" {
+		t.Errorf("expected the rollback event to have no error, got %q", rollback.Error)
+	}
+	if res := rollback.Result[svc]; res.Status != update.ReleaseStatusSuccess || res.Error != "" {
+		t.Errorf("expected a successful result for %s, got %+v", svc, res)
+	}
+}
+
+// If the service can't be locked, its release is still rolled back,
+// and the failure to lock reported with the rollback.
+func TestCheckRollouts_RollsBackWhenLockFails(t *testing.T) {
+	d, clean, _, events := mockDaemon(t)
+	defer clean()
+	w := newWait(t)
+	d.Manifests = unlockableManifests{d.Manifests}
+	watchStalledRelease(t, d)
+
+	d.checkRollouts(log.NewNopLogger())
+
+	w.Eventually(func() bool {
+		return manifestHasImage(t, d, previousHelloImage)
+	}, "Waiting for the release to be rolled back")
+
+	rollback := waitForRollbackEvent(t, w, events)
+	if !strings.Contains(rollback.Error, "could not be locked") {
+		t.Errorf("expected the rollback event to report the service wasn't locked, got %q", rollback.Error)
+	}
+	if res := rollback.Result[svc]; res.Status != update.ReleaseStatusSuccess || res.Error == "" {
+		t.Errorf("expected a successful result with the locking error for %s, got %+v", svc, res)
+	}
+}
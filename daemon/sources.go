@@ -0,0 +1,282 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+)
+
+// Source is a git repo (and the path within it) that the daemon syncs
+// to the cluster, as well as the main repo given by Daemon.Repo and
+// Daemon.Checkout. Each source has its own branch, sync tag and notes
+// ref, and changes to the services it defines are committed to it.
+type Source struct {
+	Name     string
+	Repo     git.Repo
+	Checkout *git.Checkout
+}
+
+func (s Source) String() string {
+	if s.Name == "" {
+		return "main"
+	}
+	return s.Name
+}
+
+// SourceConfig is the configuration of a source, as given to fluxd in
+// a flag.
+type SourceConfig struct {
+	Name     string
+	Remote   flux.GitRemoteConfig
+	SyncTag  string
+	NotesRef string
+}
+
+// ParseSourceConfig parses the configuration of a source given as
+// comma-separated fields, e.g.,
+//
+//	name=addons,url=git@github.com:example/addons,branch=master,path=k8s
+//
+// The name and URL must be given. Other fields not given are taken
+// from the defaults given; the sync tag and notes ref have the name
+// of the source appended, so that they don't clash with those of a
+// source that uses another path in the same repo.
+func ParseSourceConfig(s string, defaults SourceConfig) (SourceConfig, error) {
+	conf := SourceConfig{Remote: flux.GitRemoteConfig{Branch: defaults.Remote.Branch}}
+	for _, field := range strings.Split(s, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return SourceConfig{}, fmt.Errorf("expected key=value in git source %q, got %q", s, field)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch key {
+		case "name":
+			conf.Name = value
+		case "url":
+			conf.Remote.URL = value
+		case "branch":
+			conf.Remote.Branch = value
+		case "path":
+			conf.Remote.Path = value
+		case "sync-tag":
+			conf.SyncTag = value
+		case "notes-ref":
+			conf.NotesRef = value
+		default:
+			return SourceConfig{}, fmt.Errorf("unknown field %q in git source %q", key, s)
+		}
+	}
+	if conf.Name == "" || conf.Remote.URL == "" {
+		return SourceConfig{}, fmt.Errorf("git source %q needs at least a name and a url", s)
+	}
+	remote, err := flux.NewGitRemoteConfig(conf.Remote.URL, conf.Remote.Branch, conf.Remote.Path)
+	if err != nil {
+		return SourceConfig{}, err
+	}
+	conf.Remote = remote
+	if conf.SyncTag == "" {
+		conf.SyncTag = defaults.SyncTag + "-" + conf.Name
+	}
+	if conf.NotesRef == "" {
+		conf.NotesRef = defaults.NotesRef + "-" + conf.Name
+	}
+	return conf, nil
+}
+
+// sources returns all the sources the daemon syncs, starting with the
+// main repo.
+func (d *Daemon) sources() []Source {
+	return append([]Source{{Repo: d.Repo, Checkout: d.Checkout}}, d.Sources...)
+}
+
+// servicesWithPolicies returns the policies of the services defined
+// in all the sources.
+func (d *Daemon) servicesWithPolicies() (policy.ServiceMap, error) {
+	all := policy.ServiceMap{}
+	for _, src := range d.sources() {
+		src.Checkout.RLock()
+		services, err := d.Manifests.ServicesWithPolicies(src.Checkout.ManifestDir())
+		src.Checkout.RUnlock()
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting service policies from source %s", src)
+		}
+		for id, policies := range services {
+			if _, ok := all[id]; !ok {
+				all[id] = policies
+			}
+		}
+	}
+	return all, nil
+}
+
+// sourcesFor returns the sources that define the services given, in
+// the order they're configured; if no services are given, meaning any
+// service, it returns all the sources. A service defined in more than
+// one source is an error, since there's no telling which definition
+// should be changed. If none of the services are defined anywhere,
+// the main repo is given, so that the job reports them as missing.
+func (d *Daemon) sourcesFor(ids []flux.ServiceID) ([]Source, error) {
+	sources := d.sources()
+	if ids == nil {
+		return sources, nil
+	}
+	owns := make([]bool, len(sources))
+	definedIn := map[flux.ServiceID]Source{}
+	for i, src := range sources {
+		src.Checkout.RLock()
+		defined, err := d.Manifests.FindDefinedServices(src.Checkout.ManifestDir())
+		src.Checkout.RUnlock()
+		if err != nil {
+			return nil, errors.Wrapf(err, "finding services in source %s", src)
+		}
+		for _, id := range ids {
+			if _, ok := defined[id]; !ok {
+				continue
+			}
+			if other, ok := definedIn[id]; ok {
+				return nil, fmt.Errorf("service %s is defined in more than one git source (%s and %s)", id, other, src)
+			}
+			definedIn[id] = src
+			owns[i] = true
+		}
+	}
+	var res []Source
+	for i, src := range sources {
+		if owns[i] {
+			res = append(res, src)
+		}
+	}
+	if len(res) == 0 {
+		res = sources[:1]
+	}
+	return res, nil
+}
+
+// servicesNamed returns the services the changes given are to, or nil
+// if they may be to any service.
+func servicesNamed(c release.Changes) []flux.ServiceID {
+	var ids []flux.ServiceID
+	switch s := c.(type) {
+	case update.ReleaseSpec:
+		for _, spec := range s.ServiceSpecs {
+			id, err := spec.AsID()
+			if err != nil {
+				return nil
+			}
+			ids = append(ids, id)
+		}
+	case *update.Automated:
+		for _, change := range s.Changes {
+			ids = append(ids, change.ServiceID)
+		}
+	case update.RollbackSpec:
+		for _, change := range s.Changes {
+			ids = append(ids, change.ServiceID)
+		}
+	}
+	return ids
+}
+
+// mergeResources combines the resources loaded from each source. A
+// resource defined in more than one source is a conflict: the
+// definition from the first is used, and the conflict is returned as
+// an error for that resource. The revisions give the revision of each
+// source; the revision of the source each resource comes from is
+// returned too.
+func mergeResources(sources []Source, revisions []string, loaded []map[string]resource.Resource) (map[string]resource.Resource, map[string]string, cluster.SyncError) {
+	all := map[string]resource.Resource{}
+	revisionOf := map[string]string{}
+	from := map[string]Source{}
+	var conflicts cluster.SyncError
+	for i, resources := range loaded {
+		for id, res := range resources {
+			if other, ok := from[id]; ok {
+				if conflicts == nil {
+					conflicts = cluster.SyncError{}
+				}
+				conflicts[id] = fmt.Errorf("defined in more than one git source (%s and %s); using the definition in %s", other, sources[i], other)
+				continue
+			}
+			all[id] = res
+			revisionOf[id] = revisions[i]
+			from[id] = sources[i]
+		}
+	}
+	return all, revisionOf, conflicts
+}
+
+// syncRevision is how a sync of all the sources is identified: the
+// HEAD revision of each source, in order, joined with commas. With
+// only the main repo, it's just its HEAD revision.
+func syncRevision(revisions []string) string {
+	return strings.Join(revisions, ",")
+}
+
+// revisionAt gives the revision of the i'th source in a sync revision.
+func revisionAt(syncRev string, i int) string {
+	revisions := strings.Split(syncRev, ",")
+	if i < len(revisions) {
+		return revisions[i]
+	}
+	return ""
+}
+
+// withConflicts adds the errors for conflicting resources to the
+// error from a sync. If the sync failed as a whole, that error stands
+// for every resource already.
+func withConflicts(syncErr error, conflicts cluster.SyncError) error {
+	if len(conflicts) == 0 {
+		return syncErr
+	}
+	if syncErr == nil {
+		return conflicts
+	}
+	errs, ok := syncErr.(cluster.SyncError)
+	if !ok {
+		return syncErr
+	}
+	combined := cluster.SyncError{}
+	for id, err := range errs {
+		combined[id] = err
+	}
+	for id, err := range conflicts {
+		combined[id] = err
+	}
+	return combined
+}
+
+// resultRank orders the outcomes for a service from different
+// sources, so that the outcome from the source that defines the
+// service is kept when they're merged, rather than the outcome from a
+// source that doesn't have it.
+func resultRank(r update.ServiceResult) int {
+	switch {
+	case r.Error == update.NotInRepo, r.Error == cluster.ErrNoResourceFilesFoundForService.Error():
+		return 0
+	case r.Status == update.ReleaseStatusSuccess:
+		return 3
+	case r.Status == update.ReleaseStatusFailed:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// mergeResults adds the results from a source to those from other
+// sources.
+func mergeResults(into, from update.Result) {
+	for id, r := range from {
+		if existing, ok := into[id]; !ok || resultRank(r) > resultRank(existing) {
+			into[id] = r
+		}
+	}
+}
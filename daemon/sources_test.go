@@ -0,0 +1,315 @@
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/gittest"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+)
+
+func TestParseSourceConfig(t *testing.T) {
+	defaults := SourceConfig{
+		Remote:   flux.GitRemoteConfig{Branch: "master"},
+		SyncTag:  "flux-sync",
+		NotesRef: "flux",
+	}
+
+	conf, err := ParseSourceConfig("name=addons,url=git@github.com:example/addons,path=k8s", defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := SourceConfig{
+		Name:     "addons",
+		Remote:   flux.GitRemoteConfig{URL: "git@github.com:example/addons", Branch: "master", Path: "k8s"},
+		SyncTag:  "flux-sync-addons",
+		NotesRef: "flux-addons",
+	}
+	if !reflect.DeepEqual(conf, expected) {
+		t.Errorf("expected %+v, got %+v", expected, conf)
+	}
+
+	conf, err = ParseSourceConfig("name=apps, url=git@github.com:example/apps, branch=prod, sync-tag=apps-sync, notes-ref=apps", defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = SourceConfig{
+		Name:     "apps",
+		Remote:   flux.GitRemoteConfig{URL: "git@github.com:example/apps", Branch: "prod"},
+		SyncTag:  "apps-sync",
+		NotesRef: "apps",
+	}
+	if !reflect.DeepEqual(conf, expected) {
+		t.Errorf("expected %+v, got %+v", expected, conf)
+	}
+
+	for _, s := range []string{
+		"url=git@github.com:example/apps",
+		"name=apps",
+		"name=apps,url=git@github.com:example/apps,colour=blue",
+		"name=apps,url=git@github.com:example/apps,path=/k8s",
+		"name=apps,git@github.com:example/apps",
+	} {
+		if _, err := ParseSourceConfig(s, defaults); err == nil {
+			t.Errorf("%q: expected error, got nil", s)
+		}
+	}
+}
+
+type fakeResource struct {
+	id, source string
+}
+
+func (r fakeResource) ResourceID() string                                       { return r.id }
+func (r fakeResource) ServiceIDs(map[string]resource.Resource) []flux.ServiceID { return nil }
+func (r fakeResource) Policy() policy.Set                                       { return nil }
+func (r fakeResource) Source() string                                           { return r.source }
+func (r fakeResource) Offset() int                                              { return 0 }
+func (r fakeResource) Bytes() []byte                                            { return nil }
+
+func TestMergeResources(t *testing.T) {
+	sources := []Source{{}, {Name: "apps"}}
+	deploy := fakeResource{"Deployment default/helloworld", "main/deploy.yaml"}
+	svc := fakeResource{"Service default/helloworld", "apps/svc.yaml"}
+	dupe := fakeResource{"Deployment default/helloworld", "apps/deploy.yaml"}
+	loaded := []map[string]resource.Resource{
+		{deploy.id: deploy},
+		{svc.id: svc, dupe.id: dupe},
+	}
+
+	all, revisions, conflicts := mergeResources(sources, []string{"rev1", "rev2"}, loaded)
+	if !reflect.DeepEqual(all, map[string]resource.Resource{deploy.id: deploy, svc.id: svc}) {
+		t.Errorf("expected the first definition of each resource, got %+v", all)
+	}
+	if !reflect.DeepEqual(revisions, map[string]string{deploy.id: "rev1", svc.id: "rev2"}) {
+		t.Errorf("unexpected revisions %v", revisions)
+	}
+	if len(conflicts) != 1 || conflicts[deploy.id] == nil {
+		t.Errorf("expected a conflict for %s, got %v", deploy.id, conflicts)
+	}
+
+	// The conflict is added to the errors from the sync
+	syncErr := withConflicts(cluster.SyncError{svc.id: conflicts[deploy.id]}, conflicts)
+	if errs, ok := syncErr.(cluster.SyncError); !ok || len(errs) != 2 {
+		t.Errorf("expected errors for both resources, got %v", syncErr)
+	}
+	if withConflicts(nil, nil) != nil {
+		t.Error("expected no error without conflicts")
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	merged := update.Result{
+		"default/helloworld": update.ServiceResult{Status: update.ReleaseStatusSkipped, Error: update.NotInRepo},
+		"default/locked":     update.ServiceResult{Status: update.ReleaseStatusSkipped, Error: update.Locked},
+	}
+	mergeResults(merged, update.Result{
+		"default/helloworld": update.ServiceResult{Status: update.ReleaseStatusSuccess},
+		"default/locked":     update.ServiceResult{Status: update.ReleaseStatusSkipped, Error: update.NotInRepo},
+		"apps/frontend":      update.ServiceResult{Status: update.ReleaseStatusFailed, Error: cluster.ErrNoResourceFilesFoundForService.Error()},
+	})
+	expected := update.Result{
+		"default/helloworld": update.ServiceResult{Status: update.ReleaseStatusSuccess},
+		"default/locked":     update.ServiceResult{Status: update.ReleaseStatusSkipped, Error: update.Locked},
+		"apps/frontend":      update.ServiceResult{Status: update.ReleaseStatusFailed, Error: cluster.ErrNoResourceFilesFoundForService.Error()},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %+v, got %+v", expected, merged)
+	}
+}
+
+// splitSources gives the daemon another source, and divides the test
+// services between the two: test-service is defined only in the other
+// source, and the rest only in the main one.
+func splitSources(t *testing.T, d *Daemon) func() {
+	repo, cleanupRepo := gittest.Repo(t)
+	other, err := repo.Clone(git.Config{
+		SyncTag:   gitSyncTag,
+		NotesRef:  gitNotesRef,
+		UserName:  gitUser,
+		UserEmail: gitEmail,
+	})
+	if err != nil {
+		cleanupRepo()
+		t.Fatal(err)
+	}
+	d.Sources = []Source{{Name: "other", Repo: repo, Checkout: other}}
+
+	isTestService := func(file string) bool { return strings.HasPrefix(file, "test-service-") }
+	keepOnly := func(co *git.Checkout, keep func(string) bool) {
+		for file := range testfiles.Files {
+			if keep(file) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(co.ManifestDir(), file)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := co.CommitAndPush("Divide services between sources", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keepOnly(d.Checkout, func(file string) bool { return !isTestService(file) })
+	keepOnly(other, isTestService)
+	return func() {
+		other.Clean()
+		cleanupRepo()
+	}
+}
+
+func TestDaemon_SourcesFor(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	defer splitSources(t, d)()
+
+	for _, c := range []struct {
+		ids     []flux.ServiceID
+		sources []string
+	}{
+		{nil, []string{"main", "other"}},
+		{[]flux.ServiceID{"default/helloworld"}, []string{"main"}},
+		{[]flux.ServiceID{"default/test-service"}, []string{"other"}},
+		{[]flux.ServiceID{"default/test-service", "default/helloworld"}, []string{"main", "other"}},
+		// Services that aren't defined anywhere go to the main source,
+		// for the job to report them as missing
+		{[]flux.ServiceID{"default/nonexistent"}, []string{"main"}},
+	} {
+		sources, err := d.sourcesFor(c.ids)
+		if err != nil {
+			t.Errorf("%v: %s", c.ids, err)
+			continue
+		}
+		var names []string
+		for _, src := range sources {
+			names = append(names, src.String())
+		}
+		if !reflect.DeepEqual(names, c.sources) {
+			t.Errorf("%v: expected sources %v, got %v", c.ids, c.sources, names)
+		}
+	}
+
+	// A service defined in both sources can't be changed in either
+	def := testfiles.Files["test-service-deploy.yaml"]
+	if err := ioutil.WriteFile(filepath.Join(d.Checkout.ManifestDir(), "test-service-deploy.yaml"), []byte(def), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.sourcesFor([]flux.ServiceID{"default/test-service"}); err == nil {
+		t.Error("expected an error for a service defined in both sources, got nil")
+	}
+}
+
+// A job over several sources is done in each, and its results
+// combined; it succeeds if it made changes in any of them.
+func TestDaemon_QueueJobInSources(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	defer splitSources(t, d)()
+
+	// change commits a change to the service's definition, if the
+	// working clone has it.
+	change := func(working *git.Checkout, name string) (*history.CommitEventMetadata, error) {
+		path := filepath.Join(working.ManifestDir(), name+"-deploy.yaml")
+		def, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, git.ErrNoChanges
+		} else if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, append(def, "# changed\n"...), 0666); err != nil {
+			return nil, err
+		}
+		if err := working.CommitAndPush("Change "+name, nil); err != nil {
+			return nil, err
+		}
+		rev, err := working.HeadRevision()
+		if err != nil {
+			return nil, err
+		}
+		return &history.CommitEventMetadata{
+			Revision: rev,
+			Result: update.Result{
+				flux.ServiceID("default/" + name): update.ServiceResult{Status: update.ReleaseStatusSuccess},
+			},
+		}, nil
+	}
+	changeAll := func(names ...string) DaemonJobFunc {
+		return func(_ job.ID, working *git.Checkout, _ map[string]resource.Resource, _ log.Logger) (*history.CommitEventMetadata, error) {
+			var metadata *history.CommitEventMetadata
+			for _, name := range names {
+				m, err := change(working, name)
+				if err == git.ErrNoChanges {
+					continue
+				} else if err != nil {
+					return nil, err
+				}
+				metadata = m
+			}
+			if metadata == nil {
+				return nil, git.ErrNoChanges
+			}
+			return metadata, nil
+		}
+	}
+	run := func(do DaemonJobFunc) job.Status {
+		id := d.queueJob(d.sources(), do)
+		j := <-d.Jobs.Ready()
+		j.Do(log.NewNopLogger())
+		status, ok := d.JobStatusCache.Status(id)
+		if !ok {
+			t.Fatalf("no status for job %s", id)
+		}
+		return status
+	}
+
+	// Changes in both sources are reported together, with the
+	// revision of the first
+	status := run(changeAll("helloworld", "test-service"))
+	if status.StatusString != job.StatusSucceeded {
+		t.Fatalf("expected job to succeed, got %+v", status)
+	}
+	if err := d.Checkout.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	head, err := d.Checkout.HeadRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Result.Revision != head {
+		t.Errorf("expected the revision of the main source %s, got %s", head, status.Result.Revision)
+	}
+	for _, id := range []flux.ServiceID{"default/helloworld", "default/test-service"} {
+		if res := status.Result.Result[id]; res.Status != update.ReleaseStatusSuccess {
+			t.Errorf("expected %s to be changed, got %+v", id, res)
+		}
+	}
+
+	// A source with nothing to change is passed over
+	status = run(changeAll("test-service"))
+	if status.StatusString != job.StatusSucceeded {
+		t.Fatalf("expected job to succeed, got %+v", status)
+	}
+	if res := status.Result.Result["default/test-service"]; res.Status != update.ReleaseStatusSuccess {
+		t.Errorf("expected test-service to be changed, got %+v", res)
+	}
+
+	// ... but if there's nothing to change in any source, that's a
+	// failure
+	status = run(changeAll("nonexistent"))
+	if status.StatusString != job.StatusFailed || status.Err != git.ErrNoChanges.Error() {
+		t.Errorf("expected job to fail with no changes, got %+v", status)
+	}
+}
@@ -0,0 +1,117 @@
+package daemon
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/resource"
+	fluxsync "github.com/weaveworks/flux/sync"
+)
+
+// syncStatusCache keeps the outcome of the most recent sync, for
+// each resource in the repo.
+type syncStatusCache struct {
+	mu       sync.RWMutex
+	statuses map[string]flux.ResourceSyncStatus
+}
+
+// record updates the cache with the outcome of a sync of the
+// resources given, each at the revision given for it (that of the
+// git source it came from). Resources that are no longer in the repo
+// are forgotten. If the sync failed as a whole (i.e., not with a
+// per-resource error), every resource is recorded as having failed
+// with that error.
+func (c *syncStatusCache) record(revisions map[string]string, at time.Time, resources map[string]resource.Resource, result fluxsync.Result, err error) {
+	applied := map[string]bool{}
+	for _, id := range result.Applied {
+		applied[id] = true
+	}
+	errs, isSyncError := err.(cluster.SyncError)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := map[string]flux.ResourceSyncStatus{}
+	for id, res := range resources {
+		status := c.statuses[id]
+		status.ID = id
+		status.ServiceIDs = res.ServiceIDs(resources)
+		status.Error = ""
+		switch {
+		case err != nil && !isSyncError:
+			status.Error = err.Error()
+		case errs[id] != nil:
+			status.Error = errs[id].Error()
+		case applied[id]:
+			status.Revision = revisions[id]
+			status.AppliedAt = at
+		}
+		statuses[id] = status
+	}
+	c.statuses = statuses
+}
+
+// list returns the statuses of all resources, sorted by ID.
+func (c *syncStatusCache) list() []flux.ResourceSyncStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	res := make([]flux.ResourceSyncStatus, 0, len(c.statuses))
+	for _, status := range c.statuses {
+		res = append(res, status)
+	}
+	sort.Sort(byResourceID(res))
+	return res
+}
+
+// forService returns the statuses of the resources that are part of
+// the service given.
+func (c *syncStatusCache) forService(id flux.ServiceID) []flux.ResourceSyncStatus {
+	var res []flux.ResourceSyncStatus
+	for _, status := range c.list() {
+		if flux.ServiceIDs(status.ServiceIDs).Contains(id) {
+			res = append(res, status)
+		}
+	}
+	return res
+}
+
+type byResourceID []flux.ResourceSyncStatus
+
+func (s byResourceID) Len() int           { return len(s) }
+func (s byResourceID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+func (s byResourceID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// syncFailure records the revision at which a sync most recently
+// failed, in strict mode, so that we can report it to anyone waiting
+// for that revision (or one before it) to be applied.
+type syncFailure struct {
+	mu       sync.RWMutex
+	revision string
+	err      error
+}
+
+// set records a failed sync, and reports whether it is at a different
+// revision to the failure already recorded (if any).
+func (f *syncFailure) set(revision string, err error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	changed := f.revision != revision
+	f.revision, f.err = revision, err
+	return changed
+}
+
+func (f *syncFailure) clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revision, f.err = "", nil
+}
+
+func (f *syncFailure) get() (string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.revision, f.err
+}
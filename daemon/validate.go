@@ -0,0 +1,56 @@
+package daemon
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/resource"
+)
+
+// validate checks the changes made in a working clone, before they
+// are committed. The manifests are loaded (and so parsed) as they are
+// now, and compared with those loaded before the job started,
+// `before` (see doJobIn); each resource that's new or different is given to the
+// validator. Comparing what's loaded, rather than looking at which
+// files changed, means resources defined through an overlay or a
+// chart are checked as they will be applied.
+func (d *Daemon) validate(working *git.Checkout, before map[string]resource.Resource) error {
+	if d.Validator == nil {
+		return nil
+	}
+
+	after, err := d.Manifests.LoadManifests(working.ManifestDir())
+	if err != nil {
+		return &cluster.ValidationError{Problems: []string{err.Error()}}
+	}
+
+	// If the manifests didn't load before, there's nothing to compare
+	// with, so everything is checked.
+	var ids []string
+	for id, res := range after {
+		if prev, ok := before[id]; !ok || !bytes.Equal(prev.Bytes(), res.Bytes()) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+	changed := make([]resource.Resource, len(ids))
+	for i, id := range ids {
+		changed[i] = after[id]
+	}
+
+	problems, err := d.Validator.Validate(working.Dir, changed)
+	if err != nil {
+		return errors.Wrap(err, "validating manifests")
+	}
+	if len(problems) > 0 {
+		return &cluster.ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package daemon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+)
+
+// unverifiedCommits remembers which commits have been reported as not
+// signed by a trusted key, so that each is reported only once rather
+// than at every sync.
+type unverifiedCommits struct {
+	mu       sync.Mutex
+	reported map[string]bool
+}
+
+// unreported returns those of the commits given that haven't been
+// reported already, and marks them as reported.
+func (u *unverifiedCommits) unreported(commits []git.UnverifiedCommit) []git.UnverifiedCommit {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.reported == nil {
+		u.reported = map[string]bool{}
+	}
+	var res []git.UnverifiedCommit
+	for _, c := range commits {
+		if !u.reported[c.Revision] {
+			u.reported[c.Revision] = true
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// verifySource checks that the commits in the working clone of a
+// source since it was last synced are signed by trusted keys, and
+// moves the working clone back to the newest commit that can be
+// trusted, so that nothing past it is synced (and the sync tag isn't
+// moved past it). Each commit that can't be trusted is reported as an
+// event. It returns false if there's nothing in the source that can
+// be synced, in which case the source is held back (see doSync).
+func (d *Daemon) verifySource(working *git.Checkout, logger log.Logger) bool {
+	from := working.SyncTag
+	if _, err := working.TagRevision(from); isUnknownRevision(err) {
+		// Never synced before, so only the head can be checked
+		from = ""
+	} else if err != nil {
+		logger.Log("err", errors.Wrap(err, "getting sync tag revision"))
+		return false
+	}
+
+	verified, unverified, err := working.VerifySignatures(d.TrustedKeyring, from, "HEAD")
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "verifying commit signatures"))
+		return false
+	}
+
+	now := time.Now().UTC()
+	for _, c := range d.unverified.unreported(unverified) {
+		logger.Log("unverified", c.Revision, "reason", c.Reason)
+		if err := d.LogEvent(history.Event{
+			Type:      history.EventUnverified,
+			StartedAt: now,
+			EndedAt:   now,
+			LogLevel:  history.LogLevelError,
+			Metadata: &history.UnverifiedCommitEventMetadata{
+				Commit: history.Commit{Revision: c.Revision, Message: c.Message},
+				Reason: c.Reason,
+			},
+		}); err != nil {
+			logger.Log("err", err)
+		}
+	}
+
+	if verified == "" {
+		logger.Log("err", "the head commit is not signed by a trusted key; not syncing")
+		return false
+	}
+	if len(unverified) > 0 {
+		if err := working.ResetTo(verified); err != nil {
+			logger.Log("err", err)
+			return false
+		}
+	}
+	return true
+}
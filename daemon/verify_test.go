@@ -0,0 +1,189 @@
+package daemon
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/gittest"
+	"github.com/weaveworks/flux/history"
+)
+
+const testSigningKey = "flux@example.com"
+
+// writeKeys generates a key, and writes the private key and the
+// public key to the files given.
+func writeKeys(t *testing.T, privateFile, publicFile string) {
+	entity, err := openpgp.NewEntity("Flux", "", testSigningKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(file, blockType string, serialize func(w io.Writer) error) {
+		f, err := os.Create(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		w, err := armor.Encode(f, blockType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := serialize(w); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(privateFile, openpgp.PrivateKeyType, func(w io.Writer) error {
+		return entity.SerializePrivate(w, nil)
+	})
+	write(publicFile, openpgp.PublicKeyType, func(w io.Writer) error {
+		return entity.Serialize(w)
+	})
+}
+
+// An unsigned commit is reported, and neither it nor anything after
+// it is synced.
+func TestDoSync_StopsAtUnverifiedCommit(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	k8s.SyncFunc = func(def cluster.SyncDef) error { return nil }
+
+	dir, cleanupKeys := testfiles.TempDir(t)
+	defer cleanupKeys()
+	private, public := filepath.Join(dir, "private.asc"), filepath.Join(dir, "public.asc")
+	writeKeys(t, private, public)
+	d.TrustedKeyring = public
+
+	change := func(msg, from, to string) {
+		if err := cluster.UpdateManifest(k8s, d.Checkout.ManifestDir(), "default/helloworld", func(def []byte) ([]byte, error) {
+			return []byte(strings.Replace(string(def), from, to, -1)), nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Checkout.CommitAndPush(msg, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A signed commit, synced already
+	d.Checkout.SigningKey, d.Checkout.SigningKeyring = testSigningKey, private
+	change("signed", "replicas: 5", "replicas: 4")
+	if err := d.Checkout.MoveTagAndPush("HEAD", "Sync pointer"); err != nil {
+		t.Fatal(err)
+	}
+	synced, err := d.Checkout.HeadRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An unsigned commit, and a signed one after it
+	d.Checkout.SigningKey = ""
+	change("unsigned", "replicas: 4", "replicas: 3")
+	unsigned, err := d.Checkout.HeadRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Checkout.SigningKey = testSigningKey
+	change("signed again", "replicas: 3", "replicas: 2")
+
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+
+	// The unsigned commit is reported
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reported bool
+	for _, e := range es {
+		if e.Type != history.EventUnverified {
+			continue
+		}
+		if e.Metadata.(*history.UnverifiedCommitEventMetadata).Commit.Revision != unsigned {
+			t.Errorf("expected %s to be reported as unverified, got %#v", unsigned, e.Metadata)
+		}
+		reported = true
+	}
+	if !reported {
+		t.Errorf("expected an event for the unverified commit, got %#v", es)
+	}
+
+	// The sync tag hasn't moved past it
+	if err := d.Checkout.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := d.Checkout.TagRevision(gitSyncTag); err != nil || rev != synced {
+		t.Errorf("expected the sync tag to stay at %s, got %s (%v)", synced, rev, err)
+	}
+}
+
+// A source with nothing that can be verified is left out, and the
+// other sources are still synced.
+func TestDoSync_SkipsUnverifiedSource(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	k8s.SyncFunc = func(def cluster.SyncDef) error { return nil }
+
+	dir, cleanupKeys := testfiles.TempDir(t)
+	defer cleanupKeys()
+	private, public := filepath.Join(dir, "private.asc"), filepath.Join(dir, "public.asc")
+	writeKeys(t, private, public)
+	d.TrustedKeyring = public
+
+	// The main source has a signed commit at its head ...
+	d.Checkout.SigningKey, d.Checkout.SigningKeyring = testSigningKey, private
+	if err := cluster.UpdateManifest(k8s, d.Checkout.ManifestDir(), "default/helloworld", func(def []byte) ([]byte, error) {
+		return []byte(strings.Replace(string(def), "replicas: 5", "replicas: 4", -1)), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Checkout.CommitAndPush("signed", nil); err != nil {
+		t.Fatal(err)
+	}
+	head, err := d.Checkout.HeadRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ... and the other source doesn't.
+	repo, cleanupRepo := gittest.Repo(t)
+	defer cleanupRepo()
+	other, err := repo.Clone(git.Config{
+		SyncTag:   gitSyncTag,
+		NotesRef:  gitNotesRef,
+		UserName:  gitUser,
+		UserEmail: gitEmail,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Clean()
+	d.Sources = []Source{{Name: "other", Repo: repo, Checkout: other}}
+
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+
+	if err := d.Checkout.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := d.Checkout.TagRevision(gitSyncTag); err != nil || rev != head {
+		t.Errorf("expected the main source to be synced to %s, got %s (%v)", head, rev, err)
+	}
+	if err := other.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.TagRevision(gitSyncTag); !isUnknownRevision(err) {
+		t.Errorf("expected the other source not to be synced, got %v", err)
+	}
+}
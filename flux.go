@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -157,12 +158,45 @@ type ServiceStatus struct {
 	Locked     bool
 	Ignore     bool
 	Policies   map[string]string
+	Sync       []ResourceSyncStatus
+	// Deferred is set when automated releases of the service are
+	// being held back, e.g., because it's outside its automation
+	// window.
+	Deferred *DeferredRelease `json:",omitempty"`
+}
+
+// DeferredRelease is an automated release that's waiting, and why.
+// Until is when it may go ahead, if that's known.
+type DeferredRelease struct {
+	Images []ImageID
+	Reason string
+	Until  time.Time
+}
+
+// ResourceSyncStatus is the outcome of the most recent attempt to
+// apply a resource from the repo to the cluster. Revision and
+// AppliedAt refer to the last time it was applied successfully, so
+// they are kept if a later attempt fails; Error is from the most
+// recent attempt, and is empty if that succeeded.
+type ResourceSyncStatus struct {
+	ID         string // e.g., "Deployment default/helloworld"
+	ServiceIDs []ServiceID
+	Revision   string
+	AppliedAt  time.Time
+	Error      string
 }
 
 type Container struct {
 	Name      string
 	Current   Image
 	Available []Image
+	// TagPolicy is the container's tag policy, if it has one, and
+	// Selected the available image that the policy would select
+	// (e.g., when automated). If the tag policy can't be parsed,
+	// TagPolicyError says why, and nothing is selected.
+	TagPolicy      string `json:",omitempty"`
+	TagPolicyError string `json:",omitempty"`
+	Selected       *Image `json:",omitempty"`
 }
 
 // --- config types
@@ -187,4 +221,8 @@ type GitRemoteConfig struct {
 type GitConfig struct {
 	Remote       GitRemoteConfig `json:"remote"`
 	PublicSSHKey ssh.PublicKey   `json:"publicSSHKey"`
+	// Auth is how the daemon authenticates to the repo; "ssh" (using
+	// PublicSSHKey) or "https". It's empty from older daemons, which
+	// only use SSH.
+	Auth string `json:"auth,omitempty"`
 }
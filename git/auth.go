@@ -0,0 +1,141 @@
+package git
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+
+	"github.com/weaveworks/flux/ssh"
+)
+
+const (
+	AuthMethodSSH   = "ssh"
+	AuthMethodHTTPS = "https"
+)
+
+// Auth is how we authenticate to a remote git repo. It supplies the
+// credentials to present to the remote, for each URL it's used with.
+type Auth interface {
+	// Method names the kind of authentication, for reporting
+	Method() string
+	AuthMethod(repoURL string) (transport.AuthMethod, error)
+}
+
+// SSHAuth authenticates with the private key in a keyring, e.g., a
+// deploy key. The host is checked against the known hosts files, as
+// ssh would check it.
+type SSHAuth struct {
+	KeyRing ssh.KeyRing
+}
+
+func (a SSHAuth) Method() string {
+	return AuthMethodSSH
+}
+
+func (a SSHAuth) AuthMethod(repoURL string) (transport.AuthMethod, error) {
+	if a.KeyRing == nil {
+		return nil, nil
+	}
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	user := endpoint.User
+	if user == "" {
+		user = "git"
+	}
+	_, privateKeyPath := a.KeyRing.KeyPair()
+	return gitssh.NewPublicKeysFromFile(user, privateKeyPath, "")
+}
+
+// HTTPSAuth authenticates to repos served over HTTPS with credentials
+// kept as files in a directory, e.g., a Kubernetes secret mounted as a
+// volume. The directory has either `username` and `password` in it,
+// or `token`; a `username` can be given with a token, for hosts that
+// need a particular one, otherwise "x-access-token" is used.
+//
+// The files are read each time credentials are needed, so changes to
+// the secret are picked up without restarting, and the credentials
+// don't appear in the daemon's config or logs. Proxy settings are
+// taken from the environment (HTTPS_PROXY and so on).
+type HTTPSAuth struct {
+	Dir string
+}
+
+// NewHTTPSAuth checks that there are credentials in the directory
+// given, and returns the auth that uses them.
+func NewHTTPSAuth(dir string) (HTTPSAuth, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return HTTPSAuth{}, err
+	}
+	a := HTTPSAuth{Dir: dir}
+	if a.has("token") {
+		return a, nil
+	}
+	if !a.has("username") || !a.has("password") {
+		return HTTPSAuth{}, errors.Errorf("expected either token, or username and password, in git credentials directory %s", dir)
+	}
+	return a, nil
+}
+
+func (a HTTPSAuth) has(file string) bool {
+	_, err := os.Stat(filepath.Join(a.Dir, file))
+	return err == nil
+}
+
+func (a HTTPSAuth) read(file string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(a.Dir, file))
+	if err != nil {
+		return "", errors.Wrap(err, "reading git credentials")
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (a HTTPSAuth) Method() string {
+	return AuthMethodHTTPS
+}
+
+func (a HTTPSAuth) AuthMethod(repoURL string) (transport.AuthMethod, error) {
+	username := "x-access-token"
+	if a.has("username") || !a.has("token") {
+		var err error
+		if username, err = a.read("username"); err != nil {
+			return nil, err
+		}
+	}
+	passwordFile := "password"
+	if a.has("token") {
+		passwordFile = "token"
+	}
+	password, err := a.read(passwordFile)
+	if err != nil {
+		return nil, err
+	}
+	return &githttp.BasicAuth{Username: username, Password: password}, nil
+}
+
+// CheckURL checks that a repo URL suits the auth given. Credentials
+// must not be put in the URL, since it's logged and shown in the
+// daemon's config, and HTTPS auth needs an http(s) URL.
+func CheckURL(auth Auth, repoURL string) error {
+	if repoURL == "" {
+		return nil
+	}
+	u, err := url.Parse(repoURL)
+	isHTTP := err == nil && (u.Scheme == "https" || u.Scheme == "http")
+	if isHTTP && u.User != nil {
+		return errors.New("git URL must not have credentials in it; use --git-auth=https and mount them from a secret")
+	}
+	if auth != nil && auth.Method() == AuthMethodHTTPS && !isHTTP {
+		return errors.Errorf("git URL %q must be an https URL to use HTTPS auth", repoURL)
+	}
+	return nil
+}
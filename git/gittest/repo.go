@@ -1,50 +1,97 @@
 package gittest
 
 import (
-	"io/ioutil"
-	"os/exec"
-	"path/filepath"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
 	"github.com/weaveworks/flux/git"
 )
 
-// Repo creates a new clone-able git repo, pre-populated with some kubernetes
-// files and a few commits. Also returns a cleanup func to clean up after.
-func Repo(t *testing.T) (git.Repo, func()) {
-	newDir, cleanup := testfiles.TempDir(t)
+// Test repos are kept in memory, and served in-process (as the git
+// package serves repos on disk) under URLs with this scheme.
+const scheme = "gittest"
 
-	filesDir := filepath.Join(newDir, "files")
-	gitDir := filepath.Join(newDir, "git")
-	if err := execCommand("mkdir", filesDir); err != nil {
-		t.Fatal(err)
+func init() {
+	client.InstallProtocol(scheme, server.NewServer(repos))
+}
+
+// memoryLoader serves the test repos currently in use, by URL.
+type memoryLoader struct {
+	sync.Mutex
+	next    int
+	storers map[string]storer.Storer
+}
+
+var repos = &memoryLoader{storers: map[string]storer.Storer{}}
+
+func (l *memoryLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	l.Lock()
+	defer l.Unlock()
+	s, ok := l.storers[ep.String()]
+	if !ok {
+		return nil, transport.ErrRepositoryNotFound
 	}
+	return s, nil
+}
 
-	var err error
-	if err = execCommand("git", "-C", filesDir, "init"); err != nil {
-		cleanup()
-		t.Fatal(err)
+// add serves the storer given, returning the URL it's served at, and
+// a func to stop serving it.
+func (l *memoryLoader) add(s storer.Storer) (string, func()) {
+	l.Lock()
+	defer l.Unlock()
+	l.next++
+	url := fmt.Sprintf("%s://repos/%d", scheme, l.next)
+	l.storers[url] = s
+	return url, func() {
+		l.Lock()
+		defer l.Unlock()
+		delete(l.storers, url)
 	}
-	if err = testfiles.WriteTestFiles(filesDir); err != nil {
-		cleanup()
+}
+
+// Repo creates a new clone-able git repo, pre-populated with some kubernetes
+// files and a few commits. Also returns a cleanup func to clean up after.
+func Repo(t *testing.T) (git.Repo, func()) {
+	storage := memory.NewStorage()
+	files := memfs.New()
+	repo, err := gogit.Init(storage, files)
+	if err != nil {
 		t.Fatal(err)
 	}
-	if err = execCommand("git", "-C", filesDir, "add", "--all"); err != nil {
-		cleanup()
+	worktree, err := repo.Worktree()
+	if err != nil {
 		t.Fatal(err)
 	}
-	if err = execCommand("git", "-C", filesDir, "commit", "-m", "'Initial revision'"); err != nil {
-		cleanup()
-		t.Fatal(err)
+	for file, content := range testfiles.Files {
+		if err = util.WriteFile(files, file, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = worktree.Add(file); err != nil {
+			t.Fatal(err)
+		}
 	}
-
-	if err = execCommand("git", "clone", "--bare", filesDir, gitDir); err != nil {
+	if _, err = worktree.Commit("Initial revision", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "example", Email: "example@example.com", When: time.Now()},
+	}); err != nil {
 		t.Fatal(err)
 	}
 
-	conf, _ := flux.NewGitRemoteConfig(gitDir, "master", "")
+	url, cleanup := repos.add(storage)
+	conf, _ := flux.NewGitRemoteConfig(url, "master", "")
 	return git.Repo{
 		GitRemoteConfig: conf,
 	}, cleanup
@@ -68,10 +115,3 @@ func Checkout(t *testing.T) (*git.Checkout, func()) {
 		cleanup()
 	}
 }
-
-func execCommand(cmd string, args ...string) error {
-	c := exec.Command(cmd, args...)
-	c.Stderr = ioutil.Discard
-	c.Stdout = ioutil.Discard
-	return c.Run()
-}
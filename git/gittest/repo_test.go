@@ -122,3 +122,107 @@ func TestCheckout(t *testing.T) {
 	defer anotherCheckout.Clean()
 	check(checkout)
 }
+
+func TestCommitAndPushBranch(t *testing.T) {
+	checkout, cleanup := Checkout(t)
+	defer cleanup()
+
+	var changedFile string
+	for file := range testfiles.Files {
+		changedFile = file
+		break
+	}
+	change := func() (*git.Checkout, string, bool) {
+		working, err := checkout.WorkingClone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(working.ManifestDir(), changedFile)
+		if err := ioutil.WriteFile(path, []byte("PROPOSED CHANGE"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		branch, created, err := working.CommitAndPushBranch("Proposed change", nil, "flux-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return working, branch, created
+	}
+
+	first, branch, created := change()
+	defer first.Clean()
+	if !created {
+		t.Errorf("expected branch %s to be created", branch)
+	}
+	rev, err := first.HeadRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The branch checked out is left alone
+	if err := checkout.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if head, err := checkout.HeadRevision(); err != nil || head == rev {
+		t.Errorf("expected %s not to be pushed to the branch; got head %s (%v)", rev, head, err)
+	}
+
+	// The same change again goes to the same branch, which is left
+	// as it was
+	second, secondBranch, created := change()
+	defer second.Clean()
+	if created || secondBranch != branch {
+		t.Errorf("expected existing branch %s to be used, got %s (created %v)", branch, secondBranch, created)
+	}
+	if head, err := second.HeadRevision(); err != nil || head != rev {
+		t.Errorf("expected head to be moved to %s, got %s (%v)", rev, head, err)
+	}
+}
+
+func TestSaveProposals(t *testing.T) {
+	repo, cleanup := Repo(t)
+	defer cleanup()
+
+	params := git.Config{
+		UserName:  "example",
+		UserEmail: "example@example.com",
+		SyncTag:   "flux-test",
+		NotesRef:  "fluxtest",
+	}
+	checkout, err := repo.Clone(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkout.Clean()
+
+	proposals, err := checkout.Proposals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proposals) != 0 {
+		t.Errorf("expected no proposals yet, got %+v", proposals)
+	}
+
+	proposal := git.Proposal{
+		JobID:     job.ID("jobID1234"),
+		Spec:      update.Spec{Type: update.Images, Spec: update.ReleaseSpec{}},
+		Revision:  "abc123",
+		Approvers: []string{"alice"},
+	}
+	if err := checkout.SaveProposals([]git.Proposal{proposal}); err != nil {
+		t.Fatal(err)
+	}
+
+	// They're seen from another clone, e.g., after a restart
+	anotherCheckout, err := repo.Clone(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer anotherCheckout.Clean()
+	proposals, err = anotherCheckout.Proposals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proposals) != 1 || proposals[0].JobID != proposal.JobID || !reflect.DeepEqual(proposals[0].Approvers, proposal.Approvers) {
+		t.Errorf("expected the proposal saved, got %+v", proposals)
+	}
+}
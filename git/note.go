@@ -1,6 +1,8 @@
 package git
 
 import (
+	"time"
+
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/update"
 )
@@ -10,3 +12,17 @@ type Note struct {
 	Spec   update.Spec   `json:"spec"`
 	Result update.Result `json:"result"`
 }
+
+// Proposal is a release that's been proposed, and is waiting to be
+// approved. Proposals are kept in the repo (see SaveProposals) so
+// they survive fluxd restarting.
+type Proposal struct {
+	JobID job.ID      `json:"jobID"`
+	Spec  update.Spec `json:"spec"`
+	// the revision the release was planned against, and the result
+	// of planning it
+	Revision   string        `json:"revision"`
+	Result     update.Result `json:"result"`
+	Approvers  []string      `json:"approvers,omitempty"`
+	ProposedAt time.Time     `json:"proposedAt"`
+}
@@ -1,242 +1,792 @@
 package git
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
-	"github.com/weaveworks/flux/ssh"
+	"golang.org/x/crypto/openpgp"
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/utils/merkletrie"
 )
 
-func config(workingDir, user, email string) error {
-	for k, v := range map[string]string{
-		"user.name":  user,
-		"user.email": email,
-	} {
-		if err := execGitCmd(workingDir, nil, nil, "config", k, v); err != nil {
-			return errors.Wrap(err, "setting git config")
-		}
+// The operations here are done in-process, with go-git, on a clone
+// on disk. Each one opens the repo afresh, as running a git command
+// would, so that nothing is cached between them.
+
+// Fetches and pushes are made to a URL rather than a configured
+// remote; go-git still wants a name for the remote.
+const remoteName = "origin"
+
+func init() {
+	// Repos given as paths (e.g., the checkout that working clones
+	// are made from) are served in-process too, rather than by
+	// running git-upload-pack and git-receive-pack.
+	client.InstallProtocol("file", server.NewServer(localLoader{}))
+}
+
+// localLoader loads repos from the filesystem, whether they're bare
+// or have a working tree.
+type localLoader struct{}
+
+func (localLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	r, err := open(ep.Path)
+	if err == gogit.ErrRepositoryNotExists {
+		return nil, transport.ErrRepositoryNotFound
+	} else if err != nil {
+		return nil, err
 	}
-	return nil
+	return r.Storer, nil
 }
 
-func clone(workingDir string, keyRing ssh.KeyRing, repoURL, repoBranch string) (path string, err error) {
+func open(path string) (*gogit.Repository, error) {
+	return gogit.PlainOpen(path)
+}
+
+// authMethod gives the credentials for the repo URL, if there's an
+// auth to get them from.
+func authMethod(auth Auth, repoURL string) (transport.AuthMethod, error) {
+	if auth == nil {
+		return nil, nil
+	}
+	return auth.AuthMethod(repoURL)
+}
+
+// remote gives a remote for the repo URL, without adding it to the
+// repo's config.
+func remote(r *gogit.Repository, repoURL string) *gogit.Remote {
+	return gogit.NewRemote(r.Storer, &config.RemoteConfig{
+		Name: remoteName,
+		URLs: []string{repoURL},
+	})
+}
+
+func clone(workingDir string, auth Auth, repoURL, repoBranch string) (path string, err error) {
 	repoPath := filepath.Join(workingDir, "repo")
-	args := []string{"clone"}
+	opts := &gogit.CloneOptions{
+		URL:  repoURL,
+		Tags: gogit.AllTags,
+	}
 	if repoBranch != "" {
-		args = append(args, "--branch", repoBranch)
+		opts.ReferenceName = branchRef(repoBranch)
+		opts.SingleBranch = true
 	}
-	args = append(args, repoURL, repoPath)
-	if err := execGitCmd(workingDir, keyRing, nil, args...); err != nil {
+	if opts.Auth, err = authMethod(auth, repoURL); err != nil {
+		return "", err
+	}
+	if _, err := gogit.PlainClone(repoPath, false, opts); err != nil {
 		return "", errors.Wrap(err, "git clone")
 	}
 	return repoPath, nil
 }
 
-func commit(workingDir, commitMessage string) error {
-	if err := execGitCmd(
-		workingDir, nil, nil,
-		"commit",
-		"--no-verify", "-a", "-m", commitMessage,
-	); err != nil {
+func commit(workingDir, commitMessage string, author *object.Signature, signingKey *openpgp.Entity) error {
+	r, err := open(workingDir)
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	// Like `git commit -a`, this commits changes to the files already
+	// in the repo, but doesn't add new files.
+	if _, err := w.Commit(commitMessage, &gogit.CommitOptions{
+		All:     true,
+		Author:  author,
+		SignKey: signingKey,
+	}); err != nil {
 		return errors.Wrap(err, "git commit")
 	}
 	return nil
 }
 
 // push the refs given to the upstream repo
-func push(keyRing ssh.KeyRing, workingDir, upstream string, refs []string) error {
-	args := append([]string{"push", upstream}, refs...)
-	if err := execGitCmd(workingDir, keyRing, nil, args...); err != nil {
-		return errors.Wrap(err, fmt.Sprintf("git push %s %s", upstream, refs))
+func push(auth Auth, workingDir, upstream string, refspecs []string) error {
+	r, err := open(workingDir)
+	if err != nil {
+		return err
+	}
+	am, err := authMethod(auth, upstream)
+	if err != nil {
+		return err
+	}
+	var specs []config.RefSpec
+	for _, s := range refspecs {
+		specs = append(specs, config.RefSpec(s))
+	}
+	err = remote(r, upstream).Push(&gogit.PushOptions{
+		RemoteName: remoteName,
+		RefSpecs:   specs,
+		Auth:       am,
+	})
+	if err != nil && err != gogit.NoErrAlreadyUpToDate {
+		return errors.Wrap(err, fmt.Sprintf("git push %s %s", upstream, refspecs))
 	}
 	return nil
 }
 
-// pull the specific ref from upstream
-func pull(keyRing ssh.KeyRing, workingDir, upstream, ref string) error {
-	if err := execGitCmd(workingDir, keyRing, nil, "pull", "--ff-only", upstream, ref); err != nil {
-		return errors.Wrap(err, fmt.Sprintf("git pull --ff-only %s %s", upstream, ref))
+// fetch the refs given by the refspecs from upstream. It's not an
+// error for upstream not to have one of the refs, since e.g., the
+// sync tag and the notes may not have been pushed yet; those refspecs
+// are skipped. The refs that were fetched are returned.
+func fetch(auth Auth, workingDir, upstream string, refspecs ...string) ([]string, error) {
+	r, err := open(workingDir)
+	if err != nil {
+		return nil, err
+	}
+	am, err := authMethod(auth, upstream)
+	if err != nil {
+		return nil, err
+	}
+	rem := remote(r, upstream)
+	refs, err := rem.List(&gogit.ListOptions{Auth: am})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("git ls-remote %s", upstream))
+	}
+	exists := map[string]bool{}
+	for _, ref := range refs {
+		exists[ref.Name().String()] = true
+	}
+
+	var specs []config.RefSpec
+	var fetched []string
+	for _, s := range refspecs {
+		spec := config.RefSpec(s)
+		if exists[spec.Src()] {
+			specs = append(specs, spec)
+			fetched = append(fetched, spec.Src())
+		}
 	}
-	return nil
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	err = rem.Fetch(&gogit.FetchOptions{
+		RemoteName: remoteName,
+		RefSpecs:   specs,
+		Auth:       am,
+		Tags:       gogit.NoTags,
+	})
+	if err != nil && err != gogit.NoErrAlreadyUpToDate {
+		return nil, errors.Wrap(err, fmt.Sprintf("git fetch %s %s", upstream, refspecs))
+	}
+	return fetched, nil
 }
 
-func fetch(keyRing ssh.KeyRing, workingDir, upstream, refspec string) error {
-	if err := execGitCmd(workingDir, keyRing, nil, "fetch", "--tags", upstream, refspec); err != nil &&
-		!strings.Contains(err.Error(), "Couldn't find remote ref") {
-		return errors.Wrap(err, fmt.Sprintf("git fetch --tags %s %s", upstream, refspec))
+// pull the branch from upstream, along with the other refs given,
+// and fast-forward the branch checked out to it.
+func pull(auth Auth, workingDir, upstream, branch string, refspecs ...string) error {
+	tracking := "refs/remotes/" + remoteName + "/" + branch
+	specs := append([]string{"+" + branchRef(branch).String() + ":" + tracking}, refspecs...)
+	fetched, err := fetch(auth, workingDir, upstream, specs...)
+	if err != nil {
+		return err
 	}
-	return nil
+	if len(fetched) == 0 || fetched[0] != branchRef(branch).String() {
+		return errors.Errorf("git pull %s %s: no such branch", upstream, branch)
+	}
+
+	r, err := open(workingDir)
+	if err != nil {
+		return err
+	}
+	head, err := resolve(r, "HEAD")
+	if err != nil {
+		return err
+	}
+	target, err := resolve(r, tracking)
+	if err != nil {
+		return err
+	}
+	if !isAncestor(head, target) {
+		return errors.Errorf("git pull %s %s: not possible to fast-forward", upstream, branch)
+	}
+	return resetTo(r, target.Hash)
 }
 
-func refExists(workingDir, ref string) (bool, error) {
-	if err := execGitCmd(workingDir, nil, nil, "rev-list", ref); err != nil {
-		if strings.Contains(err.Error(), "unknown revision") {
-			return false, nil
-		}
-		return false, err
+func branchRef(branch string) plumbing.ReferenceName {
+	return plumbing.ReferenceName("refs/heads/" + branch)
+}
+
+// setBranch makes (or moves) a branch to point at the ref given.
+func setBranch(path, branch, ref string) error {
+	r, err := open(path)
+	if err != nil {
+		return err
+	}
+	c, err := resolve(r, ref)
+	if err != nil {
+		return err
 	}
-	return true, nil
+	return r.Storer.SetReference(plumbing.NewHashReference(branchRef(branch), c.Hash))
 }
 
-// Get the full ref for a shorthand notes ref.
-func getNotesRef(workingDir, ref string) (string, error) {
-	out := &bytes.Buffer{}
-	if err := execGitCmd(workingDir, nil, out, "notes", "--ref", ref, "get-ref"); err != nil {
-		return "", err
+// Get the full ref for a shorthand notes ref, as `git notes --ref`
+// would.
+func expandNotesRef(ref string) string {
+	switch {
+	case strings.HasPrefix(ref, "refs/"):
+		return ref
+	case strings.HasPrefix(ref, "notes/"):
+		return "refs/" + ref
 	}
-	return strings.TrimSpace(out.String()), nil
+	return "refs/notes/" + ref
 }
 
-func addNote(workingDir, rev, notesRef string, note *Note) error {
+// Notes are kept in a commit history of their own. Each commit's tree
+// has a blob for each object with a note, named for the object's
+// hash; in a big tree, the names are split into directories by their
+// first two characters (the "fanout"), and maybe again below that.
+
+func addNote(workingDir, rev, notesRef string, author *object.Signature, note *Note) error {
 	b, err := json.Marshal(note)
 	if err != nil {
 		return err
 	}
-	return execGitCmd(workingDir, nil, nil, "notes", "--ref", notesRef, "add", "-m", string(b), rev)
+	r, err := open(workingDir)
+	if err != nil {
+		return err
+	}
+	c, err := resolve(r, rev)
+	if err != nil {
+		return err
+	}
+
+	var parents []plumbing.Hash
+	var entries []object.TreeEntry
+	ref, err := r.Reference(plumbing.ReferenceName(notesRef), true)
+	switch err {
+	case nil:
+		notes, err := r.CommitObject(ref.Hash())
+		if err != nil {
+			return err
+		}
+		tree, err := notes.Tree()
+		if err != nil {
+			return err
+		}
+		parents, entries = []plumbing.Hash{notes.Hash}, tree.Entries
+	case plumbing.ErrReferenceNotFound:
+	default:
+		return err
+	}
+
+	blob, err := storeBlob(r, append(b, '\n'))
+	if err != nil {
+		return err
+	}
+	entries, err = putNote(r, entries, c.Hash.String(), blob)
+	if err != nil {
+		return err
+	}
+	tree, err := storeTree(r, entries)
+	if err != nil {
+		return err
+	}
+	notes, err := storeObject(r, &object.Commit{
+		Author:       *author,
+		Committer:    *author,
+		Message:      "Notes added by 'git notes add'\n",
+		TreeHash:     tree,
+		ParentHashes: parents,
+	})
+	if err != nil {
+		return err
+	}
+	return r.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(notesRef), notes))
+}
+
+// putNote returns the entries of a notes tree with the blob given as
+// the note for the object named, following any fanout there is
+// already.
+func putNote(r *gogit.Repository, entries []object.TreeEntry, name string, blob plumbing.Hash) ([]object.TreeEntry, error) {
+	// Don't change the entries given, since they may be shared
+	entries = append([]object.TreeEntry(nil), entries...)
+	for i, e := range entries {
+		if e.Mode == filemode.Dir && len(name) > 2 && e.Name == name[:2] {
+			sub, err := r.TreeObject(e.Hash)
+			if err != nil {
+				return nil, err
+			}
+			subEntries, err := putNote(r, sub.Entries, name[2:], blob)
+			if err != nil {
+				return nil, err
+			}
+			if entries[i].Hash, err = storeTree(r, subEntries); err != nil {
+				return nil, err
+			}
+			return entries, nil
+		}
+		if e.Mode != filemode.Dir && e.Name == name {
+			entries[i].Hash = blob
+			return entries, nil
+		}
+	}
+	return append(entries, object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: blob}), nil
+}
+
+// findNote looks for the note for the object named in a notes tree,
+// and returns its blob.
+func findNote(r *gogit.Repository, tree *object.Tree, name string) (*object.Blob, error) {
+	for _, e := range tree.Entries {
+		switch {
+		case e.Mode == filemode.Dir && len(name) > 2 && e.Name == name[:2]:
+			sub, err := r.TreeObject(e.Hash)
+			if err != nil {
+				return nil, err
+			}
+			return findNote(r, sub, name[2:])
+		case e.Mode != filemode.Dir && e.Name == name:
+			return r.BlobObject(e.Hash)
+		}
+	}
+	return nil, nil
 }
 
 // NB return values (*Note, nil), (nil, error), (nil, nil)
 func getNote(workingDir, notesRef, rev string) (*Note, error) {
-	out := &bytes.Buffer{}
-	if err := execGitCmd(workingDir, nil, out, "notes", "--ref", notesRef, "show", rev); err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "no note found for object") {
-			return nil, nil
-		}
+	r, err := open(workingDir)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := r.Reference(plumbing.ReferenceName(notesRef), true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	c, err := resolve(r, rev)
+	if err != nil {
 		return nil, err
 	}
+	notes, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := notes.Tree()
+	if err != nil {
+		return nil, err
+	}
+	blob, err := findNote(r, tree, c.Hash.String())
+	if blob == nil || err != nil {
+		return nil, err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
 	var note Note
-	if err := json.NewDecoder(out).Decode(&note); err != nil {
+	if err := json.NewDecoder(reader).Decode(&note); err != nil {
 		return nil, err
 	}
 	return &note, nil
 }
 
+// Proposals are kept in a commit history of their own, in the same
+// way as notes; each commit's tree has a blob for each proposal,
+// named for the ID of the job that proposed it. Since the whole set
+// is written each time, there's no fanout.
+
+func readProposals(workingDir, ref string) ([]Proposal, error) {
+	r, err := open(workingDir)
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Reference(plumbing.ReferenceName(ref), true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	c, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var proposals []Proposal
+	for _, e := range tree.Entries {
+		blob, err := r.BlobObject(e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		reader, err := blob.Reader()
+		if err != nil {
+			return nil, err
+		}
+		var p Proposal
+		err = json.NewDecoder(reader).Decode(&p)
+		reader.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding proposal %s", e.Name)
+		}
+		proposals = append(proposals, p)
+	}
+	return proposals, nil
+}
+
+func writeProposals(workingDir, ref string, author *object.Signature, proposals []Proposal) error {
+	r, err := open(workingDir)
+	if err != nil {
+		return err
+	}
+	var parents []plumbing.Hash
+	head, err := r.Reference(plumbing.ReferenceName(ref), true)
+	switch err {
+	case nil:
+		parents = []plumbing.Hash{head.Hash()}
+	case plumbing.ErrReferenceNotFound:
+	default:
+		return err
+	}
+
+	var entries []object.TreeEntry
+	for _, p := range proposals {
+		b, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		blob, err := storeBlob(r, append(b, '\n'))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, object.TreeEntry{Name: string(p.JobID), Mode: filemode.Regular, Hash: blob})
+	}
+	tree, err := storeTree(r, entries)
+	if err != nil {
+		return err
+	}
+	c, err := storeObject(r, &object.Commit{
+		Author:       *author,
+		Committer:    *author,
+		Message:      "Update proposed releases\n",
+		TreeHash:     tree,
+		ParentHashes: parents,
+	})
+	if err != nil {
+		return err
+	}
+	return r.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(ref), c))
+}
+
+func storeObject(r *gogit.Repository, o interface {
+	Encode(plumbing.EncodedObject) error
+}) (plumbing.Hash, error) {
+	encoded := r.Storer.NewEncodedObject()
+	if err := o.Encode(encoded); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return r.Storer.SetEncodedObject(encoded)
+}
+
+func storeBlob(r *gogit.Repository, content []byte) (plumbing.Hash, error) {
+	encoded := r.Storer.NewEncodedObject()
+	encoded.SetType(plumbing.BlobObject)
+	w, err := encoded.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return r.Storer.SetEncodedObject(encoded)
+}
+
+func storeTree(r *gogit.Repository, entries []object.TreeEntry) (plumbing.Hash, error) {
+	sort.Sort(treeOrder(entries))
+	return storeObject(r, &object.Tree{Entries: entries})
+}
+
+// treeOrder sorts tree entries as git expects them to be, which is
+// by name, but with directories compared as though they end in "/".
+type treeOrder []object.TreeEntry
+
+func (t treeOrder) Len() int      { return len(t) }
+func (t treeOrder) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t treeOrder) Less(i, j int) bool {
+	return t.sortName(i) < t.sortName(j)
+}
+
+func (t treeOrder) sortName(i int) string {
+	if t[i].Mode == filemode.Dir {
+		return t[i].Name + "/"
+	}
+	return t[i].Name
+}
+
+// resolve gets the commit a ref or revision refers to, following tags
+// to the commit they point at.
+func resolve(r *gogit.Repository, ref string) (*object.Commit, error) {
+	hash, err := r.ResolveRevision(plumbing.Revision(ref))
+	switch err {
+	case nil:
+	case plumbing.ErrReferenceNotFound, plumbing.ErrObjectNotFound:
+		return nil, errors.Wrap(ErrUnknownRevision, ref)
+	default:
+		return nil, errors.Wrap(err, "resolving "+ref)
+	}
+	return r.CommitObject(*hash)
+}
+
 // Get the commit hash for a reference
 func refRevision(path, ref string) (string, error) {
-	out := &bytes.Buffer{}
-	if err := execGitCmd(path, nil, out, "rev-list", "--max-count", "1", ref); err != nil {
+	r, err := open(path)
+	if err != nil {
+		return "", err
+	}
+	c, err := resolve(r, ref)
+	if err != nil {
 		return "", err
 	}
-	return strings.TrimSpace(out.String()), nil
+	return c.Hash.String(), nil
 }
 
-func revlist(path, ref string) ([]string, error) {
-	out := &bytes.Buffer{}
-	if err := execGitCmd(path, nil, out, "rev-list", ref); err != nil {
-		return nil, err
+// Get the hash of the tree (i.e., the content) of the commit at a
+// reference
+func treeRevision(path, ref string) (string, error) {
+	r, err := open(path)
+	if err != nil {
+		return "", err
+	}
+	c, err := resolve(r, ref)
+	if err != nil {
+		return "", err
 	}
-	return splitList(out.String()), nil
+	return c.TreeHash.String(), nil
 }
 
-// Return the revisions and one-line log commit messages
-func onelinelog(path, refspec string) ([]Commit, error) {
-	out := &bytes.Buffer{}
-	if err := execGitCmd(path, nil, out, "log", "--oneline", "--no-abbrev-commit", refspec); err != nil {
+// remoteBranchExists reports whether the upstream repo has a branch
+// with the name given.
+func remoteBranchExists(auth Auth, workingDir, upstream, branch string) (bool, error) {
+	r, err := open(workingDir)
+	if err != nil {
+		return false, err
+	}
+	am, err := authMethod(auth, upstream)
+	if err != nil {
+		return false, err
+	}
+	refs, err := remote(r, upstream).List(&gogit.ListOptions{Auth: am})
+	if err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("git ls-remote %s", upstream))
+	}
+	for _, ref := range refs {
+		if ref.Name() == branchRef(branch) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ancestors returns the set of commits reachable from the commit
+// given (including itself).
+func ancestors(c *object.Commit) (map[plumbing.Hash]bool, error) {
+	seen := map[plumbing.Hash]bool{}
+	err := object.NewCommitPreorderIter(c, nil, nil).ForEach(func(c *object.Commit) error {
+		seen[c.Hash] = true
+		return nil
+	})
+	return seen, err
+}
+
+// commitRange returns the commits reachable from `to` but not from
+// `from` -- or all those reachable from `to`, if `from` is empty --
+// newest first, as `git log from..to` would list them. The set of
+// commits reachable from `from` is also returned.
+func commitRange(r *gogit.Repository, from, to string) ([]*object.Commit, map[plumbing.Hash]bool, error) {
+	toCommit, err := resolve(r, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	exclude := map[plumbing.Hash]bool{}
+	if from != "" {
+		fromCommit, err := resolve(r, from)
+		if err != nil {
+			return nil, nil, err
+		}
+		if exclude, err = ancestors(fromCommit); err != nil {
+			return nil, nil, err
+		}
+	}
+	var commits []*object.Commit
+	err = object.NewCommitIterCTime(toCommit, exclude, nil).ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	return commits, exclude, err
+}
+
+// Return the revisions and one-line log commit messages of the
+// commits between `from` and `to` (see commitRange).
+func onelinelog(path, from, to string) ([]Commit, error) {
+	r, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	commits, _, err := commitRange(r, from, to)
+	if err != nil {
 		return nil, err
 	}
-	return splitLog(out.String())
+	log := make([]Commit, len(commits))
+	for i, c := range commits {
+		log[i] = Commit{Revision: c.Hash.String(), Message: subject(c.Message), Time: c.Committer.When}
+	}
+	return log, nil
+}
+
+// subject gives the first paragraph of a commit message on one line,
+// as `git log --oneline` does.
+func subject(message string) string {
+	paragraph := strings.SplitN(strings.TrimSpace(message), "\n\n", 2)[0]
+	return strings.Join(strings.Fields(paragraph), " ")
 }
 
-func splitLog(s string) ([]Commit, error) {
-	lines := splitList(s)
-	commits := make([]Commit, len(lines))
-	for i, m := range lines {
-		revAndMessage := strings.SplitN(m, " ", 2)
-		commits[i].Revision = revAndMessage[0]
-		commits[i].Message = revAndMessage[1]
+// isAncestor reports whether c1 is in the history of c2 (or is c2).
+func isAncestor(c1, c2 *object.Commit) bool {
+	ok, err := c1.IsAncestor(c2)
+	return err == nil && ok
+}
+
+// resetTo moves the branch checked out, and the working tree, to the
+// commit given.
+func resetTo(r *gogit.Repository, hash plumbing.Hash) error {
+	w, err := r.Worktree()
+	if err != nil {
+		return err
 	}
-	return commits, nil
+	if err := w.Reset(&gogit.ResetOptions{Commit: hash, Mode: gogit.HardReset}); err != nil {
+		return errors.Wrap(err, "resetting to "+hash.String())
+	}
+	return nil
 }
 
-func splitList(s string) []string {
-	outStr := strings.TrimSpace(s)
-	if outStr == "" {
-		return []string{}
+// Move the branch checked out, and the working tree, to the ref given
+func reset(path, ref string) error {
+	r, err := open(path)
+	if err != nil {
+		return err
 	}
-	return strings.Split(outStr, "\n")
+	c, err := resolve(r, ref)
+	if err != nil {
+		return err
+	}
+	return resetTo(r, c.Hash)
 }
 
 // Move the tag to the ref given and push that tag upstream
-func moveTagAndPush(path string, keyRing ssh.KeyRing, tag, ref, msg, upstream string) error {
-	if err := execGitCmd(path, nil, nil, "tag", "--force", "-a", "-m", msg, tag, ref); err != nil {
+func moveTagAndPush(path string, auth Auth, tag, ref, msg string, tagger *object.Signature, upstream string) error {
+	r, err := open(path)
+	if err != nil {
+		return err
+	}
+	c, err := resolve(r, ref)
+	if err != nil {
+		return err
+	}
+	tagObject, err := storeObject(r, &object.Tag{
+		Name:       tag,
+		Tagger:     *tagger,
+		Message:    msg + "\n",
+		TargetType: plumbing.CommitObject,
+		Target:     c.Hash,
+	})
+	if err != nil {
+		return errors.Wrap(err, "moving tag "+tag)
+	}
+	tagRef := plumbing.ReferenceName("refs/tags/" + tag)
+	if err := r.Storer.SetReference(plumbing.NewHashReference(tagRef, tagObject)); err != nil {
 		return errors.Wrap(err, "moving tag "+tag)
 	}
-	if err := execGitCmd(path, keyRing, nil, "push", "--force", upstream, "tag", tag); err != nil {
+	if err := push(auth, path, upstream, []string{"+" + tagRef.String() + ":" + tagRef.String()}); err != nil {
 		return errors.Wrap(err, "pushing tag to origin")
 	}
 	return nil
 }
 
+// changedFiles lists the files under subPath that are different
+// between the ref given and HEAD, leaving out files that have been
+// deleted.
 func changedFiles(path, subPath, ref string) ([]string, error) {
 	// Remove leading slash if present. diff doesn't work when using github style root paths.
 	if len(subPath) > 0 && subPath[0] == '/' {
 		return []string{}, errors.New("git subdirectory should not have leading forward slash")
 	}
-	out := &bytes.Buffer{}
-	// This uses --diff-filter to only look at changes for file _in
-	// the working dir_; i.e, we do not report on things that no
-	// longer appear.
-	if err := execGitCmd(path, nil, out, "diff", "--name-only", "--diff-filter=ACMRT", ref, "--", subPath); err != nil {
+	r, err := open(path)
+	if err != nil {
 		return nil, err
 	}
-	return splitList(out.String()), nil
-}
-
-func execGitCmd(dir string, keyRing ssh.KeyRing, out io.Writer, args ...string) error {
-	//	println("git", strings.Join(args, " "))
-	c := exec.Command("git", args...)
-	if dir != "" {
-		c.Dir = dir
-	}
-	c.Env = env(keyRing)
-	c.Stdout = ioutil.Discard
-	if out != nil {
-		c.Stdout = out
+	trees := make([]*object.Tree, 2)
+	for i, rev := range []string{ref, "HEAD"} {
+		c, err := resolve(r, rev)
+		if err != nil {
+			return nil, err
+		}
+		if trees[i], err = c.Tree(); err != nil {
+			return nil, err
+		}
 	}
-	errOut := &bytes.Buffer{}
-	c.Stderr = errOut
-	err := c.Run()
+	changes, err := object.DiffTree(trees[0], trees[1])
 	if err != nil {
-		msg := findErrorMessage(errOut)
-		if msg != "" {
-			err = errors.New(msg)
+		return nil, err
+	}
+	files := []string{}
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+		// Only look at changes for files in HEAD; i.e., we do not
+		// report on things that no longer appear.
+		if action != merkletrie.Delete && inPath(subPath, change.To.Name) {
+			files = append(files, change.To.Name)
 		}
 	}
-	return err
+	return files, nil
 }
 
-func env(keyRing ssh.KeyRing) []string {
-	base := `GIT_SSH_COMMAND=ssh -o LogLevel=error`
-	if keyRing == nil {
-		return []string{base}
-	}
-	_, privateKeyPath := keyRing.KeyPair()
-	return []string{fmt.Sprintf("%s -i %q", base, privateKeyPath), "GIT_TERMINAL_PROMPT=0"}
+// inPath reports whether the file is at or under the path given,
+// both relative to the top of the repo.
+func inPath(path, file string) bool {
+	path = strings.Trim(path, "/")
+	return path == "" || file == path || strings.HasPrefix(file, path+"/")
 }
 
 // check returns true if there are changes locally.
 func check(workingDir, subdir string) bool {
-	// `--quiet` means "exit with 1 if there are changes"
-	return execGitCmd(workingDir, nil, nil, "diff", "--quiet", "--", subdir) != nil
-}
-
-func findErrorMessage(output io.Reader) string {
-	sc := bufio.NewScanner(output)
-	for sc.Scan() {
-		switch {
-		case strings.HasPrefix(sc.Text(), "fatal: "):
-			return sc.Text()
-		case strings.HasPrefix(sc.Text(), "error:"):
-			return strings.Trim(sc.Text(), "error: ")
+	r, err := open(workingDir)
+	if err != nil {
+		return true
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return true
+	}
+	status, err := w.Status()
+	if err != nil {
+		return true
+	}
+	// Like `git diff`, this looks only at files already in the repo
+	for file, s := range status {
+		if s.Worktree != gogit.Unmodified && s.Worktree != gogit.Untracked && inPath(subdir, file) {
+			return true
 		}
 	}
-	return ""
+	return false
 }
@@ -1,11 +1,21 @@
 package git
 
 import (
-	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
-	"io/ioutil"
-	"os/exec"
+	"os"
 	"path"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
 )
 
 func TestChangedFiles_SlashPath(t *testing.T) {
@@ -59,30 +69,157 @@ func TestChangedFiles_NoPath(t *testing.T) {
 	}
 }
 
+func TestNotes(t *testing.T) {
+	newDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+
+	if err := createRepo(newDir, ""); err != nil {
+		t.Fatal(err)
+	}
+	rev, err := refRevision(newDir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notesRef := expandNotesRef("flux")
+	checkNote := func(expected *Note) {
+		note, err := getNote(newDir, notesRef, rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(note, expected) {
+			t.Errorf("expected note %+v, got %+v", expected, note)
+		}
+	}
+
+	// No notes at all, yet
+	checkNote(nil)
+	if err := addNote(newDir, rev, notesRef, testSignature(), &Note{JobID: job.ID("job1")}); err != nil {
+		t.Fatal(err)
+	}
+	checkNote(&Note{JobID: job.ID("job1")})
+
+	// Once there are lots of notes, git puts them in directories
+	// named for the first two characters of the revision. Make sure
+	// those are found, and updated rather than added to.
+	r, err := open(newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := storeBlob(r, []byte(`{"jobID":"job2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fanout, err := storeTree(r, []object.TreeEntry{{Name: rev[2:], Mode: filemode.Regular, Hash: blob}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := storeTree(r, []object.TreeEntry{{Name: rev[:2], Mode: filemode.Dir, Hash: fanout}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := storeObject(r, &object.Commit{Author: *testSignature(), Committer: *testSignature(), TreeHash: tree})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(notesRef), notes)); err != nil {
+		t.Fatal(err)
+	}
+	checkNote(&Note{JobID: job.ID("job2")})
+
+	if err := addNote(newDir, rev, notesRef, testSignature(), &Note{JobID: job.ID("job3")}); err != nil {
+		t.Fatal(err)
+	}
+	checkNote(&Note{JobID: job.ID("job3")})
+	ref, err := r.Reference(plumbing.ReferenceName(notesRef), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree, err := c.Tree(); err != nil || len(tree.Entries) != 1 || tree.Entries[0].Name != rev[:2] {
+		t.Errorf("expected the note to be kept under %s/, got %+v (%v)", rev[:2], tree, err)
+	}
+}
+
+func TestProposals(t *testing.T) {
+	newDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+
+	if err := createRepo(newDir, ""); err != nil {
+		t.Fatal(err)
+	}
+	ref := expandNotesRef("flux") + "-proposals"
+	checkProposals := func(expected ...Proposal) {
+		proposals, err := readProposals(newDir, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(proposals) != len(expected) {
+			t.Fatalf("expected %d proposals, got %+v", len(expected), proposals)
+		}
+		for i, p := range proposals {
+			e := expected[i]
+			if p.JobID != e.JobID || p.Revision != e.Revision || !p.ProposedAt.Equal(e.ProposedAt) ||
+				!reflect.DeepEqual(p.Approvers, e.Approvers) || p.Spec.Type != e.Spec.Type {
+				t.Errorf("expected proposal %+v, got %+v", e, p)
+			}
+		}
+	}
+
+	// None at all, yet
+	checkProposals()
+
+	spec := update.Spec{Type: update.Images, Spec: update.ReleaseSpec{
+		ServiceSpecs: []update.ServiceSpec{update.ServiceSpecAll},
+		ImageSpec:    update.ImageSpecLatest,
+		Kind:         update.ReleaseKindPropose,
+	}}
+	proposedAt := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	first := Proposal{JobID: job.ID("job1"), Spec: spec, Revision: "abc", ProposedAt: proposedAt}
+	second := Proposal{JobID: job.ID("job2"), Spec: spec, Revision: "def", Approvers: []string{"alice"}, ProposedAt: proposedAt}
+	if err := writeProposals(newDir, ref, testSignature(), []Proposal{first, second}); err != nil {
+		t.Fatal(err)
+	}
+	checkProposals(first, second)
+
+	// The whole set is replaced each time
+	if err := writeProposals(newDir, ref, testSignature(), []Proposal{second}); err != nil {
+		t.Fatal(err)
+	}
+	checkProposals(second)
+	if err := writeProposals(newDir, ref, testSignature(), nil); err != nil {
+		t.Fatal(err)
+	}
+	checkProposals()
+}
+
+func testSignature() *object.Signature {
+	return &object.Signature{Name: "Flux", Email: "flux@example.com", When: time.Now()}
+}
+
 func createRepo(dir string, nestedDir string) error {
 	fullPath := path.Join(dir, nestedDir)
-	var err error
-	if err = execCommand("git", "-C", dir, "init"); err != nil {
+	r, err := gogit.PlainInit(dir, false)
+	if err != nil {
 		return err
 	}
-	if err := execCommand("mkdir", "-p", fullPath); err != nil {
+	if err := os.MkdirAll(fullPath, 0755); err != nil {
 		return err
 	}
 	if err = testfiles.WriteTestFiles(fullPath); err != nil {
 		return err
 	}
-	if err = execCommand("git", "-C", dir, "add", "--all"); err != nil {
+	w, err := r.Worktree()
+	if err != nil {
 		return err
 	}
-	if err = execCommand("git", "-C", dir, "commit", "-m", "'Initial revision'"); err != nil {
-		return err
+	for file := range testfiles.Files {
+		if _, err := w.Add(path.Join(strings.TrimPrefix(nestedDir, "/"), file)); err != nil {
+			return err
+		}
 	}
-	return nil
-}
-
-func execCommand(cmd string, args ...string) error {
-	c := exec.Command(cmd, args...)
-	c.Stderr = ioutil.Discard
-	c.Stdout = ioutil.Discard
-	return c.Run()
+	_, err = w.Commit("Initial revision", &gogit.CommitOptions{Author: testSignature()})
+	return err
 }
@@ -1,24 +1,31 @@
 package git
 
 import (
-	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 
 	"github.com/weaveworks/flux"
-	"github.com/weaveworks/flux/ssh"
 )
 
 var (
 	ErrNoChanges = errors.New("no changes made in repo")
+	// ErrUnknownRevision is returned (wrapped, so use errors.Cause to
+	// compare with it) when a ref or revision isn't in the repo, e.g.,
+	// the sync tag before anything has been synced.
+	ErrUnknownRevision = errors.New("unknown revision or path not in the working tree")
 )
 
 // Repo represents a (remote) git repo.
 type Repo struct {
 	flux.GitRemoteConfig
-	KeyRing ssh.KeyRing
+	Auth Auth
 }
 
 // Checkout is a local clone of the remote repo.
@@ -37,11 +44,18 @@ type Config struct {
 	NotesRef  string
 	UserName  string
 	UserEmail string
+	// SigningKey is the GPG key to sign commits with, if any, and
+	// SigningKeyring the file or directory it's in (see SigningKey
+	// and ReadKeyRing)
+	SigningKey     string
+	SigningKeyring string
 }
 
 type Commit struct {
 	Revision string
 	Message  string
+	// Time is when the commit was made, according to the committer
+	Time time.Time
 }
 
 // Get a local clone of the upstream repo, and use the config given.
@@ -55,22 +69,14 @@ func (r Repo) Clone(c Config) (*Checkout, error) {
 		return nil, err
 	}
 
-	repoDir, err := clone(workingDir, r.KeyRing, r.URL, r.Branch)
+	repoDir, err := clone(workingDir, r.Auth, r.URL, r.Branch)
 	if err != nil {
 		return nil, CloningError(r.URL, err)
 	}
 
-	if err := config(repoDir, c.UserName, c.UserEmail); err != nil {
-		return nil, err
-	}
-
-	notesRef, err := getNotesRef(repoDir, c.NotesRef)
-	if err != nil {
-		return nil, err
-	}
-
+	notesRef := expandNotesRef(c.NotesRef)
 	// this fetches and updates the local ref, so we'll see notes
-	if err := fetch(r.KeyRing, repoDir, r.URL, notesRef+":"+notesRef); err != nil {
+	if _, err := fetch(r.Auth, repoDir, r.URL, notesRef+":"+notesRef); err != nil {
 		return nil, err
 	}
 
@@ -98,12 +104,8 @@ func (c *Checkout) WorkingClone() (*Checkout, error) {
 		return nil, err
 	}
 
-	if err := config(repoDir, c.UserName, c.UserEmail); err != nil {
-		return nil, err
-	}
-
 	// this fetches and updates the local ref, so we'll see notes
-	if err := fetch(nil, repoDir, c.Dir, c.realNotesRef+":"+c.realNotesRef); err != nil {
+	if _, err := fetch(nil, repoDir, c.Dir, c.realNotesRef+":"+c.realNotesRef); err != nil {
 		return nil, err
 	}
 
@@ -132,10 +134,67 @@ func (c *Checkout) ManifestDir() string {
 func (c *Checkout) CommitAndPush(commitMessage string, note *Note) error {
 	c.Lock()
 	defer c.Unlock()
+	if err := c.commit(commitMessage, note); err != nil {
+		return err
+	}
+	branch := branchRef(c.repo.Branch).String()
+	return c.push(branch + ":" + branch)
+}
+
+// CommitAndPushBranch commits changes made in this checkout, as
+// CommitAndPush does, but pushes the commit to a new branch rather
+// than to the branch checked out, so that it can be merged later
+// (e.g., by a pull request). The branch is named with the prefix
+// given and the content of the commit, so that the same changes,
+// made again, go to the same branch. If that branch exists already,
+// it's left as it is, and the checkout is moved to the commit at its
+// head instead. It returns the name of the branch, and whether it was
+// created.
+func (c *Checkout) CommitAndPushBranch(commitMessage string, note *Note, prefix string) (string, bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.commit(commitMessage, note); err != nil {
+		return "", false, err
+	}
+	tree, err := treeRevision(c.Dir, "HEAD")
+	if err != nil {
+		return "", false, err
+	}
+	branch := prefix + tree[:12]
+	exists, err := remoteBranchExists(c.repo.Auth, c.Dir, c.repo.URL, branch)
+	if err != nil {
+		return "", false, err
+	}
+	ref := branchRef(branch).String()
+	if exists {
+		if _, err := fetch(c.repo.Auth, c.Dir, c.repo.URL, "+"+ref+":"+ref); err != nil {
+			return "", false, err
+		}
+		if err := reset(c.Dir, ref); err != nil {
+			return "", false, err
+		}
+		return branch, false, nil
+	}
+	if err := setBranch(c.Dir, branch, "HEAD"); err != nil {
+		return "", false, err
+	}
+	return branch, true, c.push(ref + ":" + ref)
+}
+
+// commit commits the changes in the checkout, with the note given
+// (if any) attached.
+func (c *Checkout) commit(commitMessage string, note *Note) error {
 	if !check(c.Dir, c.repo.Path) {
 		return ErrNoChanges
 	}
-	if err := commit(c.Dir, commitMessage); err != nil {
+	var signingKey *openpgp.Entity
+	if c.SigningKey != "" {
+		var err error
+		if signingKey, err = SigningKey(c.SigningKeyring, c.SigningKey); err != nil {
+			return err
+		}
+	}
+	if err := commit(c.Dir, commitMessage, c.signature(), signingKey); err != nil {
 		return err
 	}
 
@@ -144,25 +203,41 @@ func (c *Checkout) CommitAndPush(commitMessage string, note *Note) error {
 		if err != nil {
 			return err
 		}
-		if err := addNote(c.Dir, rev, c.realNotesRef, note); err != nil {
+		if err := addNote(c.Dir, rev, c.realNotesRef, c.signature(), note); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	refs := []string{c.repo.Branch}
-	ok, err := refExists(c.Dir, c.realNotesRef)
-	if ok {
-		refs = append(refs, c.realNotesRef)
-	} else if err != nil {
+// signature gives the author (and committer) of commits, notes and
+// tags made now.
+func (c *Checkout) signature() *object.Signature {
+	return &object.Signature{Name: c.UserName, Email: c.UserEmail, When: time.Now()}
+}
+
+// push pushes the refspec given, and the notes, to the remote repo.
+func (c *Checkout) push(refspec string) error {
+	refs := []string{refspec}
+	_, err := refRevision(c.Dir, c.realNotesRef)
+	if err == nil {
+		refs = append(refs, c.realNotesRef+":"+c.realNotesRef)
+	} else if errors.Cause(err) != ErrUnknownRevision {
 		return err
 	}
 
-	if err := push(c.repo.KeyRing, c.Dir, c.repo.URL, refs); err != nil {
+	if err := push(c.repo.Auth, c.Dir, c.repo.URL, refs); err != nil {
 		return PushError(c.repo.URL, err)
 	}
 	return nil
 }
 
+// Remote returns the configuration of the remote repo this is a
+// checkout of.
+func (c *Checkout) Remote() flux.GitRemoteConfig {
+	return c.repo.GitRemoteConfig
+}
+
 // GetNote gets a note for the revision specified, or "" if there is no such note.
 func (c *Checkout) GetNote(rev string) (*Note, error) {
 	c.RLock()
@@ -170,27 +245,53 @@ func (c *Checkout) GetNote(rev string) (*Note, error) {
 	return getNote(c.Dir, c.realNotesRef, rev)
 }
 
-// Pull fetches the latest commits on the branch we're using, and the latest notes
-func (c *Checkout) Pull() error {
+// proposalsRef is the ref the proposed releases are kept in, next to
+// the notes.
+func (c *Checkout) proposalsRef() string {
+	return c.realNotesRef + "-proposals"
+}
+
+// Proposals fetches the releases proposed and waiting for approval
+// from the remote repo.
+func (c *Checkout) Proposals() ([]Proposal, error) {
+	c.Lock()
+	defer c.Unlock()
+	ref := c.proposalsRef()
+	if _, err := fetch(c.repo.Auth, c.Dir, c.repo.URL, "+"+ref+":"+ref); err != nil {
+		return nil, err
+	}
+	return readProposals(c.Dir, ref)
+}
+
+// SaveProposals records the releases given as those proposed and
+// waiting for approval (replacing any recorded before), and pushes
+// them to the remote repo.
+func (c *Checkout) SaveProposals(proposals []Proposal) error {
 	c.Lock()
 	defer c.Unlock()
-	if err := pull(c.repo.KeyRing, c.Dir, c.repo.URL, c.repo.Branch); err != nil {
+	ref := c.proposalsRef()
+	if err := writeProposals(c.Dir, ref, c.signature(), proposals); err != nil {
 		return err
 	}
-	for _, ref := range []string{
-		c.realNotesRef + ":" + c.realNotesRef,
-		c.SyncTag,
-	} {
-		// this fetches and updates the local ref, so we'll see the new
-		// notes; but it's possible that the upstream doesn't have this
-		// ref.
-		if err := fetch(c.repo.KeyRing, c.Dir, c.repo.URL, ref); err != nil {
-			return err
-		}
+	if err := push(c.repo.Auth, c.Dir, c.repo.URL, []string{"+" + ref + ":" + ref}); err != nil {
+		return PushError(c.repo.URL, err)
 	}
 	return nil
 }
 
+// Pull fetches the latest commits on the branch we're using, and the latest notes
+func (c *Checkout) Pull() error {
+	c.Lock()
+	defer c.Unlock()
+	// this also fetches and updates the notes and the sync tag, so
+	// we'll see the new notes; but it's possible that the upstream
+	// doesn't have these refs.
+	tag := "refs/tags/" + c.SyncTag
+	return pull(c.repo.Auth, c.Dir, c.repo.URL, c.repo.Branch,
+		c.realNotesRef+":"+c.realNotesRef,
+		"+"+tag+":"+tag)
+}
+
 func (c *Checkout) HeadRevision() (string, error) {
 	c.RLock()
 	defer c.RUnlock()
@@ -206,22 +307,23 @@ func (c *Checkout) TagRevision(tag string) (string, error) {
 func (c *Checkout) CommitsBetween(ref1, ref2 string) ([]Commit, error) {
 	c.RLock()
 	defer c.RUnlock()
-	return onelinelog(c.Dir, ref1+".."+ref2)
+	return onelinelog(c.Dir, ref1, ref2)
 }
 
 func (c *Checkout) CommitsBefore(ref string) ([]Commit, error) {
 	c.RLock()
 	defer c.RUnlock()
-	return onelinelog(c.Dir, ref)
+	return onelinelog(c.Dir, "", ref)
 }
 
 func (c *Checkout) MoveTagAndPush(ref, msg string) error {
 	c.Lock()
 	defer c.Unlock()
-	return moveTagAndPush(c.Dir, c.repo.KeyRing, c.SyncTag, ref, msg, c.repo.URL)
+	return moveTagAndPush(c.Dir, c.repo.Auth, c.SyncTag, ref, msg, c.signature(), c.repo.URL)
 }
 
-// ChangedFiles does a git diff listing changed files
+// ChangedFiles lists the files changed between the ref given and
+// HEAD, as `git diff` would
 func (c *Checkout) ChangedFiles(ref string) ([]string, error) {
 	c.Lock()
 	defer c.Unlock()
@@ -0,0 +1,261 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// A keyring here is a file of GPG keys, or a directory of such files.
+// Commits are signed using a keyring with a private key in it, and
+// verified against a keyring with only the trusted public keys in it.
+// Keyrings are read each time they're used, so that e.g., a
+// Kubernetes secret can be updated without restarting.
+
+// ReadKeyRing reads the GPG keys in the file given, or in each file
+// in the directory given. Files with names starting with "." are
+// skipped, so that a Kubernetes secret mounted as a volume can be
+// given as the directory. Keys can be ASCII-armored or not.
+func ReadKeyRing(path string) (openpgp.EntityList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = nil
+		for _, info := range infos {
+			if strings.HasPrefix(info.Name(), ".") || info.IsDir() {
+				continue
+			}
+			files = append(files, filepath.Join(path, info.Name()))
+		}
+	}
+	var keys openpgp.EntityList
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var fileKeys openpgp.EntityList
+		if _, err := armor.Decode(bytes.NewReader(b)); err == nil {
+			fileKeys, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+		} else {
+			fileKeys, err = openpgp.ReadKeyRing(bytes.NewReader(b))
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading GPG keys from %s", file)
+		}
+		keys = append(keys, fileKeys...)
+	}
+	if len(keys) == 0 {
+		return nil, errors.Errorf("no GPG keys found in %s", path)
+	}
+	return keys, nil
+}
+
+// SigningKey finds the private key to sign commits with in the
+// keyring. The key can be given by its ID (or fingerprint) in hex, or
+// by (part of) the name or email address it's for.
+func SigningKey(keyring, id string) (*openpgp.Entity, error) {
+	keys, err := ReadKeyRing(keyring)
+	if err != nil {
+		return nil, err
+	}
+	hexID := strings.ToUpper(strings.TrimPrefix(strings.Replace(id, " ", "", -1), "0x"))
+	for _, key := range keys {
+		if key.PrivateKey == nil {
+			continue
+		}
+		fingerprint := fmt.Sprintf("%X", key.PrimaryKey.Fingerprint)
+		if len(hexID) >= 8 && strings.HasSuffix(fingerprint, hexID) {
+			return signable(key, id)
+		}
+		for name := range key.Identities {
+			if strings.Contains(name, id) {
+				return signable(key, id)
+			}
+		}
+	}
+	return nil, errors.Errorf("no private key for %q in %s", id, keyring)
+}
+
+func signable(key *openpgp.Entity, id string) (*openpgp.Entity, error) {
+	if key.PrivateKey.Encrypted {
+		return nil, errors.Errorf("the private key for %q has a passphrase; keys used for signing must not", id)
+	}
+	return key, nil
+}
+
+// UnverifiedCommit is a commit that isn't signed by a trusted key,
+// along with the reason it isn't.
+type UnverifiedCommit struct {
+	Commit
+	Reason string
+}
+
+// signatureProblem checks the signature on a commit against the
+// keyring, and explains what's wrong with it, if anything.
+func signatureProblem(keys openpgp.EntityList, c *object.Commit) string {
+	if c.PGPSignature == "" {
+		return "not signed"
+	}
+	encoded := &plumbing.MemoryObject{}
+	if err := c.EncodeWithoutSignature(encoded); err != nil {
+		return "signature could not be checked"
+	}
+	signed, err := encoded.Reader()
+	if err != nil {
+		return "signature could not be checked"
+	}
+	signer, err := openpgp.CheckArmoredDetachedSignature(keys, signed, strings.NewReader(c.PGPSignature))
+	switch {
+	case err == pgperrors.ErrUnknownIssuer:
+		// This includes keys that have been revoked, since they're
+		// never used to check signatures
+		return "not signed by a trusted key"
+	case err != nil:
+		return "bad signature"
+	}
+	for _, identity := range signer.Identities {
+		if identity.SelfSignature != nil && identity.SelfSignature.KeyExpired(time.Now()) {
+			return "signed by a key that has expired"
+		}
+	}
+	return ""
+}
+
+// unverified returns those of the commits given that aren't signed by
+// a key in the keyring.
+func unverified(keys openpgp.EntityList, commits []*object.Commit) []UnverifiedCommit {
+	var res []UnverifiedCommit
+	for _, c := range commits {
+		if reason := signatureProblem(keys, c); reason != "" {
+			res = append(res, UnverifiedCommit{
+				Commit: Commit{Revision: c.Hash.String(), Message: subject(c.Message)},
+				Reason: reason,
+			})
+		}
+	}
+	return res
+}
+
+// firstParents returns the commits from `to` back along the
+// first-parent line (i.e., the branch itself rather than anything
+// merged into it), stopping at any commit in the set to exclude,
+// oldest first.
+func firstParents(to *object.Commit, exclude map[plumbing.Hash]bool) ([]*object.Commit, error) {
+	var line []*object.Commit
+	for c := to; c != nil && !exclude[c.Hash]; {
+		line = append([]*object.Commit{c}, line...)
+		if c.NumParents() == 0 {
+			break
+		}
+		var err error
+		if c, err = c.Parent(0); err != nil {
+			return nil, err
+		}
+	}
+	return line, nil
+}
+
+// reachable reports whether any of the commits named is in the
+// history of the commit given, not looking past the commits to
+// exclude.
+func reachable(c *object.Commit, exclude map[plumbing.Hash]bool, revisions []UnverifiedCommit) (bool, error) {
+	names := map[string]bool{}
+	for _, u := range revisions {
+		names[u.Revision] = true
+	}
+	found := false
+	err := object.NewCommitPreorderIter(c, exclude, nil).ForEach(func(c *object.Commit) error {
+		found = found || names[c.Hash.String()]
+		return nil
+	})
+	return found, err
+}
+
+// VerifySignatures checks that the commits after `from`, up to and
+// including `to`, are signed by keys in the keyring given. It returns
+// the newest commit that can be trusted -- following the branch from
+// `from` to `to`, the last commit before one that has an unverified
+// commit in its history, which may be `from` itself -- and the
+// unverified commits, newest first.
+//
+// If `from` is empty, only `to` is checked, and if it isn't signed by
+// a trusted key, the revision returned is empty.
+func (c *Checkout) VerifySignatures(keyring, from, to string) (string, []UnverifiedCommit, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	keys, err := ReadKeyRing(keyring)
+	if err != nil {
+		return "", nil, err
+	}
+	r, err := open(c.Dir)
+	if err != nil {
+		return "", nil, err
+	}
+	toCommit, err := resolve(r, to)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if from == "" {
+		if bad := unverified(keys, []*object.Commit{toCommit}); len(bad) > 0 {
+			return "", bad, nil
+		}
+		return toCommit.Hash.String(), nil, nil
+	}
+
+	commits, exclude, err := commitRange(r, from, to)
+	if err != nil {
+		return "", nil, err
+	}
+	bad := unverified(keys, commits)
+	if len(bad) == 0 {
+		return toCommit.Hash.String(), nil, nil
+	}
+	verified, err := refRevision(c.Dir, from)
+	if err != nil {
+		return "", nil, err
+	}
+	line, err := firstParents(toCommit, exclude)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, commit := range line {
+		tainted, err := reachable(commit, exclude, bad)
+		if err != nil {
+			return "", nil, err
+		}
+		if tainted {
+			break
+		}
+		verified = commit.Hash.String()
+	}
+	return verified, bad, nil
+}
+
+// ResetTo moves the checkout (and its branch) to the revision given,
+// e.g., so that it can be synced as it was at that revision.
+func (c *Checkout) ResetTo(rev string) error {
+	c.Lock()
+	defer c.Unlock()
+	return reset(c.Dir, rev)
+}
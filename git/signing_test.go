@@ -0,0 +1,145 @@
+package git
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	gogit "gopkg.in/src-d/go-git.v4"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+)
+
+const testSigningKey = "flux@example.com"
+
+// writeKey generates a key for the email given, and writes it to the
+// files given: the private key (if the file is named), and the public
+// key.
+func writeKey(t *testing.T, email, privateFile, publicFile string) {
+	entity, err := openpgp.NewEntity("Flux", "", email, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(file, blockType string, serialize func(w io.Writer) error) {
+		f, err := os.Create(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		w, err := armor.Encode(f, blockType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := serialize(w); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if privateFile != "" {
+		write(privateFile, openpgp.PrivateKeyType, func(w io.Writer) error {
+			return entity.SerializePrivate(w, nil)
+		})
+	}
+	write(publicFile, openpgp.PublicKeyType, func(w io.Writer) error {
+		return entity.Serialize(w)
+	})
+}
+
+func TestVerifySignatures(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	signing, trusted, untrusted := filepath.Join(dir, "signing.asc"), filepath.Join(dir, "trusted.asc"), filepath.Join(dir, "untrusted.asc")
+	writeKey(t, testSigningKey, signing, trusted)
+	writeKey(t, "someone@example.com", "", untrusted)
+
+	repoDir := filepath.Join(dir, "repo")
+	r, err := gogit.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var revs []string
+	for i, key := range []string{testSigningKey, "", testSigningKey} {
+		if err := ioutil.WriteFile(filepath.Join(repoDir, "file"), []byte{byte('a' + i)}, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Add("file"); err != nil {
+			t.Fatal(err)
+		}
+		var signingKey *openpgp.Entity
+		if key != "" {
+			if signingKey, err = SigningKey(signing, key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := commit(repoDir, "change", testSignature(), signingKey); err != nil {
+			t.Fatal(err)
+		}
+		rev, err := refRevision(repoDir, "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs = append(revs, rev)
+	}
+	checkout := &Checkout{Dir: repoDir}
+
+	// Just the head, which is signed
+	verified, unverified, err := checkout.VerifySignatures(trusted, "", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified != revs[2] || len(unverified) != 0 {
+		t.Errorf("expected HEAD to be verified, got %q and unverified %+v", verified, unverified)
+	}
+
+	// The unsigned commit stops us going any further than the one
+	// before it
+	verified, unverified, err = checkout.VerifySignatures(trusted, revs[0], "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []UnverifiedCommit{{Commit: Commit{Revision: revs[1], Message: "change"}, Reason: "not signed"}}
+	if verified != revs[0] || !reflect.DeepEqual(unverified, expected) {
+		t.Errorf("expected to verify up to %s, with unverified %+v; got %s and %+v", revs[0], expected, verified, unverified)
+	}
+
+	// Signed, but not by a trusted key
+	verified, unverified, err = checkout.VerifySignatures(untrusted, "", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified != "" || len(unverified) != 1 || unverified[0].Reason != "not signed by a trusted key" {
+		t.Errorf("expected HEAD to be untrusted, got %q and unverified %+v", verified, unverified)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	keys := filepath.Join(dir, "keys")
+	if err := os.Mkdir(keys, 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, testSigningKey, filepath.Join(keys, "private.asc"), filepath.Join(keys, ".public.asc"))
+
+	key, err := SigningKey(keys, testSigningKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byID, err := SigningKey(keys, key.PrimaryKey.KeyIdString()); err != nil || byID.PrimaryKey.Fingerprint != key.PrimaryKey.Fingerprint {
+		t.Errorf("expected to find the key by its ID, got %v (%v)", byID, err)
+	}
+	if _, err := SigningKey(keys, "someone@example.com"); err == nil {
+		t.Error("expected no key for someone else")
+	}
+}
@@ -19,11 +19,14 @@ const (
 	EventSync         = "sync"
 	EventRelease      = "release"
 	EventAutoRelease  = "autorelease"
+	EventAutoDeferred = "autorelease_deferred"
+	EventRollback     = "rollback"
 	EventAutomate     = "automate"
 	EventDeautomate   = "deautomate"
 	EventLock         = "lock"
 	EventUnlock       = "unlock"
 	EventUpdatePolicy = "update_policy"
+	EventUnverified   = "unverified_commit"
 
 	// This is used to label e.g., commits that we _don't_ consider an event in themselves.
 	NoneOfTheAbove = "other"
@@ -124,6 +127,42 @@ func (e Event) String() string {
 			"Automated release of %s",
 			strings.Join(strImageIDs, ", "),
 		)
+	case EventRollback:
+		metadata := e.Metadata.(*RollbackEventMetadata)
+		var changes []string
+		for _, id := range strServiceIDs {
+			for _, c := range metadata.Result[flux.ServiceID(id)].PerContainer {
+				changes = append(changes, fmt.Sprintf("%s (%s) from %s to %s", id, c.Container, c.Current, c.Target.Tag))
+			}
+		}
+		if len(changes) == 0 {
+			changes = []string{"no changes"}
+		}
+		var reason string
+		if metadata.Spec.Reason != "" {
+			reason = ": " + metadata.Spec.Reason
+		}
+		if metadata.Error != "" {
+			reason += " (" + metadata.Error + ")"
+		}
+		return fmt.Sprintf("Rolled back %s%s", strings.Join(changes, ", "), reason)
+	case EventAutoDeferred:
+		metadata := e.Metadata.(*AutoReleaseDeferredEventMetadata)
+		var strImageIDs []string
+		for _, image := range metadata.Images {
+			strImageIDs = append(strImageIDs, image.String())
+		}
+		var until string
+		if !metadata.Until.IsZero() {
+			until = fmt.Sprintf(" until %s", metadata.Until.Format(time.RFC822))
+		}
+		return fmt.Sprintf(
+			"Deferred automated release of %s to %s%s: %s",
+			strings.Join(strImageIDs, ", "),
+			strings.Join(strServiceIDs, ", "),
+			until,
+			metadata.Reason,
+		)
 	case EventCommit:
 		metadata := e.Metadata.(*CommitEventMetadata)
 		svcStr := "<no changes>"
@@ -147,6 +186,20 @@ func (e Event) String() string {
 		if len(strServiceIDs) > 0 {
 			svcStr = strings.Join(strServiceIDs, ", ")
 		}
+		if metadata.Error != "" {
+			return fmt.Sprintf("Sync failed: %s, %s", revStr, metadata.Error)
+		}
+		if len(metadata.Errors) > 0 {
+			var failed []string
+			for id := range metadata.Errors {
+				failed = append(failed, id)
+			}
+			sort.Strings(failed)
+			return fmt.Sprintf("Sync failed: %s, could not apply %s", revStr, strings.Join(failed, ", "))
+		}
+		if len(metadata.Deleted) > 0 {
+			return fmt.Sprintf("Sync: %s, %s; deleted %s", revStr, svcStr, strings.Join(metadata.Deleted, ", "))
+		}
 		return fmt.Sprintf("Sync: %s, %s", revStr, svcStr)
 	case EventAutomate:
 		return fmt.Sprintf("Automated: %s", strings.Join(strServiceIDs, ", "))
@@ -158,6 +211,9 @@ func (e Event) String() string {
 		return fmt.Sprintf("Unlocked: %s", strings.Join(strServiceIDs, ", "))
 	case EventUpdatePolicy:
 		return fmt.Sprintf("Updated policies: %s", strings.Join(strServiceIDs, ", "))
+	case EventUnverified:
+		metadata := e.Metadata.(*UnverifiedCommitEventMetadata)
+		return fmt.Sprintf("Refused to sync commit %s: %s", shortRevision(metadata.Commit.Revision), metadata.Reason)
 	default:
 		return fmt.Sprintf("Unknown event: %s", e.Type)
 	}
@@ -175,6 +231,10 @@ type CommitEventMetadata struct {
 	Revision string        `json:"revision,omitempty"`
 	Spec     *update.Spec  `json:"spec"`
 	Result   update.Result `json:"result,omitempty"`
+	// PullRequests are the URLs of the pull requests opened for the
+	// commit, if it was pushed to a branch of its own to be merged
+	// later, rather than to the branch being synced
+	PullRequests []string `json:"pullRequests,omitempty"`
 }
 
 func (c CommitEventMetadata) ShortRevision() string {
@@ -201,6 +261,14 @@ type SyncEventMetadata struct {
 	Includes map[string]bool `json:"includes,omitempty"`
 	// `true` if we have no record of having synced before
 	InitialSync bool `json:"initialSync,omitempty"`
+	// The resources that were garbage collected, because they were
+	// removed from the repo
+	Deleted []string `json:"deleted,omitempty"`
+	// If the sync failed, either the error for each resource that
+	// could not be applied, or the error that stopped the sync as a
+	// whole
+	Errors map[string]string `json:"errors,omitempty"`
+	Error  string            `json:"error,omitempty"`
 }
 
 // Account for old events, which used the revisions field rather than commits
@@ -240,6 +308,27 @@ type AutoReleaseEventMetadata struct {
 	Spec update.Automated `json:"spec"`
 }
 
+// RollbackEventMetadata is for when service(s) are returned to the
+// images they ran before a release
+type RollbackEventMetadata struct {
+	ReleaseEventCommon
+	Spec  update.RollbackSpec `json:"spec"`
+	Cause update.Cause        `json:"cause"`
+}
+
+// AutoReleaseDeferredEventMetadata is for when an automated release
+// of a service is held back, e.g., by its automation window
+type AutoReleaseDeferredEventMetadata struct {
+	flux.DeferredRelease
+}
+
+// UnverifiedCommitEventMetadata is for when a commit isn't synced,
+// because it isn't signed by a trusted key
+type UnverifiedCommitEventMetadata struct {
+	Commit Commit `json:"commit"`
+	Reason string `json:"reason"`
+}
+
 type UnknownEventMetadata map[string]interface{}
 
 func (e *Event) UnmarshalJSON(in []byte) error {
@@ -275,6 +364,20 @@ func (e *Event) UnmarshalJSON(in []byte) error {
 		}
 		e.Metadata = &metadata
 		break
+	case EventRollback:
+		var metadata RollbackEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
+	case EventAutoDeferred:
+		var metadata AutoReleaseDeferredEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
 	case EventCommit:
 		var metadata CommitEventMetadata
 		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
@@ -289,6 +392,13 @@ func (e *Event) UnmarshalJSON(in []byte) error {
 		}
 		e.Metadata = &metadata
 		break
+	case EventUnverified:
+		var metadata UnverifiedCommitEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
 	default:
 		if len(wireEvent.MetadataBytes) > 0 {
 			var metadata UnknownEventMetadata
@@ -328,6 +438,18 @@ func (rem *AutoReleaseEventMetadata) Type() string {
 	return EventAutoRelease
 }
 
+func (rem *RollbackEventMetadata) Type() string {
+	return EventRollback
+}
+
+func (rem *AutoReleaseDeferredEventMetadata) Type() string {
+	return EventAutoDeferred
+}
+
+func (uem *UnverifiedCommitEventMetadata) Type() string {
+	return EventUnverified
+}
+
 // Special exception from pointer receiver rule, as UnknownEventMetadata is a
 // type alias for a map
 func (uem UnknownEventMetadata) Type() string {
@@ -3,7 +3,9 @@ package history
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -60,3 +62,96 @@ func TestEvent_ParseNoMetadata(t *testing.T) {
 		t.Fatal("Hasn't been unmarshalled properly")
 	}
 }
+
+func TestEvent_ParseAutoReleaseDeferred(t *testing.T) {
+	image, _ := flux.ParseImageID("quay.io/weaveworks/helloworld:master-a000002")
+	origEvent := Event{
+		ServiceIDs: []flux.ServiceID{"default/helloworld"},
+		Type:       EventAutoDeferred,
+		Metadata: &AutoReleaseDeferredEventMetadata{flux.DeferredRelease{
+			Images: []flux.ImageID{image},
+			Reason: "outside automation window",
+			Until:  time.Date(2017, 10, 7, 9, 0, 0, 0, time.UTC),
+		}},
+	}
+
+	bytes, _ := json.Marshal(origEvent)
+
+	e := Event{}
+	if err := e.UnmarshalJSON(bytes); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.Metadata.(*AutoReleaseDeferredEventMetadata); !ok {
+		t.Fatal("Wrong event type unmarshalled")
+	}
+	expected := "Deferred automated release of quay.io/weaveworks/helloworld:master-a000002 to default/helloworld until 07 Oct 17 09:00 UTC: outside automation window"
+	if e.String() != expected {
+		t.Errorf("expected %q, got %q", expected, e.String())
+	}
+}
+
+func TestEvent_ParseRollback(t *testing.T) {
+	bad, _ := flux.ParseImageID("quay.io/weaveworks/helloworld:master-a000002")
+	good, _ := flux.ParseImageID("quay.io/weaveworks/helloworld:master-a000001")
+	origEvent := Event{
+		ServiceIDs: []flux.ServiceID{"default/helloworld"},
+		Type:       EventRollback,
+		Metadata: &RollbackEventMetadata{
+			ReleaseEventCommon: ReleaseEventCommon{
+				Revision: "deadbeef",
+				Result: update.Result{
+					"default/helloworld": {
+						Status: update.ReleaseStatusSuccess,
+						PerContainer: []update.ContainerUpdate{
+							{Container: "helloworld", Current: bad, Target: good},
+						},
+					},
+				},
+			},
+			Spec: update.RollbackSpec{Reason: "not ready", Lock: true},
+		},
+	}
+
+	bytes, _ := json.Marshal(origEvent)
+
+	e := Event{}
+	if err := e.UnmarshalJSON(bytes); err != nil {
+		t.Fatal(err)
+	}
+	metadata, ok := e.Metadata.(*RollbackEventMetadata)
+	if !ok {
+		t.Fatal("Wrong event type unmarshalled")
+	}
+	if !metadata.Spec.Lock {
+		t.Error("expected rollback spec to say to lock")
+	}
+	expected := "Rolled back default/helloworld (helloworld) from quay.io/weaveworks/helloworld:master-a000002 to master-a000001: not ready"
+	if e.String() != expected {
+		t.Errorf("expected %q, got %q", expected, e.String())
+	}
+}
+
+func TestEvent_ParseUnverifiedCommit(t *testing.T) {
+	origEvent := Event{
+		Type:     EventUnverified,
+		LogLevel: LogLevelError,
+		Metadata: &UnverifiedCommitEventMetadata{
+			Commit: Commit{Revision: "a000002b1c2d3e4f", Message: "Sneaky change"},
+			Reason: "no signature",
+		},
+	}
+
+	bytes, _ := json.Marshal(origEvent)
+
+	e := Event{}
+	if err := e.UnmarshalJSON(bytes); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.Metadata.(*UnverifiedCommitEventMetadata); !ok {
+		t.Fatal("Wrong event type unmarshalled")
+	}
+	expected := "Refused to sync commit a000002: no signature"
+	if e.String() != expected {
+		t.Errorf("expected %q, got %q", expected, e.String())
+	}
+}
@@ -78,6 +78,24 @@ func (db *qlDB) scanEvents(query squirrel.Sqlizer) ([]history.Event, error) {
 					return nil, err
 				}
 				h.Metadata = &m
+			case history.EventRollback:
+				var m history.RollbackEventMetadata
+				if err := json.Unmarshal(metadataBytes, &m); err != nil {
+					return nil, err
+				}
+				h.Metadata = &m
+			case history.EventAutoDeferred:
+				var m history.AutoReleaseDeferredEventMetadata
+				if err := json.Unmarshal(metadataBytes, &m); err != nil {
+					return nil, err
+				}
+				h.Metadata = &m
+			case history.EventUnverified:
+				var m history.UnverifiedCommitEventMetadata
+				if err := json.Unmarshal(metadataBytes, &m); err != nil {
+					return nil, err
+				}
+				h.Metadata = &m
 			}
 		}
 		events = append(events, h)
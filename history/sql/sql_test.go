@@ -4,13 +4,16 @@ import (
 	"flag"
 	"io/ioutil"
 	"net/url"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/db"
 	"github.com/weaveworks/flux/history"
 	"github.com/weaveworks/flux/service"
+	"github.com/weaveworks/flux/update"
 )
 
 var (
@@ -92,6 +95,70 @@ func TestHistoryLog(t *testing.T) {
 	checkInDescOrder(t, es)
 }
 
+// Each kind of event comes back with its metadata decoded, so that
+// it can be shown.
+func TestEventMetadata(t *testing.T) {
+	instance := service.InstanceID("instance")
+	db := newSQL(t)
+	defer db.Close()
+
+	image, _ := flux.ParseImageID("quay.io/weaveworks/helloworld:master-a000002")
+	previous, _ := flux.ParseImageID("quay.io/weaveworks/helloworld:master-a000001")
+	for _, event := range []history.Event{
+		{
+			Type: history.EventRollback,
+			Metadata: &history.RollbackEventMetadata{
+				ReleaseEventCommon: history.ReleaseEventCommon{
+					Revision: "abc123",
+					Result: update.Result{
+						flux.ServiceID("namespace/service"): update.ServiceResult{
+							Status: update.ReleaseStatusSuccess,
+							PerContainer: []update.ContainerUpdate{
+								{Container: "helloworld", Current: image, Target: previous},
+							},
+						},
+					},
+				},
+				Spec: update.RollbackSpec{
+					Changes: []update.Change{
+						{ServiceID: flux.ServiceID("namespace/service"), Container: cluster.Container{Name: "helloworld", Image: image.String()}, ImageID: previous},
+					},
+					Reason: "release did not become ready",
+					Lock:   true,
+				},
+				Cause: update.Cause{User: "flux"},
+			},
+		},
+		{
+			Type: history.EventAutoDeferred,
+			Metadata: &history.AutoReleaseDeferredEventMetadata{
+				DeferredRelease: flux.DeferredRelease{
+					Images: []flux.ImageID{image},
+					Reason: "outside automation window",
+					Until:  time.Now().UTC().Add(time.Hour).Truncate(time.Second),
+				},
+			},
+		},
+	} {
+		event.ServiceIDs = []flux.ServiceID{flux.ServiceID("namespace/service")}
+		bailIfErr(t, db.LogEvent(instance, event))
+
+		es, err := db.AllEvents(instance, time.Now().UTC(), 1, time.Unix(0, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(es) != 1 {
+			t.Fatalf("expected the %s event, got %#v", event.Type, es)
+		}
+		if es[0].Type != event.Type || !reflect.DeepEqual(es[0].Metadata, event.Metadata) {
+			t.Errorf("expected %s event with metadata %#v, got %s with %#v", event.Type, event.Metadata, es[0].Type, es[0].Metadata)
+		}
+		if es[0].String() != event.String() {
+			t.Errorf("expected %q, got %q", event.String(), es[0].String())
+		}
+	}
+}
+
 func checkInDescOrder(t *testing.T, events []history.Event) {
 	var last time.Time = time.Now()
 	for _, event := range events {
@@ -19,6 +19,7 @@ import (
 	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/service"
 	"github.com/weaveworks/flux/ssh"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -62,6 +63,18 @@ func (c *Client) UpdateImages(_ service.InstanceID, s update.ReleaseSpec, cause
 	for _, ex := range s.Excludes {
 		args = append(args, "exclude", string(ex))
 	}
+	for _, ns := range s.Namespaces {
+		args = append(args, "namespace", ns)
+	}
+	if s.Selector != "" {
+		args = append(args, "selector", s.Selector)
+	}
+	for _, ns := range s.ExcludeNamespaces {
+		args = append(args, "exclude-namespace", ns)
+	}
+	if s.ExcludeSelector != "" {
+		args = append(args, "exclude-selector", s.ExcludeSelector)
+	}
 	if cause.Message != "" {
 		args = append(args, "message", cause.Message)
 	}
@@ -90,6 +103,18 @@ func (c *Client) SyncStatus(_ service.InstanceID, ref string) ([]string, error)
 	return res, err
 }
 
+func (c *Client) SyncPlan(_ service.InstanceID) (fluxsync.Plan, error) {
+	var res fluxsync.Plan
+	err := c.get(&res, "SyncPlan")
+	return res, err
+}
+
+func (c *Client) ListSyncStatus(_ service.InstanceID) ([]flux.ResourceSyncStatus, error) {
+	var res []flux.ResourceSyncStatus
+	err := c.get(&res, "ListSyncStatus")
+	return res, err
+}
+
 func (c *Client) UpdatePolicies(_ service.InstanceID, updates policy.Updates, cause update.Cause) (job.ID, error) {
 	args := []string{"user", cause.User}
 	if cause.Message != "" {
@@ -99,6 +124,24 @@ func (c *Client) UpdatePolicies(_ service.InstanceID, updates policy.Updates, ca
 	return res, c.methodWithResp("PATCH", &res, "UpdatePolicies", updates, args...)
 }
 
+func (c *Client) Rollback(_ service.InstanceID, spec update.RollbackSpec, cause update.Cause) (job.ID, error) {
+	args := []string{"user", cause.User}
+	if cause.Message != "" {
+		args = append(args, "message", cause.Message)
+	}
+	var res job.ID
+	return res, c.methodWithResp("POST", &res, "Rollback", spec, args...)
+}
+
+func (c *Client) ApproveRelease(_ service.InstanceID, id job.ID, cause update.Cause) (job.ID, error) {
+	args := []string{"id", string(id), "user", cause.User}
+	if cause.Message != "" {
+		args = append(args, "message", cause.Message)
+	}
+	var res job.ID
+	return res, c.methodWithResp("POST", &res, "ApproveRelease", nil, args...)
+}
+
 func (c *Client) LogEvent(_ service.InstanceID, event history.Event) error {
 	return c.postWithBody("LogEvent", event)
 }
@@ -162,6 +205,19 @@ func (c *Client) PublicSSHKey(_ service.InstanceID, regenerate bool) (ssh.Public
 	return res, err
 }
 
+func (c *Client) GitRepoConfig(_ service.InstanceID, regenerate bool) (flux.GitConfig, error) {
+	if regenerate {
+		err := c.post("RegeneratePublicSSHKey")
+		if err != nil {
+			return flux.GitConfig{}, err
+		}
+	}
+
+	var res flux.GitConfig
+	err := c.get(&res, "GitRepoConfig")
+	return res, err
+}
+
 // post is a simple query-param only post request
 func (c *Client) post(route string, queryParams ...string) error {
 	return c.postWithBody(route, nil, queryParams...)
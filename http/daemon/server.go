@@ -47,12 +47,17 @@ func NewHandler(d remote.Platform, r *mux.Router) http.Handler {
 	r.Get("SyncNotify").HandlerFunc(handle.SyncNotify)
 	r.Get("JobStatus").HandlerFunc(handle.JobStatus)
 	r.Get("SyncStatus").HandlerFunc(handle.SyncStatus)
+	r.Get("SyncPlan").HandlerFunc(handle.SyncPlan)
+	r.Get("ListSyncStatus").HandlerFunc(handle.ListSyncStatus)
 	r.Get("UpdateImages").HandlerFunc(handle.UpdateImages)
 	r.Get("UpdatePolicies").HandlerFunc(handle.UpdatePolicies)
+	r.Get("Rollback").HandlerFunc(handle.Rollback)
+	r.Get("ApproveRelease").HandlerFunc(handle.ApproveRelease)
 	r.Get("ListServices").HandlerFunc(handle.ListServices)
 	r.Get("ListImages").HandlerFunc(handle.ListImages)
 	r.Get("Export").HandlerFunc(handle.Export)
 	r.Get("GetPublicSSHKey").HandlerFunc(handle.GetPublicSSHKey)
+	r.Get("GitRepoConfig").HandlerFunc(handle.GitRepoConfig)
 	r.Get("RegeneratePublicSSHKey").HandlerFunc(handle.RegeneratePublicSSHKey)
 
 	return middleware.Instrument{
@@ -94,6 +99,24 @@ func (s HTTPServer) SyncStatus(w http.ResponseWriter, r *http.Request) {
 	transport.JSONResponse(w, r, commits)
 }
 
+func (s HTTPServer) SyncPlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := s.daemon.SyncPlan()
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, plan)
+}
+
+func (s HTTPServer) ListSyncStatus(w http.ResponseWriter, r *http.Request) {
+	statuses, err := s.daemon.ListSyncStatus()
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, statuses)
+}
+
 func (s HTTPServer) ListImages(w http.ResponseWriter, r *http.Request) {
 	service := mux.Vars(r)["service"]
 	spec, err := update.ParseServiceSpec(service)
@@ -150,11 +173,23 @@ func (s HTTPServer) UpdateImages(w http.ResponseWriter, r *http.Request) {
 		excludes = append(excludes, s)
 	}
 
+	query := r.URL.Query()
+	for _, sel := range []string{query.Get("selector"), query.Get("exclude-selector")} {
+		if _, err := update.ParseLabelSelector(sel); err != nil {
+			transport.WriteError(w, r, http.StatusBadRequest, errors.Wrapf(err, "parsing label selector %q", sel))
+			return
+		}
+	}
+
 	spec := update.ReleaseSpec{
-		ServiceSpecs: serviceSpecs,
-		ImageSpec:    imageSpec,
-		Kind:         releaseKind,
-		Excludes:     excludes,
+		ServiceSpecs:      serviceSpecs,
+		ImageSpec:         imageSpec,
+		Kind:              releaseKind,
+		Excludes:          excludes,
+		Namespaces:        query["namespace"],
+		Selector:          query.Get("selector"),
+		ExcludeNamespaces: query["exclude-namespace"],
+		ExcludeSelector:   query.Get("exclude-selector"),
 	}
 	cause := update.Cause{
 		User:    r.FormValue("user"),
@@ -189,6 +224,43 @@ func (s HTTPServer) UpdatePolicies(w http.ResponseWriter, r *http.Request) {
 	transport.JSONResponse(w, r, jobID)
 }
 
+func (s HTTPServer) Rollback(w http.ResponseWriter, r *http.Request) {
+	var spec update.RollbackSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	cause := update.Cause{
+		User:    r.FormValue("user"),
+		Message: r.FormValue("message"),
+	}
+
+	jobID, err := s.daemon.UpdateManifests(update.Spec{Type: update.Rollback, Cause: cause, Spec: spec})
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+
+	transport.JSONResponse(w, r, jobID)
+}
+
+func (s HTTPServer) ApproveRelease(w http.ResponseWriter, r *http.Request) {
+	cause := update.Cause{
+		User:    r.FormValue("user"),
+		Message: r.FormValue("message"),
+	}
+	spec := update.ApprovalSpec{ReleaseID: mux.Vars(r)["id"]}
+
+	jobID, err := s.daemon.UpdateManifests(update.Spec{Type: update.Approval, Cause: cause, Spec: spec})
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+
+	transport.JSONResponse(w, r, jobID)
+}
+
 func (s HTTPServer) ListServices(w http.ResponseWriter, r *http.Request) {
 	namespace := mux.Vars(r)["namespace"]
 	res, err := s.daemon.ListServices(namespace)
@@ -210,6 +282,15 @@ func (s HTTPServer) Export(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s HTTPServer) GetPublicSSHKey(w http.ResponseWriter, r *http.Request) {
+	res, err := s.daemon.GitRepoConfig(false)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, res.PublicSSHKey)
+}
+
+func (s HTTPServer) GitRepoConfig(w http.ResponseWriter, r *http.Request) {
 	res, err := s.daemon.GitRepoConfig(false)
 	if err != nil {
 		transport.ErrorResponse(w, r, err)
@@ -83,6 +83,8 @@ func NewHandler(s api.FluxService, r *mux.Router, logger log.Logger) http.Handle
 		"UpdateImages":             handle.UpdateImages,
 		"UpdatePolicies":           handle.UpdatePolicies,
 		"UpdatePoliciesV4":         handle.UpdatePolicies,
+		"Rollback":                 handle.Rollback,
+		"ApproveRelease":           handle.ApproveRelease,
 		"LogEvent":                 handle.LogEvent,
 		"History":                  handle.History,
 		"HistoryV3":                handle.History,
@@ -103,7 +105,10 @@ func NewHandler(s api.FluxService, r *mux.Router, logger log.Logger) http.Handle
 		"SyncNotify":               handle.SyncNotify,
 		"JobStatus":                handle.JobStatus,
 		"SyncStatus":               handle.SyncStatus,
+		"SyncPlan":                 handle.SyncPlan,
+		"ListSyncStatus":           handle.ListSyncStatus,
 		"GetPublicSSHKey":          handle.GetPublicSSHKey,
+		"GitRepoConfig":            handle.GitRepoConfig,
 		"RegeneratePublicSSHKey":   handle.RegeneratePublicSSHKey,
 	} {
 		handler := logging(handlerMethod, log.NewContext(logger).With("method", method))
@@ -190,11 +195,23 @@ func (s HTTPService) UpdateImages(w http.ResponseWriter, r *http.Request) {
 		excludes = append(excludes, s)
 	}
 
+	query := r.URL.Query()
+	for _, sel := range []string{query.Get("selector"), query.Get("exclude-selector")} {
+		if _, err := update.ParseLabelSelector(sel); err != nil {
+			transport.WriteError(w, r, http.StatusBadRequest, errors.Wrapf(err, "parsing label selector %q", sel))
+			return
+		}
+	}
+
 	jobID, err := s.service.UpdateImages(inst, update.ReleaseSpec{
-		ServiceSpecs: serviceSpecs,
-		ImageSpec:    imageSpec,
-		Kind:         releaseKind,
-		Excludes:     excludes,
+		ServiceSpecs:      serviceSpecs,
+		ImageSpec:         imageSpec,
+		Kind:              releaseKind,
+		Excludes:          excludes,
+		Namespaces:        query["namespace"],
+		Selector:          query.Get("selector"),
+		ExcludeNamespaces: query["exclude-namespace"],
+		ExcludeSelector:   query.Get("exclude-selector"),
 	}, update.Cause{
 		User:    r.FormValue("user"),
 		Message: r.FormValue("message"),
@@ -239,6 +256,26 @@ func (s HTTPService) SyncStatus(w http.ResponseWriter, r *http.Request) {
 	transport.JSONResponse(w, r, res)
 }
 
+func (s HTTPService) SyncPlan(w http.ResponseWriter, r *http.Request) {
+	inst := getInstanceID(r)
+	res, err := s.service.SyncPlan(inst)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, res)
+}
+
+func (s HTTPService) ListSyncStatus(w http.ResponseWriter, r *http.Request) {
+	inst := getInstanceID(r)
+	res, err := s.service.ListSyncStatus(inst)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, res)
+}
+
 func (s HTTPService) UpdatePolicies(w http.ResponseWriter, r *http.Request) {
 	inst := getInstanceID(r)
 
@@ -260,6 +297,43 @@ func (s HTTPService) UpdatePolicies(w http.ResponseWriter, r *http.Request) {
 	transport.JSONResponse(w, r, jobID)
 }
 
+func (s HTTPService) Rollback(w http.ResponseWriter, r *http.Request) {
+	inst := getInstanceID(r)
+
+	var spec update.RollbackSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	jobID, err := s.service.Rollback(inst, spec, update.Cause{
+		User:    r.FormValue("user"),
+		Message: r.FormValue("message"),
+	})
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+
+	transport.JSONResponse(w, r, jobID)
+}
+
+func (s HTTPService) ApproveRelease(w http.ResponseWriter, r *http.Request) {
+	inst := getInstanceID(r)
+	id := job.ID(mux.Vars(r)["id"])
+
+	jobID, err := s.service.ApproveRelease(inst, id, update.Cause{
+		User:    r.FormValue("user"),
+		Message: r.FormValue("message"),
+	})
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+
+	transport.JSONResponse(w, r, jobID)
+}
+
 func (s HTTPService) LogEvent(w http.ResponseWriter, r *http.Request) {
 	inst := getInstanceID(r)
 
@@ -514,6 +588,17 @@ func (s HTTPService) GetPublicSSHKey(w http.ResponseWriter, r *http.Request) {
 	transport.JSONResponse(w, r, publicSSHKey)
 }
 
+func (s HTTPService) GitRepoConfig(w http.ResponseWriter, r *http.Request) {
+	inst := getInstanceID(r)
+	config, err := s.service.GitRepoConfig(inst, false)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+
+	transport.JSONResponse(w, r, config)
+}
+
 func (s HTTPService) RegeneratePublicSSHKey(w http.ResponseWriter, r *http.Request) {
 	inst := getInstanceID(r)
 	_, err := s.service.PublicSSHKey(inst, true)
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	gh "github.com/google/go-github/github"
 	"github.com/weaveworks/flux/http/httperror"
+	"github.com/weaveworks/flux/integrations"
 	"golang.org/x/oauth2"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 var (
@@ -69,6 +72,77 @@ func (g *github) InsertDeployKey(ownerName string, repoName string, deployKey st
 	return nil
 }
 
+// NewGithubEnterpriseClient instantiates a client, as
+// NewGithubClient does, for the GitHub API at the URL given; e.g.,
+// https://github.example.com/api/v3/.
+func NewGithubEnterpriseClient(token, apiURL string) (*github, error) {
+	base, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	g := NewGithubClient(token)
+	g.client.BaseURL = base
+	return g, nil
+}
+
+// OpenPullRequest opens a pull request in the repo given, unless
+// there's an open pull request from the same branch already, and
+// returns the URL of the pull request, and whether it was opened just
+// now. A pull request from the branch that's been closed doesn't
+// count, so another is opened.
+func (g *github) OpenPullRequest(pr integrations.PullRequest) (string, bool, error) {
+	ownerName, repoName, err := parseRepoURL(pr.RepoURL)
+	if err != nil {
+		return "", false, err
+	}
+
+	open, resp, err := g.client.PullRequests.List(ownerName, repoName, &gh.PullRequestListOptions{
+		State: "open",
+		Head:  ownerName + ":" + pr.Head,
+		Base:  pr.Base,
+	})
+	if err != nil {
+		return "", false, parseError(resp, err)
+	}
+	if len(open) > 0 && open[0].HTMLURL != nil {
+		return *open[0].HTMLURL, false, nil
+	}
+
+	created, resp, err := g.client.PullRequests.Create(ownerName, repoName, &gh.NewPullRequest{
+		Title: &pr.Title,
+		Head:  &pr.Head,
+		Base:  &pr.Base,
+		Body:  &pr.Body,
+	})
+	if err != nil {
+		return "", false, parseError(resp, err)
+	}
+	if created.HTMLURL == nil {
+		return "", true, nil
+	}
+	return *created.HTMLURL, true, nil
+}
+
+// parseRepoURL gets the owner and name of a repo from its git URL,
+// which may be given in the scp-like form used with SSH (e.g.,
+// git@github.com:weaveworks/flux), or as an ssh or https URL.
+func parseRepoURL(repoURL string) (string, string, error) {
+	path := repoURL
+	if u, err := url.Parse(repoURL); err == nil && u.Scheme != "" {
+		path = u.Path
+	} else if i := strings.Index(repoURL, ":"); i >= 0 {
+		path = repoURL[i+1:]
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(path, "/"), ".git"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("cannot find the owner and name of the GitHub repo in %q", repoURL)
+	}
+	return parts[0], parts[1], nil
+}
+
 func populateError(err httperror.APIError, resp *gh.Response) *httperror.APIError {
 	err.StatusCode = resp.StatusCode
 	err.Status = resp.Status
@@ -76,6 +150,10 @@ func populateError(err httperror.APIError, resp *gh.Response) *httperror.APIErro
 }
 
 func parseError(resp *gh.Response, err error) error {
+	if resp == nil {
+		// We didn't get as far as a response
+		return err
+	}
 	switch resp.StatusCode {
 	case http.StatusUnauthorized:
 		return populateError(errUnauthorized, resp)
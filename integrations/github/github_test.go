@@ -1,8 +1,10 @@
 package github
 
 import (
+	"encoding/json"
 	"fmt"
 	gh "github.com/google/go-github/github"
+	"github.com/weaveworks/flux/integrations"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -108,6 +110,86 @@ func TestInsertDeployKey_KeyDoesExist(t *testing.T) {
 	}
 }
 
+func TestOpenPullRequest(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var created bool
+	var existing string
+	mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+		t.Log(r.Method, r.URL)
+		switch r.Method {
+		case "GET":
+			if head := r.URL.Query().Get("head"); head != "o:flux-a000001" {
+				t.Errorf("expected to look for pull requests from o:flux-a000001, got %q", head)
+			}
+			fmt.Fprint(w, "["+existing+"]")
+		case "POST":
+			var pr gh.NewPullRequest
+			if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
+				t.Fatal(err)
+			}
+			if *pr.Head != "flux-a000001" || *pr.Base != "master" || *pr.Title != "Release" {
+				t.Errorf("unexpected pull request %+v", pr)
+			}
+			created = true
+			fmt.Fprint(w, `{"number":2,"html_url":"https://github.com/o/r/pull/2"}`)
+		}
+	})
+
+	g := github{
+		client: client,
+	}
+	pr := integrations.PullRequest{
+		RepoURL: "git@github.com:o/r",
+		Head:    "flux-a000001",
+		Base:    "master",
+		Title:   "Release",
+		Body:    "Release of images",
+	}
+
+	url, opened, err := g.OpenPullRequest(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || !opened || url != "https://github.com/o/r/pull/2" {
+		t.Errorf("expected pull request to be created, got %q", url)
+	}
+
+	// An open pull request from the branch is used, rather than
+	// opening another
+	created = false
+	existing = `{"number":1,"html_url":"https://github.com/o/r/pull/1"}`
+	url, opened, err = g.OpenPullRequest(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || opened || url != "https://github.com/o/r/pull/1" {
+		t.Errorf("expected existing pull request, got %q", url)
+	}
+}
+
+func TestParseRepoURL(t *testing.T) {
+	for _, u := range []string{
+		"git@github.com:weaveworks/flux-example",
+		"git@github.com:weaveworks/flux-example.git",
+		"ssh://git@github.com/weaveworks/flux-example.git",
+		"https://github.com/weaveworks/flux-example",
+	} {
+		owner, repo, err := parseRepoURL(u)
+		if err != nil {
+			t.Errorf("%s: %s", u, err)
+			continue
+		}
+		if owner != "weaveworks" || repo != "flux-example" {
+			t.Errorf("%s: expected weaveworks/flux-example, got %s/%s", u, owner, repo)
+		}
+	}
+	if _, _, err := parseRepoURL("https://github.com/weaveworks"); err == nil {
+		t.Error("expected error for URL without a repo name")
+	}
+}
+
 func testMethod(t *testing.T, r *http.Request, want string) {
 	if got := r.Method; got != want {
 		t.Errorf("Request method: %v, want %v", got, want)
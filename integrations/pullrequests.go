@@ -0,0 +1,24 @@
+package integrations
+
+// PullRequest is a request to merge the changes on one branch of a
+// repo into another.
+type PullRequest struct {
+	// RepoURL is the git URL of the repo, as it's cloned
+	RepoURL string
+	// Head is the branch with the changes, and Base the branch
+	// they're to be merged into
+	Head  string
+	Base  string
+	Title string
+	Body  string
+}
+
+// PullRequester opens pull requests, using the API of the service
+// hosting the repo.
+type PullRequester interface {
+	// OpenPullRequest opens the pull request given, unless there's
+	// one open for the same branch already, and returns the URL of
+	// the pull request for people to look at, and whether it was
+	// opened just now (rather than being open already).
+	OpenPullRequest(PullRequest) (string, bool, error)
+}
@@ -0,0 +1,180 @@
+package policy
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	glob "github.com/ryanuber/go-glob"
+
+	"github.com/weaveworks/flux"
+)
+
+const (
+	globPrefix   = "glob:"
+	semverPrefix = "semver:"
+	regexpPrefix = "regex:"
+)
+
+// Pattern is a tag policy: it says which image tags a container may
+// be updated to, and which of those images is to be preferred.
+type Pattern interface {
+	// Matches reports whether an image with the tag given may be
+	// used.
+	Matches(tag string) bool
+	// Newer reports whether image `a` is to be preferred to image
+	// `b`, assuming both match.
+	Newer(a, b *flux.Image) bool
+	// String gives the pattern as it would appear in a policy.
+	String() string
+}
+
+// PatternAll matches any tag apart from `latest`.
+var PatternAll Pattern = GlobPattern("*")
+
+// ParsePattern interprets a tag policy value. Values starting with
+// `semver:` are semantic version constraints, e.g., `semver:~1.4`;
+// values starting with `regex:` are regular expressions, e.g.,
+// `regex:^master-[0-9a-f]+-(\d+)$`; anything else is a glob, with or
+// without the `glob:` prefix.
+func ParsePattern(pattern string) (Pattern, error) {
+	if strings.HasPrefix(pattern, regexpPrefix) {
+		expr := strings.TrimPrefix(pattern, regexpPrefix)
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing regex %q", expr)
+		}
+		return RegexpPattern{re}, nil
+	}
+	if strings.HasPrefix(pattern, semverPrefix) {
+		constraint := strings.TrimPrefix(pattern, semverPrefix)
+		c, err := semver.NewConstraint(constraint)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing semver constraint %q", constraint)
+		}
+		return SemverPattern{constraint: constraint, constraints: c}, nil
+	}
+	return GlobPattern(strings.TrimPrefix(pattern, globPrefix)), nil
+}
+
+// GlobPattern matches tags against a glob, where `*` matches
+// anything. Images are preferred by when they were created.
+type GlobPattern string
+
+// Matches reports whether the tag matches the glob. The tag `latest`
+// is only matched if it's asked for by name, since it doesn't say
+// which image it is.
+func (g GlobPattern) Matches(tag string) bool {
+	if strings.EqualFold(tag, "latest") {
+		return strings.EqualFold(string(g), "latest")
+	}
+	return glob.Glob(string(g), tag)
+}
+
+func (g GlobPattern) Newer(a, b *flux.Image) bool {
+	return a.CreatedAt.After(b.CreatedAt)
+}
+
+func (g GlobPattern) String() string {
+	return globPrefix + string(g)
+}
+
+// SemverPattern matches tags that are semantic versions meeting a
+// constraint, e.g., `~1.4` or `>=1.2, <2`. Pre-release versions only
+// match if the constraint mentions a pre-release. Images are
+// preferred by version, then by when they were created.
+type SemverPattern struct {
+	constraint  string
+	constraints *semver.Constraints
+}
+
+func (s SemverPattern) Matches(tag string) bool {
+	v, err := semver.NewVersion(tag)
+	if err != nil {
+		return false
+	}
+	return s.constraints.Check(v)
+}
+
+func (s SemverPattern) Newer(a, b *flux.Image) bool {
+	va, erra := semver.NewVersion(a.ID.Tag)
+	vb, errb := semver.NewVersion(b.ID.Tag)
+	switch {
+	case erra != nil || errb != nil:
+		return erra == nil
+	case va.Equal(vb):
+		return a.CreatedAt.After(b.CreatedAt)
+	default:
+		return va.GreaterThan(vb)
+	}
+}
+
+func (s SemverPattern) String() string {
+	return semverPrefix + s.constraint
+}
+
+// RegexpPattern matches tags against a regular expression. If the
+// expression has a capture group, the first group is used to order
+// images: numerically, if the captured text is a number in both
+// tags, or else lexically, so that e.g., `^master-[0-9a-f]+-(\d+)$`
+// prefers the highest build number. Images with the same key, or
+// when there's no capture group, are preferred by when they were
+// created.
+type RegexpPattern struct {
+	re *regexp.Regexp
+}
+
+func (r RegexpPattern) Matches(tag string) bool {
+	return r.re.MatchString(tag)
+}
+
+func (r RegexpPattern) Newer(a, b *flux.Image) bool {
+	if r.re.NumSubexp() > 0 {
+		ka, kb := r.key(a.ID.Tag), r.key(b.ID.Tag)
+		if c := compareKeys(ka, kb); c != 0 {
+			return c > 0
+		}
+	}
+	return a.CreatedAt.After(b.CreatedAt)
+}
+
+func (r RegexpPattern) String() string {
+	return regexpPrefix + r.re.String()
+}
+
+// key returns the text captured by the first group, for ordering.
+func (r RegexpPattern) key(tag string) string {
+	m := r.re.FindStringSubmatch(tag)
+	if len(m) < 2 {
+		return ""
+	}
+	return m[1]
+}
+
+// compareKeys compares two sort keys, as numbers if they are both
+// strings of digits (of any length), and otherwise as strings.
+func compareKeys(a, b string) int {
+	if isDigits(a) && isDigits(b) {
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			if len(a) > len(b) {
+				return 1
+			}
+			return -1
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
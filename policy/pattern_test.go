@@ -0,0 +1,141 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestGlobPattern(t *testing.T) {
+	for _, c := range []struct {
+		pattern string
+		tag     string
+		matches bool
+	}{
+		{"*", "master-a000001", true},
+		{"glob:*", "1.2.3", true},
+		{"*", "latest", false},
+		{"latest", "latest", true},
+		{"glob:master-*", "master-a000001", true},
+		{"glob:master-*", "dev-a000001", false},
+	} {
+		p, err := ParsePattern(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Matches(c.tag) != c.matches {
+			t.Errorf("expected %q matching %q to be %v", c.pattern, c.tag, c.matches)
+		}
+	}
+}
+
+func TestSemverPattern(t *testing.T) {
+	for _, c := range []struct {
+		pattern string
+		tag     string
+		matches bool
+	}{
+		{"semver:~1.4", "1.4.2", true},
+		{"semver:~1.4", "v1.4.0", true},
+		{"semver:~1.4", "1.5.0", false},
+		{"semver:~1.4", "1.4.3-rc.1", false},
+		{"semver:~1.4.3-rc.0", "1.4.3-rc.1", true},
+		{"semver:^1.2", "1.9.0", true},
+		{"semver:^1.2", "2.0.0", false},
+		{"semver:*", "master-a000001", false},
+		{"semver:*", "latest", false},
+	} {
+		p, err := ParsePattern(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Matches(c.tag) != c.matches {
+			t.Errorf("expected %q matching %q to be %v", c.pattern, c.tag, c.matches)
+		}
+		if p.String() != c.pattern {
+			t.Errorf("expected %q as pattern string, got %q", c.pattern, p.String())
+		}
+	}
+
+	if _, err := ParsePattern("semver:not a version"); err == nil {
+		t.Errorf("expected error from invalid semver constraint")
+	}
+}
+
+func TestRegexpPattern(t *testing.T) {
+	p, err := ParsePattern(`regex:^master-[0-9a-f]+-(\d+)$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tag, matches := range map[string]bool{
+		"master-a000001-12": true,
+		"master-a000001":    false,
+		"dev-a000001-12":    false,
+	} {
+		if p.Matches(tag) != matches {
+			t.Errorf("expected %q matching %q to be %v", p, tag, matches)
+		}
+	}
+	if p.String() != `regex:^master-[0-9a-f]+-(\d+)$` {
+		t.Errorf("unexpected pattern string %q", p.String())
+	}
+
+	if _, err := ParsePattern("regex:master-(["); err == nil {
+		t.Errorf("expected error from invalid regex")
+	}
+}
+
+func TestCompareKeys(t *testing.T) {
+	for _, c := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"9", "10", -1},
+		{"010", "9", 1},
+		{"12", "012", 0},
+		{"123456789012345678901234567890", "99", 1},
+		{"b", "a", 1},
+		{"9", "10a", 1},
+		{"", "1", -1},
+	} {
+		if got := compareKeys(c.a, c.b); got != c.expected {
+			t.Errorf("comparing %q with %q: expected %d, got %d", c.a, c.b, c.expected, got)
+		}
+	}
+}
+
+func TestPatternNewer(t *testing.T) {
+	older, newer := time.Now().Add(-time.Hour), time.Now()
+	image := func(tag string, created time.Time) *flux.Image {
+		return &flux.Image{ID: flux.ImageID{Image: "helloworld", Tag: tag}, CreatedAt: created}
+	}
+	for _, c := range []struct {
+		pattern string
+		a, b    *flux.Image
+		newer   bool
+	}{
+		{"*", image("a", newer), image("b", older), true},
+		{"*", image("a", older), image("b", newer), false},
+		{"semver:*", image("1.10.0", older), image("1.9.0", newer), true},
+		{"semver:*", image("1.9.0", newer), image("1.10.0", older), false},
+		{"semver:*", image("v2.0.0", older), image("1.0.0", newer), true},
+		{"semver:*", image("1.0.0", newer), image("1.0.0", older), true},
+		{"semver:*", image("1.0.0-rc.2", older), image("1.0.0-rc.1", newer), true},
+		{"semver:*", image("1.0.0-rc.1", older), image("1.0.0", newer), false},
+		{"semver:*", image("1.0.0", older), image("not-a-version", newer), true},
+		{`regex:^master-[0-9a-f]+-(\d+)$`, image("master-a000001-10", older), image("master-a000002-9", newer), true},
+		{`regex:^master-[0-9a-f]+-(\d+)$`, image("master-a000002-9", newer), image("master-a000001-10", older), false},
+		{`regex:^master-[0-9a-f]+-(\d+)$`, image("master-a000002-10", newer), image("master-a000001-10", older), true},
+		{`regex:^(\w+)-`, image("beta-1", older), image("alpha-2", newer), true},
+		{`regex:^master-`, image("master-a", older), image("master-b", newer), false},
+	} {
+		p, err := ParsePattern(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Newer(c.a, c.b); got != c.newer {
+			t.Errorf("%s: expected %s newer than %s to be %v", c.pattern, c.a.ID.Tag, c.b.ID.Tag, c.newer)
+		}
+	}
+}
@@ -12,6 +12,21 @@ const (
 	Locked    = Policy("locked")
 	Automated = Policy("automated")
 	TagAll    = Policy("tag_all")
+
+	// RollbackOnFailure asks for a release of a service to be rolled
+	// back, and the service locked, if it doesn't become ready in
+	// time.
+	RollbackOnFailure = Policy("rollback-on-failure")
+
+	// SyncGCMark is put on resources by fluxd when it applies them,
+	// so it knows which resources it may garbage collect.
+	SyncGCMark = Policy("sync-gc-mark")
+
+	// AutomationWindow restricts automated releases of a service to
+	// the windows given (see ParseWindows), and AutomationInterval
+	// to at most one in the interval given (e.g., "2h").
+	AutomationWindow   = Policy("automation-window")
+	AutomationInterval = Policy("automation-interval")
 )
 
 // Policy is an string, denoting the current deployment policy of a service,
@@ -20,7 +35,7 @@ type Policy string
 
 func Boolean(policy Policy) bool {
 	switch policy {
-	case Locked, Automated, Ignore:
+	case Locked, Automated, Ignore, RollbackOnFailure:
 		return true
 	}
 	return false
@@ -0,0 +1,189 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a period of the day, on some days of the week, in a
+// particular timezone. A window that ends at or before the time it
+// starts runs over midnight, into the next day.
+type Window struct {
+	Days     [7]bool // indexed by time.Weekday
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+// Windows are a set of windows, e.g., those in which automated
+// releases may happen.
+type Windows []Window
+
+// ParseWindows parses windows given in the form
+//
+//	[days] HH:MM-HH:MM [timezone]
+//
+// separated by `;`, e.g., `Mon-Fri 09:00-17:00 Europe/London; Sat
+// 10:00-12:00`. Days are given as a comma-separated list of days or
+// ranges of days; if they are left out, the window is every day. If
+// the timezone is left out, it's UTC.
+func ParseWindows(s string) (Windows, error) {
+	var windows Windows
+	for _, part := range strings.Split(s, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		w, err := parseWindow(part)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing window %q", strings.TrimSpace(part))
+		}
+		windows = append(windows, w)
+	}
+	if len(windows) == 0 {
+		return nil, errors.New("no windows given")
+	}
+	return windows, nil
+}
+
+func parseWindow(s string) (Window, error) {
+	w := Window{Location: time.UTC}
+	fields := strings.Fields(s)
+	var times string
+	switch {
+	case len(fields) > 0 && strings.Contains(fields[0], ":"):
+		times, fields = fields[0], fields[1:]
+		for i := range w.Days {
+			w.Days[i] = true
+		}
+	case len(fields) > 1:
+		if err := parseDays(fields[0], &w.Days); err != nil {
+			return w, err
+		}
+		times, fields = fields[1], fields[2:]
+	default:
+		return w, errors.New("expected [days] HH:MM-HH:MM [timezone]")
+	}
+
+	span := strings.Split(times, "-")
+	if len(span) != 2 {
+		return w, fmt.Errorf("expected times as HH:MM-HH:MM, got %q", times)
+	}
+	var err error
+	if w.Start, err = parseTimeOfDay(span[0]); err != nil {
+		return w, err
+	}
+	if w.End, err = parseTimeOfDay(span[1]); err != nil {
+		return w, err
+	}
+
+	switch len(fields) {
+	case 0:
+	case 1:
+		if w.Location, err = time.LoadLocation(fields[0]); err != nil {
+			return w, errors.Wrapf(err, "loading timezone %q", fields[0])
+		}
+	default:
+		return w, fmt.Errorf("unexpected %q after timezone", strings.Join(fields[1:], " "))
+	}
+	return w, nil
+}
+
+// parseDays parses e.g., `Mon-Wed,Fri` into the days given.
+func parseDays(s string, days *[7]bool) error {
+	for _, r := range strings.Split(s, ",") {
+		ends := strings.Split(r, "-")
+		if len(ends) > 2 {
+			return fmt.Errorf("unexpected range of days %q", r)
+		}
+		from, ok := weekdays[strings.ToLower(ends[0])]
+		if !ok {
+			return fmt.Errorf("unknown day %q", ends[0])
+		}
+		to := from
+		if len(ends) == 2 {
+			if to, ok = weekdays[strings.ToLower(ends[1])]; !ok {
+				return fmt.Errorf("unknown day %q", ends[1])
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("expected time as HH:MM, got %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// timeOfDay returns the weekday and wall clock time of `t`, in the
+// window's timezone.
+func (w Window) timeOfDay(t time.Time) (time.Weekday, time.Duration) {
+	t = t.In(w.Location)
+	return t.Weekday(), time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// Contains reports whether the time given is in the window.
+func (w Window) Contains(t time.Time) bool {
+	day, tod := w.timeOfDay(t)
+	if w.End > w.Start {
+		return w.Days[day] && tod >= w.Start && tod < w.End
+	}
+	yesterday := (day + 6) % 7
+	return (w.Days[day] && tod >= w.Start) || (w.Days[yesterday] && tod < w.End)
+}
+
+// Next returns the next time after `t` that the window opens.
+func (w Window) Next(t time.Time) time.Time {
+	t = t.In(w.Location)
+	hour, minute := int(w.Start/time.Hour), int(w.Start%time.Hour/time.Minute)
+	for i := 0; i <= 7; i++ {
+		start := time.Date(t.Year(), t.Month(), t.Day()+i, hour, minute, 0, 0, w.Location)
+		if w.Days[start.Weekday()] && start.After(t) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// Contains reports whether the time given is in any of the windows.
+func (ws Windows) Contains(t time.Time) bool {
+	for _, w := range ws {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the next time after `t` that one of the windows
+// opens.
+func (ws Windows) Next(t time.Time) time.Time {
+	var next time.Time
+	for _, w := range ws {
+		if n := w.Next(t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return next
+}
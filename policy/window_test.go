@@ -0,0 +1,68 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParseTime(t *testing.T, s string) time.Time {
+	tm, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func TestParseWindowsErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"Mon-Fri",
+		"Mon-Fri 09:00",
+		"Mon-Fri 9am-5pm",
+		"Someday 09:00-17:00",
+		"Mon-Fri 09:00-17:00 Not/AZone",
+		"Mon-Fri 09:00-17:00 UTC extra",
+	} {
+		if _, err := ParseWindows(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	for _, c := range []struct {
+		windows string
+		at      string
+		in      bool
+		next    string
+	}{
+		// 2017-10-02 is a Monday
+		{"Mon-Fri 09:00-17:00", "2017-10-02T10:00:00Z", true, "2017-10-03T09:00:00Z"},
+		{"Mon-Fri 09:00-17:00", "2017-10-02T17:00:00Z", false, "2017-10-03T09:00:00Z"},
+		{"Mon-Fri 09:00-17:00", "2017-10-06T18:00:00Z", false, "2017-10-09T09:00:00Z"},
+		{"Mon-Fri 09:00-17:00", "2017-10-07T10:00:00Z", false, "2017-10-09T09:00:00Z"},
+		{"Mon,Wed 09:00-17:00", "2017-10-03T10:00:00Z", false, "2017-10-04T09:00:00Z"},
+		{"Fri-Mon 09:00-17:00", "2017-10-08T10:00:00Z", true, "2017-10-09T09:00:00Z"},
+		{"09:00-17:00", "2017-10-08T08:00:00Z", false, "2017-10-08T09:00:00Z"},
+		// Over midnight, so Sunday 01:00 is in Saturday's window
+		{"Sat 22:00-02:00", "2017-10-08T01:00:00Z", true, "2017-10-14T22:00:00Z"},
+		{"Sat 22:00-02:00", "2017-10-07T01:00:00Z", false, "2017-10-07T22:00:00Z"},
+		// 08:30 UTC is 09:30 in London, in October (BST)
+		{"Mon-Fri 09:00-17:00 Europe/London", "2017-10-02T08:30:00Z", true, "2017-10-03T08:00:00Z"},
+		// ... and after the clocks go back, 09:00 is 09:00 UTC
+		{"Mon-Fri 09:00-17:00 Europe/London", "2017-10-27T16:30:00Z", false, "2017-10-30T09:00:00Z"},
+		{"Sat 10:00-12:00; Mon-Fri 09:00-17:00", "2017-10-06T18:00:00Z", false, "2017-10-07T10:00:00Z"},
+	} {
+		windows, err := ParseWindows(c.windows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		at := mustParseTime(t, c.at)
+		if windows.Contains(at) != c.in {
+			t.Errorf("%q at %s: expected in window to be %v", c.windows, c.at, c.in)
+		}
+		if next := windows.Next(at); !next.Equal(mustParseTime(t, c.next)) {
+			t.Errorf("%q at %s: expected next window at %s, got %s", c.windows, c.at, c.next, next.UTC().Format(time.RFC3339))
+		}
+	}
+}
@@ -2,8 +2,6 @@ package release
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
 	"strings"
 
 	"github.com/weaveworks/flux"
@@ -42,14 +40,43 @@ func (rc *ReleaseContext) WriteUpdates(updates []*update.ServiceUpdate) error {
 	rc.repo.Lock()
 	defer rc.repo.Unlock()
 	err := func() error {
+		// More than one service may be defined by the same
+		// resource; this keeps track of what each definition has
+		// been updated to so far.
+		written := map[string][]byte{}
+		// Replacing a definition moves those after it in the same
+		// file; this keeps track of by how much.
+		type edit struct{ offset, delta int }
+		edits := map[string][]edit{}
 		for _, update := range updates {
-			fi, err := os.Stat(update.ManifestPath)
-			if err != nil {
-				return err
+			def, newDef := update.Resource.Bytes(), update.ManifestBytes
+			path, offset := update.ManifestPath, update.Resource.Offset()
+			key := fmt.Sprintf("%s@%d", path, offset)
+			if sofar, ok := written[key]; ok {
+				// Make this service's changes on top of those
+				// already written
+				def, newDef = sofar, sofar
+				for _, c := range update.Updates {
+					var err error
+					if newDef, err = rc.manifests.UpdateDefinition(newDef, c.Container, c.Target); err != nil {
+						return err
+					}
+				}
+			}
+			// Only the resource's own definition is replaced, so
+			// that other resources in the same file (including
+			// any updated here) are kept as they are.
+			at := offset
+			for _, e := range edits[path] {
+				if e.offset < offset {
+					at += e.delta
+				}
 			}
-			if err = ioutil.WriteFile(update.ManifestPath, update.ManifestBytes, fi.Mode()); err != nil {
+			if err := cluster.ReplaceDefinition(path, at, def, newDef); err != nil {
 				return err
 			}
+			edits[path] = append(edits[path], edit{offset, len(newDef) - len(def)})
+			written[key] = newDef
 		}
 		return nil
 	}()
@@ -135,20 +162,21 @@ func (rc *ReleaseContext) FindDefinedServices() ([]*update.ServiceUpdate, error)
 	}
 
 	var defined []*update.ServiceUpdate
-	for id, paths := range services {
-		switch len(paths) {
+	for id, resources := range services {
+		switch len(resources) {
 		case 1:
-			def, err := ioutil.ReadFile(paths[0])
-			if err != nil {
-				return nil, err
-			}
 			defined = append(defined, &update.ServiceUpdate{
 				ServiceID:     id,
-				ManifestPath:  paths[0],
-				ManifestBytes: def,
+				Resource:      resources[0],
+				ManifestPath:  resources[0].Source(),
+				ManifestBytes: resources[0].Bytes(),
 			})
 		default:
-			return nil, fmt.Errorf("multiple resource files found for service %s: %s", id, strings.Join(paths, ", "))
+			var ids []string
+			for _, res := range resources {
+				ids = append(ids, fmt.Sprintf("%s (in %s)", res.ResourceID(), res.Source()))
+			}
+			return nil, fmt.Errorf("multiple resources found for service %s: %s", id, strings.Join(ids, ", "))
 		}
 	}
 	return defined, nil
@@ -1,7 +1,10 @@
 package release
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +13,7 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/cluster/kubernetes"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/git/gittest"
 	"github.com/weaveworks/flux/registry"
@@ -27,7 +31,8 @@ var (
 	hwSvcID, _        = flux.ParseServiceID("default/helloworld")
 	hwSvcSpec, _      = update.ParseServiceSpec(hwSvcID.String())
 	hwSvc             = cluster.Service{
-		ID: hwSvcID,
+		ID:     hwSvcID,
+		Labels: map[string]string{"app": "helloworld"},
 		Containers: cluster.ContainersOrExcuse{
 			Containers: []cluster.Container{
 				cluster.Container{
@@ -48,7 +53,8 @@ var (
 	lockedSvcID, _   = flux.ParseServiceID("default/locked-service")
 	lockedSvcSpec, _ = update.ParseServiceSpec(lockedSvcID.String())
 	lockedSvc        = cluster.Service{
-		ID: lockedSvcID,
+		ID:     lockedSvcID,
+		Labels: map[string]string{"app": "locked-service"},
 		Containers: cluster.ContainersOrExcuse{
 			Containers: []cluster.Container{
 				cluster.Container{
@@ -261,6 +267,66 @@ func Test_FilterLogic(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "selected by label",
+			Spec: update.ReleaseSpec{
+				ServiceSpecs: []update.ServiceSpec{update.ServiceSpecAll},
+				ImageSpec:    update.ImageSpecLatest,
+				Kind:         update.ReleaseKindExecute,
+				Namespaces:   []string{"def*"},
+				Selector:     "app=helloworld",
+			},
+			Expected: update.Result{
+				flux.ServiceID("default/helloworld"): update.ServiceResult{
+					Status: update.ReleaseStatusSuccess,
+					PerContainer: []update.ContainerUpdate{
+						update.ContainerUpdate{
+							Container: container,
+							Current:   oldImageID,
+							Target:    newImageID,
+						},
+					},
+				},
+				flux.ServiceID("default/locked-service"): update.ServiceResult{
+					Status: update.ReleaseStatusIgnored,
+					Error:  update.NotIncluded,
+				},
+				flux.ServiceID("default/test-service"): update.ServiceResult{
+					Status: update.ReleaseStatusIgnored,
+					Error:  update.NotIncluded,
+				},
+			},
+		},
+		{
+			Name: "excluded by namespace and label",
+			Spec: update.ReleaseSpec{
+				ServiceSpecs:      []update.ServiceSpec{update.ServiceSpecAll},
+				ImageSpec:         update.ImageSpecLatest,
+				Kind:              update.ReleaseKindExecute,
+				ExcludeNamespaces: []string{"default"},
+				ExcludeSelector:   "app in (locked-service, other)",
+			},
+			Expected: update.Result{
+				flux.ServiceID("default/helloworld"): update.ServiceResult{
+					Status: update.ReleaseStatusSuccess,
+					PerContainer: []update.ContainerUpdate{
+						update.ContainerUpdate{
+							Container: container,
+							Current:   oldImageID,
+							Target:    newImageID,
+						},
+					},
+				},
+				flux.ServiceID("default/locked-service"): update.ServiceResult{
+					Status: update.ReleaseStatusIgnored,
+					Error:  update.Excluded,
+				},
+				flux.ServiceID("default/test-service"): update.ServiceResult{
+					Status: update.ReleaseStatusSkipped,
+					Error:  update.NotInCluster,
+				},
+			},
+		},
 		{
 			Name: "service not in repo",
 			Spec: update.ReleaseSpec{
@@ -398,3 +464,106 @@ func testRelease(t *testing.T, name string, ctx *ReleaseContext, spec update.Rel
 		t.Errorf("%s - expected:\n%#v, got:\n%#v", name, expected, results)
 	}
 }
+
+const sharedDeploymentFile = `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  namespace: default
+spec:
+  selector:
+    name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: backend
+  namespace: default
+spec:
+  selector:
+    name: web
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: web
+  namespace: default
+spec:
+  template:
+    metadata:
+      labels:
+        name: web
+    spec:
+      containers:
+      - name: frontend
+        image: quay.io/weaveworks/frontend:1
+      - name: backend
+        image: quay.io/weaveworks/backend:1
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: other
+  namespace: default
+spec:
+  template:
+    metadata:
+      labels:
+        name: other
+    spec:
+      containers:
+      - name: other
+        image: quay.io/weaveworks/frontend:1
+`
+
+// Two services defined by the same resource are updated in turn, each
+// on top of the other, without disturbing the rest of the file.
+func Test_WriteUpdatesSharedDefinition(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "web.yaml")
+	if err := ioutil.WriteFile(path, []byte(sharedDeploymentFile), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	defined, err := mockManifests.FindDefinedServices(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var updates []*update.ServiceUpdate
+	for _, name := range []string{"frontend", "backend"} {
+		resources := defined[flux.ServiceID("default/"+name)]
+		if len(resources) != 1 {
+			t.Fatalf("expected one resource for %s, got %d", name, len(resources))
+		}
+		target, _ := flux.ParseImageID("quay.io/weaveworks/" + name + ":2")
+		newDef, err := mockManifests.UpdateDefinition(resources[0].Bytes(), name, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		updates = append(updates, &update.ServiceUpdate{
+			ServiceID:     flux.ServiceID("default/" + name),
+			Resource:      resources[0],
+			ManifestPath:  path,
+			ManifestBytes: newDef,
+			Updates:       []update.ContainerUpdate{{Container: name, Target: target}},
+		})
+	}
+
+	ctx := NewReleaseContext(nil, mockManifests, nil, &git.Checkout{})
+	if err := ctx.WriteUpdates(updates); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.NewReplacer(
+		"frontend\n        image: quay.io/weaveworks/frontend:1", "frontend\n        image: quay.io/weaveworks/frontend:2",
+		"backend:1", "backend:2",
+	).Replace(sharedDeploymentFile)
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(got))
+	}
+}
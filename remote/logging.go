@@ -5,6 +5,7 @@ import (
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/job"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -86,6 +87,24 @@ func (p *ErrorLoggingPlatform) SyncStatus(rev string) (_ []string, err error) {
 	return p.Platform.SyncStatus(rev)
 }
 
+func (p *ErrorLoggingPlatform) SyncPlan() (_ fluxsync.Plan, err error) {
+	defer func() {
+		if err != nil {
+			p.Logger.Log("method", "SyncPlan", "error", err)
+		}
+	}()
+	return p.Platform.SyncPlan()
+}
+
+func (p *ErrorLoggingPlatform) ListSyncStatus() (_ []flux.ResourceSyncStatus, err error) {
+	defer func() {
+		if err != nil {
+			p.Logger.Log("method", "ListSyncStatus", "error", err)
+		}
+	}()
+	return p.Platform.ListSyncStatus()
+}
+
 func (p *ErrorLoggingPlatform) UpdateManifests(u update.Spec) (_ job.ID, err error) {
 	defer func() {
 		if err != nil {
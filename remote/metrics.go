@@ -12,6 +12,7 @@ import (
 	"github.com/weaveworks/flux/job"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
 	"github.com/weaveworks/flux/service"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -123,6 +124,26 @@ func (i *instrumentedPlatform) SyncStatus(cursor string) (_ []string, err error)
 	return i.p.SyncStatus(cursor)
 }
 
+func (i *instrumentedPlatform) SyncPlan() (_ fluxsync.Plan, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "SyncPlan",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.p.SyncPlan()
+}
+
+func (i *instrumentedPlatform) ListSyncStatus() (_ []flux.ResourceSyncStatus, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "ListSyncStatus",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.p.ListSyncStatus()
+}
+
 func (i *instrumentedPlatform) GitRepoConfig(regenerate bool) (_ flux.GitConfig, err error) {
 	defer func(begin time.Time) {
 		requestDuration.With(
@@ -8,8 +8,10 @@ import (
 	"time"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/guid"
 	"github.com/weaveworks/flux/job"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -37,6 +39,12 @@ type MockPlatform struct {
 	SyncStatusAnswer []string
 	SyncStatusError  error
 
+	SyncPlanAnswer fluxsync.Plan
+	SyncPlanError  error
+
+	ListSyncStatusAnswer []flux.ResourceSyncStatus
+	ListSyncStatusError  error
+
 	JobStatusAnswer job.Status
 	JobStatusError  error
 
@@ -81,6 +89,14 @@ func (p *MockPlatform) SyncStatus(string) ([]string, error) {
 	return p.SyncStatusAnswer, p.SyncStatusError
 }
 
+func (p *MockPlatform) SyncPlan() (fluxsync.Plan, error) {
+	return p.SyncPlanAnswer, p.SyncPlanError
+}
+
+func (p *MockPlatform) ListSyncStatus() ([]flux.ResourceSyncStatus, error) {
+	return p.ListSyncStatusAnswer, p.ListSyncStatusError
+}
+
 func (p *MockPlatform) JobStatus(job.ID) (job.Status, error) {
 	return p.JobStatusAnswer, p.JobStatusError
 }
@@ -106,6 +122,13 @@ func PlatformTestBattery(t *testing.T, wrap func(mock Platform) Platform) {
 	now := time.Now().UTC()
 
 	imageID, _ := flux.ParseImageID("quay.io/example.com/frob:v0.4.5")
+	resourceStatus := flux.ResourceSyncStatus{
+		ID:         "Deployment foobar/hello",
+		ServiceIDs: []flux.ServiceID{"foobar/hello"},
+		Revision:   "a000001",
+		AppliedAt:  now,
+		Error:      "could not apply",
+	}
 	serviceAnswer := []flux.ServiceStatus{
 		flux.ServiceStatus{
 			ID:     flux.ServiceID("foobar/hello"),
@@ -119,6 +142,7 @@ func PlatformTestBattery(t *testing.T, wrap func(mock Platform) Platform) {
 					},
 				},
 			},
+			Sync: []flux.ResourceSyncStatus{resourceStatus},
 		},
 		flux.ServiceStatus{},
 	}
@@ -143,6 +167,26 @@ func PlatformTestBattery(t *testing.T, wrap func(mock Platform) Platform) {
 		"commit 3",
 	}
 
+	syncPlanAnswer := fluxsync.Plan{
+		"Deployment default/helloworld": fluxsync.ResourcePlan{
+			Action: fluxsync.ActionUpdate,
+			Source: "helloworld-deploy.yaml",
+			Changes: []fluxsync.Change{
+				{Path: "spec.replicas", Old: "5", New: "2"},
+			},
+		},
+		"Service default/helloworld": fluxsync.ResourcePlan{
+			Action: fluxsync.ActionCreate,
+		},
+	}
+
+	listSyncStatusAnswer := []flux.ResourceSyncStatus{
+		resourceStatus,
+		flux.ResourceSyncStatus{
+			ID: "Service foobar/hello",
+		},
+	}
+
 	updateSpec := update.Spec{
 		Type: update.Images,
 		Spec: update.ReleaseSpec{
@@ -165,6 +209,8 @@ func PlatformTestBattery(t *testing.T, wrap func(mock Platform) Platform) {
 		UpdateManifestsArgTest: checkUpdateSpec,
 		UpdateManifestsAnswer:  job.ID(guid.New()),
 		SyncStatusAnswer:       syncStatusAnswer,
+		SyncPlanAnswer:         syncPlanAnswer,
+		ListSyncStatusAnswer:   listSyncStatusAnswer,
 	}
 
 	// OK, here we go
@@ -211,6 +257,31 @@ func PlatformTestBattery(t *testing.T, wrap func(mock Platform) Platform) {
 		t.Error("expected error from UpdateManifests, got nil")
 	}
 
+	// A rollback spec has to survive the trip to the platform
+	rollbackSpec := update.Spec{
+		Type: update.Rollback,
+		Spec: update.RollbackSpec{
+			Changes: []update.Change{
+				{
+					ServiceID: flux.ServiceID("foobar/hello"),
+					Container: cluster.Container{Name: "frobnicator", Image: "quay.io/example/frobnicator:v2"},
+					ImageID:   imageID,
+				},
+			},
+			Reason: "v2 is broken",
+		},
+	}
+	mock.UpdateManifestsError = nil
+	mock.UpdateManifestsArgTest = func(s update.Spec) error {
+		if !reflect.DeepEqual(rollbackSpec, s) {
+			return fmt.Errorf("expected:\n%#v\ngot:\n%#v", rollbackSpec, s)
+		}
+		return nil
+	}
+	if _, err = client.UpdateManifests(rollbackSpec); err != nil {
+		t.Error(err)
+	}
+
 	if err := client.SyncNotify(); err != nil {
 		t.Error(err)
 	}
@@ -222,4 +293,28 @@ func PlatformTestBattery(t *testing.T, wrap func(mock Platform) Platform) {
 	if !reflect.DeepEqual(mock.SyncStatusAnswer, syncSt) {
 		t.Error(fmt.Errorf("expected: %#v\ngot: %#v"), mock.SyncStatusAnswer, syncSt)
 	}
+
+	plan, err := client.SyncPlan()
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(mock.SyncPlanAnswer, plan) {
+		t.Error(fmt.Errorf("expected: %#v\ngot: %#v", mock.SyncPlanAnswer, plan))
+	}
+	mock.SyncPlanError = fmt.Errorf("sync plan error")
+	if _, err = client.SyncPlan(); err == nil {
+		t.Error("expected error from SyncPlan, got nil")
+	}
+
+	statuses, err := client.ListSyncStatus()
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(mock.ListSyncStatusAnswer, statuses) {
+		t.Error(fmt.Errorf("expected: %#v\ngot: %#v", mock.ListSyncStatusAnswer, statuses))
+	}
+	mock.ListSyncStatusError = fmt.Errorf("list sync status error")
+	if _, err = client.ListSyncStatus(); err == nil {
+		t.Error("expected error from ListSyncStatus, got nil")
+	}
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/service"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -46,6 +47,10 @@ type PlatformV6 interface {
 	SyncNotify() error
 	// Ask the daemon where it's up to with syncing
 	SyncStatus(string) ([]string, error)
+	// Ask the daemon what it would do, were it to sync now
+	SyncPlan() (fluxsync.Plan, error)
+	// Ask the daemon how each resource fared in the most recent sync
+	ListSyncStatus() ([]flux.ResourceSyncStatus, error)
 	// Ask the daemon where it's up to with job processing
 	JobStatus(job.ID) (job.Status, error)
 	// Get the daemon's public SSH key
@@ -6,6 +6,7 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/remote"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -50,6 +51,14 @@ func (bc baseClient) SyncStatus(string) ([]string, error) {
 	return nil, remote.UpgradeNeededError(errors.New("SyncStatus method not implemented"))
 }
 
+func (bc baseClient) SyncPlan() (fluxsync.Plan, error) {
+	return nil, remote.UpgradeNeededError(errors.New("SyncPlan method not implemented"))
+}
+
+func (bc baseClient) ListSyncStatus() ([]flux.ResourceSyncStatus, error) {
+	return nil, remote.UpgradeNeededError(errors.New("ListSyncStatus method not implemented"))
+}
+
 func (bc baseClient) GitRepoConfig(bool) (flux.GitConfig, error) {
 	return flux.GitConfig{}, remote.UpgradeNeededError(errors.New("GitRepoConfig method not implemented"))
 }
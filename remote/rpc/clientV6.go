@@ -7,6 +7,7 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/remote"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -88,6 +89,24 @@ func (p *RPCClientV6) SyncStatus(ref string) ([]string, error) {
 	return result, err
 }
 
+func (p *RPCClientV6) SyncPlan() (fluxsync.Plan, error) {
+	var result fluxsync.Plan
+	err := p.client.Call("RPCServer.SyncPlan", struct{}{}, &result)
+	if _, ok := err.(rpc.ServerError); !ok && err != nil {
+		return nil, remote.FatalError{err}
+	}
+	return result, err
+}
+
+func (p *RPCClientV6) ListSyncStatus() ([]flux.ResourceSyncStatus, error) {
+	var result []flux.ResourceSyncStatus
+	err := p.client.Call("RPCServer.ListSyncStatus", struct{}{}, &result)
+	if _, ok := err.(rpc.ServerError); !ok && err != nil {
+		return nil, remote.FatalError{err}
+	}
+	return result, err
+}
+
 func (p *RPCClientV6) GitRepoConfig(regenerate bool) (flux.GitConfig, error) {
 	var result flux.GitConfig
 	err := p.client.Call("RPCServer.GitRepoConfig", regenerate, &result)
@@ -14,6 +14,7 @@ import (
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/remote"
 	"github.com/weaveworks/flux/service"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -35,6 +36,8 @@ const (
 	methodSyncNotify      = ".Platform.SyncNotify"
 	methodJobStatus       = ".Platform.JobStatus"
 	methodSyncStatus      = ".Platform.SyncStatus"
+	methodSyncPlan        = ".Platform.SyncPlan"
+	methodListSyncStatus  = ".Platform.ListSyncStatus"
 	methodUpdateManifests = ".Platform.UpdateManifests"
 	methodGitRepoConfig   = ".Platform.GitRepoConfig"
 )
@@ -163,6 +166,20 @@ type SyncStatusResponse struct {
 	ErrorResponse
 }
 
+type syncPlan struct{}
+
+type SyncPlanResponse struct {
+	Result fluxsync.Plan
+	ErrorResponse
+}
+
+type listSyncStatus struct{}
+
+type ListSyncStatusResponse struct {
+	Result []flux.ResourceSyncStatus
+	ErrorResponse
+}
+
 type GitRepoConfigResponse struct {
 	Result flux.GitConfig
 	ErrorResponse
@@ -295,6 +312,28 @@ func (r *natsPlatform) SyncStatus(ref string) ([]string, error) {
 	return response.Result, extractError(response.ErrorResponse)
 }
 
+func (r *natsPlatform) SyncPlan() (fluxsync.Plan, error) {
+	var response SyncPlanResponse
+	if err := r.conn.Request(r.instance+methodSyncPlan, syncPlan{}, &response, timeout); err != nil {
+		if err == nats.ErrTimeout {
+			err = remote.UnavailableError(err)
+		}
+		return nil, err
+	}
+	return response.Result, extractError(response.ErrorResponse)
+}
+
+func (r *natsPlatform) ListSyncStatus() ([]flux.ResourceSyncStatus, error) {
+	var response ListSyncStatusResponse
+	if err := r.conn.Request(r.instance+methodListSyncStatus, listSyncStatus{}, &response, timeout); err != nil {
+		if err == nats.ErrTimeout {
+			err = remote.UnavailableError(err)
+		}
+		return nil, err
+	}
+	return response.Result, extractError(response.ErrorResponse)
+}
+
 func (r *natsPlatform) GitRepoConfig(regenerate bool) (flux.GitConfig, error) {
 	var response GitRepoConfigResponse
 	if err := r.conn.Request(r.instance+methodGitRepoConfig, regenerate, &response, timeout); err != nil {
@@ -439,6 +478,27 @@ func (n *NATS) Subscribe(instID service.InstanceID, platform remote.Platform, do
 			}
 			n.enc.Publish(request.Reply, SyncStatusResponse{res, makeErrorResponse(err)})
 
+		case strings.HasSuffix(request.Subject, methodSyncPlan):
+			var (
+				req syncPlan
+				res fluxsync.Plan
+			)
+			err = encoder.Decode(request.Subject, request.Data, &req)
+			if err == nil {
+				res, err = platform.SyncPlan()
+			}
+			n.enc.Publish(request.Reply, SyncPlanResponse{res, makeErrorResponse(err)})
+		case strings.HasSuffix(request.Subject, methodListSyncStatus):
+			var (
+				req listSyncStatus
+				res []flux.ResourceSyncStatus
+			)
+			err = encoder.Decode(request.Subject, request.Data, &req)
+			if err == nil {
+				res, err = platform.ListSyncStatus()
+			}
+			n.enc.Publish(request.Reply, ListSyncStatusResponse{res, makeErrorResponse(err)})
+
 		case strings.HasSuffix(request.Subject, methodGitRepoConfig):
 			var (
 				req bool
@@ -8,6 +8,7 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/remote"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -85,6 +86,18 @@ func (p *RPCServer) SyncStatus(cursor string, resp *[]string) error {
 	return err
 }
 
+func (p *RPCServer) SyncPlan(_ struct{}, resp *fluxsync.Plan) error {
+	v, err := p.p.SyncPlan()
+	*resp = v
+	return err
+}
+
+func (p *RPCServer) ListSyncStatus(_ struct{}, resp *[]flux.ResourceSyncStatus) error {
+	v, err := p.p.ListSyncStatus()
+	*resp = v
+	return err
+}
+
 func (p *RPCServer) GitRepoConfig(regenerate bool, resp *flux.GitConfig) error {
 	v, err := p.p.GitRepoConfig(regenerate)
 	*resp = v
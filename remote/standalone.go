@@ -7,6 +7,7 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/service"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -215,6 +216,24 @@ func (p *removeablePlatform) SyncStatus(ref string) (revs []string, err error) {
 	return p.remote.SyncStatus(ref)
 }
 
+func (p *removeablePlatform) SyncPlan() (_ fluxsync.Plan, err error) {
+	defer func() {
+		if _, ok := err.(FatalError); ok {
+			p.closeWithError(err)
+		}
+	}()
+	return p.remote.SyncPlan()
+}
+
+func (p *removeablePlatform) ListSyncStatus() (_ []flux.ResourceSyncStatus, err error) {
+	defer func() {
+		if _, ok := err.(FatalError); ok {
+			p.closeWithError(err)
+		}
+	}()
+	return p.remote.ListSyncStatus()
+}
+
 func (p *removeablePlatform) GitRepoConfig(regenerate bool) (_ flux.GitConfig, err error) {
 	defer func() {
 		if _, ok := err.(FatalError); ok {
@@ -266,6 +285,14 @@ func (p disconnectedPlatform) SyncStatus(string) ([]string, error) {
 	return nil, errNotSubscribed
 }
 
+func (p disconnectedPlatform) SyncPlan() (fluxsync.Plan, error) {
+	return nil, errNotSubscribed
+}
+
+func (p disconnectedPlatform) ListSyncStatus() ([]flux.ResourceSyncStatus, error) {
+	return nil, errNotSubscribed
+}
+
 func (p disconnectedPlatform) GitRepoConfig(bool) (flux.GitConfig, error) {
 	return flux.GitConfig{}, errNotSubscribed
 }
@@ -11,5 +11,6 @@ type Resource interface {
 	ServiceIDs(map[string]Resource) []flux.ServiceID // ServiceIDs returns the associated services for this resource
 	Policy() policy.Set                              // policy for this resource; e.g., whether it is locked, automated, ignored
 	Source() string                                  // where did this come from (informational)
+	Offset() int                                     // where the definition starts in the source
 	Bytes() []byte                                   // the definition, for sending to platform.Sync
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/weaveworks/flux/service"
 	"github.com/weaveworks/flux/service/instance"
 	"github.com/weaveworks/flux/ssh"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -124,6 +125,24 @@ func (s *Server) UpdatePolicies(instID service.InstanceID, updates policy.Update
 	return inst.Platform.UpdateManifests(update.Spec{Type: update.Policy, Cause: cause, Spec: updates})
 }
 
+func (s *Server) Rollback(instID service.InstanceID, spec update.RollbackSpec, cause update.Cause) (job.ID, error) {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return "", errors.Wrapf(err, "getting instance "+string(instID))
+	}
+
+	return inst.Platform.UpdateManifests(update.Spec{Type: update.Rollback, Cause: cause, Spec: spec})
+}
+
+func (s *Server) ApproveRelease(instID service.InstanceID, id job.ID, cause update.Cause) (job.ID, error) {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return "", errors.Wrapf(err, "getting instance "+string(instID))
+	}
+
+	return inst.Platform.UpdateManifests(update.Spec{Type: update.Approval, Cause: cause, Spec: update.ApprovalSpec{ReleaseID: string(id)}})
+}
+
 func (s *Server) SyncNotify(instID service.InstanceID) (err error) {
 	inst, err := s.instancer.Get(instID)
 	if err != nil {
@@ -150,6 +169,24 @@ func (s *Server) SyncStatus(instID service.InstanceID, ref string) (res []string
 	return inst.Platform.SyncStatus(ref)
 }
 
+func (s *Server) SyncPlan(instID service.InstanceID) (fluxsync.Plan, error) {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting instance "+string(instID))
+	}
+
+	return inst.Platform.SyncPlan()
+}
+
+func (s *Server) ListSyncStatus(instID service.InstanceID) ([]flux.ResourceSyncStatus, error) {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting instance "+string(instID))
+	}
+
+	return inst.Platform.ListSyncStatus()
+}
+
 // LogEvent receives events from fluxd and pushes events to the history
 // db and a slack notification
 func (s *Server) LogEvent(instID service.InstanceID, e history.Event) error {
@@ -262,6 +299,14 @@ func (s *Server) PublicSSHKey(instID service.InstanceID, regenerate bool) (ssh.P
 	return gitRepoConfig.PublicSSHKey, nil
 }
 
+func (s *Server) GitRepoConfig(instID service.InstanceID, regenerate bool) (flux.GitConfig, error) {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return flux.GitConfig{}, errors.Wrapf(err, "getting instance "+string(instID))
+	}
+	return inst.Platform.GitRepoConfig(regenerate)
+}
+
 // RegisterDaemon handles a daemon connection. It blocks until the
 // daemon is disconnected.
 //
@@ -0,0 +1,225 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/resource"
+)
+
+// Action says what a sync would do with a particular resource.
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionUpdate    Action = "update"
+	ActionDelete    Action = "delete"
+	ActionIgnore    Action = "ignore"
+	ActionUnchanged Action = "unchanged"
+)
+
+// Change is a difference in a single field, between the resource as
+// defined in the repo and the resource as it is in the cluster. The
+// path is given as dotted field names, with list elements either
+// indexed by name (for lists of named things, like containers) or by
+// position.
+type Change struct {
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// ResourcePlan is what a sync would do to one resource.
+type ResourcePlan struct {
+	Action  Action   `json:"action"`
+	Source  string   `json:"source,omitempty"`
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Plan is what a sync would do, by resource ID.
+type Plan map[string]ResourcePlan
+
+// DryRun works out what `Sync` would do given the same arguments,
+// without changing anything in the cluster.
+//
+// Updates are reported as the fields defined in the repo that have a
+// different value in the cluster. Fields that are only present in the
+// cluster aren't considered changes, since they are most likely
+// defaults or status filled in by the cluster; so this is an
+// approximation, in the same way that syncing itself is.
+func DryRun(m cluster.Manifests, repoResources map[string]resource.Resource, clus cluster.Cluster, gcMark string, logger log.Logger) (Plan, error) {
+	clusterResources, err := exportResources(m, clus)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := Plan{}
+	if gcMark != "" {
+		for id, res := range clusterResources {
+			if _, ok := repoResources[id]; ok {
+				continue
+			}
+			if garbage(id, res, repoResources, gcMark, logger) {
+				plan[id] = ResourcePlan{Action: ActionDelete}
+			} else if isIgnored(res) {
+				plan[id] = ResourcePlan{Action: ActionIgnore}
+			}
+		}
+	}
+
+	for id, res := range repoResources {
+		cres, inCluster := clusterResources[id]
+		if ignored(res, cres, logger) {
+			plan[id] = ResourcePlan{Action: ActionIgnore, Source: res.Source()}
+			continue
+		}
+		if !inCluster {
+			plan[id] = ResourcePlan{Action: ActionCreate, Source: res.Source()}
+			continue
+		}
+		changes, err := diffDefinitions(toApply(m, res, gcMark, logger), cres.Bytes())
+		if err != nil {
+			return nil, errors.Wrapf(err, "comparing definitions of %s", id)
+		}
+		action := ActionUpdate
+		if len(changes) == 0 {
+			action = ActionUnchanged
+		}
+		plan[id] = ResourcePlan{Action: action, Source: res.Source(), Changes: changes}
+	}
+	return plan, nil
+}
+
+func isIgnored(res resource.Resource) bool {
+	return ignored(res, nil, log.NewNopLogger())
+}
+
+// diffDefinitions compares the fields given in `want` with those in
+// `got`, and reports any that differ.
+func diffDefinitions(want, got []byte) ([]Change, error) {
+	var wantObj, gotObj interface{}
+	if err := yaml.Unmarshal(want, &wantObj); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(got, &gotObj); err != nil {
+		return nil, err
+	}
+	var changes []Change
+	diffValues("", wantObj, gotObj, &changes)
+	return changes, nil
+}
+
+func diffValues(path string, want, got interface{}, changes *[]Change) {
+	switch want := want.(type) {
+	case nil:
+		// Not specified, so whatever the cluster has is fine
+		return
+	case map[interface{}]interface{}:
+		gotMap, ok := got.(map[interface{}]interface{})
+		if !ok {
+			*changes = append(*changes, change(path, got, want))
+			return
+		}
+		var keys []string
+		for k := range want {
+			keys = append(keys, fmt.Sprint(k))
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffValues(fieldPath(path, k), want[k], gotMap[k], changes)
+		}
+	case []interface{}:
+		gotList, ok := got.([]interface{})
+		if !ok {
+			*changes = append(*changes, change(path, got, want))
+			return
+		}
+		wantNamed, wantOK := byName(want)
+		gotNamed, gotOK := byName(gotList)
+		if wantOK && gotOK {
+			var names []string
+			for name := range wantNamed {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				diffValues(path+"["+name+"]", wantNamed[name], gotNamed[name], changes)
+			}
+			var removed []string
+			for name := range gotNamed {
+				if _, ok := wantNamed[name]; !ok {
+					removed = append(removed, name)
+				}
+			}
+			sort.Strings(removed)
+			for _, name := range removed {
+				*changes = append(*changes, change(path+"["+name+"]", gotNamed[name], nil))
+			}
+			return
+		}
+		if len(want) != len(gotList) {
+			*changes = append(*changes, change(path, got, want))
+			return
+		}
+		for i := range want {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), want[i], gotList[i], changes)
+		}
+	default:
+		if got == nil || fmt.Sprint(want) != fmt.Sprint(got) {
+			*changes = append(*changes, change(path, got, want))
+		}
+	}
+}
+
+// byName indexes a list of things that each have a name (e.g.,
+// containers, ports, environment entries), if that's what it is.
+func byName(list []interface{}) (map[string]interface{}, bool) {
+	if len(list) == 0 {
+		return nil, false
+	}
+	named := map[string]interface{}{}
+	for _, item := range list {
+		m, ok := item.(map[interface{}]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok {
+			return nil, false
+		}
+		named[name] = item
+	}
+	return named, true
+}
+
+func fieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func change(path string, old, new interface{}) Change {
+	return Change{Path: path, Old: render(old), New: render(new)}
+}
+
+func render(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case map[interface{}]interface{}, []interface{}:
+		bytes, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return strings.TrimSpace(string(bytes))
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/cluster/kubernetes"
+)
+
+func TestDryRun(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+
+	manifests := &kubernetes.Manifests{}
+	clus := &syncCluster{&cluster.Mock{}, map[string][]byte{}}
+
+	resources, err := manifests.LoadManifests(checkout.ManifestDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing in the cluster yet, so everything will be created
+	plan, err := DryRun(manifests, resources, clus, "", log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != len(resources) {
+		t.Fatalf("expected a plan for each of %d resources, got %d", len(resources), len(plan))
+	}
+	for id, p := range plan {
+		if p.Action != ActionCreate {
+			t.Errorf("expected %s to be created, got %q", id, p.Action)
+		}
+	}
+	if len(clus.resources) > 0 {
+		t.Fatal("expected dry run to leave the cluster alone")
+	}
+
+	// Once synced, nothing should change
+	if _, err := Sync(manifests, resources, clus, "", log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = DryRun(manifests, resources, clus, "", log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, p := range plan {
+		if p.Action != ActionUnchanged {
+			t.Errorf("expected %s to be unchanged, got %q %v", id, p.Action, p.Changes)
+		}
+	}
+}
+
+func TestDiffDefinitions(t *testing.T) {
+	repo := []byte(`apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: greeter
+        image: quay.io/weaveworks/helloworld:master-a000002
+      - name: sidecar
+        image: quay.io/weaveworks/sidecar:master-a000001
+`)
+	clus := []byte(`apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+  uid: 8d7b42ee-2c1c-11e7-8f89-42010a840033
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: greeter
+        image: quay.io/weaveworks/helloworld:master-a000001
+        imagePullPolicy: IfNotPresent
+      - name: sidecar
+        image: quay.io/weaveworks/sidecar:master-a000001
+      - name: extra
+        image: busybox
+status:
+  replicas: 5
+`)
+
+	changes, err := diffDefinitions(repo, clus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{Path: "spec.replicas", Old: "5", New: "2"},
+		{Path: "spec.template.spec.containers[greeter].image", Old: "quay.io/weaveworks/helloworld:master-a000001", New: "quay.io/weaveworks/helloworld:master-a000002"},
+		{Path: "spec.template.spec.containers[extra]", Old: "image: busybox\nname: extra"},
+	}
+	if !reflect.DeepEqual(expected, changes) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expected, changes)
+	}
+}
@@ -1,6 +1,10 @@
 package sync
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 
@@ -9,55 +13,144 @@ import (
 	"github.com/weaveworks/flux/resource"
 )
 
-// Synchronise the cluster to the files in a directory
-func Sync(m cluster.Manifests, repoResources map[string]resource.Resource, clus cluster.Cluster, deletes bool, logger log.Logger) error {
-	// Get a map of resources defined in the cluster
-	clusterBytes, err := clus.Export()
-	if err != nil {
-		return errors.Wrap(err, "exporting resource defs from cluster")
-	}
-	clusterResources, err := m.ParseManifests(clusterBytes)
+// Result records what a sync did. Applied includes resources that
+// failed to apply; the error returned from Sync says which those were.
+type Result struct {
+	Applied []string
+	Deleted []string
+}
+
+// GCMark gives a value for marking resources for garbage collection
+// that identifies the set of sources being synced (e.g., git URL,
+// branch and path of each), so that a daemon syncing a different set
+// won't collect them.
+func GCMark(sources ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(sources, "\n")))
+	return "sha256." + hex.EncodeToString(sum[:])[:32]
+}
+
+// Synchronise the cluster to the files in a directory. If `gcMark`
+// is not empty, resources are marked with it when applied, and
+// resources in the cluster with the same mark but that are no longer
+// in the repo are garbage collected.
+func Sync(m cluster.Manifests, repoResources map[string]resource.Resource, clus cluster.Cluster, gcMark string, logger log.Logger) (Result, error) {
+	clusterResources, err := exportResources(m, clus)
 	if err != nil {
-		return errors.Wrap(err, "parsing exported resources")
+		return Result{}, err
 	}
 
-	// Everything that's in the cluster but not in the repo, delete;
-	// everything that's in the repo, apply. This is an approximation
-	// to figuring out what's changed, and applying that. We're
-	// relying on Kubernetes to decide for each application if it is a
-	// no-op.
+	// Everything that's in the cluster but not in the repo, and that
+	// we created, delete; everything that's in the repo, apply. This
+	// is an approximation to figuring out what's changed, and
+	// applying that. We're relying on Kubernetes to decide for each
+	// application if it is a no-op.
 	var sync cluster.SyncDef
 
-	if deletes {
+	if gcMark != "" {
 		for id, res := range clusterResources {
-			if res.Policy().Contains(policy.Ignore) {
-				logger.Log("resource", res.ResourceID(), "ignore", "delete")
+			if !garbage(id, res, repoResources, gcMark, logger) {
 				continue
 			}
-			if _, ok := repoResources[id]; !ok {
-				sync.Actions = append(sync.Actions, cluster.SyncAction{
-					ResourceID: id,
-					Delete:     res.Bytes(),
-				})
-			}
+			sync.Actions = append(sync.Actions, cluster.SyncAction{
+				ResourceID: id,
+				Delete:     res.Bytes(),
+			})
 		}
 	}
 
 	for id, res := range repoResources {
-		if res.Policy().Contains(policy.Ignore) {
-			logger.Log("resource", res.ResourceID(), "ignore", "apply")
+		if ignored(res, clusterResources[id], logger) {
 			continue
 		}
-		if cres, ok := clusterResources[id]; ok {
-			if cres.Policy().Contains(policy.Ignore) {
-				logger.Log("resource", res.ResourceID(), "ignore", "apply")
-				continue
-			}
-		}
 		sync.Actions = append(sync.Actions, cluster.SyncAction{
 			ResourceID: id,
-			Apply:      res.Bytes(),
+			Apply:      toApply(m, res, gcMark, logger),
 		})
 	}
-	return clus.Sync(sync)
+
+	err = clus.Sync(sync)
+	return result(sync, err), err
+}
+
+// Get a map of resources defined in the cluster
+func exportResources(m cluster.Manifests, clus cluster.Cluster) (map[string]resource.Resource, error) {
+	clusterBytes, err := clus.Export()
+	if err != nil {
+		return nil, errors.Wrap(err, "exporting resource defs from cluster")
+	}
+	clusterResources, err := m.ParseManifests(clusterBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing exported resources")
+	}
+	return clusterResources, nil
+}
+
+// garbage says whether a resource in the cluster should be garbage
+// collected; i.e., it's not in the repo, it's not to be ignored, and
+// we know we put it there, because it has our mark.
+func garbage(id string, res resource.Resource, repoResources map[string]resource.Resource, gcMark string, logger log.Logger) bool {
+	if _, ok := repoResources[id]; ok {
+		return false
+	}
+	if res.Policy().Contains(policy.Ignore) {
+		logger.Log("resource", res.ResourceID(), "ignore", "delete")
+		return false
+	}
+	mark, ok := res.Policy().Get(policy.SyncGCMark)
+	return ok && mark == gcMark
+}
+
+// ignored says whether a resource from the repo should be left alone,
+// either because it's marked as such in the repo, or in the cluster
+// (`cres` may be nil, if it's not in the cluster).
+func ignored(res, cres resource.Resource, logger log.Logger) bool {
+	if res.Policy().Contains(policy.Ignore) {
+		logger.Log("resource", res.ResourceID(), "ignore", "apply")
+		return true
+	}
+	if cres != nil && cres.Policy().Contains(policy.Ignore) {
+		logger.Log("resource", res.ResourceID(), "ignore", "apply")
+		return true
+	}
+	return false
+}
+
+// toApply gives the definition to apply for a resource from the
+// repo. If we're garbage collecting, the resource is marked as ours,
+// so that we know we can delete it when it's removed from the repo.
+func toApply(m cluster.Manifests, res resource.Resource, gcMark string, logger log.Logger) cluster.ResourceDef {
+	def := res.Bytes()
+	if gcMark == "" {
+		return def
+	}
+	marked, err := m.UpdatePolicies(def, policy.Update{
+		Add: policy.Set{policy.SyncGCMark: gcMark},
+	})
+	if err != nil {
+		logger.Log("resource", res.ResourceID(), "err", errors.Wrap(err, "marking resource for garbage collection"))
+		return def
+	}
+	return marked
+}
+
+// result reports the resources that were applied, and those that
+// were successfully deleted, given the sync actions and the result of
+// applying them.
+func result(sync cluster.SyncDef, err error) Result {
+	var res Result
+	errs, ok := err.(cluster.SyncError)
+	if err != nil && !ok {
+		return res
+	}
+	for _, action := range sync.Actions {
+		if len(action.Apply) > 0 {
+			res.Applied = append(res.Applied, action.ResourceID)
+			continue
+		}
+		if _, failed := errs[action.ResourceID]; failed {
+			continue
+		}
+		res.Deleted = append(res.Deleted, action.ResourceID)
+	}
+	return res
 }
@@ -18,6 +18,7 @@ import (
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/git/gittest"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/resource"
 )
 
@@ -38,12 +39,12 @@ func TestSync(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := Sync(manifests, resources, clus, true, log.NewNopLogger()); err != nil {
+	if _, err := Sync(manifests, resources, clus, testGCMark, log.NewNopLogger()); err != nil {
 		t.Fatal(err)
 	}
 	checkClusterMatchesFiles(t, manifests, clus, checkout.ManifestDir())
 
-	for file, _ := range testfiles.Files {
+	for file := range testfiles.Files {
 		if err := execCommand("rm", filepath.Join(checkout.ManifestDir(), file)); err != nil {
 			t.Fatal(err)
 		}
@@ -57,14 +58,97 @@ func TestSync(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := Sync(manifests, resources, clus, true, log.NewNopLogger()); err != nil {
+	if _, err := Sync(manifests, resources, clus, testGCMark, log.NewNopLogger()); err != nil {
 		t.Fatal(err)
 	}
 	checkClusterMatchesFiles(t, manifests, clus, checkout.ManifestDir())
 }
 
+func TestSyncOnlyDeletesMarked(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+
+	mockCluster := &cluster.Mock{}
+	manifests := &kubernetes.Manifests{}
+	// Something that's in the cluster, but that we didn't put there
+	unmarked := []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: not-ours
+`)
+	// Something that another daemon (syncing a different repo) put
+	// there
+	otherMarked := []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: someone-elses
+  annotations:
+    flux.weave.works/sync-gc-mark: other
+`)
+	clus := &syncCluster{mockCluster, map[string][]byte{
+		"Service default/not-ours":      unmarked,
+		"Service default/someone-elses": otherMarked,
+	}}
+
+	resources, err := manifests.LoadManifests(checkout.ManifestDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Sync(manifests, resources, clus, testGCMark, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Deleted) > 0 {
+		t.Errorf("expected nothing to be deleted, got %v", res.Deleted)
+	}
+	if _, ok := clus.resources["Service default/not-ours"]; !ok {
+		t.Error("expected unmarked resource to be left in the cluster")
+	}
+
+	// Now remove a file, and check that the resource defined in it
+	// is garbage collected.
+	var removed string
+	for file := range testfiles.Files {
+		if err := execCommand("rm", filepath.Join(checkout.ManifestDir(), file)); err != nil {
+			t.Fatal(err)
+		}
+		removed = file
+		break
+	}
+	removedResources, err := manifests.ParseManifests([]byte(testfiles.Files[removed]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err = manifests.LoadManifests(checkout.ManifestDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = Sync(manifests, resources, clus, testGCMark, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Deleted) != len(removedResources) {
+		t.Fatalf("expected %d resource(s) to be deleted, got %v", len(removedResources), res.Deleted)
+	}
+	for _, id := range res.Deleted {
+		if _, ok := removedResources[id]; !ok {
+			t.Errorf("did not expect %q to be deleted", id)
+		}
+	}
+	if _, ok := clus.resources["Service default/not-ours"]; !ok {
+		t.Error("expected unmarked resource to be left in the cluster")
+	}
+	if _, ok := clus.resources["Service default/someone-elses"]; !ok {
+		t.Error("expected resource with another mark to be left in the cluster")
+	}
+}
+
 // ---
 
+var testGCMark = GCMark("git@example.com:test/repo", "master", "")
+
 var gitconf git.Config = git.Config{
 	SyncTag:   "test-sync",
 	NotesRef:  "test-notes",
@@ -156,7 +240,17 @@ func checkClusterMatchesFiles(t *testing.T, m cluster.Manifests, c cluster.Clust
 		t.Fatal(err)
 	}
 
-	expected := resourcesToStrings(files)
+	// What's been applied has been marked for garbage collection
+	expected := map[string]string{}
+	for id, r := range files {
+		marked, err := m.UpdatePolicies(r.Bytes(), policy.Update{
+			Add: policy.Set{policy.SyncGCMark: "true"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[id] = string(marked)
+	}
 	got := resourcesToStrings(resources)
 
 	if !reflect.DeepEqual(expected, got) {
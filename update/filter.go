@@ -1,6 +1,10 @@
 package update
 
-import "github.com/weaveworks/flux"
+import (
+	glob "github.com/ryanuber/go-glob"
+
+	"github.com/weaveworks/flux"
+)
 
 const (
 	Locked          = "locked"
@@ -88,3 +92,56 @@ func (f *LockedFilter) Filter(u ServiceUpdate) ServiceResult {
 	}
 	return ServiceResult{}
 }
+
+// SelectorFilter includes only the services in one of the namespaces
+// given (if any are given; each may be a glob), with labels matching
+// the selector.
+type SelectorFilter struct {
+	Namespaces []string
+	Labels     LabelSelector
+}
+
+func (f *SelectorFilter) Filter(u ServiceUpdate) ServiceResult {
+	if selects(f.Namespaces, f.Labels, u) {
+		return ServiceResult{}
+	}
+	return ServiceResult{
+		Status: ReleaseStatusIgnored,
+		Error:  NotIncluded,
+	}
+}
+
+// ExcludeSelectorFilter excludes the services in one of the
+// namespaces given (or any namespace, if none are given), with labels
+// matching the selector.
+type ExcludeSelectorFilter struct {
+	Namespaces []string
+	Labels     LabelSelector
+}
+
+func (f *ExcludeSelectorFilter) Filter(u ServiceUpdate) ServiceResult {
+	if selects(f.Namespaces, f.Labels, u) {
+		return ServiceResult{
+			Status: ReleaseStatusIgnored,
+			Error:  Excluded,
+		}
+	}
+	return ServiceResult{}
+}
+
+func selects(namespaces []string, labels LabelSelector, u ServiceUpdate) bool {
+	if len(namespaces) > 0 {
+		ns, _ := u.ServiceID.Components()
+		matched := false
+		for _, pattern := range namespaces {
+			if glob.Glob(pattern, ns) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return labels.Matches(u.Service.Labels)
+}
@@ -2,35 +2,35 @@ package update
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
-	glob "github.com/ryanuber/go-glob"
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/registry"
 )
 
 type ImageMap map[string][]flux.Image
 
-// LatestImage returns the latest releasable image for a repository for
-// which the tag matches a given pattern. A releasable image is one that
-// is not tagged "latest". (Assumes the available images are in
-// descending order of latestness.) If no such image exists, returns nil,
-// and the caller can decide whether that's an error or not.
-func (m ImageMap) LatestImage(repo, tagGlob string) *flux.Image {
-	for _, image := range m[repo] {
-		_, _, tag := image.ID.Components()
-		// Ignore latest if and only if it's not what the user wants.
-		if !strings.EqualFold(tagGlob, "latest") && strings.EqualFold(tag, "latest") {
+// LatestImage returns the latest releasable image for a repository,
+// according to the tag pattern given: of the images with tags the
+// pattern matches, the one the pattern says is newest. (For glob
+// patterns, this assumes the available images are in descending order
+// of latestness, so that images without a creation time are taken in
+// the order given.) If no such image exists, returns nil, and the
+// caller can decide whether that's an error or not.
+func (m ImageMap) LatestImage(repo string, pattern policy.Pattern) *flux.Image {
+	var latest *flux.Image
+	for i, image := range m[repo] {
+		if !pattern.Matches(image.ID.Tag) {
 			continue
 		}
-		if glob.Glob(tagGlob, tag) {
-			return &image
+		if latest == nil || pattern.Newer(&image, latest) {
+			latest = &m[repo][i]
 		}
 	}
-	return nil
+	return latest
 }
 
 // CollectUpdateImages is a convenient shim to
@@ -0,0 +1,59 @@
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/policy"
+)
+
+func mustParseImage(s string, createdAt time.Time) flux.Image {
+	image, err := flux.ParseImage(s, createdAt)
+	if err != nil {
+		panic(err)
+	}
+	return image
+}
+
+func TestLatestImage(t *testing.T) {
+	now := time.Now()
+	// In descending order of creation, as they come from the registry
+	images := ImageMap{
+		"quay.io/weaveworks/helloworld": []flux.Image{
+			mustParseImage("quay.io/weaveworks/helloworld:latest", now),
+			mustParseImage("quay.io/weaveworks/helloworld:1.4.1", now.Add(-time.Minute)),
+			mustParseImage("quay.io/weaveworks/helloworld:2.0.0-rc.1", now.Add(-2*time.Minute)),
+			mustParseImage("quay.io/weaveworks/helloworld:1.10.0", now.Add(-3*time.Minute)),
+			mustParseImage("quay.io/weaveworks/helloworld:1.4.2", now.Add(-4*time.Minute)),
+		},
+	}
+	for _, c := range []struct {
+		pattern  string
+		expected string
+	}{
+		{"glob:*", "1.4.1"},
+		{"glob:1.10.*", "1.10.0"},
+		{"latest", "latest"},
+		{"semver:*", "1.10.0"},
+		{"semver:~1.4", "1.4.2"},
+		{"semver:>=2.0.0-rc.0", "2.0.0-rc.1"},
+		{"semver:^3", ""},
+		{`regex:^1\.`, "1.4.1"},
+		{`regex:^1\.(\d+)\.`, "1.10.0"},
+		{`regex:^1\.(\d+)\.(\d+)$`, "1.10.0"},
+		{`regex:^1\.4\.(\d+)$`, "1.4.2"},
+	} {
+		pattern, err := policy.ParsePattern(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		latest := images.LatestImage("quay.io/weaveworks/helloworld", pattern)
+		switch {
+		case latest == nil && c.expected != "":
+			t.Errorf("%s: expected %s, got nothing", c.pattern, c.expected)
+		case latest != nil && latest.ID.Tag != c.expected:
+			t.Errorf("%s: expected %q, got %s", c.pattern, c.expected, latest.ID.Tag)
+		}
+	}
+}
@@ -22,13 +22,15 @@ var (
 	ErrInvalidReleaseKind = errors.New("invalid release kind")
 )
 
-// ReleaseKind says whether a release is to be planned only, or planned then executed
+// ReleaseKind says whether a release is to be planned only, planned
+// then executed, or planned then executed once it's been approved
 type ReleaseKind string
 type ReleaseType string
 
 const (
 	ReleaseKindPlan    ReleaseKind = "plan"
 	ReleaseKindExecute             = "execute"
+	ReleaseKindPropose ReleaseKind = "propose"
 )
 
 func ParseReleaseKind(s string) (ReleaseKind, error) {
@@ -37,11 +39,20 @@ func ParseReleaseKind(s string) (ReleaseKind, error) {
 		return ReleaseKindPlan, nil
 	case string(ReleaseKindExecute):
 		return ReleaseKindExecute, nil
+	case string(ReleaseKindPropose):
+		return ReleaseKindPropose, nil
 	default:
 		return "", ErrInvalidReleaseKind
 	}
 }
 
+// ApprovalSpec approves a proposed release, identified by the ID of
+// the job that proposed it. The user approving it is given in the
+// cause of the update.
+type ApprovalSpec struct {
+	ReleaseID string
+}
+
 const UserAutomated = "<automated>"
 
 type ReleaseContext interface {
@@ -58,6 +69,14 @@ type ReleaseSpec struct {
 	ImageSpec    ImageSpec
 	Kind         ReleaseKind
 	Excludes     []flux.ServiceID
+	// Namespaces (globs) and Selector (a label selector) narrow the
+	// services released to; ExcludeNamespaces and ExcludeSelector
+	// exclude services, e.g., those with a particular label in a
+	// particular namespace.
+	Namespaces        []string `json:",omitempty"`
+	Selector          string   `json:",omitempty"`
+	ExcludeNamespaces []string `json:",omitempty"`
+	ExcludeSelector   string   `json:",omitempty"`
 }
 
 // ReleaseType gives a one-word description of the release, mainly
@@ -149,10 +168,26 @@ func (s ReleaseSpec) filters(rc ReleaseContext) ([]ServiceFilter, error) {
 		filtList = append(filtList, &IncludeFilter{ids})
 	}
 
-	// Exclude filter
+	// Selector filters
+	if len(s.Namespaces) > 0 || s.Selector != "" {
+		labels, err := ParseLabelSelector(s.Selector)
+		if err != nil {
+			return nil, err
+		}
+		filtList = append(filtList, &SelectorFilter{s.Namespaces, labels})
+	}
+
+	// Exclude filters
 	if len(s.Excludes) > 0 {
 		filtList = append(filtList, &ExcludeFilter{s.Excludes})
 	}
+	if len(s.ExcludeNamespaces) > 0 || s.ExcludeSelector != "" {
+		labels, err := ParseLabelSelector(s.ExcludeSelector)
+		if err != nil {
+			return nil, err
+		}
+		filtList = append(filtList, &ExcludeSelectorFilter{s.ExcludeNamespaces, labels})
+	}
 
 	// Locked filter
 	services, err := rc.ServicesWithPolicies()
@@ -237,7 +272,7 @@ func (s ReleaseSpec) calculateImageUpdates(rc ReleaseContext, candidates []*Serv
 				return nil, err
 			}
 
-			latestImage := images.LatestImage(currentImageID.Repository(), "*")
+			latestImage := images.LatestImage(currentImageID.Repository(), policy.PatternAll)
 			if latestImage == nil {
 				if currentImageID.Repository() != repo {
 					ignoredOrSkipped = ReleaseStatusIgnored
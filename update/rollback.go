@@ -0,0 +1,50 @@
+package update
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+)
+
+// RollbackSpec returns the containers of services to the images
+// they were running before a release. It's calculated in the same
+// way as an automated release, but recorded as a rollback, so it can
+// be told apart in the commits and events.
+type RollbackSpec struct {
+	// Changes give the image each container is returned to
+	Changes []Change
+	// Reason says why the release is being rolled back
+	Reason string
+	// Lock says whether to lock the services rolled back, so that
+	// the release isn't simply made again (e.g., by automation)
+	Lock bool
+}
+
+func (r RollbackSpec) CalculateRelease(rc ReleaseContext, logger log.Logger) ([]*ServiceUpdate, Result, error) {
+	return (&Automated{Changes: r.Changes}).CalculateRelease(rc, logger)
+}
+
+func (r RollbackSpec) ReleaseType() ReleaseType {
+	return "rollback"
+}
+
+func (r RollbackSpec) ReleaseKind() ReleaseKind {
+	return ReleaseKindExecute
+}
+
+func (r RollbackSpec) CommitMessage() string {
+	a := &Automated{Changes: r.Changes}
+	var services, images []string
+	for _, id := range a.serviceIDs() {
+		services = append(services, id.String())
+	}
+	for _, image := range a.Images() {
+		images = append(images, image.String())
+	}
+	msg := fmt.Sprintf("Roll back %s to %s", strings.Join(services, ", "), strings.Join(images, ", "))
+	if r.Reason != "" {
+		msg += "\n\n" + r.Reason
+	}
+	return msg
+}
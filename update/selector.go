@@ -0,0 +1,145 @@
+package update
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LabelSelector selects services by their labels. It's written in
+// the same way as a Kubernetes label selector: a comma-separated list
+// of requirements, all of which must be met, each one of
+//
+//	key=value, key==value, key!=value
+//	key in (value1,value2), key notin (value1,value2)
+//	key, !key
+type LabelSelector []labelRequirement
+
+type labelRequirement struct {
+	key    string
+	op     string
+	values []string
+}
+
+const (
+	opEquals    = "="
+	opNotEquals = "!="
+	opIn        = "in"
+	opNotIn     = "notin"
+	opExists    = "exists"
+	opNotExists = "!"
+)
+
+var setRequirement = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// ParseLabelSelector parses a label selector. An empty selector
+// selects everything.
+func ParseLabelSelector(s string) (LabelSelector, error) {
+	var selector LabelSelector
+	for _, term := range splitTerms(s) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		r, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+// splitTerms splits a selector at the commas that aren't in a set of
+// values.
+func splitTerms(s string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, s[start:])
+}
+
+func parseRequirement(term string) (labelRequirement, error) {
+	if m := setRequirement.FindStringSubmatch(term); m != nil {
+		var values []string
+		for _, v := range strings.Split(m[3], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return labelRequirement{}, fmt.Errorf("no values given in %q", term)
+		}
+		return labelRequirement{key: m[1], op: m[2], values: values}, nil
+	}
+
+	var r labelRequirement
+	switch {
+	case strings.HasPrefix(term, "!"):
+		r = labelRequirement{key: strings.TrimSpace(term[1:]), op: opNotExists}
+	case strings.Contains(term, "!="):
+		parts := strings.SplitN(term, "!=", 2)
+		r = labelRequirement{key: strings.TrimSpace(parts[0]), op: opNotEquals, values: []string{strings.TrimSpace(parts[1])}}
+	case strings.Contains(term, "="):
+		parts := strings.SplitN(term, "=", 2)
+		value := strings.TrimPrefix(parts[1], "=")
+		r = labelRequirement{key: strings.TrimSpace(parts[0]), op: opEquals, values: []string{strings.TrimSpace(value)}}
+	default:
+		r = labelRequirement{key: term, op: opExists}
+	}
+	if r.key == "" || strings.ContainsAny(r.key, " \t()!=") {
+		return labelRequirement{}, fmt.Errorf("invalid label selector requirement %q", term)
+	}
+	return r, nil
+}
+
+// Matches reports whether the labels given meet all the requirements
+// of the selector.
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r labelRequirement) matches(labels map[string]string) bool {
+	value, ok := labels[r.key]
+	switch r.op {
+	case opExists:
+		return ok
+	case opNotExists:
+		return !ok
+	case opEquals:
+		return ok && value == r.values[0]
+	case opNotEquals:
+		return !ok || value != r.values[0]
+	case opIn:
+		return ok && contains(r.values, value)
+	case opNotIn:
+		return !ok || !contains(r.values, value)
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
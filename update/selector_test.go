@@ -0,0 +1,60 @@
+package update
+
+import (
+	"testing"
+)
+
+func TestLabelSelector(t *testing.T) {
+	labels := map[string]string{
+		"app":  "hello",
+		"tier": "frontend",
+	}
+	for _, c := range []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{"app=hello", true},
+		{"app==hello", true},
+		{"app = hello", true},
+		{"app=goodbye", false},
+		{"app!=goodbye", true},
+		{"app!=hello", false},
+		{"missing!=hello", true},
+		{"app=hello,tier=frontend", true},
+		{"app=hello, tier=backend", false},
+		{"tier in (frontend,backend)", true},
+		{"tier in (backend, database)", false},
+		{"tier notin (backend)", true},
+		{"missing notin (backend)", true},
+		{"tier notin (frontend)", false},
+		{"app", true},
+		{"missing", false},
+		{"!missing", true},
+		{"!app", false},
+		{"tier in (frontend,backend),app=hello", true},
+	} {
+		selector, err := ParseLabelSelector(c.selector)
+		if err != nil {
+			t.Errorf("%q: %s", c.selector, err)
+			continue
+		}
+		if got := selector.Matches(labels); got != c.matches {
+			t.Errorf("%q: expected match %v, got %v", c.selector, c.matches, got)
+		}
+	}
+}
+
+func TestLabelSelectorInvalid(t *testing.T) {
+	for _, s := range []string{
+		"app in foo",
+		"tier in ()",
+		"=hello",
+		"!",
+		"app=hello,!=x",
+	} {
+		if _, err := ParseLabelSelector(s); err == nil {
+			t.Errorf("%q: expected error, got nil", s)
+		}
+	}
+}
@@ -3,11 +3,15 @@ package update
 import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/resource"
 )
 
 type ServiceUpdate struct {
-	ServiceID     flux.ServiceID
-	Service       cluster.Service
+	ServiceID flux.ServiceID
+	Service   cluster.Service
+	// The resource (e.g., Deployment) defining the service, as it is
+	// in the manifest file
+	Resource      resource.Resource
 	ManifestPath  string
 	ManifestBytes []byte
 	Updates       []ContainerUpdate
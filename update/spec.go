@@ -8,9 +8,11 @@ import (
 )
 
 const (
-	Images = "image"
-	Policy = "policy"
-	Auto   = "auto"
+	Images   = "image"
+	Policy   = "policy"
+	Auto     = "auto"
+	Rollback = "rollback"
+	Approval = "approval"
 )
 
 // How did this update get triggered?
@@ -58,6 +60,18 @@ func (spec *Spec) UnmarshalJSON(in []byte) error {
 			return err
 		}
 		spec.Spec = update
+	case Rollback:
+		var update RollbackSpec
+		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
+			return err
+		}
+		spec.Spec = update
+	case Approval:
+		var update ApprovalSpec
+		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
+			return err
+		}
+		spec.Spec = update
 	default:
 		return errors.New("unknown spec type: " + wire.Type)
 	}